@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Embedded IANA timezones for profile and ?tz= lookups
 
 	"github.com/joho/godotenv"
 	"github.com/kmassidik/mercuria/internal/analytics"
@@ -18,6 +23,7 @@ import (
 	"github.com/kmassidik/mercuria/internal/common/middleware"
 	"github.com/kmassidik/mercuria/internal/common/mtls"
 	"github.com/kmassidik/mercuria/internal/common/redis"
+	"github.com/kmassidik/mercuria/pkg/outbox"
 )
 
 func main() {
@@ -36,6 +42,11 @@ func main() {
 	// Initialize logger
 	log := logger.New("analytics-service")
 
+	// Dead-letter admin: `analytics dlq [-topic T] list|replay|discard [flags]`
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		os.Exit(runDLQ(cfg.Kafka, log, os.Args[2:]))
+	}
+
 	// Load mTLS configuration
 	mtlsConfig := mtls.LoadFromEnv()
 	if mtlsConfig.Enabled {
@@ -58,26 +69,80 @@ func main() {
 	}
 	defer redisClient.Close()
 
-	// Initialize Kafka consumer
-	consumer := kafka.NewConsumer(cfg.Kafka, "ledger.entry_created", log)
-	defer consumer.Close()
+	// Aggregate recompute from ledger history
+	recomputer := analytics.NewRecomputer(database.DB, redisClient, cfg.Kafka, log)
 
-	// Verify Kafka is reachable
-	log.Info("Checking Kafka connection...")
-	if consumer == nil {
-		log.Fatal("❌ Failed to initialize Kafka consumer")
+	// Offline recompute: `analytics recompute -from YYYY-MM-DD -to YYYY-MM-DD`
+	if len(os.Args) > 1 && os.Args[1] == "recompute" {
+		code := runRecompute(recomputer, log, os.Args[2:])
+		redisClient.Close()
+		database.Close()
+		os.Exit(code)
 	}
-	log.Info("✅ Kafka consumer initialized")
+
+	// Initialize Kafka consumers, one per topic
+	// With KAFKA_DB_OFFSETS the consumed offsets live in the analytics DB and
+	// commit together with the metric updates
+	var offsets *kafka.OffsetStore
+	if cfg.Kafka.OffsetsInDB {
+		offsets = kafka.NewOffsetStore(database.DB)
+	}
+	consumer := newConsumer(cfg.Kafka, kafka.TopicLedgerEntryCreated, offsets, log)
+	defer consumer.Close()
+	failedConsumer := newConsumer(cfg.Kafka, kafka.TopicTransactionFailed, offsets, log)
+	defer failedConsumer.Close()
+	feeConsumer := newConsumer(cfg.Kafka, kafka.TopicFeeCharged, offsets, log)
+	defer feeConsumer.Close()
+	log.Info("✅ Kafka consumers initialized")
 
 	// Initialize repositories
 	repo := analytics.NewRepository(database.DB)
 
+	// Converted totals in the reporting currency (optional)
+	rates, err := analytics.NewRateTable(cfg.Analytics.ReportingCurrency, cfg.Analytics.ExchangeRates)
+	if err != nil {
+		log.Fatalf("Failed to load exchange rates: %v", err)
+	}
+	if rates != nil {
+		log.Infof("Analytics totals are also reported in %s", rates.Currency)
+	}
+
 	// Initialize service
-	service := analytics.NewService(repo, redisClient)
+	service := analytics.NewService(repo, redisClient, offsets, rates)
 
 	// Initialize handler
 	handler := analytics.NewHandler(service)
 
+	// Live metric streams (SSE); replicas share processed entries over Redis pub/sub
+	streamBroker := analytics.NewStreamBroker(redisClient, log)
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	defer cancelStream()
+	go streamBroker.Run(streamCtx)
+
+	// Anomaly detection; anomalies are published to analytics.anomaly_detected
+	// through the outbox (migrations/outbox must be applied to the analytics DB)
+	producer := kafka.NewProducer(cfg.Kafka, log)
+	defer producer.Close()
+
+	outboxRepo := outbox.NewRepository(database.DB, log)
+	outboxPublisher := outbox.NewPublisher(outboxRepo, producer, "analytics-service", log, 5*time.Second)
+	if err := outboxPublisher.ListenForEvents(db.DSN(cfg.Database)); err != nil {
+		log.Warnf("Outbox LISTEN unavailable, falling back to polling: %v", err)
+	}
+	detector := analytics.NewDetector(database.DB, outboxRepo, cfg.Analytics, log)
+
+	anomalyCtx, cancelAnomaly := context.WithCancel(context.Background())
+	defer cancelAnomaly()
+	go outboxPublisher.Start(anomalyCtx)
+	go outbox.NewJanitor(outboxRepo, cfg.Outbox.Retention, time.Minute, log).Start(anomalyCtx)
+	go detector.Start(anomalyCtx, time.Minute)
+	log.Infof("Anomaly detection started (threshold %.1f)", cfg.Analytics.AnomalyThreshold)
+
+	// Failed events are retried from event_processing_log with backoff
+	retryWorker := analytics.NewRetryWorker(database.DB, service, cfg.Analytics, log)
+	go retryWorker.Start(anomalyCtx, 30*time.Second)
+	log.Infof("Failed event retries started (max %d attempts)", cfg.Analytics.RetryMaxAttempts)
+
 	// =============================================================
 	// PUBLIC SERVER - Port 8084 (HTTPS + JWT for external clients)
 	// =============================================================
@@ -91,6 +156,7 @@ func main() {
 
 	// Register routes with JWT protection
 	analytics.SetupRoutes(publicMux, handler, cfg.JWT.Secret)
+	analytics.NewStreamHandler(streamBroker).RegisterRoutes(publicMux, cfg.JWT.Secret)
 
 	publicPort := cfg.Service.Port // Default: 8084
 	publicServer := &http.Server{
@@ -122,6 +188,10 @@ func main() {
 
 		// Register internal routes (no JWT middleware)
 		analytics.SetupInternalRoutes(internalMux, handler)
+		analytics.NewRecomputeHandler(recomputer).RegisterInternalRoutes(internalMux)
+		analytics.NewAnomalyHandler(detector).RegisterInternalRoutes(internalMux)
+		analytics.NewRetryHandler(retryWorker).RegisterInternalRoutes(internalMux)
+		outbox.NewHandler(outboxRepo, log).RegisterInternalRoutes(internalMux)
 
 		internalPort := os.Getenv("ANALYTICS_INTERNAL_PORT")
 		if internalPort == "" {
@@ -157,29 +227,18 @@ func main() {
 		}()
 	}
 
-	// Start Kafka consumer worker
+	// Start Kafka consumer workers
 	consumerCtx, cancelConsumer := context.WithCancel(context.Background())
 	defer cancelConsumer()
 
-	go func() {
-		log.Info("Kafka consumer started for analytics-service on topic: ledger.entry_created")
-
-		for {
-			select {
-			case <-consumerCtx.Done():
-				log.Info("Kafka consumer stopped")
-				return
-			default:
-				err := consumer.Consume(consumerCtx, func(ctx context.Context, key, value []byte) error {
-					return service.ProcessKafkaEvent(ctx, value)
-				})
-				if err != nil {
-					log.Errorf("Error consuming Kafka message: %v", err)
-					time.Sleep(5 * time.Second)
-				}
-			}
-		}
-	}()
+	go runConsumer(consumerCtx, consumer, kafka.TopicLedgerEntryCreated, log, func(ctx context.Context, key, value []byte) error {
+		return service.ProcessKafkaEvent(ctx, value)
+	})
+	transactionHandler := func(ctx context.Context, key, value []byte) error {
+		return service.ProcessTransactionEvent(ctx, value)
+	}
+	go runConsumer(consumerCtx, failedConsumer, kafka.TopicTransactionFailed, log, transactionHandler)
+	go runConsumer(consumerCtx, feeConsumer, kafka.TopicFeeCharged, log, transactionHandler)
 
 	// =============================================================
 	// GRACEFUL SHUTDOWN
@@ -190,8 +249,10 @@ func main() {
 
 	log.Info("🛑 Shutting down servers...")
 
-	// Stop background workers
+	// Stop background workers; closing the streams lets SSE requests finish
 	cancelConsumer()
+	cancelStream()
+	cancelAnomaly()
 
 	// Shutdown public server
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -202,4 +263,95 @@ func main() {
 	}
 
 	log.Info("✅ All servers exited gracefully")
-}
\ No newline at end of file
+}
+
+// newConsumer creates the consumer for topic, seeking to the offsets stored
+// in the analytics DB when offsets is set
+func newConsumer(cfg config.KafkaConfig, topic string, offsets *kafka.OffsetStore, log *logger.Logger) *kafka.Consumer {
+	if offsets == nil {
+		return kafka.NewConsumer(cfg, topic, log)
+	}
+
+	seekCtx, seekCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer seekCancel()
+	consumer, err := kafka.NewStoredOffsetConsumer(seekCtx, cfg, topic, offsets, log)
+	if err != nil {
+		log.Fatalf("Failed to initialize Kafka consumer for %s: %v", topic, err)
+	}
+	return consumer
+}
+
+// runConsumer consumes topic until ctx is cancelled, backing off after errors
+func runConsumer(ctx context.Context, consumer *kafka.Consumer, topic string, log *logger.Logger, handler kafka.EventHandler) {
+	log.Infof("Kafka consumer started for analytics-service on topic: %s", topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Kafka consumer stopped for topic: %s", topic)
+			return
+		default:
+			if err := consumer.Consume(ctx, handler); err != nil {
+				log.Errorf("Error consuming Kafka message from %s: %v", topic, err)
+				time.Sleep(5 * time.Second)
+			}
+		}
+	}
+}
+
+// consumedTopics are the topics analytics consumes, each with its own DLQ
+var consumedTopics = []string{kafka.TopicLedgerEntryCreated, kafka.TopicTransactionFailed, kafka.TopicFeeCharged}
+
+// runDLQ runs a dead-letter admin command against the DLQ of one consumed topic
+func runDLQ(cfg config.KafkaConfig, log *logger.Logger, args []string) int {
+	fs := flag.NewFlagSet("dlq", flag.ContinueOnError)
+	topic := fs.String("topic", kafka.TopicLedgerEntryCreated, "consumed topic whose DLQ to manage")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if !slices.Contains(consumedTopics, *topic) {
+		log.Errorf("Invalid -topic %q: analytics consumes %s", *topic, strings.Join(consumedTopics, ", "))
+		return 2
+	}
+	return kafka.RunDLQCommand(context.Background(), cfg, *topic, fs.Args(), os.Stdout, log)
+}
+
+// runRecompute rebuilds aggregates for a date range and prints the job report
+func runRecompute(recomputer *analytics.Recomputer, log *logger.Logger, args []string) int {
+	fs := flag.NewFlagSet("recompute", flag.ContinueOnError)
+	from := fs.String("from", "", "first day to recompute (YYYY-MM-DD, UTC)")
+	to := fs.String("to", "", "last day to recompute, inclusive (YYYY-MM-DD, UTC; default -from)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *to == "" {
+		*to = *from
+	}
+	fromDate, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Errorf("Invalid -from: %v", err)
+		return 2
+	}
+	toDate, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		log.Errorf("Invalid -to: %v", err)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	job, err := recomputer.Run(ctx, fromDate, toDate)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(job)
+
+	if err != nil {
+		log.Errorf("Recompute failed: %v", err)
+		return 2
+	}
+	return 0
+}
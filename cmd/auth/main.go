@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Embedded IANA timezones for profile and ?tz= lookups
 
 	"github.com/joho/godotenv"
 	"github.com/kmassidik/mercuria/internal/auth"
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"expvar"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,6 +19,7 @@ import (
 	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
 	"github.com/kmassidik/mercuria/internal/common/middleware"
+	"github.com/kmassidik/mercuria/internal/common/mtls"
 	"github.com/kmassidik/mercuria/internal/common/redis"
 	"github.com/kmassidik/mercuria/internal/ledger"
 	"github.com/kmassidik/mercuria/pkg/outbox"
@@ -38,6 +41,14 @@ func main() {
     // Initialize logger
     log := logger.New("ledger-service")
 
+    // Load mTLS configuration (internal operator API)
+    mtlsConfig := mtls.LoadFromEnv()
+
+    // Dead-letter admin: `ledger dlq list|replay|discard [flags]`
+    if len(os.Args) > 1 && os.Args[1] == "dlq" {
+        os.Exit(kafka.RunDLQCommand(context.Background(), cfg.Kafka, "transaction.completed", os.Args[2:], os.Stdout, log))
+    }
+
     // Connect to database
     database, err := db.Connect(cfg.Database, log)
     if err != nil {
@@ -45,6 +56,13 @@ func main() {
     }
     defer database.Close()
 
+    // Offline rebuild: `ledger rebuild [flags]` replays history, reports and exits
+    if len(os.Args) > 1 && os.Args[1] == "rebuild" {
+        code := runRebuild(cfg, database, log, os.Args[2:])
+        database.Close()
+        os.Exit(code)
+    }
+
     // Connect to Redis
     redisClient, err := redis.Connect(cfg.Redis, log)
     if err != nil {
@@ -66,10 +84,6 @@ func main() {
     }
     log.Info("✅ Kafka is healthy")
 
-    // Initialize Kafka consumer
-    consumer := kafka.NewConsumer(cfg.Kafka, "transaction.completed", log)
-    defer consumer.Close()
-
     // Initialize repositories
     repo := ledger.NewRepository(database, log)
     outboxRepo := outbox.NewRepository(database.DB, log)
@@ -77,14 +91,46 @@ func main() {
     // Initialize service
     service := ledger.NewService(repo, outboxRepo, database, log)
 
+    // Initialize Kafka consumer
+    // With KAFKA_DB_OFFSETS the consumed offsets live in the ledger DB and
+    // commit together with the entries and outbox events they produce
+    var consumer *kafka.Consumer
+    if cfg.Kafka.OffsetsInDB {
+        offsets := kafka.NewOffsetStore(database.DB)
+        service.UseOffsetStore(offsets)
+
+        seekCtx, seekCancel := context.WithTimeout(context.Background(), 15*time.Second)
+        consumer, err = kafka.NewStoredOffsetConsumer(seekCtx, cfg.Kafka, "transaction.completed", offsets, log)
+        seekCancel()
+        if err != nil {
+            log.Fatalf("Failed to initialize Kafka consumer: %v", err)
+        }
+    } else {
+        consumer = kafka.NewConsumer(cfg.Kafka, "transaction.completed", log)
+    }
+    defer consumer.Close()
+
+    // Partition maintenance and archival (seven-year retention)
+    archiveStore, err := ledger.NewLocalArchiveStore(cfg.Ledger.ArchiveDir)
+    if err != nil {
+        log.Fatalf("Failed to initialize ledger archive store: %v", err)
+    }
+    archiver := ledger.NewArchiver(repo, database, archiveStore, ledger.ArchiveConfig{
+        MonthsAhead: cfg.Ledger.PartitionMonthsAhead,
+        HotMonths:   cfg.Ledger.HotMonths,
+        AutoArchive: cfg.Ledger.AutoArchive,
+        Interval:    cfg.Ledger.MaintenanceInterval,
+    }, log)
+
     // Initialize handler
-    handler := ledger.NewHandler(service)
+    handler := ledger.NewHandler(service, archiver)
 
     // Create HTTP server
     mux := http.NewServeMux()
 
     // Apply middleware
     var httpHandler http.Handler = mux
+    httpHandler = middleware.Tracing(httpHandler)
     httpHandler = middleware.CORS(httpHandler)
     httpHandler = middleware.Logging(log)(httpHandler)
     httpHandler = middleware.Recovery(log)(httpHandler)
@@ -92,6 +138,15 @@ func main() {
     // Register routes
     handler.RegisterRoutes(mux, cfg.JWT.Secret)
 
+    // Internal router (mTLS): operator actions such as period close, archival and outbox replay
+    internalMux := http.NewServeMux()
+    var internalHandler http.Handler = internalMux
+    internalHandler = middleware.Tracing(internalHandler)
+    internalHandler = middleware.Logging(log)(internalHandler)
+    internalHandler = middleware.Recovery(log)(internalHandler)
+
+    handler.RegisterInternalRoutes(internalMux)
+
     // Track consumer health
     var consumerHealthy atomic.Bool
     consumerHealthy.Store(true)
@@ -102,6 +157,7 @@ func main() {
             "status":           "healthy",
             "service":          "ledger",
             "kafka_consumer":   consumerHealthy.Load(),
+            "duplicate_events": service.DuplicateTransactionEvents(),
             "timestamp":        time.Now(),
         }
 
@@ -113,15 +169,29 @@ func main() {
         json.NewEncoder(w).Encode(status)
     })
 
+    // Runtime counters (expvar), e.g. ledger_duplicate_transaction_events, outbox
+    internalMux.Handle("GET /debug/vars", expvar.Handler())
+
+    // Outbox operations (stuck/failed events)
+    outbox.NewHandler(outboxRepo, log).RegisterInternalRoutes(internalMux)
+
 
     // Start outbox publisher (background worker)
-    outboxPublisher := outbox.NewPublisher(outboxRepo, producer, log, 5*time.Second)
+    outboxPublisher := outbox.NewPublisher(outboxRepo, producer, "ledger-service", log, 5*time.Second)
+    if err := outboxPublisher.ListenForEvents(db.DSN(cfg.Database)); err != nil {
+        log.Warnf("Outbox LISTEN unavailable, falling back to polling: %v", err)
+    }
     publisherCtx, cancelPublisher := context.WithCancel(context.Background())
     defer cancelPublisher()
 
     go outboxPublisher.Start(publisherCtx)
     log.Info("Outbox publisher started")
 
+    // Outbox retention cleanup and backlog metrics
+    go outbox.NewJanitor(outboxRepo, cfg.Outbox.Retention, time.Minute, log).Start(publisherCtx)
+
+    go archiver.Start(publisherCtx)
+
     // Start Kafka consumer worker
     go func() {
         log.Info("Kafka consumer started for ledger-service")
@@ -160,6 +230,43 @@ func main() {
         }
     }()
 
+    // Internal server - Port 9083 (mTLS for operators and services)
+    if mtlsConfig.Enabled {
+        internalPort := os.Getenv("LEDGER_INTERNAL_PORT")
+        if internalPort == "" {
+            internalPort = "9083" // Default internal port
+        }
+
+        tlsConfig, err := mtlsConfig.ServerTLSConfig()
+        if err != nil {
+            log.Fatalf("Failed to load mTLS config: %v", err)
+        }
+
+        internalServer := &http.Server{
+            Addr:         ":" + internalPort,
+            Handler:      internalHandler,
+            TLSConfig:    tlsConfig,
+            ReadTimeout:  15 * time.Second,
+            WriteTimeout: 15 * time.Second,
+            IdleTimeout:  60 * time.Second,
+        }
+
+        go func() {
+            log.Infof("🔐 Internal API starting on port %s (mTLS)", internalPort)
+            if err := internalServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+                log.Fatalf("Failed to start internal server: %v", err)
+            }
+        }()
+
+        defer func() {
+            shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            internalServer.Shutdown(shutdownCtx)
+        }()
+    } else {
+        log.Info("⚠️  mTLS is DISABLED - internal operator API not started")
+    }
+
 
     // Graceful shutdown
     quit := make(chan os.Signal, 1)
@@ -180,4 +287,91 @@ func main() {
     }
 
     log.Info("Server exited")
-}
\ No newline at end of file
+}
+
+// runRebuild replays transaction.completed history into a fresh schema and
+// compares it with the live ledger. Exit code 0 = identical, 1 = differences, 2 = error
+// NOTE: The live ledger is only read, never modified
+func runRebuild(cfg *config.Config, database *db.DB, log *logger.Logger, args []string) int {
+    fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+    source := fs.String("source", "outbox", "history source: outbox or kafka")
+    schema := fs.String("schema", "ledger_rebuild", "schema to rebuild into (must not exist)")
+    reset := fs.Bool("reset", false, "drop the rebuild schema first if it exists")
+    offset := fs.Int64("offset", -1, "kafka: offset to start from in each partition (-1 = oldest retained)")
+    partition := fs.Int("partition", -1, "kafka: only replay this partition (-1 = all)")
+    outboxDB := fs.String("outbox-db", "mercuria_transaction", "outbox: database holding the transaction service outbox")
+    since := fs.String("since", "", "outbox: only replay events created at or after this time (RFC3339)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+
+    ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer cancel()
+
+    rebuilder, err := ledger.NewRebuilder(database, *schema, log)
+    if err != nil {
+        log.Errorf("Rebuild failed: %v", err)
+        return 2
+    }
+
+    if err := rebuilder.Prepare(ctx, *reset); err != nil {
+        log.Errorf("Rebuild failed: %v", err)
+        return 2
+    }
+
+    partial := false
+    switch *source {
+    case "kafka":
+        partial = *offset >= 0 || *partition >= 0
+        err = rebuilder.LoadFromKafka(ctx, cfg.Kafka, *partition, *offset)
+    case "outbox":
+        var sinceTime time.Time
+        if *since != "" {
+            if sinceTime, err = time.Parse(time.RFC3339, *since); err != nil {
+                log.Errorf("Invalid -since: %v", err)
+                return 2
+            }
+            partial = true
+        }
+
+        outboxCfg := cfg.Database
+        outboxCfg.DBName = *outboxDB
+        var outboxConn *db.DB
+        if outboxConn, err = db.Connect(outboxCfg, log); err == nil {
+            err = rebuilder.LoadFromOutbox(ctx, outboxConn.DB, sinceTime)
+            outboxConn.Close()
+        }
+    default:
+        err = fmt.Errorf("unknown source %q (want outbox or kafka)", *source)
+    }
+    if err != nil {
+        log.Errorf("Rebuild failed: %v", err)
+        return 2
+    }
+
+    entries, err := rebuilder.Build(ctx)
+    if err != nil {
+        log.Errorf("Rebuild failed: %v", err)
+        return 2
+    }
+    log.Infof("Rebuilt %d ledger entries into schema %s", entries, *schema)
+
+    report, err := rebuilder.Verify(ctx, partial)
+    if err != nil {
+        log.Errorf("Verification failed: %v", err)
+        return 2
+    }
+
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    enc.Encode(report)
+
+    if report.HasDifferences() {
+        log.Warnf("Rebuilt ledger differs from the live ledger (missing=%d unexpected=%d mismatched=%d balances=%d)",
+            report.MissingCount, report.UnexpectedCount, len(report.Mismatched), len(report.BalanceDifferences))
+        return 1
+    }
+
+    log.Info("Rebuilt ledger matches the live ledger")
+    return 0
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
 	"github.com/kmassidik/mercuria/internal/common/middleware"
+	"github.com/kmassidik/mercuria/internal/common/mtls"
 	"github.com/kmassidik/mercuria/internal/common/redis"
 	"github.com/kmassidik/mercuria/internal/transaction"
 	"github.com/kmassidik/mercuria/pkg/outbox"
@@ -36,6 +38,9 @@ func main() {
 	// Initialize logger
 	log := logger.New("transaction-service")
 
+	// Load mTLS configuration (internal operator API)
+	mtlsConfig := mtls.LoadFromEnv()
+
 	// Connect to database
 	database, err := db.Connect(cfg.Database, log)
 	if err != nil {
@@ -68,8 +73,17 @@ func main() {
 	txnRepo := transaction.NewRepository(database, log)
 	outboxRepo := outbox.NewRepository(database.DB, log)
 
+	// Transfer fees (optional), published on transaction.fee_charged
+	fees, err := transaction.NewFeePolicy(cfg.Transaction)
+	if err != nil {
+		log.Fatalf("Failed to load transfer fees: %v", err)
+	}
+	if fees != nil {
+		log.Infof("Transfer fees enabled at rate %s", cfg.Transaction.FeeRate)
+	}
+
 	// Initialize service
-	service := transaction.NewService(txnRepo, outboxRepo, redisClient, producer, database, log)
+	service := transaction.NewService(txnRepo, outboxRepo, redisClient, producer, database, fees, log)
 
 	// Initialize handler
 	handler := transaction.NewHandler(service, log)
@@ -79,6 +93,7 @@ func main() {
 
 	// Apply middleware
 	var httpHandler http.Handler = mux
+	httpHandler = middleware.Tracing(httpHandler)
 	httpHandler = middleware.CORS(httpHandler)
 	httpHandler = middleware.Logging(log)(httpHandler)
 	httpHandler = middleware.Recovery(log)(httpHandler)
@@ -92,14 +107,30 @@ func main() {
 		w.Write([]byte(`{"status":"healthy"}`))
 	})
 
+	// Internal router (mTLS): outbox operations (stuck/failed events) and runtime counters
+	internalMux := http.NewServeMux()
+	var internalHandler http.Handler = internalMux
+	internalHandler = middleware.Tracing(internalHandler)
+	internalHandler = middleware.Logging(log)(internalHandler)
+	internalHandler = middleware.Recovery(log)(internalHandler)
+
+	outbox.NewHandler(outboxRepo, log).RegisterInternalRoutes(internalMux)
+	internalMux.Handle("GET /debug/vars", expvar.Handler())
+
 	// Start outbox publisher (background worker)
-	outboxPublisher := outbox.NewPublisher(outboxRepo, producer, log, 5*time.Second)
+	outboxPublisher := outbox.NewPublisher(outboxRepo, producer, "transaction-service", log, 5*time.Second)
+	if err := outboxPublisher.ListenForEvents(db.DSN(cfg.Database)); err != nil {
+		log.Warnf("Outbox LISTEN unavailable, falling back to polling: %v", err)
+	}
 	publisherCtx, cancelPublisher := context.WithCancel(context.Background())
 	defer cancelPublisher()
 
 	go outboxPublisher.Start(publisherCtx)
 	log.Info("Outbox publisher started")
 
+	// Outbox retention cleanup and backlog metrics
+	go outbox.NewJanitor(outboxRepo, cfg.Outbox.Retention, time.Minute, log).Start(publisherCtx)
+
 	// Start scheduled transfer worker (background worker)
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
@@ -140,6 +171,43 @@ func main() {
 		}
 	}()
 
+	// Internal server - Port 9082 (mTLS for operators and services)
+	if mtlsConfig.Enabled {
+		internalPort := os.Getenv("TRANSACTION_INTERNAL_PORT")
+		if internalPort == "" {
+			internalPort = "9082" // Default internal port
+		}
+
+		tlsConfig, err := mtlsConfig.ServerTLSConfig()
+		if err != nil {
+			log.Fatalf("Failed to load mTLS config: %v", err)
+		}
+
+		internalServer := &http.Server{
+			Addr:         ":" + internalPort,
+			Handler:      internalHandler,
+			TLSConfig:    tlsConfig,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+
+		go func() {
+			log.Infof("🔐 Internal API starting on port %s (mTLS)", internalPort)
+			if err := internalServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start internal server: %v", err)
+			}
+		}()
+
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			internalServer.Shutdown(shutdownCtx)
+		}()
+	} else {
+		log.Info("⚠️  mTLS is DISABLED - internal operator API not started")
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
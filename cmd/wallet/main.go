@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -86,12 +87,14 @@ func main() {
 
 	// Apply middleware to public router (external clients)
 	var publicHandler http.Handler = publicMux
+	publicHandler = middleware.Tracing(publicHandler)
 	publicHandler = middleware.CORS(publicHandler)
 	publicHandler = middleware.Logging(log)(publicHandler)
 	publicHandler = middleware.Recovery(log)(publicHandler)
 
 	// Apply middleware to internal router (service-to-service)
 	var internalHandler http.Handler = internalMux
+	internalHandler = middleware.Tracing(internalHandler)
 	internalHandler = middleware.Logging(log)(internalHandler)
 	internalHandler = middleware.Recovery(log)(internalHandler)
 
@@ -110,13 +113,23 @@ func main() {
 	publicMux.HandleFunc("GET /health", healthHandler)
 	internalMux.HandleFunc("GET /health", healthHandler)
 
+	// Outbox operations (stuck/failed events) and runtime counters (internal only)
+	outbox.NewHandler(outboxRepo, log).RegisterInternalRoutes(internalMux)
+	internalMux.Handle("GET /debug/vars", expvar.Handler())
+
 	// Start outbox publisher (background worker)
-	outboxPublisher := outbox.NewPublisher(outboxRepo, producer, log, 5*time.Second)
+	outboxPublisher := outbox.NewPublisher(outboxRepo, producer, "wallet-service", log, 5*time.Second)
+	if err := outboxPublisher.ListenForEvents(db.DSN(cfg.Database)); err != nil {
+		log.Warnf("Outbox LISTEN unavailable, falling back to polling: %v", err)
+	}
 	publisherCtx, cancelPublisher := context.WithCancel(context.Background())
 	defer cancelPublisher()
 	go outboxPublisher.Start(publisherCtx)
 	log.Info("✅ Outbox publisher started")
 
+	// Outbox retention cleanup and backlog metrics
+	go outbox.NewJanitor(outboxRepo, cfg.Outbox.Retention, time.Minute, log).Start(publisherCtx)
+
 	// =============================================================
 	// PUBLIC SERVER - Port 8081 (HTTPS + JWT for external clients)
 	// =============================================================
@@ -0,0 +1,524 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/pkg/outbox"
+)
+
+// Anomaly kinds
+const (
+	AnomalyHourlyVolume = "hourly_volume"
+	AnomalyHourlyCount  = "hourly_count"
+	AnomalyUserSpending = "user_spending"
+)
+
+// Anomaly statuses
+const (
+	AnomalyStatusOpen         = "open"
+	AnomalyStatusAcknowledged = "acknowledged"
+)
+
+const (
+	// minBaselineSamples is how many past weeks of an hour must have data
+	// before the hour is judged
+	minBaselineSamples = 4
+
+	// minUserActiveDays is how many days of spending a user needs in the
+	// history window before their spending is judged
+	minUserActiveDays = 5
+
+	// anomalyCheckDelay lets lagging events land before an hour or day is judged
+	anomalyCheckDelay = 15 * time.Minute
+)
+
+// Anomaly is a flagged deviation from the baseline
+type Anomaly struct {
+	ID             int64        `json:"id"`
+	Kind           string       `json:"kind"`
+	WalletID       string       `json:"wallet_id,omitempty"`
+	Currency       string       `json:"currency"`
+	WindowStart    time.Time    `json:"window_start"`
+	WindowEnd      time.Time    `json:"window_end"`
+	Observed       money.Amount `json:"observed"`
+	Expected       money.Amount `json:"expected"`
+	Score          float64      `json:"score"`
+	Status         string       `json:"status"`
+	DetectedAt     time.Time    `json:"detected_at"`
+	AcknowledgedAt *time.Time   `json:"acknowledged_at,omitempty"`
+}
+
+// Detector flags transaction flow that deviates from its history
+// NOTE: Hourly count and volume per currency are compared with the same hour
+// of the week over the previous weeks (z-score), which absorbs daily and
+// weekly seasonality. A user's daily spending is compared with their
+// user_snapshots history, inactive days counting as zero. Each window is
+// judged once: anomalies are unique per window and are published to
+// analytics.anomaly_detected through the outbox in the same transaction.
+type Detector struct {
+	db     *sql.DB
+	outbox *outbox.Repository
+	cfg    config.AnalyticsConfig
+	logger *logger.Logger
+
+	lastHour time.Time // Last hour judged by Start
+	lastDay  time.Time // Last day judged by Start
+}
+
+func NewDetector(db *sql.DB, outboxRepo *outbox.Repository, cfg config.AnalyticsConfig, log *logger.Logger) *Detector {
+	return &Detector{
+		db:     db,
+		outbox: outboxRepo,
+		cfg:    cfg,
+		logger: log,
+	}
+}
+
+// Start judges every hour and day as it closes until ctx is done
+// NOTE: Replicas may all run it; the unique window constraint keeps one
+// anomaly per window
+func (d *Detector) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.checkClosedWindows(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Detector) checkClosedWindows(ctx context.Context, now time.Time) {
+	settled := now.UTC().Add(-anomalyCheckDelay)
+
+	hour := settled.Truncate(time.Hour).Add(-time.Hour)
+	if hour.After(d.lastHour) {
+		if n, err := d.CheckHour(ctx, hour); err != nil {
+			d.logger.Errorf("Anomaly check for hour %s failed: %v", hour.Format(time.RFC3339), err)
+		} else {
+			d.lastHour = hour
+			if n > 0 {
+				d.logger.Warnf("Flagged %d anomalies for hour %s", n, hour.Format(time.RFC3339))
+			}
+		}
+	}
+
+	day := settled.Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if day.After(d.lastDay) {
+		if n, err := d.CheckUsers(ctx, day); err != nil {
+			d.logger.Errorf("User anomaly check for %s failed: %v", day.Format("2006-01-02"), err)
+		} else {
+			d.lastDay = day
+			if n > 0 {
+				d.logger.Warnf("Flagged %d user spending anomalies for %s", n, day.Format("2006-01-02"))
+			}
+		}
+	}
+}
+
+// CheckHour compares each currency's count and volume in hour with the same
+// hour of the week in the baseline weeks; it returns the anomalies recorded
+func (d *Detector) CheckHour(ctx context.Context, hour time.Time) (int, error) {
+	hour = hour.UTC().Truncate(time.Hour)
+
+	// The hour itself and the same hour in each baseline week
+	hours := []interface{}{hour}
+	placeholders := []string{"$1"}
+	for week := 1; week <= d.cfg.AnomalyBaselineWeeks; week++ {
+		hours = append(hours, hour.AddDate(0, 0, -7*week))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(hours)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT metric_hour, currency, total_transactions, total_volume::float8
+		FROM hourly_metrics
+		WHERE metric_hour IN (%s)
+	`, strings.Join(placeholders, ", "))
+
+	rows, err := d.db.QueryContext(ctx, query, hours...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read hourly baseline: %w", err)
+	}
+	defer rows.Close()
+
+	type series struct {
+		count, volume               float64 // In the judged hour
+		countSamples, volumeSamples []float64
+	}
+	byCurrency := make(map[string]*series)
+	for rows.Next() {
+		var metricHour time.Time
+		var currency string
+		var count int64
+		var volume float64
+		if err := rows.Scan(&metricHour, &currency, &count, &volume); err != nil {
+			return 0, fmt.Errorf("failed to scan hourly baseline: %w", err)
+		}
+
+		s := byCurrency[currency]
+		if s == nil {
+			s = &series{}
+			byCurrency[currency] = s
+		}
+		if metricHour.Equal(hour) {
+			s.count, s.volume = float64(count), volume
+		} else {
+			s.countSamples = append(s.countSamples, float64(count))
+			s.volumeSamples = append(s.volumeSamples, volume)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read hourly baseline: %w", err)
+	}
+
+	// A currency missing from the hour counts as zero - an outage is an anomaly too
+	found := 0
+	for currency, s := range byCurrency {
+		if len(s.countSamples) < minBaselineSamples {
+			continue
+		}
+
+		checks := []struct {
+			kind     string
+			observed float64
+			samples  []float64
+		}{
+			{AnomalyHourlyCount, s.count, s.countSamples},
+			{AnomalyHourlyVolume, s.volume, s.volumeSamples},
+		}
+		for _, c := range checks {
+			mean, score := zScore(c.observed, c.samples)
+			if math.Abs(score) < d.cfg.AnomalyThreshold {
+				continue
+			}
+
+			recorded, err := d.record(ctx, &Anomaly{
+				Kind:        c.kind,
+				Currency:    currency,
+				WindowStart: hour,
+				WindowEnd:   hour.Add(time.Hour),
+				Observed:    floatAmount(c.observed),
+				Expected:    floatAmount(mean),
+				Score:       score,
+			})
+			if err != nil {
+				return found, err
+			}
+			if recorded {
+				found++
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// CheckUsers compares each user's spending on day with their snapshot
+// history; only spikes are flagged. It returns the anomalies recorded.
+func (d *Detector) CheckUsers(ctx context.Context, day time.Time) (int, error) {
+	day = day.UTC().Truncate(24 * time.Hour)
+	days := d.cfg.AnomalyUserDays
+
+	rows, err := d.db.QueryContext(ctx, `
+		WITH spent AS (
+			SELECT user_id, currency, total_sent
+			FROM user_snapshots
+			WHERE snapshot_date = $1 AND total_sent > 0
+		)
+		SELECT s.user_id, s.currency, s.total_sent::float8,
+			COUNT(h.snapshot_date), COALESCE(SUM(h.total_sent), 0)::float8,
+			COALESCE(SUM(h.total_sent * h.total_sent), 0)::float8
+		FROM spent s
+		JOIN user_snapshots h
+			ON h.user_id = s.user_id AND h.currency = s.currency
+			AND h.snapshot_date >= $1::date - $2::int AND h.snapshot_date < $1::date
+			AND h.total_sent > 0
+		GROUP BY s.user_id, s.currency, s.total_sent
+		HAVING COUNT(h.snapshot_date) >= $3
+	`, day, days, minUserActiveDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read user spending history: %w", err)
+	}
+
+	// Collected first so rows is closed before record opens transactions
+	var candidates []Anomaly
+	for rows.Next() {
+		var userID, currency string
+		var spent, sum, sumSq float64
+		var active int
+		if err := rows.Scan(&userID, &currency, &spent, &active, &sum, &sumSq); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user spending history: %w", err)
+		}
+
+		mean, sigma := meanAndDeviation(float64(days), sum, sumSq)
+		score := (spent - mean) / sigma
+		if score < d.cfg.AnomalyThreshold {
+			continue
+		}
+
+		candidates = append(candidates, Anomaly{
+			Kind:        AnomalyUserSpending,
+			WalletID:    userID,
+			Currency:    currency,
+			WindowStart: day,
+			WindowEnd:   day.Add(24 * time.Hour),
+			Observed:    floatAmount(spent),
+			Expected:    floatAmount(mean),
+			Score:       score,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("failed to read user spending history: %w", err)
+	}
+	rows.Close()
+
+	found := 0
+	for i := range candidates {
+		recorded, err := d.record(ctx, &candidates[i])
+		if err != nil {
+			return found, err
+		}
+		if recorded {
+			found++
+		}
+	}
+	return found, nil
+}
+
+// record stores an anomaly and queues its event; false if the window was
+// already flagged
+func (d *Detector) record(ctx context.Context, a *Anomaly) (bool, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO anomalies (
+			kind, wallet_id, currency, window_start, window_end, observed, expected, score
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT ON CONSTRAINT unique_anomaly_window DO NOTHING
+		RETURNING id, status, detected_at
+	`,
+		a.Kind, a.WalletID, a.Currency, a.WindowStart, a.WindowEnd, a.Observed, a.Expected, a.Score,
+	).Scan(&a.ID, &a.Status, &a.DetectedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record anomaly: %w", err)
+	}
+
+	aggregateID := a.WalletID
+	if aggregateID == "" {
+		aggregateID = a.Currency
+	}
+	event := &outbox.OutboxEvent{
+		AggregateID: aggregateID,
+		Topic:       kafka.TopicAnomalyDetected,
+		Payload: kafka.AnomalyDetected{
+			AnomalyID:   a.ID,
+			Kind:        a.Kind,
+			WalletID:    a.WalletID,
+			Currency:    a.Currency,
+			WindowStart: a.WindowStart,
+			WindowEnd:   a.WindowEnd,
+			Observed:    a.Observed.String(),
+			Expected:    a.Expected.String(),
+			Score:       a.Score,
+			DetectedAt:  a.DetectedAt,
+		},
+	}
+	if err := d.outbox.SaveEvent(ctx, tx, event); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit anomaly: %w", err)
+	}
+	return true, nil
+}
+
+// ListAnomalies returns the most recent anomalies, optionally filtered
+func (d *Detector) ListAnomalies(ctx context.Context, status, kind string, limit int) ([]Anomaly, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, kind, wallet_id, currency, window_start, window_end, observed, expected,
+			score, status, detected_at, acknowledged_at
+		FROM anomalies
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY detected_at DESC, id DESC
+		LIMIT $3
+	`, status, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	anomalies := []Anomaly{}
+	for rows.Next() {
+		a, err := scanAnomaly(rows)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, *a)
+	}
+	return anomalies, rows.Err()
+}
+
+// AcknowledgeAnomaly marks an anomaly as handled; nil if it does not exist
+func (d *Detector) AcknowledgeAnomaly(ctx context.Context, id int64) (*Anomaly, error) {
+	row := d.db.QueryRowContext(ctx, `
+		UPDATE anomalies
+		SET status = $2, acknowledged_at = COALESCE(acknowledged_at, CURRENT_TIMESTAMP)
+		WHERE id = $1
+		RETURNING id, kind, wallet_id, currency, window_start, window_end, observed, expected,
+			score, status, detected_at, acknowledged_at
+	`, id, AnomalyStatusAcknowledged)
+
+	a, err := scanAnomaly(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+func scanAnomaly(row interface{ Scan(...interface{}) error }) (*Anomaly, error) {
+	var a Anomaly
+	var acknowledged sql.NullTime
+	err := row.Scan(
+		&a.ID, &a.Kind, &a.WalletID, &a.Currency, &a.WindowStart, &a.WindowEnd,
+		&a.Observed, &a.Expected, &a.Score, &a.Status, &a.DetectedAt, &acknowledged,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+	}
+	if acknowledged.Valid {
+		a.AcknowledgedAt = &acknowledged.Time
+	}
+	return &a, nil
+}
+
+// zScore returns the samples' mean and how many deviations observed is from it
+func zScore(observed float64, samples []float64) (float64, float64) {
+	var sum, sumSq float64
+	for _, v := range samples {
+		sum += v
+		sumSq += v * v
+	}
+	mean, sigma := meanAndDeviation(float64(len(samples)), sum, sumSq)
+	return mean, (observed - mean) / sigma
+}
+
+// meanAndDeviation returns the mean and standard deviation of n values
+// NOTE: The deviation is floored at 10% of the mean (and at 1) so a nearly
+// flat baseline does not turn small changes into large scores
+func meanAndDeviation(n, sum, sumSq float64) (float64, float64) {
+	mean := sum / n
+	sigma := math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	return mean, math.Max(sigma, math.Max(0.1*mean, 1))
+}
+
+// floatAmount rounds a statistic to an amount
+func floatAmount(v float64) money.Amount {
+	amount, err := money.Parse(strconv.FormatFloat(v, 'f', money.Scale, 64))
+	if err != nil {
+		return money.Zero()
+	}
+	return amount
+}
+
+// AnomalyHandler exposes flagged anomalies to operators
+type AnomalyHandler struct {
+	detector *Detector
+}
+
+func NewAnomalyHandler(d *Detector) *AnomalyHandler {
+	return &AnomalyHandler{detector: d}
+}
+
+// RegisterInternalRoutes registers the anomaly admin routes
+// NOTE: Anomalies name every wallet's spending, so they are mTLS only
+func (h *AnomalyHandler) RegisterInternalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/internal/analytics/anomalies", h.ListAnomalies)
+	mux.HandleFunc("POST /api/v1/internal/analytics/anomalies/{id}/acknowledge", h.AcknowledgeAnomaly)
+}
+
+// ListAnomalies handles GET /api/v1/internal/analytics/anomalies?status=&kind=&limit=
+func (h *AnomalyHandler) ListAnomalies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if status != "" && status != AnomalyStatusOpen && status != AnomalyStatusAcknowledged {
+		writeError(w, http.StatusBadRequest, "invalid_status", "status must be open or acknowledged")
+		return
+	}
+
+	kind := query.Get("kind")
+	if kind != "" && kind != AnomalyHourlyVolume && kind != AnomalyHourlyCount && kind != AnomalyUserSpending {
+		writeError(w, http.StatusBadRequest, "invalid_kind", "kind must be hourly_volume, hourly_count or user_spending")
+		return
+	}
+
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	anomalies, err := h.detector.ListAnomalies(r.Context(), status, kind, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list anomalies")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"anomalies": anomalies,
+		"total":     len(anomalies),
+	})
+}
+
+// AcknowledgeAnomaly handles POST /api/v1/internal/analytics/anomalies/{id}/acknowledge
+func (h *AnomalyHandler) AcknowledgeAnomaly(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_id", "anomaly id must be a number")
+		return
+	}
+
+	anomaly, err := h.detector.AcknowledgeAnomaly(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to acknowledge anomaly")
+		return
+	}
+	if anomaly == nil {
+		writeError(w, http.StatusNotFound, "not_found", "anomaly not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, anomaly)
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeanAndDeviation(t *testing.T) {
+	tests := []struct {
+		name      string
+		samples   []float64
+		wantMean  float64
+		wantSigma float64
+	}{
+		{"spread baseline", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+		{"flat baseline floors at 10% of the mean", []float64{100, 100, 100}, 100, 10},
+		{"small baseline floors at 1", []float64{1, 1, 1}, 1, 1},
+		{"empty baseline", []float64{0, 0}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sum, sumSq float64
+			for _, v := range tt.samples {
+				sum += v
+				sumSq += v * v
+			}
+
+			mean, sigma := meanAndDeviation(float64(len(tt.samples)), sum, sumSq)
+			if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(sigma-tt.wantSigma) > 1e-9 {
+				t.Errorf("meanAndDeviation() = %v, %v, want %v, %v", mean, sigma, tt.wantMean, tt.wantSigma)
+			}
+		})
+	}
+}
+
+func TestZScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		observed  float64
+		samples   []float64
+		wantMean  float64
+		wantScore float64
+	}{
+		{"above baseline", 11, []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 3},
+		{"below baseline", 1, []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, -2},
+		{"flat baseline", 120, []float64{100, 100, 100}, 100, 2},
+		{"first activity", 5, []float64{0, 0, 0}, 0, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, score := zScore(tt.observed, tt.samples)
+			if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(score-tt.wantScore) > 1e-9 {
+				t.Errorf("zScore(%v) = %v, %v, want %v, %v", tt.observed, mean, score, tt.wantMean, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestFloatAmount(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{1.23456, "1.2346"},
+		{-2.5, "-2.5000"},
+		{0, "0.0000"},
+		{math.NaN(), "0.0000"},
+		{math.Inf(1), "0.0000"},
+	}
+
+	for _, tt := range tests {
+		if got := floatAmount(tt.value).String(); got != tt.want {
+			t.Errorf("floatAmount(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
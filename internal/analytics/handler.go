@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/middleware"
@@ -44,6 +46,40 @@ func writeError(w http.ResponseWriter, status int, err string, message string) {
 	})
 }
 
+// currencyFromQuery reads the optional ?currency= filter
+func currencyFromQuery(r *http.Request) (string, error) {
+	currency := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	if currency == "" {
+		return "", nil
+	}
+	if err := ValidateCurrency(currency); err != nil {
+		return "", err
+	}
+	return currency, nil
+}
+
+// locationFromQuery reads the optional ?tz= IANA timezone, falling back to
+// fallback (UTC when empty)
+func locationFromQuery(r *http.Request, fallback string) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = fallback
+	}
+	return LoadTimezone(tz)
+}
+
+// userLocation resolves ?tz= for /me endpoints, defaulting to the profile timezone
+func userLocation(r *http.Request) (*time.Location, error) {
+	profileTz, _ := middleware.GetTimezoneFromContext(r.Context())
+	return locationFromQuery(r, profileTz)
+}
+
+// localToday is today's date in loc, at UTC midnight like parsed dates
+func localToday(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
 // GetDailyMetrics handles GET /api/v1/analytics/daily
 func (h *Handler) GetDailyMetrics(w http.ResponseWriter, r *http.Request) {
 	// Public API requires JWT, internal mTLS calls are also allowed
@@ -82,8 +118,20 @@ func (h *Handler) GetDailyMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
+	loc, err := locationFromQuery(r, "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_timezone", err.Error())
+		return
+	}
+
 	// Fetch metrics
-	metrics, err := h.service.GetDailyMetrics(r.Context(), startDate, endDate)
+	metrics, err := h.service.GetDailyMetrics(r.Context(), startDate, endDate, currency, loc)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch daily metrics")
 		return
@@ -132,8 +180,14 @@ func (h *Handler) GetHourlyMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
 	// Fetch metrics
-	metrics, err := h.service.GetHourlyMetrics(r.Context(), startTime, endTime)
+	metrics, err := h.service.GetHourlyMetrics(r.Context(), startTime, endTime, currency)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch hourly metrics")
 		return
@@ -144,6 +198,57 @@ func (h *Handler) GetHourlyMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetPercentiles handles GET /api/v1/analytics/percentiles
+func (h *Handler) GetPercentiles(w http.ResponseWriter, r *http.Request) {
+	startTimeStr := r.URL.Query().Get("start_time")
+	endTimeStr := r.URL.Query().Get("end_time")
+
+	if startTimeStr == "" || endTimeStr == "" {
+		writeError(w, http.StatusBadRequest, "invalid_parameters", "start_time and end_time are required")
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_time_format", "start_time must be in RFC3339 format")
+		return
+	}
+
+	endTime, err := time.Parse(time.RFC3339, endTimeStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_time_format", "end_time must be in RFC3339 format")
+		return
+	}
+
+	// Validate time range
+	if endTime.Before(startTime) {
+		writeError(w, http.StatusBadRequest, "invalid_time_range", "end_time must be after start_time")
+		return
+	}
+
+	// Histograms merge cheaply, so allow the same span as daily metrics
+	if endTime.Sub(startTime) > 90*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "time_range_too_large", "time range cannot exceed 90 days")
+		return
+	}
+
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
+	percentiles, err := h.service.GetPercentiles(r.Context(), startTime, endTime, currency)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch percentiles")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{
+		Data: percentiles,
+	})
+}
+
 // GetMetricsSummary handles GET /api/v1/analytics/summary
 func (h *Handler) GetMetricsSummary(w http.ResponseWriter, r *http.Request) {
 	// Public API requires JWT, internal mTLS calls are also allowed
@@ -186,8 +291,20 @@ func (h *Handler) GetMetricsSummary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
+	loc, err := locationFromQuery(r, "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_timezone", err.Error())
+		return
+	}
+
 	// Fetch summary
-	summary, err := h.service.GetMetricsSummary(r.Context(), startDate, endDate, period)
+	summary, err := h.service.GetMetricsSummary(r.Context(), startDate, endDate, period, currency, loc)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch metrics summary")
 		return
@@ -207,11 +324,18 @@ func (h *Handler) GetUserAnalytics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Dates are days in the requested or profile timezone
+	loc, err := userLocation(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_timezone", err.Error())
+		return
+	}
+
 	// Parse dates with defaults (last 30 days)
 	startDateStr := r.URL.Query().Get("start_date")
 	endDateStr := r.URL.Query().Get("end_date")
 
-	endDate := time.Now().Truncate(24 * time.Hour)
+	endDate := localToday(loc)
 	startDate := endDate.AddDate(0, 0, -30)
 
 	if startDateStr != "" {
@@ -244,6 +368,12 @@ func (h *Handler) GetUserAnalytics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
 	// Get user's wallet IDs from Wallet Service
 	walletClient := NewWalletClient()
 	authToken := r.Header.Get("Authorization")
@@ -258,20 +388,17 @@ func (h *Handler) GetUserAnalytics(w http.ResponseWriter, r *http.Request) {
 	if len(walletIDs) == 0 {
 		writeJSON(w, http.StatusOK, SuccessResponse{
 			Data: &UserAnalyticsResponse{
-				UserID:           userID,
-				Period:           fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
-				TotalSent:        0,
-				TotalReceived:    0,
-				NetAmount:        0,
-				TransactionCount: 0,
-				TotalFeesPaid:    0,
+				UserID:     userID,
+				Period:     fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
+				Currency:   currency,
+				ByCurrency: []UserCurrencyTotals{},
 			},
 		})
 		return
 	}
 
 	// Fetch analytics across all user's wallets
-	analytics, err := h.service.GetUserAnalyticsByWallets(r.Context(), walletIDs, startDate, endDate)
+	analytics, err := h.service.GetUserAnalyticsByWallets(r.Context(), walletIDs, startDate, endDate, currency, loc)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch user analytics")
 		return
@@ -294,11 +421,18 @@ func (h *Handler) GetUserSnapshots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Dates are days in the requested or profile timezone
+	loc, err := userLocation(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_timezone", err.Error())
+		return
+	}
+
 	// Parse dates with defaults (last 30 days)
 	startDateStr := r.URL.Query().Get("start_date")
 	endDateStr := r.URL.Query().Get("end_date")
 
-	endDate := time.Now().Truncate(24 * time.Hour)
+	endDate := localToday(loc)
 	startDate := endDate.AddDate(0, 0, -30)
 
 	if startDateStr != "" {
@@ -331,6 +465,12 @@ func (h *Handler) GetUserSnapshots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
 	// Get user's wallet IDs from Wallet Service
 	walletClient := NewWalletClient()
 	authToken := r.Header.Get("Authorization")
@@ -350,7 +490,7 @@ func (h *Handler) GetUserSnapshots(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch snapshots across all user's wallets
-	snapshots, err := h.service.GetUserSnapshotsByWallets(r.Context(), walletIDs, startDate, endDate)
+	snapshots, err := h.service.GetUserSnapshotsByWallets(r.Context(), walletIDs, startDate, endDate, currency, loc)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch user snapshots")
 		return
@@ -361,6 +501,260 @@ func (h *Handler) GetUserSnapshots(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetTopCounterparties handles GET /api/v1/analytics/me/counterparties
+// Ranks the wallets the authenticated user paid (or was paid by) the most
+func (h *Handler) GetTopCounterparties(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	// Parse dates with defaults (last 30 days)
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	endDate := time.Now().Truncate(24 * time.Hour)
+	startDate := endDate.AddDate(0, 0, -30)
+
+	if startDateStr != "" {
+		var err error
+		startDate, err = time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_date_format", "start_date must be in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	if endDateStr != "" {
+		var err error
+		endDate, err = time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_date_format", "end_date must be in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	// Validate date range
+	if endDate.Before(startDate) {
+		writeError(w, http.StatusBadRequest, "invalid_date_range", "end_date must be after start_date")
+		return
+	}
+
+	// Limit to 366 days; counterparty rows are small
+	if endDate.Sub(startDate) > 366*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "date_range_too_large", "date range cannot exceed 366 days")
+		return
+	}
+
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
+	direction := r.URL.Query().Get("direction")
+	if direction == "" {
+		direction = DirectionSent
+	}
+	if direction != DirectionSent && direction != DirectionReceived {
+		writeError(w, http.StatusBadRequest, "invalid_direction", "direction must be sent or received")
+		return
+	}
+
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			writeError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and 100")
+			return
+		}
+	}
+
+	// Get user's wallet IDs from Wallet Service
+	walletClient := NewWalletClient()
+	authToken := r.Header.Get("Authorization")
+
+	walletIDs, err := walletClient.GetUserWalletIDs(r.Context(), userID, authToken)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "wallet_service_error", fmt.Sprintf("Failed to fetch user wallets: %v", err))
+		return
+	}
+
+	counterparties, err := h.service.GetTopCounterparties(r.Context(), walletIDs, startDate, endDate, currency, direction, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch counterparties")
+		return
+	}
+	counterparties.UserID = userID
+
+	writeJSON(w, http.StatusOK, SuccessResponse{
+		Data: counterparties,
+	})
+}
+
+// GetCohorts handles GET /api/v1/analytics/cohorts?start_month=YYYY-MM&end_month=YYYY-MM
+// Returns the monthly retention of wallets grouped by their first active month
+func (h *Handler) GetCohorts(w http.ResponseWriter, r *http.Request) {
+	// Default: the last 12 cohorts
+	now := time.Now().UTC()
+	endMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	startMonth := endMonth.AddDate(0, -11, 0)
+
+	if v := r.URL.Query().Get("start_month"); v != "" {
+		var err error
+		startMonth, err = time.Parse("2006-01", v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_date_format", "start_month must be in YYYY-MM format")
+			return
+		}
+	}
+
+	if v := r.URL.Query().Get("end_month"); v != "" {
+		var err error
+		endMonth, err = time.Parse("2006-01", v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_date_format", "end_month must be in YYYY-MM format")
+			return
+		}
+	}
+
+	if endMonth.Before(startMonth) {
+		writeError(w, http.StatusBadRequest, "invalid_date_range", "end_month must be after start_month")
+		return
+	}
+
+	// Limit to 24 cohorts
+	if endMonth.After(startMonth.AddDate(0, 23, 0)) {
+		writeError(w, http.StatusBadRequest, "date_range_too_large", "month range cannot exceed 24 months")
+		return
+	}
+
+	cohorts, err := h.service.GetCohorts(r.Context(), startMonth, endMonth)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch cohorts")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{
+		Data: cohorts,
+	})
+}
+
+// GetActiveUsers handles GET /api/v1/analytics/active-users?start_date=&end_date=
+// Returns daily DAU, trailing 30-day MAU and their ratio
+func (h *Handler) GetActiveUsers(w http.ResponseWriter, r *http.Request) {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	if startDateStr == "" || endDateStr == "" {
+		writeError(w, http.StatusBadRequest, "invalid_parameters", "start_date and end_date are required")
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "start_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "end_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	// Validate date range
+	if endDate.Before(startDate) {
+		writeError(w, http.StatusBadRequest, "invalid_date_range", "end_date must be after start_date")
+		return
+	}
+
+	// Limit to 90 days
+	if endDate.Sub(startDate) > 90*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "date_range_too_large", "date range cannot exceed 90 days")
+		return
+	}
+
+	points, err := h.service.GetActiveUsers(r.Context(), startDate, endDate)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch active users")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{
+		Data: points,
+	})
+}
+
+// GetRollup handles GET /api/v1/analytics/rollup
+// Sums hourly metrics into the days, weeks or months of ?tz= (default UTC)
+func (h *Handler) GetRollup(w http.ResponseWriter, r *http.Request) {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+	interval := r.URL.Query().Get("interval")
+
+	if startDateStr == "" || endDateStr == "" {
+		writeError(w, http.StatusBadRequest, "invalid_parameters", "start_date and end_date are required")
+		return
+	}
+
+	if interval == "" {
+		interval = IntervalDay
+	}
+
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		writeError(w, http.StatusBadRequest, "invalid_interval", "interval must be 'day', 'week' or 'month'")
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "start_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "end_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	// Validate date range
+	if endDate.Before(startDate) {
+		writeError(w, http.StatusBadRequest, "invalid_date_range", "end_date must be after start_date")
+		return
+	}
+
+	// Limit to a year of hourly rows
+	if endDate.Sub(startDate) > 366*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "date_range_too_large", "date range cannot exceed 366 days")
+		return
+	}
+
+	currency, err := currencyFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_currency", err.Error())
+		return
+	}
+
+	loc, err := locationFromQuery(r, "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_timezone", err.Error())
+		return
+	}
+
+	rollup, err := h.service.GetRollup(r.Context(), startDate, endDate, interval, currency, loc)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch metrics rollup")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{
+		Data: rollup,
+	})
+}
+
 // HealthCheck handles GET /health
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{
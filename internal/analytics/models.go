@@ -2,110 +2,265 @@ package analytics
 
 import (
 	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
 )
 
 // DailyMetric represents aggregated daily statistics
 type DailyMetric struct {
-	ID                     int64     `json:"id" db:"id"`
-	MetricDate             time.Time `json:"metric_date" db:"metric_date"`
-	TotalTransactions      int64     `json:"total_transactions" db:"total_transactions"`
-	TotalVolume            float64   `json:"total_volume" db:"total_volume"`
-	TotalFees              float64   `json:"total_fees" db:"total_fees"`
-	UniqueUsers            int64     `json:"unique_users" db:"unique_users"`
-	SuccessfulTransactions int64     `json:"successful_transactions" db:"successful_transactions"`
-	FailedTransactions     int64     `json:"failed_transactions" db:"failed_transactions"`
-	AvgTransactionValue    float64   `json:"avg_transaction_value" db:"avg_transaction_value"`
-	CreatedAt              time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt              time.Time `json:"updated_at" db:"updated_at"`
+	ID                     int64        `json:"id" db:"id"`
+	MetricDate             time.Time    `json:"metric_date" db:"metric_date"`
+	Currency               string       `json:"currency" db:"currency"`
+	TotalTransactions      int64        `json:"total_transactions" db:"total_transactions"`
+	TotalVolume            money.Amount `json:"total_volume" db:"total_volume"`
+	TotalFees              money.Amount `json:"total_fees" db:"total_fees"`
+	UniqueUsers            int64        `json:"unique_users" db:"unique_users"`
+	SuccessfulTransactions int64        `json:"successful_transactions" db:"successful_transactions"`
+	FailedTransactions     int64        `json:"failed_transactions" db:"failed_transactions"`
+	AvgTransactionValue    money.Amount `json:"avg_transaction_value" db:"avg_transaction_value"`
+	CreatedAt              time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time    `json:"updated_at" db:"updated_at"`
 }
 
 // HourlyMetric represents aggregated hourly statistics for real-time monitoring
 type HourlyMetric struct {
-	ID                     int64     `json:"id" db:"id"`
-	MetricHour             time.Time `json:"metric_hour" db:"metric_hour"`
-	TotalTransactions      int64     `json:"total_transactions" db:"total_transactions"`
-	TotalVolume            float64   `json:"total_volume" db:"total_volume"`
-	TotalFees              float64   `json:"total_fees" db:"total_fees"`
-	UniqueUsers            int64     `json:"unique_users" db:"unique_users"`
-	SuccessfulTransactions int64     `json:"successful_transactions" db:"successful_transactions"`
-	FailedTransactions     int64     `json:"failed_transactions" db:"failed_transactions"`
-	AvgTransactionValue    float64   `json:"avg_transaction_value" db:"avg_transaction_value"`
-	MaxTransactionValue    float64   `json:"max_transaction_value" db:"max_transaction_value"`
-	MinTransactionValue    float64   `json:"min_transaction_value" db:"min_transaction_value"`
-	AvgProcessingTimeMs    int       `json:"avg_processing_time_ms" db:"avg_processing_time_ms"`
-	CreatedAt              time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt              time.Time `json:"updated_at" db:"updated_at"`
+	ID                     int64        `json:"id" db:"id"`
+	MetricHour             time.Time    `json:"metric_hour" db:"metric_hour"`
+	Currency               string       `json:"currency" db:"currency"`
+	TotalTransactions      int64        `json:"total_transactions" db:"total_transactions"`
+	TotalVolume            money.Amount `json:"total_volume" db:"total_volume"`
+	TotalFees              money.Amount `json:"total_fees" db:"total_fees"`
+	UniqueUsers            int64        `json:"unique_users" db:"unique_users"`
+	SuccessfulTransactions int64        `json:"successful_transactions" db:"successful_transactions"`
+	FailedTransactions     int64        `json:"failed_transactions" db:"failed_transactions"`
+	AvgTransactionValue    money.Amount `json:"avg_transaction_value" db:"avg_transaction_value"`
+	MaxTransactionValue    money.Amount `json:"max_transaction_value" db:"max_transaction_value"`
+	MinTransactionValue    money.Amount `json:"min_transaction_value" db:"min_transaction_value"`
+	AvgProcessingTimeMs    int          `json:"avg_processing_time_ms" db:"avg_processing_time_ms"`
+	CreatedAt              time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time    `json:"updated_at" db:"updated_at"`
 }
 
 // UserSnapshot represents per-user aggregated statistics
 type UserSnapshot struct {
-	ID                 int64      `json:"id" db:"id"`
-	UserID             string     `json:"user_id" db:"user_id"`
-	SnapshotDate       time.Time  `json:"snapshot_date" db:"snapshot_date"`
-	TotalSent          float64    `json:"total_sent" db:"total_sent"`
-	TotalReceived      float64    `json:"total_received" db:"total_received"`
-	TransactionCount   int64      `json:"transaction_count" db:"transaction_count"`
-	SentCount          int64      `json:"sent_count" db:"sent_count"`
-	ReceivedCount      int64      `json:"received_count" db:"received_count"`
-	TotalFeesPaid      float64    `json:"total_fees_paid" db:"total_fees_paid"`
-	LastTransactionAt  *time.Time `json:"last_transaction_at,omitempty" db:"last_transaction_at"`
-	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+	ID                int64        `json:"id" db:"id"`
+	UserID            string       `json:"user_id" db:"user_id"`
+	SnapshotDate      time.Time    `json:"snapshot_date" db:"snapshot_date"`
+	Currency          string       `json:"currency" db:"currency"`
+	TotalSent         money.Amount `json:"total_sent" db:"total_sent"`
+	TotalReceived     money.Amount `json:"total_received" db:"total_received"`
+	TransactionCount  int64        `json:"transaction_count" db:"transaction_count"`
+	SentCount         int64        `json:"sent_count" db:"sent_count"`
+	ReceivedCount     int64        `json:"received_count" db:"received_count"`
+	TotalFeesPaid     money.Amount `json:"total_fees_paid" db:"total_fees_paid"`
+	LastTransactionAt *time.Time   `json:"last_transaction_at,omitempty" db:"last_transaction_at"`
+	CreatedAt         time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at" db:"updated_at"`
 }
 
 // EventProcessingLog tracks processed Kafka events for idempotency
 type EventProcessingLog struct {
-	ID                int64     `json:"id" db:"id"`
-	EventID           string    `json:"event_id" db:"event_id"`
-	EventType         string    `json:"event_type" db:"event_type"`
-	Topic             string    `json:"topic" db:"topic"`
-	Partition         int       `json:"partition" db:"partition"`
-	Offset            int64     `json:"offset" db:"offset"`
-	EventData         []byte    `json:"event_data,omitempty" db:"event_data"`
-	ProcessedAt       time.Time `json:"processed_at" db:"processed_at"`
-	ProcessingTimeMs  int       `json:"processing_time_ms" db:"processing_time_ms"`
-	Status            string    `json:"status" db:"status"`
-	ErrorMessage      *string   `json:"error_message,omitempty" db:"error_message"`
-	RetryCount        int       `json:"retry_count" db:"retry_count"`
-	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	ID               int64     `json:"id" db:"id"`
+	EventID          string    `json:"event_id" db:"event_id"`
+	EventType        string    `json:"event_type" db:"event_type"`
+	Topic            string    `json:"topic" db:"topic"`
+	Partition        int       `json:"partition" db:"partition"`
+	Offset           int64     `json:"offset" db:"offset"`
+	EventData        []byte    `json:"event_data,omitempty" db:"event_data"`
+	ProcessedAt      time.Time `json:"processed_at" db:"processed_at"`
+	ProcessingTimeMs int       `json:"processing_time_ms" db:"processing_time_ms"`
+	Status           string    `json:"status" db:"status"`
+	ErrorMessage     *string   `json:"error_message,omitempty" db:"error_message"`
+	RetryCount       int       `json:"retry_count" db:"retry_count"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 }
 
 // LedgerEntryCreatedEvent represents the Kafka event from ledger service
 type LedgerEntryCreatedEvent struct {
-	EventID         string    `json:"event_id"`
-	LedgerID        string    `json:"ledger_id"`
-	TransactionID   string    `json:"transaction_id"`
-	FromWalletID    string    `json:"from_wallet_id"`
-	ToWalletID      string    `json:"to_wallet_id"`
-	Amount          float64   `json:"amount"`
-	Fee             float64   `json:"fee"`
-	Status          string    `json:"status"`
-	TransactionType string    `json:"transaction_type"`
-	CreatedAt       time.Time `json:"created_at"`
+	EventID         string                 `json:"event_id"`
+	LedgerID        string                 `json:"ledger_id"`
+	TransactionID   string                 `json:"transaction_id"`
+	FromWalletID    string                 `json:"from_wallet_id"`
+	ToWalletID      string                 `json:"to_wallet_id"`
+	Amount          money.Amount           `json:"amount"`
+	Fee             money.Amount           `json:"fee"`
+	Currency        string                 `json:"currency"`
+	Status          string                 `json:"status"`
+	TransactionType string                 `json:"transaction_type"`
+	CreatedAt       time.Time              `json:"created_at"`
+	InitiatedAt     *time.Time             `json:"initiated_at,omitempty"` // When the transfer was initiated, if known
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// TransactionFailedEvent represents a transfer the transaction service could
+// not execute (transaction.failed)
+type TransactionFailedEvent struct {
+	EventID       string       `json:"event_id"`
+	TransactionID string       `json:"transaction_id"`
+	FromWalletID  string       `json:"from_wallet_id"`
+	ToWalletID    string       `json:"to_wallet_id"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	Reason        string       `json:"reason"`
+	CreatedAt     time.Time    `json:"created_at"` // When the transfer failed
+}
+
+// FeeChargedEvent represents a fee taken from a wallet (transaction.fee_charged)
+type FeeChargedEvent struct {
+	EventID       string       `json:"event_id"`
+	TransactionID string       `json:"transaction_id"`
+	WalletID      string       `json:"wallet_id"`
+	Fee           money.Amount `json:"fee"`
+	Currency      string       `json:"currency"`
+	CreatedAt     time.Time    `json:"created_at"` // When the fee was charged
+}
+
 // MetricsSummaryResponse represents API response for metrics summary
+// NOTE: Amounts are only ever summed per currency (ByCurrency); Converted is
+// set when a reporting currency is configured
 type MetricsSummaryResponse struct {
-	Period             string  `json:"period"` // "daily", "hourly"
-	TotalTransactions  int64   `json:"total_transactions"`
-	TotalVolume        float64 `json:"total_volume"`
-	TotalFees          float64 `json:"total_fees"`
-	UniqueUsers        int64   `json:"unique_users"`
-	SuccessRate        float64 `json:"success_rate"`
-	AvgTransactionSize float64 `json:"avg_transaction_size"`
+	Period            string            `json:"period"`             // "daily", "hourly"
+	Currency          string            `json:"currency,omitempty"` // Filter, if any
+	TotalTransactions int64             `json:"total_transactions"`
+	UniqueUsers       int64             `json:"unique_users"`
+	SuccessRate       float64           `json:"success_rate"`
+	ByCurrency        []CurrencySummary `json:"by_currency"`
+	Converted         *CurrencySummary  `json:"converted,omitempty"`
+	MissingRates      []string          `json:"missing_rates,omitempty"` // Currencies left out of Converted
+}
+
+// CurrencySummary holds the volume of one currency
+type CurrencySummary struct {
+	Currency           string       `json:"currency"`
+	TotalTransactions  int64        `json:"total_transactions"`
+	FailedTransactions int64        `json:"failed_transactions"`
+	TotalVolume        money.Amount `json:"total_volume"`
+	TotalFees          money.Amount `json:"total_fees"`
+	AvgTransactionSize money.Amount `json:"avg_transaction_size"` // Over successful transactions
 }
 
 // UserAnalyticsResponse represents API response for user analytics
 type UserAnalyticsResponse struct {
-	UserID            string     `json:"user_id"`
-	Period            string     `json:"period"`
-	TotalSent         float64    `json:"total_sent"`
-	TotalReceived     float64    `json:"total_received"`
-	NetAmount         float64    `json:"net_amount"`
-	TransactionCount  int64      `json:"transaction_count"`
-	TotalFeesPaid     float64    `json:"total_fees_paid"`
-	LastTransactionAt *time.Time `json:"last_transaction_at,omitempty"`
+	UserID            string               `json:"user_id"`
+	Period            string               `json:"period"`
+	Currency          string               `json:"currency,omitempty"` // Filter, if any
+	TransactionCount  int64                `json:"transaction_count"`
+	LastTransactionAt *time.Time           `json:"last_transaction_at,omitempty"`
+	ByCurrency        []UserCurrencyTotals `json:"by_currency"`
+	Converted         *UserCurrencyTotals  `json:"converted,omitempty"`
+	MissingRates      []string             `json:"missing_rates,omitempty"`
+}
+
+// UserCurrencyTotals holds a user's activity in one currency
+type UserCurrencyTotals struct {
+	Currency         string       `json:"currency"`
+	TotalSent        money.Amount `json:"total_sent"`
+	TotalReceived    money.Amount `json:"total_received"`
+	NetAmount        money.Amount `json:"net_amount"`
+	TransactionCount int64        `json:"transaction_count"`
+	TotalFeesPaid    money.Amount `json:"total_fees_paid"`
+}
+
+// Counterparty ranking directions
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// CounterpartyActivity is one day of transfers between a wallet and a counterparty
+// NOTE: Exactly one of the sent or received sides is set per ledger entry
+type CounterpartyActivity struct {
+	ActivityDate         time.Time
+	WalletID             string
+	CounterpartyWalletID string
+	Currency             string
+	TotalSent            money.Amount
+	SentCount            int64
+	TotalReceived        money.Amount
+	ReceivedCount        int64
+	LastTransactionAt    time.Time
+}
+
+// CounterpartyTotals holds a user's transfers with one counterparty in one currency
+type CounterpartyTotals struct {
+	CounterpartyWalletID string       `json:"counterparty_wallet_id"`
+	Currency             string       `json:"currency"`
+	TotalSent            money.Amount `json:"total_sent"`
+	SentCount            int64        `json:"sent_count"`
+	TotalReceived        money.Amount `json:"total_received"`
+	ReceivedCount        int64        `json:"received_count"`
+	LastTransactionAt    *time.Time   `json:"last_transaction_at,omitempty"`
+}
+
+// CounterpartiesResponse represents API response for a user's top counterparties
+// NOTE: Counterparties are ranked per currency by the amount in Direction
+type CounterpartiesResponse struct {
+	UserID         string               `json:"user_id"`
+	Period         string               `json:"period"`
+	Currency       string               `json:"currency,omitempty"` // Filter, if any
+	Direction      string               `json:"direction"`
+	Counterparties []CounterpartyTotals `json:"counterparties"`
+}
+
+// CohortActivity is how many wallets of a cohort were active in one month
+type CohortActivity struct {
+	CohortMonth   time.Time
+	ActivityMonth time.Time
+	ActiveWallets int64
+}
+
+// CohortRow is the activity of one monthly cohort
+type CohortRow struct {
+	CohortMonth string        `json:"cohort_month"` // YYYY-MM
+	Size        int64         `json:"size"`         // Wallets first active in the month
+	Months      []CohortMonth `json:"months"`       // Month 0 is the cohort month
+}
+
+// CohortMonth is how many wallets of a cohort were active N months later
+type CohortMonth struct {
+	Offset        int     `json:"offset"`
+	ActiveWallets int64   `json:"active_wallets"`
+	Retention     float64 `json:"retention"` // ActiveWallets / cohort size
+}
+
+// CohortsResponse represents API response for monthly activity cohorts
+type CohortsResponse struct {
+	StartMonth string      `json:"start_month"`
+	EndMonth   string      `json:"end_month"`
+	Cohorts    []CohortRow `json:"cohorts"`
+}
+
+// ActiveUsersPoint holds the active wallets on one day
+type ActiveUsersPoint struct {
+	Date       string  `json:"date"`
+	DAU        int64   `json:"dau"`
+	MAU        int64   `json:"mau"`        // Active in the 30 days ending on Date
+	Stickiness float64 `json:"stickiness"` // DAU / MAU
+}
+
+// RollupMetric holds one currency's totals for a local day, week or month
+type RollupMetric struct {
+	PeriodStart            string       `json:"period_start"` // YYYY-MM-DD in the requested timezone
+	Currency               string       `json:"currency"`
+	TotalTransactions      int64        `json:"total_transactions"`
+	TotalVolume            money.Amount `json:"total_volume"`
+	TotalFees              money.Amount `json:"total_fees"`
+	UniqueUsers            int64        `json:"unique_users"`
+	SuccessfulTransactions int64        `json:"successful_transactions"`
+	FailedTransactions     int64        `json:"failed_transactions"`
+	AvgTransactionValue    money.Amount `json:"avg_transaction_value"`
+	MaxTransactionValue    money.Amount `json:"max_transaction_value"`
+	MinTransactionValue    money.Amount `json:"min_transaction_value"`
+}
+
+// RollupResponse represents API response for timezone-aware rollups
+type RollupResponse struct {
+	Interval  string          `json:"interval"` // day, week or month
+	Timezone  string          `json:"timezone"`
+	StartDate string          `json:"start_date"`
+	EndDate   string          `json:"end_date"`
+	Currency  string          `json:"currency,omitempty"` // Filter, if any
+	Metrics   []*RollupMetric `json:"metrics"`
 }
 
 // GetMetricsRequest represents request parameters for metrics API
@@ -122,11 +277,58 @@ type GetUserAnalyticsRequest struct {
 	EndDate   time.Time `json:"end_date"`
 }
 
+// Histogram metrics kept per hour and currency
+const (
+	HistogramValue        = "value"            // Transaction amount
+	HistogramSettlement   = "settlement_ms"    // Transfer initiated -> ledger posted
+	HistogramAnalyticsLag = "analytics_lag_ms" // Ledger posted -> analytics processed
+	HistogramEndToEnd     = "end_to_end_ms"    // Transfer initiated -> analytics processed
+	HistogramProcessing   = "processing_ms"    // Time spent processing the event
+)
+
+// HistogramBucket is the count of one histogram bucket summed over a range
+// NOTE: Buckets are sketch.Bucket indexes, so counts from any hours add up
+type HistogramBucket struct {
+	Currency string
+	Metric   string
+	Bucket   int
+	Count    int64
+}
+
+// PercentilesResponse represents API response for value and latency percentiles
+// NOTE: Values are per currency; latencies cover every currency in the range
+type PercentilesResponse struct {
+	StartTime        time.Time                     `json:"start_time"`
+	EndTime          time.Time                     `json:"end_time"`
+	Currency         string                        `json:"currency,omitempty"`
+	TransactionValue []ValuePercentiles            `json:"transaction_value"`
+	LatencyMs        map[string]LatencyPercentiles `json:"latency_ms"`
+}
+
+// ValuePercentiles holds transaction value percentiles for one currency
+type ValuePercentiles struct {
+	Currency string       `json:"currency"`
+	Count    int64        `json:"count"`
+	P50      money.Amount `json:"p50"`
+	P90      money.Amount `json:"p90"`
+	P99      money.Amount `json:"p99"`
+}
+
+// LatencyPercentiles holds latency percentiles in milliseconds
+type LatencyPercentiles struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
 // EventProcessingStatus constants
 const (
 	EventStatusProcessed = "processed"
 	EventStatusFailed    = "failed"
 	EventStatusRetrying  = "retrying"
+	EventStatusExhausted = "exhausted" // Retries given up
+	EventStatusSkipped   = "skipped"   // Set aside by an operator
 )
 
 // Transaction status constants
@@ -134,4 +336,4 @@ const (
 	TransactionStatusCompleted = "completed"
 	TransactionStatusFailed    = "failed"
 	TransactionStatusPending   = "pending"
-)
\ No newline at end of file
+)
@@ -0,0 +1,119 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+// UnknownCurrency (ISO 4217 "no currency") labels aggregates whose currency
+// is not known: events without one and rows aggregated before metrics were
+// split by currency
+const UnknownCurrency = "XXX"
+
+// RateTable converts per-currency totals into one reporting currency
+// NOTE: Rates are static configuration (ANALYTICS_EXCHANGE_RATES); converted
+// totals are indicative and never stored
+type RateTable struct {
+	Currency string
+	rates    map[string]money.Rate
+}
+
+// NewRateTable builds the table from config; it returns nil when no reporting
+// currency is configured
+func NewRateTable(currency string, rates map[string]string) (*RateTable, error) {
+	if currency == "" {
+		return nil, nil
+	}
+	if err := ValidateCurrency(currency); err != nil {
+		return nil, fmt.Errorf("invalid reporting currency: %w", err)
+	}
+
+	table := &RateTable{
+		Currency: currency,
+		rates:    map[string]money.Rate{currency: money.OneToOne()},
+	}
+	for code, value := range rates {
+		if err := ValidateCurrency(code); err != nil {
+			return nil, fmt.Errorf("invalid exchange rate currency: %w", err)
+		}
+		rate, err := money.ParseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %w", code, err)
+		}
+		if code != currency {
+			table.rates[code] = rate
+		}
+	}
+	return table, nil
+}
+
+// Convert returns amount, in currency from, in the reporting currency
+func (t *RateTable) Convert(amount money.Amount, from string) (money.Amount, bool) {
+	rate, ok := t.rates[from]
+	if !ok {
+		return money.Zero(), false
+	}
+	return amount.Convert(rate), true
+}
+
+// convertSummary sets summary.Converted to the sum of all currencies that
+// have a rate; the others are listed in MissingRates
+func (t *RateTable) convertSummary(summary *MetricsSummaryResponse) {
+	if t == nil {
+		return
+	}
+
+	converted := &CurrencySummary{Currency: t.Currency}
+	missing := []string{}
+	for _, c := range summary.ByCurrency {
+		volume, ok := t.Convert(c.TotalVolume, c.Currency)
+		if !ok {
+			missing = append(missing, c.Currency)
+			continue
+		}
+		fees, _ := t.Convert(c.TotalFees, c.Currency)
+
+		converted.TotalTransactions += c.TotalTransactions
+		converted.FailedTransactions += c.FailedTransactions
+		converted.TotalVolume = converted.TotalVolume.Add(volume)
+		converted.TotalFees = converted.TotalFees.Add(fees)
+	}
+	if succeeded := converted.TotalTransactions - converted.FailedTransactions; succeeded > 0 {
+		converted.AvgTransactionSize = converted.TotalVolume.Div(succeeded)
+	}
+
+	sort.Strings(missing)
+	summary.Converted = converted
+	summary.MissingRates = missing
+}
+
+// convertUserAnalytics sets analytics.Converted like convertSummary
+func (t *RateTable) convertUserAnalytics(analytics *UserAnalyticsResponse) {
+	if t == nil {
+		return
+	}
+
+	converted := &UserCurrencyTotals{Currency: t.Currency}
+	missing := []string{}
+	for _, c := range analytics.ByCurrency {
+		sent, ok := t.Convert(c.TotalSent, c.Currency)
+		if !ok {
+			missing = append(missing, c.Currency)
+			continue
+		}
+		received, _ := t.Convert(c.TotalReceived, c.Currency)
+		fees, _ := t.Convert(c.TotalFeesPaid, c.Currency)
+
+		converted.TotalSent = converted.TotalSent.Add(sent)
+		converted.TotalReceived = converted.TotalReceived.Add(received)
+		converted.TotalFeesPaid = converted.TotalFeesPaid.Add(fees)
+		converted.TransactionCount += c.TransactionCount
+	}
+	converted.NetAmount = converted.TotalReceived.Sub(converted.TotalSent)
+
+	sort.Strings(missing)
+	analytics.Converted = converted
+	analytics.MissingRates = missing
+}
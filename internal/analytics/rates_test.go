@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+func testRateTable(t *testing.T) *RateTable {
+	table, err := NewRateTable("USD", map[string]string{
+		"EUR": "1.1",
+		"IDR": "0.000063",
+		"USD": "2", // The reporting currency always converts 1:1
+	})
+	if err != nil {
+		t.Fatalf("NewRateTable failed: %v", err)
+	}
+	return table
+}
+
+func TestNewRateTable(t *testing.T) {
+	if table, err := NewRateTable("", map[string]string{"EUR": "1.1"}); table != nil || err != nil {
+		t.Errorf("Expected no table without a reporting currency, got %v, %v", table, err)
+	}
+
+	tests := []struct {
+		name     string
+		currency string
+		rates    map[string]string
+	}{
+		{"bad reporting currency", "usd", nil},
+		{"bad rate currency", "USD", map[string]string{"EURO": "1.1"}},
+		{"bad rate", "USD", map[string]string{"EUR": "abc"}},
+		{"zero rate", "USD", map[string]string{"EUR": "0"}},
+		{"negative rate", "USD", map[string]string{"EUR": "-1.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRateTable(tt.currency, tt.rates); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestRateTableConvert(t *testing.T) {
+	table := testRateTable(t)
+
+	tests := []struct {
+		amount string
+		from   string
+		want   string
+		wantOK bool
+	}{
+		{"10", "USD", "10.0000", true},
+		{"10", "EUR", "11.0000", true},
+		{"1000000", "IDR", "63.0000", true},
+		{"1", "IDR", "0.0001", true},   // 0.000063 rounds up
+		{"0.5", "IDR", "0.0000", true}, // 0.0000315 rounds down
+		{"-1", "IDR", "-0.0001", true}, // Rounds symmetrically
+		{"10", "GBP", "0.0000", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := table.Convert(money.MustParse(tt.amount), tt.from)
+		if ok != tt.wantOK || got.String() != tt.want {
+			t.Errorf("Convert(%s %s) = %s, %v, want %s, %v", tt.amount, tt.from, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestConvertSummary(t *testing.T) {
+	summary := &MetricsSummaryResponse{
+		ByCurrency: []CurrencySummary{
+			{Currency: "USD", TotalTransactions: 3, FailedTransactions: 1, TotalVolume: money.MustParse("100"), TotalFees: money.MustParse("1")},
+			{Currency: "EUR", TotalTransactions: 2, TotalVolume: money.MustParse("50"), TotalFees: money.MustParse("2")},
+			{Currency: "JPY", TotalTransactions: 4, TotalVolume: money.MustParse("1000")},
+			{Currency: "GBP", TotalTransactions: 1, TotalVolume: money.MustParse("10")},
+		},
+	}
+
+	testRateTable(t).convertSummary(summary)
+
+	c := summary.Converted
+	if c == nil {
+		t.Fatal("Expected a converted summary")
+	}
+	if c.Currency != "USD" || c.TotalTransactions != 5 || c.FailedTransactions != 1 {
+		t.Errorf("Unexpected converted counts: %+v", c)
+	}
+	if c.TotalVolume.String() != "155.0000" || c.TotalFees.String() != "3.2000" {
+		t.Errorf("Unexpected converted totals: volume %s, fees %s", c.TotalVolume, c.TotalFees)
+	}
+	if c.AvgTransactionSize.String() != "38.7500" {
+		t.Errorf("Expected average over 4 successful transactions 38.7500, got %s", c.AvgTransactionSize)
+	}
+	if want := []string{"GBP", "JPY"}; !reflect.DeepEqual(summary.MissingRates, want) {
+		t.Errorf("MissingRates = %v, want %v", summary.MissingRates, want)
+	}
+}
+
+func TestConvertSummaryWithoutTable(t *testing.T) {
+	summary := &MetricsSummaryResponse{}
+
+	var table *RateTable
+	table.convertSummary(summary)
+
+	if summary.Converted != nil || summary.MissingRates != nil {
+		t.Errorf("Expected summary to be left alone, got %+v", summary)
+	}
+}
@@ -0,0 +1,801 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/internal/common/redis"
+	"github.com/kmassidik/mercuria/internal/common/sketch"
+	"github.com/lib/pq"
+)
+
+// Recompute job statuses
+const (
+	RecomputeRunning   = "running"
+	RecomputeSucceeded = "succeeded"
+	RecomputeFailed    = "failed"
+)
+
+// RecomputeJob reports the progress of one recompute run
+type RecomputeJob struct {
+	ID                 string     `json:"id"`
+	From               string     `json:"from"` // First day, inclusive
+	To                 string     `json:"to"`   // Last day, inclusive
+	Status             string     `json:"status"`
+	Phase              string     `json:"phase"` // replaying, swapping, done
+	EventsRead         int64      `json:"events_read"`
+	EventsInRange      int64      `json:"events_in_range"`
+	Duplicates         int64      `json:"duplicates"`
+	Skipped            int64      `json:"skipped"`         // Undecodable messages
+	EventsFromLog      int64      `json:"events_from_log"` // Processed by the consumer but not replayed
+	DailyRows          int64      `json:"daily_rows"`
+	HourlyRows         int64      `json:"hourly_rows"`
+	SnapshotRows       int64      `json:"snapshot_rows"`
+	HourlySnapshotRows int64      `json:"hourly_snapshot_rows"`
+	CounterpartyRows   int64      `json:"counterparty_rows"`
+	HistogramRows      int64      `json:"histogram_rows"`
+	StartedAt          time.Time  `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
+// Recomputer rebuilds daily_metrics, hourly_metrics, user_snapshots,
+// user_hourly_snapshots, counterparty_daily and the value and settlement
+// histograms for a date range from a replay of ledger.entry_created, and adds
+// the range's wallet activity back to the cohort and DAU/MAU tables
+// NOTE: Replayed events are staged in a temporary table; the live rows of the
+// range are then replaced in one transaction, so readers see either the old or
+// the new aggregates. The swap holds a lock that pauses the consumer briefly
+// and also takes in every event the consumer has logged as processed, so events
+// handled during the replay are not lost. Running it again gives the same result.
+type Recomputer struct {
+	db     *sql.DB
+	redis  *redis.Client
+	kafka  config.KafkaConfig
+	logger *logger.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*RecomputeJob
+}
+
+func NewRecomputer(db *sql.DB, redisClient *redis.Client, kafkaCfg config.KafkaConfig, log *logger.Logger) *Recomputer {
+	return &Recomputer{
+		db:     db,
+		redis:  redisClient,
+		kafka:  kafkaCfg,
+		logger: log,
+		jobs:   make(map[string]*RecomputeJob),
+	}
+}
+
+// Start runs a recompute in the background and returns its job id
+func (r *Recomputer) Start(ctx context.Context, from, to time.Time) (string, error) {
+	job, err := r.newJob(from, to)
+	if err != nil {
+		return "", err
+	}
+
+	go r.run(ctx, job, from, to)
+	return job.ID, nil
+}
+
+// Run recomputes the range and returns the finished job
+func (r *Recomputer) Run(ctx context.Context, from, to time.Time) (RecomputeJob, error) {
+	job, err := r.newJob(from, to)
+	if err != nil {
+		return RecomputeJob{}, err
+	}
+
+	err = r.run(ctx, job, from, to)
+	snapshot, _ := r.Job(job.ID)
+	return snapshot, err
+}
+
+// Job returns a copy of a job's current state
+func (r *Recomputer) Job(id string) (RecomputeJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return RecomputeJob{}, false
+	}
+	return *job, true
+}
+
+func (r *Recomputer) newJob(from, to time.Time) (*RecomputeJob, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("to must not be before from")
+	}
+
+	job := &RecomputeJob{
+		ID:        fmt.Sprintf("recompute-%d", time.Now().UnixNano()),
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Status:    RecomputeRunning,
+		Phase:     "replaying",
+		StartedAt: time.Now().UTC(),
+	}
+
+	r.mu.Lock()
+	r.jobs[job.ID] = job
+	r.mu.Unlock()
+	return job, nil
+}
+
+// update changes a job under the lock
+func (r *Recomputer) update(job *RecomputeJob, fn func(*RecomputeJob)) {
+	r.mu.Lock()
+	fn(job)
+	r.mu.Unlock()
+}
+
+func (r *Recomputer) run(ctx context.Context, job *RecomputeJob, from, to time.Time) error {
+	r.logger.Infof("Recompute %s started for %s to %s", job.ID, job.From, job.To)
+
+	err := r.recompute(ctx, job, from, to)
+
+	r.update(job, func(j *RecomputeJob) {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status = RecomputeFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = RecomputeSucceeded
+			j.Phase = "done"
+		}
+	})
+
+	if err != nil {
+		r.logger.Errorf("Recompute %s failed: %v", job.ID, err)
+		return err
+	}
+	r.logger.Infof("Recompute %s finished", job.ID)
+	return nil
+}
+
+func (r *Recomputer) recompute(ctx context.Context, job *RecomputeJob, from, to time.Time) error {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	// Temporary tables and the advisory lock live on one connection
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext('analytics_recompute'))`).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take recompute lock: %w", err)
+	}
+	if !locked {
+		return fmt.Errorf("another recompute is already running")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext('analytics_recompute'))`)
+
+	if err := createStagingTable(ctx, conn); err != nil {
+		return err
+	}
+
+	// Messages are published after the entry is created, so nothing in the
+	// range was written to Kafka before its start
+	err = kafka.ReplaySince(ctx, r.kafka, "ledger.entry_created", start, func(ctx context.Context, msg kafka.ReplayMessage) error {
+		return r.stage(ctx, conn, job, msg, start, end)
+	}, r.logger)
+	if err != nil {
+		return fmt.Errorf("failed to replay ledger events: %w", err)
+	}
+
+	r.update(job, func(j *RecomputeJob) { j.Phase = "swapping" })
+	if err := r.swap(ctx, conn, job, start, end); err != nil {
+		return err
+	}
+
+	// Sketches only ever gain users, so adding the range again is safe
+	if err := r.addUniqueUsers(ctx, conn, start, end); err != nil {
+		r.logger.Warnf("Recompute %s could not refresh unique user sketches: %v", job.ID, err)
+	}
+
+	r.invalidateCache(ctx)
+	return nil
+}
+
+// createStagingTable creates (or empties) the connection's recompute_events table
+func createStagingTable(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE IF NOT EXISTS recompute_events (
+			event_id VARCHAR(36) PRIMARY KEY,
+			from_wallet_id VARCHAR(36) NOT NULL,
+			to_wallet_id VARCHAR(36) NOT NULL,
+			amount NUMERIC(20, 4) NOT NULL,
+			fee NUMERIC(20, 4) NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			partition INTEGER NOT NULL,
+			"offset" BIGINT NOT NULL,
+			event_data JSONB
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `TRUNCATE recompute_events`); err != nil {
+		return fmt.Errorf("failed to clear staging table: %w", err)
+	}
+
+	return nil
+}
+
+// addUniqueUsers feeds the staged senders into the unique user sketches
+func (r *Recomputer) addUniqueUsers(ctx context.Context, conn *sql.Conn, start, end time.Time) error {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT DISTINCT currency, from_wallet_id, date_trunc('hour', created_at)
+		FROM recompute_events
+		WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read staged users: %w", err)
+	}
+	defer rows.Close()
+
+	users := newUniqueUsers(r.redis)
+	batch := make([]userVisit, 0, 1000)
+	for rows.Next() {
+		var v userVisit
+		if err := rows.Scan(&v.Currency, &v.UserID, &v.At); err != nil {
+			return fmt.Errorf("failed to scan staged user: %w", err)
+		}
+		batch = append(batch, v)
+		if len(batch) == cap(batch) {
+			if err := users.Add(ctx, batch...); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read staged users: %w", err)
+	}
+	return users.Add(ctx, batch...)
+}
+
+// stage stores one replayed event if it falls in [start, end)
+func (r *Recomputer) stage(ctx context.Context, conn *sql.Conn, job *RecomputeJob, msg kafka.ReplayMessage, start, end time.Time) error {
+	r.update(job, func(j *RecomputeJob) { j.EventsRead++ })
+
+	event, err := decodeLedgerEvent(msg.Value)
+	if err != nil {
+		r.update(job, func(j *RecomputeJob) { j.Skipped++ })
+		r.logger.Debugf("Skipping ledger event at %d/%d: %v", msg.Partition, msg.Offset, err)
+		return nil
+	}
+	if event.CreatedAt.Before(start) || !event.CreatedAt.Before(end) {
+		return nil
+	}
+
+	eventData, err := MarshalEventData(event)
+	if err != nil {
+		return err
+	}
+
+	res, err := conn.ExecContext(ctx, `
+		INSERT INTO recompute_events (
+			event_id, from_wallet_id, to_wallet_id, amount, fee, currency,
+			status, created_at, partition, "offset", event_data
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (event_id) DO NOTHING
+	`,
+		event.EventID,
+		event.FromWalletID,
+		event.ToWalletID,
+		event.Amount,
+		event.Fee,
+		event.Currency,
+		event.Status,
+		event.CreatedAt,
+		msg.Partition,
+		msg.Offset,
+		eventData,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to stage event %s: %w", event.EventID, err)
+	}
+
+	n, _ := res.RowsAffected()
+	r.update(job, func(j *RecomputeJob) {
+		if n == 0 {
+			j.Duplicates++
+		} else {
+			j.EventsInRange++
+		}
+		if j.EventsRead%10000 == 0 {
+			r.logger.Infof("Recompute %s: %d events read, %d in range", j.ID, j.EventsRead, j.EventsInRange)
+		}
+	})
+	return nil
+}
+
+// swap replaces the range's aggregates with ones computed from the staged
+// events in a single transaction
+func (r *Recomputer) swap(ctx context.Context, conn *sql.Conn, job *RecomputeJob, start, end time.Time) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin swap: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Blocks consumer writes until commit; consumer transactions that already
+	// wrote have committed their log rows by the time the lock is granted
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE daily_metrics, hourly_metrics, user_snapshots, user_hourly_snapshots, counterparty_daily, hourly_histograms IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock aggregate tables: %w", err)
+	}
+
+	// Events the consumer processed that the replay did not see (e.g. past
+	// Kafka retention, or published after the replay finished)
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO recompute_events (
+			event_id, from_wallet_id, to_wallet_id, amount, fee, currency,
+			status, created_at, partition, "offset", event_data
+		)
+		SELECT
+			l.event_id,
+			COALESCE(l.event_data->>'from_wallet_id', ''),
+			COALESCE(l.event_data->>'to_wallet_id', ''),
+			(l.event_data->>'amount')::numeric,
+			COALESCE((l.event_data->>'fee')::numeric, 0),
+			COALESCE(NULLIF(l.event_data->>'currency', ''), $3),
+			COALESCE(l.event_data->>'status', 'completed'),
+			(l.event_data->>'created_at')::timestamptz,
+			l.partition,
+			l."offset",
+			l.event_data
+		FROM event_processing_log l
+		WHERE l.status = 'processed'
+			AND l.event_type = $4
+			AND l.event_data IS NOT NULL
+			AND (l.event_data->>'created_at')::timestamptz >= $1
+			AND (l.event_data->>'created_at')::timestamptz < $2
+		ON CONFLICT (event_id) DO NOTHING
+	`, start, end, UnknownCurrency, kafka.EventTypeLedgerEntryCreated)
+	if err != nil {
+		return fmt.Errorf("failed to stage logged events: %w", err)
+	}
+	fromLog, _ := res.RowsAffected()
+
+	lastDay := end.AddDate(0, 0, -1)
+	deletes := []string{
+		`DELETE FROM daily_metrics WHERE metric_date BETWEEN $1::date AND $2::date`,
+		`DELETE FROM user_snapshots WHERE snapshot_date BETWEEN $1::date AND $2::date`,
+		`DELETE FROM counterparty_daily WHERE activity_date BETWEEN $1::date AND $2::date`,
+	}
+	for _, stmt := range deletes {
+		if _, err := tx.ExecContext(ctx, stmt, start.Format("2006-01-02"), lastDay.Format("2006-01-02")); err != nil {
+			return fmt.Errorf("failed to clear aggregates: %w", err)
+		}
+	}
+	hourlyDeletes := []string{
+		`DELETE FROM hourly_metrics
+		WHERE metric_hour >= ($1::timestamptz AT TIME ZONE 'UTC') AND metric_hour < ($2::timestamptz AT TIME ZONE 'UTC')`,
+		`DELETE FROM user_hourly_snapshots
+		WHERE snapshot_hour >= ($1::timestamptz AT TIME ZONE 'UTC') AND snapshot_hour < ($2::timestamptz AT TIME ZONE 'UTC')`,
+	}
+	for _, stmt := range hourlyDeletes {
+		if _, err := tx.ExecContext(ctx, stmt, start, end); err != nil {
+			return fmt.Errorf("failed to clear aggregates: %w", err)
+		}
+	}
+
+	// NOTE: unique_users is counted exactly here; live updates use the sketches
+	daily, err := execCount(ctx, tx, `
+		INSERT INTO daily_metrics (
+			metric_date, currency, total_transactions, total_volume, total_fees,
+			unique_users, successful_transactions, failed_transactions, avg_transaction_value
+		)
+		SELECT
+			(created_at AT TIME ZONE 'UTC')::date, currency, COUNT(*), SUM(amount), SUM(fee),
+			COUNT(DISTINCT from_wallet_id),
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status <> 'completed'),
+			ROUND(SUM(amount) / COUNT(*), 4)
+		FROM recompute_events
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild daily metrics: %w", err)
+	}
+
+	hourly, err := execCount(ctx, tx, `
+		INSERT INTO hourly_metrics (
+			metric_hour, currency, total_transactions, total_volume, total_fees,
+			unique_users, successful_transactions, failed_transactions,
+			avg_transaction_value, max_transaction_value, min_transaction_value, avg_processing_time_ms
+		)
+		SELECT
+			date_trunc('hour', created_at AT TIME ZONE 'UTC'), currency, COUNT(*), SUM(amount), SUM(fee),
+			COUNT(DISTINCT from_wallet_id),
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status <> 'completed'),
+			ROUND(SUM(amount) / COUNT(*), 4), MAX(amount), MIN(amount), 0
+		FROM recompute_events
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild hourly metrics: %w", err)
+	}
+
+	// Same sender/receiver split as updateUserSnapshot
+	snapshots, err := execCount(ctx, tx, `
+		INSERT INTO user_snapshots (
+			user_id, snapshot_date, currency, total_sent, total_received, transaction_count,
+			sent_count, received_count, total_fees_paid, last_transaction_at
+		)
+		SELECT user_id, day, currency, SUM(sent), SUM(received), COUNT(*),
+			SUM(sent_count), SUM(received_count), SUM(fees), MAX(created_at AT TIME ZONE 'UTC')
+		FROM (
+			SELECT from_wallet_id AS user_id, (created_at AT TIME ZONE 'UTC')::date AS day, currency,
+				amount AS sent, 0 AS received, 1 AS sent_count, 0 AS received_count, fee AS fees, created_at
+			FROM recompute_events
+			WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT to_wallet_id, (created_at AT TIME ZONE 'UTC')::date, currency,
+				0, amount, 0, 1, 0, created_at
+			FROM recompute_events
+			WHERE to_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+		) legs
+		GROUP BY user_id, day, currency
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild user snapshots: %w", err)
+	}
+
+	hourlySnapshots, err := execCount(ctx, tx, `
+		INSERT INTO user_hourly_snapshots (
+			user_id, snapshot_hour, currency, total_sent, total_received, transaction_count,
+			sent_count, received_count, total_fees_paid, last_transaction_at
+		)
+		SELECT user_id, hour, currency, SUM(sent), SUM(received), COUNT(*),
+			SUM(sent_count), SUM(received_count), SUM(fees), MAX(created_at AT TIME ZONE 'UTC')
+		FROM (
+			SELECT from_wallet_id AS user_id, date_trunc('hour', created_at AT TIME ZONE 'UTC') AS hour, currency,
+				amount AS sent, 0 AS received, 1 AS sent_count, 0 AS received_count, fee AS fees, created_at
+			FROM recompute_events
+			WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT to_wallet_id, date_trunc('hour', created_at AT TIME ZONE 'UTC'), currency,
+				0, amount, 0, 1, 0, created_at
+			FROM recompute_events
+			WHERE to_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+		) legs
+		GROUP BY user_id, hour, currency
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild user hourly snapshots: %w", err)
+	}
+
+	// Failed transfers and fees are not in the ledger history: add them back
+	// from the processing log, like AddFailuresAndFees and ProcessFeeCharged
+	failures := []string{`
+		INSERT INTO daily_metrics (metric_date, currency, total_transactions, failed_transactions, total_fees)
+		SELECT ((event_data->>'created_at')::timestamptz AT TIME ZONE 'UTC')::date, event_data->>'currency',
+			COUNT(*) FILTER (WHERE event_type = $3), COUNT(*) FILTER (WHERE event_type = $3),
+			COALESCE(SUM((event_data->>'fee')::numeric) FILTER (WHERE event_type = $4), 0)
+		FROM event_processing_log
+		WHERE status = 'processed' AND event_type IN ($3, $4)
+			AND (event_data->>'created_at')::timestamptz >= $1 AND (event_data->>'created_at')::timestamptz < $2
+		GROUP BY 1, 2
+		ON CONFLICT (metric_date, currency) DO UPDATE SET
+			total_transactions = daily_metrics.total_transactions + EXCLUDED.total_transactions,
+			failed_transactions = daily_metrics.failed_transactions + EXCLUDED.failed_transactions,
+			total_fees = daily_metrics.total_fees + EXCLUDED.total_fees`,
+		`INSERT INTO hourly_metrics (metric_hour, currency, total_transactions, failed_transactions, total_fees)
+		SELECT date_trunc('hour', (event_data->>'created_at')::timestamptz AT TIME ZONE 'UTC'), event_data->>'currency',
+			COUNT(*) FILTER (WHERE event_type = $3), COUNT(*) FILTER (WHERE event_type = $3),
+			COALESCE(SUM((event_data->>'fee')::numeric) FILTER (WHERE event_type = $4), 0)
+		FROM event_processing_log
+		WHERE status = 'processed' AND event_type IN ($3, $4)
+			AND (event_data->>'created_at')::timestamptz >= $1 AND (event_data->>'created_at')::timestamptz < $2
+		GROUP BY 1, 2
+		ON CONFLICT (metric_hour, currency) DO UPDATE SET
+			total_transactions = hourly_metrics.total_transactions + EXCLUDED.total_transactions,
+			failed_transactions = hourly_metrics.failed_transactions + EXCLUDED.failed_transactions,
+			total_fees = hourly_metrics.total_fees + EXCLUDED.total_fees`,
+	}
+	for _, stmt := range failures {
+		if _, err := tx.ExecContext(ctx, stmt, start, end, kafka.EventTypeTransactionFailed, kafka.EventTypeFeeCharged); err != nil {
+			return fmt.Errorf("failed to add failures and fees: %w", err)
+		}
+	}
+
+	fees := []string{`
+		INSERT INTO user_snapshots (user_id, snapshot_date, currency, total_fees_paid)
+		SELECT event_data->>'wallet_id', ((event_data->>'created_at')::timestamptz AT TIME ZONE 'UTC')::date,
+			event_data->>'currency', SUM((event_data->>'fee')::numeric)
+		FROM event_processing_log
+		WHERE status = 'processed' AND event_type = $3 AND COALESCE(event_data->>'wallet_id', '') <> ''
+			AND (event_data->>'created_at')::timestamptz >= $1 AND (event_data->>'created_at')::timestamptz < $2
+		GROUP BY 1, 2, 3
+		ON CONFLICT (user_id, snapshot_date, currency) DO UPDATE SET
+			total_fees_paid = user_snapshots.total_fees_paid + EXCLUDED.total_fees_paid`,
+		`INSERT INTO user_hourly_snapshots (user_id, snapshot_hour, currency, total_fees_paid)
+		SELECT event_data->>'wallet_id', date_trunc('hour', (event_data->>'created_at')::timestamptz AT TIME ZONE 'UTC'),
+			event_data->>'currency', SUM((event_data->>'fee')::numeric)
+		FROM event_processing_log
+		WHERE status = 'processed' AND event_type = $3 AND COALESCE(event_data->>'wallet_id', '') <> ''
+			AND (event_data->>'created_at')::timestamptz >= $1 AND (event_data->>'created_at')::timestamptz < $2
+		GROUP BY 1, 2, 3
+		ON CONFLICT (user_id, snapshot_hour, currency) DO UPDATE SET
+			total_fees_paid = user_hourly_snapshots.total_fees_paid + EXCLUDED.total_fees_paid`,
+	}
+	for _, stmt := range fees {
+		if _, err := tx.ExecContext(ctx, stmt, start, end, kafka.EventTypeFeeCharged); err != nil {
+			return fmt.Errorf("failed to add fees paid: %w", err)
+		}
+	}
+
+	// Same split as updateEngagement: the entry type tells which side moved
+	counterparty, err := execCount(ctx, tx, `
+		INSERT INTO counterparty_daily (
+			activity_date, wallet_id, counterparty_wallet_id, currency,
+			total_sent, sent_count, total_received, received_count, last_transaction_at
+		)
+		SELECT (created_at AT TIME ZONE 'UTC')::date, from_wallet_id, to_wallet_id, currency,
+			COALESCE(SUM(amount) FILTER (WHERE event_data->>'transaction_type' = 'debit'), 0),
+			COUNT(*) FILTER (WHERE event_data->>'transaction_type' = 'debit'),
+			COALESCE(SUM(amount) FILTER (WHERE event_data->>'transaction_type' = 'credit'), 0),
+			COUNT(*) FILTER (WHERE event_data->>'transaction_type' = 'credit'),
+			MAX(created_at AT TIME ZONE 'UTC')
+		FROM recompute_events
+		WHERE from_wallet_id <> '' AND to_wallet_id <> ''
+			AND event_data->>'transaction_type' IN ('debit', 'credit')
+			AND created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2, 3, 4
+	`, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild counterparty activity: %w", err)
+	}
+
+	histograms, err := rebuildHistograms(ctx, tx, start, end)
+	if err != nil {
+		return err
+	}
+
+	// Activity only ever grows, so the range is added rather than replaced
+	activity := []string{
+		`INSERT INTO wallet_activity_days (activity_date, wallet_id)
+		SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date, from_wallet_id
+		FROM recompute_events
+		WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO cohort_activity (wallet_id, activity_month)
+		SELECT DISTINCT from_wallet_id, date_trunc('month', created_at AT TIME ZONE 'UTC')::date
+		FROM recompute_events
+		WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO wallet_cohorts (wallet_id, cohort_month, first_seen_at)
+		SELECT from_wallet_id, date_trunc('month', MIN(created_at) AT TIME ZONE 'UTC')::date,
+			MIN(created_at) AT TIME ZONE 'UTC'
+		FROM recompute_events
+		WHERE from_wallet_id <> '' AND created_at >= $1 AND created_at < $2
+		GROUP BY from_wallet_id
+		ON CONFLICT (wallet_id) DO UPDATE SET
+			cohort_month = EXCLUDED.cohort_month,
+			first_seen_at = EXCLUDED.first_seen_at
+		WHERE EXCLUDED.first_seen_at < wallet_cohorts.first_seen_at`,
+	}
+	for _, stmt := range activity {
+		if _, err := tx.ExecContext(ctx, stmt, start, end); err != nil {
+			return fmt.Errorf("failed to rebuild wallet activity: %w", err)
+		}
+	}
+
+	// Mark every event as processed so a lagging consumer does not count it again
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO event_processing_log (
+			event_id, event_type, topic, partition, "offset", event_data, status
+		)
+		SELECT event_id, 'ledger.entry_created', 'ledger.entry_created', partition, "offset", event_data, $3
+		FROM recompute_events
+		WHERE created_at >= $1 AND created_at < $2
+		ON CONFLICT (event_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			error_message = NULL,
+			processed_at = CURRENT_TIMESTAMP
+		WHERE event_processing_log.status <> $3
+	`, start, end, EventStatusProcessed); err != nil {
+		return fmt.Errorf("failed to mark events processed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit swap: %w", err)
+	}
+
+	r.update(job, func(j *RecomputeJob) {
+		j.EventsFromLog = fromLog
+		j.DailyRows = daily
+		j.HourlyRows = hourly
+		j.SnapshotRows = snapshots
+		j.HourlySnapshotRows = hourlySnapshots
+		j.CounterpartyRows = counterparty
+		j.HistogramRows = histograms
+	})
+	return nil
+}
+
+// invalidateCache drops every cached analytics response
+func (r *Recomputer) invalidateCache(ctx context.Context) {
+	iter := r.redis.Scan(ctx, 0, "analytics:*", 100).Iterator()
+	for iter.Next(ctx) {
+		r.redis.Del(ctx, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		r.logger.Warnf("Failed to invalidate analytics cache after recompute: %v", err)
+	}
+}
+
+// rebuildHistograms replaces the range's value and settlement histograms with
+// ones built from the staged events, bucketed like recordHistograms
+// NOTE: Analytics lag, end-to-end and processing time measure the live
+// consumer, not the events, so a replay cannot reproduce them; those
+// histograms keep what the consumer recorded.
+func rebuildHistograms(ctx context.Context, tx *sql.Tx, start, end time.Time) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM hourly_histograms
+		WHERE metric IN ($3, $4)
+			AND metric_hour >= ($1::timestamptz AT TIME ZONE 'UTC') AND metric_hour < ($2::timestamptz AT TIME ZONE 'UTC')
+	`, start, end, HistogramValue, HistogramSettlement); err != nil {
+		return 0, fmt.Errorf("failed to clear histograms: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT currency, amount, created_at, (event_data->>'initiated_at')::timestamptz
+		FROM recompute_events
+		WHERE created_at >= $1 AND created_at < $2
+	`, start, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read staged events: %w", err)
+	}
+
+	counts := make(map[histogramKey]int64)
+	for rows.Next() {
+		var currency string
+		var amount money.Amount
+		var createdAt time.Time
+		var initiatedAt sql.NullTime
+		if err := rows.Scan(&currency, &amount, &createdAt, &initiatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan staged event: %w", err)
+		}
+
+		hour := createdAt.UTC().Truncate(time.Hour)
+		counts[histogramKey{hour, currency, HistogramValue, sketch.Bucket(amount.Float64())}]++
+		if initiatedAt.Valid {
+			settlement := sketch.Bucket(millis(createdAt.Sub(initiatedAt.Time)))
+			counts[histogramKey{hour, currency, HistogramSettlement, settlement}]++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read staged events: %w", err)
+	}
+
+	// Inserted in batches of arrays; hours are sent as UTC wall-clock text
+	const batchSize = 1000
+	var inserted int64
+	keys := make([]histogramKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+
+		hours := make([]string, n)
+		currencies := make([]string, n)
+		metrics := make([]string, n)
+		buckets := make([]int64, n)
+		values := make([]int64, n)
+		for i, k := range keys[:n] {
+			hours[i] = k.hour.Format("2006-01-02 15:04:05")
+			currencies[i], metrics[i], buckets[i], values[i] = k.currency, k.metric, int64(k.bucket), counts[k]
+		}
+
+		added, err := execCount(ctx, tx, `
+			INSERT INTO hourly_histograms (metric_hour, currency, metric, bucket, count)
+			SELECT * FROM unnest($1::timestamp[], $2::varchar[], $3::varchar[], $4::integer[], $5::bigint[])
+		`, pq.Array(hours), pq.Array(currencies), pq.Array(metrics), pq.Array(buckets), pq.Array(values))
+		if err != nil {
+			return 0, fmt.Errorf("failed to rebuild histograms: %w", err)
+		}
+		inserted += added
+		keys = keys[n:]
+	}
+
+	return inserted, nil
+}
+
+// histogramKey identifies one hourly_histograms row
+type histogramKey struct {
+	hour     time.Time
+	currency string
+	metric   string
+	bucket   int
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecomputeHandler exposes recompute jobs to operators
+type RecomputeHandler struct {
+	recomputer *Recomputer
+}
+
+func NewRecomputeHandler(rc *Recomputer) *RecomputeHandler {
+	return &RecomputeHandler{recomputer: rc}
+}
+
+// RegisterInternalRoutes registers the recompute admin routes
+// NOTE: A recompute locks the aggregate tables, so it is mTLS only
+func (h *RecomputeHandler) RegisterInternalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/internal/analytics/recompute", h.StartRecompute)
+	mux.HandleFunc("GET /api/v1/internal/analytics/recompute/{id}", h.GetRecompute)
+}
+
+// StartRecompute handles POST /api/v1/internal/analytics/recompute?start_date=&end_date=
+func (h *RecomputeHandler) StartRecompute(w http.ResponseWriter, r *http.Request) {
+	startDate, err := time.Parse("2006-01-02", r.URL.Query().Get("start_date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "start_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", r.URL.Query().Get("end_date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_date_format", "end_date must be in YYYY-MM-DD format")
+		return
+	}
+
+	if endDate.Before(startDate) {
+		writeError(w, http.StatusBadRequest, "invalid_date_range", "end_date must be after start_date")
+		return
+	}
+
+	// The job outlives the request
+	id, err := h.recomputer.Start(context.WithoutCancel(r.Context()), startDate, endDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_parameters", err.Error())
+		return
+	}
+
+	job, _ := h.recomputer.Job(id)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// GetRecompute handles GET /api/v1/internal/analytics/recompute/{id}
+func (h *RecomputeHandler) GetRecompute(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.recomputer.Job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "recompute job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
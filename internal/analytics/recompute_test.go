@@ -0,0 +1,239 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+// ledgerMessage builds a replayed ledger.entry_created message
+func ledgerMessage(offset int64, eventID, walletID, entryType, counterparty, amount string, at time.Time) kafka.ReplayMessage {
+	key := "to_wallet_id"
+	if entryType == "credit" {
+		key = "from_wallet_id"
+	}
+	value := fmt.Sprintf(
+		`{"id":%q,"type":"ledger.entry_created","version":1,"payload":{"entry_id":%q,"transaction_id":"t-%s","wallet_id":%q,"entry_type":%q,"amount":%q,"currency":"USD","created_at":%q,"metadata":{%q:%q}}}`,
+		eventID, eventID, eventID, walletID, entryType, amount, at.Format(time.RFC3339), key, counterparty,
+	)
+	return kafka.ReplayMessage{Partition: 0, Offset: offset, Value: []byte(value), Time: at}
+}
+
+// logEvent writes a processing log row as the consumer would
+func logEvent(t *testing.T, conn *sql.DB, eventID, eventType, status string, event interface{}) {
+	data, err := MarshalEventData(event)
+	if err != nil {
+		t.Fatalf("MarshalEventData failed: %v", err)
+	}
+	_, err = conn.Exec(`
+		INSERT INTO event_processing_log (event_id, event_type, topic, partition, "offset", event_data, status)
+		VALUES ($1, $2, $2, 0, 0, $3, $4)
+	`, eventID, eventType, data, status)
+	if err != nil {
+		t.Fatalf("Failed to log event %s: %v", eventID, err)
+	}
+}
+
+// stageAndSwap stages msgs and swaps them in for [start, end) as a recompute does
+func stageAndSwap(t *testing.T, r *Recomputer, msgs []kafka.ReplayMessage, start, end time.Time) RecomputeJob {
+	ctx := context.Background()
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	defer conn.Close()
+
+	if err := createStagingTable(ctx, conn); err != nil {
+		t.Fatalf("createStagingTable failed: %v", err)
+	}
+	job, err := r.newJob(start, end.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("newJob failed: %v", err)
+	}
+	for _, msg := range msgs {
+		if err := r.stage(ctx, conn, job, msg, start, end); err != nil {
+			t.Fatalf("stage failed: %v", err)
+		}
+	}
+	if err := r.swap(ctx, conn, job, start, end); err != nil {
+		t.Fatalf("swap failed: %v", err)
+	}
+
+	snapshot, _ := r.Job(job.ID)
+	return snapshot
+}
+
+// aggregates dumps the rows a recompute replaces
+func aggregates(t *testing.T, conn *sql.DB) []string {
+	rows := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_date, currency, total_transactions, total_volume, total_fees,
+			unique_users, successful_transactions, failed_transactions)
+		FROM daily_metrics ORDER BY metric_date, currency`)
+	rows = append(rows, queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_hour, currency, total_transactions, total_volume, total_fees,
+			unique_users, max_transaction_value, min_transaction_value)
+		FROM hourly_metrics ORDER BY metric_hour, currency`)...)
+	rows = append(rows, queryStrings(t, conn, `
+		SELECT concat_ws('|', user_id, snapshot_date, currency, total_sent, total_received, transaction_count, total_fees_paid)
+		FROM user_snapshots ORDER BY user_id, snapshot_date, currency`)...)
+	return append(rows, queryStrings(t, conn, `
+		SELECT concat_ws('|', activity_date, wallet_id, counterparty_wallet_id, total_sent, total_received)
+		FROM counterparty_daily ORDER BY 1`)...)
+}
+
+func TestRecomputeSwap(t *testing.T) {
+	conn := testDB(t)
+	r := NewRecomputer(conn, nil, config.KafkaConfig{}, logger.New("test"))
+
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	at := start.Add(5 * time.Hour)
+
+	// Stale live rows for the range are replaced
+	if _, err := conn.Exec(`INSERT INTO daily_metrics (metric_date, currency, total_transactions, total_volume) VALUES ('2025-03-10', 'USD', 99, 999)`); err != nil {
+		t.Fatalf("Failed to insert stale row: %v", err)
+	}
+
+	// e3 was processed by the consumer but is no longer in Kafka; e4 is outside
+	// the range and e2 failed in the consumer earlier
+	logEvent(t, conn, "e3", kafka.EventTypeLedgerEntryCreated, EventStatusProcessed, &LedgerEntryCreatedEvent{
+		EventID: "e3", FromWalletID: "w3", ToWalletID: "w1", Amount: money.MustParse("5"), Fee: money.Zero(),
+		Currency: "USD", Status: TransactionStatusCompleted, TransactionType: "debit", CreatedAt: at.Add(time.Hour),
+	})
+	logEvent(t, conn, "e4", kafka.EventTypeLedgerEntryCreated, EventStatusProcessed, &LedgerEntryCreatedEvent{
+		EventID: "e4", FromWalletID: "w3", ToWalletID: "w1", Amount: money.MustParse("7"), Fee: money.Zero(),
+		Currency: "USD", Status: TransactionStatusCompleted, TransactionType: "debit", CreatedAt: end.Add(time.Hour),
+	})
+	logEvent(t, conn, "e2", kafka.EventTypeLedgerEntryCreated, EventStatusFailed, &LedgerEntryCreatedEvent{EventID: "e2"})
+
+	job := stageAndSwap(t, r, []kafka.ReplayMessage{
+		ledgerMessage(1, "e1", "w1", "debit", "w2", "10", at),
+		ledgerMessage(2, "e2", "w2", "credit", "w1", "10", at),
+		ledgerMessage(3, "e2", "w2", "credit", "w1", "10", at), // Redelivered
+		ledgerMessage(4, "e0", "w1", "debit", "w2", "10", start.Add(-time.Hour)),
+	}, start, end)
+
+	if job.EventsRead != 4 || job.EventsInRange != 2 || job.Duplicates != 1 || job.EventsFromLog != 1 {
+		t.Errorf("Unexpected job counts: %+v", job)
+	}
+
+	daily := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_date, currency, total_transactions, total_volume, unique_users)
+		FROM daily_metrics ORDER BY metric_date`)
+	if !reflect.DeepEqual(daily, []string{"2025-03-10|USD|3|25.0000|3"}) {
+		t.Errorf("Unexpected daily metrics: %v", daily)
+	}
+
+	// Every recomputed event is logged as processed, so the consumer and the
+	// retry worker skip them instead of counting them again
+	statuses := queryStrings(t, conn, `SELECT event_id || ':' || status FROM event_processing_log ORDER BY event_id`)
+	want := []string{"e1:processed", "e2:processed", "e3:processed", "e4:processed"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Processing log = %v, want %v", statuses, want)
+	}
+	logged, err := NewRepository(conn).GetEventLogByEventID(context.Background(), "e2")
+	if err != nil || logged == nil || logged.ErrorMessage != nil {
+		t.Errorf("Expected e2's failure to be cleared, got %+v, %v", logged, err)
+	}
+}
+
+func TestRecomputeSwapIsIdempotent(t *testing.T) {
+	conn := testDB(t)
+	r := NewRecomputer(conn, nil, config.KafkaConfig{}, logger.New("test"))
+
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	msgs := []kafka.ReplayMessage{
+		ledgerMessage(1, "e1", "w1", "debit", "w2", "10", start.Add(5*time.Hour)),
+		ledgerMessage(2, "e2", "w2", "credit", "w1", "10", start.Add(5*time.Hour)),
+		ledgerMessage(3, "e3", "w2", "debit", "w3", "2.5", start.Add(30*time.Hour)),
+		ledgerMessage(4, "e4", "w3", "credit", "w2", "2.5", start.Add(30*time.Hour)),
+	}
+
+	stageAndSwap(t, r, msgs, start, end)
+	first := aggregates(t, conn)
+	if len(first) == 0 {
+		t.Fatal("Expected the swap to write aggregates")
+	}
+
+	// The second run also sees the first run's events in the processing log
+	job := stageAndSwap(t, r, msgs, start, end)
+	if job.EventsFromLog != 0 {
+		t.Errorf("Expected logged events to be staged already, got %d from the log", job.EventsFromLog)
+	}
+	if second := aggregates(t, conn); !reflect.DeepEqual(first, second) {
+		t.Errorf("Second run changed the aggregates:\nfirst:  %v\nsecond: %v", first, second)
+	}
+}
+
+func TestRecomputeSwapKeepsFailuresAndFees(t *testing.T) {
+	conn := testDB(t)
+	r := NewRecomputer(conn, nil, config.KafkaConfig{}, logger.New("test"))
+
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	at := start.Add(5 * time.Hour)
+
+	// Failures and fees are only in the processing log
+	logEvent(t, conn, "f1", kafka.EventTypeTransactionFailed, EventStatusProcessed, &TransactionFailedEvent{
+		EventID: "f1", FromWalletID: "w1", ToWalletID: "w2", Amount: money.MustParse("10"),
+		Currency: "USD", Reason: "insufficient balance", CreatedAt: at,
+	})
+	logEvent(t, conn, "c1", kafka.EventTypeFeeCharged, EventStatusProcessed, &FeeChargedEvent{
+		EventID: "c1", WalletID: "w1", Fee: money.MustParse("0.5"), Currency: "USD", CreatedAt: at,
+	})
+	logEvent(t, conn, "c2", kafka.EventTypeFeeCharged, EventStatusProcessed, &FeeChargedEvent{
+		EventID: "c2", WalletID: "w1", Fee: money.MustParse("0.25"), Currency: "USD", CreatedAt: at.Add(2 * time.Hour),
+	})
+	logEvent(t, conn, "c3", kafka.EventTypeFeeCharged, EventStatusFailed, &FeeChargedEvent{
+		EventID: "c3", WalletID: "w1", Fee: money.MustParse("9"), Currency: "USD", CreatedAt: at,
+	})
+	logEvent(t, conn, "c4", kafka.EventTypeFeeCharged, EventStatusProcessed, &FeeChargedEvent{
+		EventID: "c4", WalletID: "w1", Fee: money.MustParse("9"), Currency: "USD", CreatedAt: end,
+	})
+
+	msgs := []kafka.ReplayMessage{
+		ledgerMessage(1, "e1", "w1", "debit", "w2", "10", at),
+		ledgerMessage(2, "e2", "w2", "credit", "w1", "10", at),
+	}
+
+	// Run twice: the failures and fees must not be added on top of themselves
+	for run := 1; run <= 2; run++ {
+		stageAndSwap(t, r, msgs, start, end)
+
+		daily := queryStrings(t, conn, `
+			SELECT concat_ws('|', metric_date, total_transactions, failed_transactions, total_volume, total_fees)
+			FROM daily_metrics`)
+		if !reflect.DeepEqual(daily, []string{"2025-03-10|3|1|20.0000|0.7500"}) {
+			t.Errorf("Run %d: unexpected daily metrics: %v", run, daily)
+		}
+
+		hourly := queryStrings(t, conn, `
+			SELECT concat_ws('|', metric_hour, total_transactions, failed_transactions, total_fees)
+			FROM hourly_metrics ORDER BY metric_hour`)
+		want := []string{"2025-03-10 05:00:00|3|1|0.5000", "2025-03-10 07:00:00|0|0|0.2500"}
+		if !reflect.DeepEqual(hourly, want) {
+			t.Errorf("Run %d: hourly metrics = %v, want %v", run, hourly, want)
+		}
+
+		fees := queryStrings(t, conn, `
+			SELECT concat_ws('|', user_id, total_fees_paid) FROM user_snapshots ORDER BY user_id`)
+		if !reflect.DeepEqual(fees, []string{"w1|0.7500", "w2|0.0000"}) {
+			t.Errorf("Run %d: unexpected fees paid: %v", run, fees)
+		}
+		hourlyFees := queryStrings(t, conn, `
+			SELECT concat_ws('|', user_id, snapshot_hour, total_fees_paid)
+			FROM user_hourly_snapshots WHERE total_fees_paid > 0 ORDER BY snapshot_hour`)
+		if !reflect.DeepEqual(hourlyFees, []string{"w1|2025-03-10 05:00:00|0.5000", "w1|2025-03-10 07:00:00|0.2500"}) {
+			t.Errorf("Run %d: unexpected hourly fees paid: %v", run, hourlyFees)
+		}
+	}
+}
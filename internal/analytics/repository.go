@@ -5,60 +5,116 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/lib/pq"
 )
 
 type Repository interface {
 	// Daily Metrics
 	UpsertDailyMetric(ctx context.Context, metric *DailyMetric) error
-	GetDailyMetrics(ctx context.Context, startDate, endDate time.Time) ([]*DailyMetric, error)
-	GetDailyMetricByDate(ctx context.Context, date time.Time) (*DailyMetric, error)
+	GetDailyMetrics(ctx context.Context, startDate, endDate time.Time, currency string) ([]*DailyMetric, error)
+	GetDailyMetricByDate(ctx context.Context, date time.Time, currency string) (*DailyMetric, error)
 
 	// Hourly Metrics
 	UpsertHourlyMetric(ctx context.Context, metric *HourlyMetric) error
-	GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time) ([]*HourlyMetric, error)
-	GetHourlyMetricByHour(ctx context.Context, hour time.Time) (*HourlyMetric, error)
+	AddFailuresAndFees(ctx context.Context, at time.Time, currency string, failed int64, fees money.Amount) error
+	GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HourlyMetric, error)
+	GetHourlyMetricByHour(ctx context.Context, hour time.Time, currency string) (*HourlyMetric, error)
+
+	// Hourly Histograms
+	// NOTE: buckets maps a histogram metric to the bucket of one observation
+	IncrementHistograms(ctx context.Context, hour time.Time, currency string, buckets map[string]int) error
+	GetHistogramBuckets(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HistogramBucket, error)
 
 	// User Snapshots
 	UpsertUserSnapshot(ctx context.Context, snapshot *UserSnapshot) error
-	GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time) ([]*UserSnapshot, error)
-	GetUserSnapshotByDate(ctx context.Context, userID string, date time.Time) (*UserSnapshot, error)
+	GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time, currency string) ([]*UserSnapshot, error)
+	GetUserSnapshotByDate(ctx context.Context, userID string, date time.Time, currency string) (*UserSnapshot, error)
+
+	// User Hourly Snapshots
+	// NOTE: SnapshotDate holds the UTC hour; rows roll up into local days
+	UpsertUserHourlySnapshot(ctx context.Context, snapshot *UserSnapshot) error
+	GetUserHourlySnapshots(ctx context.Context, userID string, startTime, endTime time.Time, currency string) ([]*UserSnapshot, error)
+
+	// Counterparties
+	UpsertCounterpartyActivity(ctx context.Context, activity *CounterpartyActivity) error
+	GetTopCounterparties(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency, direction string, limit int) ([]CounterpartyTotals, error)
+
+	// Wallet Activity (cohorts and DAU/MAU)
+	// NOTE: Recording the same activity again is a no-op
+	RecordWalletActivity(ctx context.Context, walletID string, at time.Time) error
+	GetCohortActivity(ctx context.Context, startMonth, endMonth time.Time) ([]*CohortActivity, error)
+	GetActiveUsers(ctx context.Context, startDate, endDate time.Time) ([]ActiveUsersPoint, error)
 
 	// Event Processing Log
-	CreateEventLog(ctx context.Context, log *EventProcessingLog) error
+	CreateEventLog(ctx context.Context, log *EventProcessingLog, fromKafka bool) (bool, error)
 	GetEventLogByEventID(ctx context.Context, eventID string) (*EventProcessingLog, error)
 	UpdateEventLogStatus(ctx context.Context, eventID, status string, errorMsg *string, retryCount int) error
 
 	// Analytics Queries
-	GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period string) (*MetricsSummaryResponse, error)
-	GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time) (*UserAnalyticsResponse, error)
+	// NOTE: An empty currency means all currencies
+	GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period, currency string) (*MetricsSummaryResponse, error)
+	GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time, currency string) (*UserAnalyticsResponse, error)
+	GetUserAnalyticsByHour(ctx context.Context, userID string, startTime, endTime time.Time, currency string) (*UserAnalyticsResponse, error)
+
+	// WithTx runs fn with a repository bound to one database transaction
+	WithTx(ctx context.Context, fn func(tx *sql.Tx, repo Repository) error) error
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type repository struct {
-	db *sql.DB
+	db   dbtx
+	conn *sql.DB
 }
 
 func NewRepository(db *sql.DB) Repository {
-	return &repository{db: db}
+	return &repository{db: db, conn: db}
+}
+
+// WithTx runs fn inside a transaction; it is rolled back if fn returns an error
+func (r *repository) WithTx(ctx context.Context, fn func(tx *sql.Tx, repo Repository) error) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx, &repository{db: tx, conn: r.conn}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 // UpsertDailyMetric creates or updates a daily metric record
 func (r *repository) UpsertDailyMetric(ctx context.Context, metric *DailyMetric) error {
 	query := `
 		INSERT INTO daily_metrics (
-			metric_date, total_transactions, total_volume, total_fees,
+			metric_date, currency, total_transactions, total_volume, total_fees,
 			unique_users, successful_transactions, failed_transactions, avg_transaction_value
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (metric_date) DO UPDATE SET
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (metric_date, currency) DO UPDATE SET
 			total_transactions = daily_metrics.total_transactions + EXCLUDED.total_transactions,
 			total_volume = daily_metrics.total_volume + EXCLUDED.total_volume,
 			total_fees = daily_metrics.total_fees + EXCLUDED.total_fees,
-			unique_users = EXCLUDED.unique_users,
+			unique_users = GREATEST(daily_metrics.unique_users, EXCLUDED.unique_users),
 			successful_transactions = daily_metrics.successful_transactions + EXCLUDED.successful_transactions,
 			failed_transactions = daily_metrics.failed_transactions + EXCLUDED.failed_transactions,
 			avg_transaction_value = CASE 
-				WHEN (daily_metrics.total_transactions + EXCLUDED.total_transactions) > 0 
-				THEN (daily_metrics.total_volume + EXCLUDED.total_volume) / (daily_metrics.total_transactions + EXCLUDED.total_transactions)
+				WHEN (daily_metrics.successful_transactions + EXCLUDED.successful_transactions) > 0 
+				THEN (daily_metrics.total_volume + EXCLUDED.total_volume) / (daily_metrics.successful_transactions + EXCLUDED.successful_transactions)
 				ELSE 0
 			END,
 			updated_at = CURRENT_TIMESTAMP
@@ -67,6 +123,7 @@ func (r *repository) UpsertDailyMetric(ctx context.Context, metric *DailyMetric)
 
 	err := r.db.QueryRowContext(ctx, query,
 		metric.MetricDate,
+		metric.Currency,
 		metric.TotalTransactions,
 		metric.TotalVolume,
 		metric.TotalFees,
@@ -84,17 +141,17 @@ func (r *repository) UpsertDailyMetric(ctx context.Context, metric *DailyMetric)
 }
 
 // GetDailyMetrics retrieves daily metrics within a date range
-func (r *repository) GetDailyMetrics(ctx context.Context, startDate, endDate time.Time) ([]*DailyMetric, error) {
+func (r *repository) GetDailyMetrics(ctx context.Context, startDate, endDate time.Time, currency string) ([]*DailyMetric, error) {
 	query := `
-		SELECT id, metric_date, total_transactions, total_volume, total_fees,
+		SELECT id, metric_date, currency, total_transactions, total_volume, total_fees,
 			   unique_users, successful_transactions, failed_transactions, 
 			   avg_transaction_value, created_at, updated_at
 		FROM daily_metrics
-		WHERE metric_date BETWEEN $1 AND $2
-		ORDER BY metric_date DESC
+		WHERE metric_date BETWEEN $1 AND $2 AND ($3 = '' OR currency = $3)
+		ORDER BY metric_date DESC, currency
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, startDate, endDate)
+	rows, err := r.db.QueryContext(ctx, query, startDate, endDate, currency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get daily metrics: %w", err)
 	}
@@ -104,7 +161,7 @@ func (r *repository) GetDailyMetrics(ctx context.Context, startDate, endDate tim
 	for rows.Next() {
 		var m DailyMetric
 		err := rows.Scan(
-			&m.ID, &m.MetricDate, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
+			&m.ID, &m.MetricDate, &m.Currency, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
 			&m.UniqueUsers, &m.SuccessfulTransactions, &m.FailedTransactions,
 			&m.AvgTransactionValue, &m.CreatedAt, &m.UpdatedAt,
 		)
@@ -118,18 +175,18 @@ func (r *repository) GetDailyMetrics(ctx context.Context, startDate, endDate tim
 }
 
 // GetDailyMetricByDate retrieves a specific daily metric
-func (r *repository) GetDailyMetricByDate(ctx context.Context, date time.Time) (*DailyMetric, error) {
+func (r *repository) GetDailyMetricByDate(ctx context.Context, date time.Time, currency string) (*DailyMetric, error) {
 	query := `
-		SELECT id, metric_date, total_transactions, total_volume, total_fees,
+		SELECT id, metric_date, currency, total_transactions, total_volume, total_fees,
 			   unique_users, successful_transactions, failed_transactions, 
 			   avg_transaction_value, created_at, updated_at
 		FROM daily_metrics
-		WHERE metric_date = $1
+		WHERE metric_date = $1 AND currency = $2
 	`
 
 	var m DailyMetric
-	err := r.db.QueryRowContext(ctx, query, date).Scan(
-		&m.ID, &m.MetricDate, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
+	err := r.db.QueryRowContext(ctx, query, date, currency).Scan(
+		&m.ID, &m.MetricDate, &m.Currency, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
 		&m.UniqueUsers, &m.SuccessfulTransactions, &m.FailedTransactions,
 		&m.AvgTransactionValue, &m.CreatedAt, &m.UpdatedAt,
 	)
@@ -144,28 +201,65 @@ func (r *repository) GetDailyMetricByDate(ctx context.Context, date time.Time) (
 	return &m, nil
 }
 
+// AddFailuresAndFees adds failed transfers and fees, which do not come from
+// ledger entries, to the metrics of at's day and hour
+// NOTE: A failed transfer counts towards total_transactions but adds no volume
+func (r *repository) AddFailuresAndFees(ctx context.Context, at time.Time, currency string, failed int64, fees money.Amount) error {
+	dailyQuery := `
+		INSERT INTO daily_metrics (metric_date, currency, total_transactions, failed_transactions, total_fees)
+		VALUES ($1, $2, $3, $3, $4)
+		ON CONFLICT (metric_date, currency) DO UPDATE SET
+			total_transactions = daily_metrics.total_transactions + EXCLUDED.total_transactions,
+			failed_transactions = daily_metrics.failed_transactions + EXCLUDED.failed_transactions,
+			total_fees = daily_metrics.total_fees + EXCLUDED.total_fees,
+			updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := r.db.ExecContext(ctx, dailyQuery, at.Truncate(24*time.Hour), currency, failed, fees); err != nil {
+		return fmt.Errorf("failed to add failures and fees to daily metric: %w", err)
+	}
+
+	hourlyQuery := `
+		INSERT INTO hourly_metrics (metric_hour, currency, total_transactions, failed_transactions, total_fees)
+		VALUES ($1, $2, $3, $3, $4)
+		ON CONFLICT (metric_hour, currency) DO UPDATE SET
+			total_transactions = hourly_metrics.total_transactions + EXCLUDED.total_transactions,
+			failed_transactions = hourly_metrics.failed_transactions + EXCLUDED.failed_transactions,
+			total_fees = hourly_metrics.total_fees + EXCLUDED.total_fees,
+			updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := r.db.ExecContext(ctx, hourlyQuery, at.Truncate(time.Hour), currency, failed, fees); err != nil {
+		return fmt.Errorf("failed to add failures and fees to hourly metric: %w", err)
+	}
+
+	return nil
+}
+
 // UpsertHourlyMetric creates or updates an hourly metric record
 func (r *repository) UpsertHourlyMetric(ctx context.Context, metric *HourlyMetric) error {
 	query := `
 		INSERT INTO hourly_metrics (
-			metric_hour, total_transactions, total_volume, total_fees,
+			metric_hour, currency, total_transactions, total_volume, total_fees,
 			unique_users, successful_transactions, failed_transactions, 
 			avg_transaction_value, max_transaction_value, min_transaction_value, avg_processing_time_ms
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (metric_hour) DO UPDATE SET
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (metric_hour, currency) DO UPDATE SET
 			total_transactions = hourly_metrics.total_transactions + EXCLUDED.total_transactions,
 			total_volume = hourly_metrics.total_volume + EXCLUDED.total_volume,
 			total_fees = hourly_metrics.total_fees + EXCLUDED.total_fees,
-			unique_users = EXCLUDED.unique_users,
+			unique_users = GREATEST(hourly_metrics.unique_users, EXCLUDED.unique_users),
 			successful_transactions = hourly_metrics.successful_transactions + EXCLUDED.successful_transactions,
 			failed_transactions = hourly_metrics.failed_transactions + EXCLUDED.failed_transactions,
 			avg_transaction_value = CASE 
-				WHEN (hourly_metrics.total_transactions + EXCLUDED.total_transactions) > 0 
-				THEN (hourly_metrics.total_volume + EXCLUDED.total_volume) / (hourly_metrics.total_transactions + EXCLUDED.total_transactions)
+				WHEN (hourly_metrics.successful_transactions + EXCLUDED.successful_transactions) > 0 
+				THEN (hourly_metrics.total_volume + EXCLUDED.total_volume) / (hourly_metrics.successful_transactions + EXCLUDED.successful_transactions)
 				ELSE 0
 			END,
 			max_transaction_value = GREATEST(hourly_metrics.max_transaction_value, EXCLUDED.max_transaction_value),
-			min_transaction_value = LEAST(hourly_metrics.min_transaction_value, EXCLUDED.min_transaction_value),
+			-- A row opened by a failure or fee holds no value yet
+			min_transaction_value = CASE
+				WHEN hourly_metrics.successful_transactions = 0 THEN EXCLUDED.min_transaction_value
+				ELSE LEAST(hourly_metrics.min_transaction_value, EXCLUDED.min_transaction_value)
+			END,
 			avg_processing_time_ms = ((hourly_metrics.avg_processing_time_ms * hourly_metrics.total_transactions) + 
 									 (EXCLUDED.avg_processing_time_ms * EXCLUDED.total_transactions)) / 
 									 (hourly_metrics.total_transactions + EXCLUDED.total_transactions),
@@ -175,6 +269,7 @@ func (r *repository) UpsertHourlyMetric(ctx context.Context, metric *HourlyMetri
 
 	err := r.db.QueryRowContext(ctx, query,
 		metric.MetricHour,
+		metric.Currency,
 		metric.TotalTransactions,
 		metric.TotalVolume,
 		metric.TotalFees,
@@ -195,18 +290,18 @@ func (r *repository) UpsertHourlyMetric(ctx context.Context, metric *HourlyMetri
 }
 
 // GetHourlyMetrics retrieves hourly metrics within a time range
-func (r *repository) GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time) ([]*HourlyMetric, error) {
+func (r *repository) GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HourlyMetric, error) {
 	query := `
-		SELECT id, metric_hour, total_transactions, total_volume, total_fees,
+		SELECT id, metric_hour, currency, total_transactions, total_volume, total_fees,
 			   unique_users, successful_transactions, failed_transactions, 
 			   avg_transaction_value, max_transaction_value, min_transaction_value,
 			   avg_processing_time_ms, created_at, updated_at
 		FROM hourly_metrics
-		WHERE metric_hour BETWEEN $1 AND $2
-		ORDER BY metric_hour DESC
+		WHERE metric_hour BETWEEN $1 AND $2 AND ($3 = '' OR currency = $3)
+		ORDER BY metric_hour DESC, currency
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, startTime, endTime)
+	rows, err := r.db.QueryContext(ctx, query, startTime, endTime, currency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hourly metrics: %w", err)
 	}
@@ -216,7 +311,7 @@ func (r *repository) GetHourlyMetrics(ctx context.Context, startTime, endTime ti
 	for rows.Next() {
 		var m HourlyMetric
 		err := rows.Scan(
-			&m.ID, &m.MetricHour, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
+			&m.ID, &m.MetricHour, &m.Currency, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
 			&m.UniqueUsers, &m.SuccessfulTransactions, &m.FailedTransactions,
 			&m.AvgTransactionValue, &m.MaxTransactionValue, &m.MinTransactionValue,
 			&m.AvgProcessingTimeMs, &m.CreatedAt, &m.UpdatedAt,
@@ -231,19 +326,19 @@ func (r *repository) GetHourlyMetrics(ctx context.Context, startTime, endTime ti
 }
 
 // GetHourlyMetricByHour retrieves a specific hourly metric
-func (r *repository) GetHourlyMetricByHour(ctx context.Context, hour time.Time) (*HourlyMetric, error) {
+func (r *repository) GetHourlyMetricByHour(ctx context.Context, hour time.Time, currency string) (*HourlyMetric, error) {
 	query := `
-		SELECT id, metric_hour, total_transactions, total_volume, total_fees,
+		SELECT id, metric_hour, currency, total_transactions, total_volume, total_fees,
 			   unique_users, successful_transactions, failed_transactions, 
 			   avg_transaction_value, max_transaction_value, min_transaction_value,
 			   avg_processing_time_ms, created_at, updated_at
 		FROM hourly_metrics
-		WHERE metric_hour = $1
+		WHERE metric_hour = $1 AND currency = $2
 	`
 
 	var m HourlyMetric
-	err := r.db.QueryRowContext(ctx, query, hour).Scan(
-		&m.ID, &m.MetricHour, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
+	err := r.db.QueryRowContext(ctx, query, hour, currency).Scan(
+		&m.ID, &m.MetricHour, &m.Currency, &m.TotalTransactions, &m.TotalVolume, &m.TotalFees,
 		&m.UniqueUsers, &m.SuccessfulTransactions, &m.FailedTransactions,
 		&m.AvgTransactionValue, &m.MaxTransactionValue, &m.MinTransactionValue,
 		&m.AvgProcessingTimeMs, &m.CreatedAt, &m.UpdatedAt,
@@ -259,14 +354,65 @@ func (r *repository) GetHourlyMetricByHour(ctx context.Context, hour time.Time)
 	return &m, nil
 }
 
+// IncrementHistograms counts one observation per metric in the hour's histograms
+func (r *repository) IncrementHistograms(ctx context.Context, hour time.Time, currency string, buckets map[string]int) error {
+	query := `
+		INSERT INTO hourly_histograms (metric_hour, currency, metric, bucket, count)
+		VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (metric_hour, currency, metric, bucket) DO UPDATE SET
+			count = hourly_histograms.count + 1
+	`
+
+	// Fixed order so concurrent consumers lock rows in the same order
+	metrics := make([]string, 0, len(buckets))
+	for metric := range buckets {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		if _, err := r.db.ExecContext(ctx, query, hour, currency, metric, buckets[metric]); err != nil {
+			return fmt.Errorf("failed to update %s histogram: %w", metric, err)
+		}
+	}
+	return nil
+}
+
+// GetHistogramBuckets sums histogram buckets over a time range
+func (r *repository) GetHistogramBuckets(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HistogramBucket, error) {
+	query := `
+		SELECT currency, metric, bucket, SUM(count)
+		FROM hourly_histograms
+		WHERE metric_hour BETWEEN $1 AND $2 AND ($3 = '' OR currency = $3)
+		GROUP BY currency, metric, bucket
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, startTime, endTime, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get histograms: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []*HistogramBucket
+	for rows.Next() {
+		var b HistogramBucket
+		if err := rows.Scan(&b.Currency, &b.Metric, &b.Bucket, &b.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan histogram bucket: %w", err)
+		}
+		buckets = append(buckets, &b)
+	}
+
+	return buckets, rows.Err()
+}
+
 // UpsertUserSnapshot creates or updates a user snapshot
 func (r *repository) UpsertUserSnapshot(ctx context.Context, snapshot *UserSnapshot) error {
 	query := `
 		INSERT INTO user_snapshots (
-			user_id, snapshot_date, total_sent, total_received, transaction_count,
+			user_id, snapshot_date, currency, total_sent, total_received, transaction_count,
 			sent_count, received_count, total_fees_paid, last_transaction_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		ON CONFLICT (user_id, snapshot_date) DO UPDATE SET
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id, snapshot_date, currency) DO UPDATE SET
 			total_sent = user_snapshots.total_sent + EXCLUDED.total_sent,
 			total_received = user_snapshots.total_received + EXCLUDED.total_received,
 			transaction_count = user_snapshots.transaction_count + EXCLUDED.transaction_count,
@@ -281,6 +427,7 @@ func (r *repository) UpsertUserSnapshot(ctx context.Context, snapshot *UserSnaps
 	err := r.db.QueryRowContext(ctx, query,
 		snapshot.UserID,
 		snapshot.SnapshotDate,
+		snapshot.Currency,
 		snapshot.TotalSent,
 		snapshot.TotalReceived,
 		snapshot.TransactionCount,
@@ -298,17 +445,17 @@ func (r *repository) UpsertUserSnapshot(ctx context.Context, snapshot *UserSnaps
 }
 
 // GetUserSnapshots retrieves user snapshots within a date range
-func (r *repository) GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time) ([]*UserSnapshot, error) {
+func (r *repository) GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time, currency string) ([]*UserSnapshot, error) {
 	query := `
-		SELECT id, user_id, snapshot_date, total_sent, total_received, transaction_count,
+		SELECT id, user_id, snapshot_date, currency, total_sent, total_received, transaction_count,
 			   sent_count, received_count, total_fees_paid, last_transaction_at,
 			   created_at, updated_at
 		FROM user_snapshots
-		WHERE user_id = $1 AND snapshot_date BETWEEN $2 AND $3
-		ORDER BY snapshot_date DESC
+		WHERE user_id = $1 AND snapshot_date BETWEEN $2 AND $3 AND ($4 = '' OR currency = $4)
+		ORDER BY snapshot_date DESC, currency
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID, startDate, endDate)
+	rows, err := r.db.QueryContext(ctx, query, userID, startDate, endDate, currency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user snapshots: %w", err)
 	}
@@ -318,7 +465,7 @@ func (r *repository) GetUserSnapshots(ctx context.Context, userID string, startD
 	for rows.Next() {
 		var s UserSnapshot
 		err := rows.Scan(
-			&s.ID, &s.UserID, &s.SnapshotDate, &s.TotalSent, &s.TotalReceived,
+			&s.ID, &s.UserID, &s.SnapshotDate, &s.Currency, &s.TotalSent, &s.TotalReceived,
 			&s.TransactionCount, &s.SentCount, &s.ReceivedCount, &s.TotalFeesPaid,
 			&s.LastTransactionAt, &s.CreatedAt, &s.UpdatedAt,
 		)
@@ -332,18 +479,18 @@ func (r *repository) GetUserSnapshots(ctx context.Context, userID string, startD
 }
 
 // GetUserSnapshotByDate retrieves a specific user snapshot
-func (r *repository) GetUserSnapshotByDate(ctx context.Context, userID string, date time.Time) (*UserSnapshot, error) {
+func (r *repository) GetUserSnapshotByDate(ctx context.Context, userID string, date time.Time, currency string) (*UserSnapshot, error) {
 	query := `
-		SELECT id, user_id, snapshot_date, total_sent, total_received, transaction_count,
+		SELECT id, user_id, snapshot_date, currency, total_sent, total_received, transaction_count,
 			   sent_count, received_count, total_fees_paid, last_transaction_at,
 			   created_at, updated_at
 		FROM user_snapshots
-		WHERE user_id = $1 AND snapshot_date = $2
+		WHERE user_id = $1 AND snapshot_date = $2 AND currency = $3
 	`
 
 	var s UserSnapshot
-	err := r.db.QueryRowContext(ctx, query, userID, date).Scan(
-		&s.ID, &s.UserID, &s.SnapshotDate, &s.TotalSent, &s.TotalReceived,
+	err := r.db.QueryRowContext(ctx, query, userID, date, currency).Scan(
+		&s.ID, &s.UserID, &s.SnapshotDate, &s.Currency, &s.TotalSent, &s.TotalReceived,
 		&s.TransactionCount, &s.SentCount, &s.ReceivedCount, &s.TotalFeesPaid,
 		&s.LastTransactionAt, &s.CreatedAt, &s.UpdatedAt,
 	)
@@ -358,12 +505,282 @@ func (r *repository) GetUserSnapshotByDate(ctx context.Context, userID string, d
 	return &s, nil
 }
 
-func (r *repository) CreateEventLog(ctx context.Context, log *EventProcessingLog) error {
+// UpsertUserHourlySnapshot creates or updates a user's snapshot for one hour
+func (r *repository) UpsertUserHourlySnapshot(ctx context.Context, snapshot *UserSnapshot) error {
+	query := `
+		INSERT INTO user_hourly_snapshots (
+			user_id, snapshot_hour, currency, total_sent, total_received, transaction_count,
+			sent_count, received_count, total_fees_paid, last_transaction_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id, snapshot_hour, currency) DO UPDATE SET
+			total_sent = user_hourly_snapshots.total_sent + EXCLUDED.total_sent,
+			total_received = user_hourly_snapshots.total_received + EXCLUDED.total_received,
+			transaction_count = user_hourly_snapshots.transaction_count + EXCLUDED.transaction_count,
+			sent_count = user_hourly_snapshots.sent_count + EXCLUDED.sent_count,
+			received_count = user_hourly_snapshots.received_count + EXCLUDED.received_count,
+			total_fees_paid = user_hourly_snapshots.total_fees_paid + EXCLUDED.total_fees_paid,
+			last_transaction_at = GREATEST(user_hourly_snapshots.last_transaction_at, EXCLUDED.last_transaction_at)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		snapshot.UserID,
+		snapshot.SnapshotDate,
+		snapshot.Currency,
+		snapshot.TotalSent,
+		snapshot.TotalReceived,
+		snapshot.TransactionCount,
+		snapshot.SentCount,
+		snapshot.ReceivedCount,
+		snapshot.TotalFeesPaid,
+		snapshot.LastTransactionAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert user hourly snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserHourlySnapshots retrieves a user's hourly snapshots within a time range
+func (r *repository) GetUserHourlySnapshots(ctx context.Context, userID string, startTime, endTime time.Time, currency string) ([]*UserSnapshot, error) {
+	query := `
+		SELECT user_id, snapshot_hour, currency, total_sent, total_received, transaction_count,
+			   sent_count, received_count, total_fees_paid, last_transaction_at
+		FROM user_hourly_snapshots
+		WHERE user_id = $1 AND snapshot_hour BETWEEN $2 AND $3 AND ($4 = '' OR currency = $4)
+		ORDER BY snapshot_hour DESC, currency
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, startTime, endTime, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user hourly snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*UserSnapshot
+	for rows.Next() {
+		var s UserSnapshot
+		err := rows.Scan(
+			&s.UserID, &s.SnapshotDate, &s.Currency, &s.TotalSent, &s.TotalReceived,
+			&s.TransactionCount, &s.SentCount, &s.ReceivedCount, &s.TotalFeesPaid,
+			&s.LastTransactionAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user hourly snapshot: %w", err)
+		}
+		snapshots = append(snapshots, &s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// UpsertCounterpartyActivity adds one ledger entry to a wallet's day with a counterparty
+func (r *repository) UpsertCounterpartyActivity(ctx context.Context, a *CounterpartyActivity) error {
+	query := `
+		INSERT INTO counterparty_daily (
+			activity_date, wallet_id, counterparty_wallet_id, currency,
+			total_sent, sent_count, total_received, received_count, last_transaction_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (activity_date, wallet_id, counterparty_wallet_id, currency) DO UPDATE SET
+			total_sent = counterparty_daily.total_sent + EXCLUDED.total_sent,
+			sent_count = counterparty_daily.sent_count + EXCLUDED.sent_count,
+			total_received = counterparty_daily.total_received + EXCLUDED.total_received,
+			received_count = counterparty_daily.received_count + EXCLUDED.received_count,
+			last_transaction_at = GREATEST(counterparty_daily.last_transaction_at, EXCLUDED.last_transaction_at)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		a.ActivityDate,
+		a.WalletID,
+		a.CounterpartyWalletID,
+		a.Currency,
+		a.TotalSent,
+		a.SentCount,
+		a.TotalReceived,
+		a.ReceivedCount,
+		a.LastTransactionAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert counterparty activity: %w", err)
+	}
+	return nil
+}
+
+// GetTopCounterparties returns the top counterparties of the wallets per
+// currency, ranked by the amount in direction
+// NOTE: Transfers between the wallets themselves are left out
+func (r *repository) GetTopCounterparties(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency, direction string, limit int) ([]CounterpartyTotals, error) {
+	rank, count := "total_sent DESC, sent_count DESC", "sent_count"
+	if direction == DirectionReceived {
+		rank, count = "total_received DESC, received_count DESC", "received_count"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT counterparty_wallet_id, currency, total_sent, sent_count,
+			total_received, received_count, last_transaction_at
+		FROM (
+			SELECT counterparty_wallet_id, currency, total_sent, sent_count,
+				total_received, received_count, last_transaction_at,
+				ROW_NUMBER() OVER (PARTITION BY currency ORDER BY %[1]s, counterparty_wallet_id) AS rank
+			FROM (
+				SELECT counterparty_wallet_id, currency,
+					SUM(total_sent) AS total_sent, SUM(sent_count) AS sent_count,
+					SUM(total_received) AS total_received, SUM(received_count) AS received_count,
+					MAX(last_transaction_at) AS last_transaction_at
+				FROM counterparty_daily
+				WHERE wallet_id = ANY($1) AND NOT counterparty_wallet_id = ANY($1)
+					AND activity_date BETWEEN $2 AND $3 AND ($4 = '' OR currency = $4)
+				GROUP BY counterparty_wallet_id, currency
+				HAVING SUM(%[2]s) > 0
+			) totals
+		) ranked
+		WHERE rank <= $5
+		ORDER BY currency, rank
+	`, rank, count)
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(walletIDs), startDate, endDate, currency, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top counterparties: %w", err)
+	}
+	defer rows.Close()
+
+	counterparties := []CounterpartyTotals{}
+	for rows.Next() {
+		var c CounterpartyTotals
+		err := rows.Scan(
+			&c.CounterpartyWalletID, &c.Currency, &c.TotalSent, &c.SentCount,
+			&c.TotalReceived, &c.ReceivedCount, &c.LastTransactionAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan counterparty: %w", err)
+		}
+		counterparties = append(counterparties, c)
+	}
+
+	return counterparties, rows.Err()
+}
+
+// RecordWalletActivity marks a wallet active on the day and month of at
+// NOTE: A wallet's cohort is its earliest active month, so events arriving
+// out of order can still move it back
+func (r *repository) RecordWalletActivity(ctx context.Context, walletID string, at time.Time) error {
+	day := at.UTC().Truncate(24 * time.Hour)
+	month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`
+			INSERT INTO wallet_activity_days (activity_date, wallet_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, []interface{}{day, walletID}},
+		{`
+			INSERT INTO cohort_activity (wallet_id, activity_month)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, []interface{}{walletID, month}},
+		{`
+			INSERT INTO wallet_cohorts (wallet_id, cohort_month, first_seen_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (wallet_id) DO UPDATE SET
+				cohort_month = EXCLUDED.cohort_month,
+				first_seen_at = EXCLUDED.first_seen_at
+			WHERE EXCLUDED.first_seen_at < wallet_cohorts.first_seen_at
+		`, []interface{}{walletID, month, at}},
+	}
+
+	for _, stmt := range statements {
+		if _, err := r.db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return fmt.Errorf("failed to record wallet activity: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetCohortActivity counts the active wallets of each cohort in the range per month
+func (r *repository) GetCohortActivity(ctx context.Context, startMonth, endMonth time.Time) ([]*CohortActivity, error) {
+	query := `
+		SELECT c.cohort_month, a.activity_month, COUNT(*)
+		FROM wallet_cohorts c
+		JOIN cohort_activity a ON a.wallet_id = c.wallet_id AND a.activity_month >= c.cohort_month
+		WHERE c.cohort_month BETWEEN $1 AND $2
+		GROUP BY c.cohort_month, a.activity_month
+		ORDER BY c.cohort_month, a.activity_month
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, startMonth, endMonth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cohort activity: %w", err)
+	}
+	defer rows.Close()
+
+	var activity []*CohortActivity
+	for rows.Next() {
+		var a CohortActivity
+		if err := rows.Scan(&a.CohortMonth, &a.ActivityMonth, &a.ActiveWallets); err != nil {
+			return nil, fmt.Errorf("failed to scan cohort activity: %w", err)
+		}
+		activity = append(activity, &a)
+	}
+
+	return activity, rows.Err()
+}
+
+// GetActiveUsers returns DAU and trailing 30-day MAU for every day in the range
+func (r *repository) GetActiveUsers(ctx context.Context, startDate, endDate time.Time) ([]ActiveUsersPoint, error) {
+	query := `
+		SELECT d::date,
+			(SELECT COUNT(*) FROM wallet_activity_days WHERE activity_date = d::date),
+			(SELECT COUNT(DISTINCT wallet_id) FROM wallet_activity_days
+				WHERE activity_date > d::date - 30 AND activity_date <= d::date)
+		FROM generate_series($1::date, $2::date, INTERVAL '1 day') d
+		ORDER BY 1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active users: %w", err)
+	}
+	defer rows.Close()
+
+	points := []ActiveUsersPoint{}
+	for rows.Next() {
+		var date time.Time
+		var p ActiveUsersPoint
+		if err := rows.Scan(&date, &p.DAU, &p.MAU); err != nil {
+			return nil, fmt.Errorf("failed to scan active users: %w", err)
+		}
+		p.Date = date.Format("2006-01-02")
+		if p.MAU > 0 {
+			p.Stickiness = float64(p.DAU) / float64(p.MAU)
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// CreateEventLog records how processing an event went
+// NOTE: Returns false if the event is already logged as processed. A failed
+// attempt's row is overwritten, a processed row is final. The Kafka position
+// is only replaced by another delivery; retries run without one.
+func (r *repository) CreateEventLog(ctx context.Context, log *EventProcessingLog, fromKafka bool) (bool, error) {
 	query := `
 		INSERT INTO event_processing_log (
 			event_id, event_type, topic, partition, "offset", event_data,
 			processed_at, processing_time_ms, status, error_message, retry_count
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (event_id) DO UPDATE SET
+			partition = CASE WHEN $12 THEN EXCLUDED.partition ELSE event_processing_log.partition END,
+			"offset" = CASE WHEN $12 THEN EXCLUDED."offset" ELSE event_processing_log."offset" END,
+			processed_at = EXCLUDED.processed_at,
+			processing_time_ms = EXCLUDED.processing_time_ms,
+			status = EXCLUDED.status,
+			error_message = EXCLUDED.error_message,
+			retry_count = event_processing_log.retry_count + 1
+		WHERE event_processing_log.status <> 'processed'
 		RETURNING id, created_at
 	`
 
@@ -379,13 +796,17 @@ func (r *repository) CreateEventLog(ctx context.Context, log *EventProcessingLog
 		log.Status,
 		log.ErrorMessage,
 		log.RetryCount,
+		fromKafka,
 	).Scan(&log.ID, &log.CreatedAt)
 
+	if err == sql.ErrNoRows {
+		return false, nil // Already processed
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create event log: %w", err)
+		return false, fmt.Errorf("failed to create event log: %w", err)
 	}
 
-	return nil
+	return true, nil
 }
 
 func (r *repository) GetEventLogByEventID(ctx context.Context, eventID string) (*EventProcessingLog, error) {
@@ -429,119 +850,143 @@ func (r *repository) UpdateEventLogStatus(ctx context.Context, eventID, status s
 	return nil
 }
 
-// GetMetricsSummary returns aggregated metrics summary
-func (r *repository) GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period string) (*MetricsSummaryResponse, error) {
-	var query string
-
+// GetMetricsSummary returns aggregated metrics summary, one volume per currency
+func (r *repository) GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period, currency string) (*MetricsSummaryResponse, error) {
+	table, column := "daily_metrics", "metric_date"
 	if period == "hourly" {
-		query = `
-			SELECT 
-				COALESCE(SUM(total_transactions), 0) as total_transactions,
-				COALESCE(SUM(total_volume), 0) as total_volume,
-				COALESCE(SUM(total_fees), 0) as total_fees,
-				COALESCE(MAX(unique_users), 0) as unique_users,
-				CASE 
-					WHEN SUM(total_transactions) > 0 
-					THEN (SUM(successful_transactions)::float / SUM(total_transactions)::float) * 100
-					ELSE 0
-				END as success_rate,
-				CASE 
-					WHEN SUM(total_transactions) > 0 
-					THEN SUM(total_volume) / SUM(total_transactions)
-					ELSE 0
-				END as avg_transaction_size
-			FROM hourly_metrics
-			WHERE metric_hour BETWEEN $1 AND $2
-		`
-	} else {
-		query = `
-			SELECT 
-				COALESCE(SUM(total_transactions), 0) as total_transactions,
-				COALESCE(SUM(total_volume), 0) as total_volume,
-				COALESCE(SUM(total_fees), 0) as total_fees,
-				COALESCE(MAX(unique_users), 0) as unique_users,
-				CASE 
-					WHEN SUM(total_transactions) > 0 
-					THEN (SUM(successful_transactions)::float / SUM(total_transactions)::float) * 100
-					ELSE 0
-				END as success_rate,
-				CASE 
-					WHEN SUM(total_transactions) > 0 
-					THEN SUM(total_volume) / SUM(total_transactions)
-					ELSE 0
-				END as avg_transaction_size
-			FROM daily_metrics
-			WHERE metric_date BETWEEN $1 AND $2
-		`
-	}
-
-	var summary MetricsSummaryResponse
-	err := r.db.QueryRowContext(ctx, query, startDate, endDate).Scan(
-		&summary.TotalTransactions,
-		&summary.TotalVolume,
-		&summary.TotalFees,
-		&summary.UniqueUsers,
-		&summary.SuccessRate,
-		&summary.AvgTransactionSize,
-	)
+		table, column = "hourly_metrics", "metric_hour"
+	}
 
+	query := fmt.Sprintf(`
+		SELECT 
+			currency,
+			SUM(total_transactions) as total_transactions,
+			SUM(total_volume) as total_volume,
+			SUM(total_fees) as total_fees,
+			SUM(successful_transactions) as successful_transactions,
+			SUM(failed_transactions) as failed_transactions,
+			MAX(unique_users) as unique_users,
+			CASE 
+				WHEN SUM(successful_transactions) > 0 
+				THEN ROUND(SUM(total_volume) / SUM(successful_transactions), 4)
+				ELSE 0
+			END as avg_transaction_size
+		FROM %s
+		WHERE %s BETWEEN $1 AND $2 AND ($3 = '' OR currency = $3)
+		GROUP BY currency
+		ORDER BY currency
+	`, table, column)
+
+	rows, err := r.db.QueryContext(ctx, query, startDate, endDate, currency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metrics summary: %w", err)
 	}
+	defer rows.Close()
+
+	summary := MetricsSummaryResponse{
+		Period:     period,
+		Currency:   currency,
+		ByCurrency: []CurrencySummary{},
+	}
+	var successful int64
+	for rows.Next() {
+		var c CurrencySummary
+		var succeeded, uniqueUsers int64
+		if err := rows.Scan(
+			&c.Currency,
+			&c.TotalTransactions,
+			&c.TotalVolume,
+			&c.TotalFees,
+			&succeeded,
+			&c.FailedTransactions,
+			&uniqueUsers,
+			&c.AvgTransactionSize,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan metrics summary: %w", err)
+		}
+
+		summary.ByCurrency = append(summary.ByCurrency, c)
+		summary.TotalTransactions += c.TotalTransactions
+		successful += succeeded
+		if uniqueUsers > summary.UniqueUsers {
+			summary.UniqueUsers = uniqueUsers
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get metrics summary: %w", err)
+	}
+
+	// Failed transfers count towards the total but add no volume
+	if summary.TotalTransactions > 0 {
+		summary.SuccessRate = float64(successful) / float64(summary.TotalTransactions) * 100
+	}
 
-	summary.Period = period
 	return &summary, nil
 }
 
-// GetUserAnalytics returns user-specific analytics
-func (r *repository) GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time) (*UserAnalyticsResponse, error) {
-	query := `
-		SELECT 
-			user_id,
-			COALESCE(SUM(total_sent), 0) as total_sent,
-			COALESCE(SUM(total_received), 0) as total_received,
-			COALESCE(SUM(transaction_count), 0) as transaction_count,
-			COALESCE(SUM(total_fees_paid), 0) as total_fees_paid,
-			MAX(last_transaction_at) as last_transaction_at
-		FROM user_snapshots
-		WHERE user_id = $1 AND snapshot_date BETWEEN $2 AND $3
-		GROUP BY user_id
-	`
+// GetUserAnalytics returns user-specific analytics, one total per currency
+func (r *repository) GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time, currency string) (*UserAnalyticsResponse, error) {
+	return r.userAnalytics(ctx, "user_snapshots", "snapshot_date", userID, startDate, endDate, currency)
+}
 
-	var analytics UserAnalyticsResponse
-	var lastTxAt sql.NullTime
+// GetUserAnalyticsByHour returns user-specific analytics over a range of UTC
+// hours, one total per currency
+func (r *repository) GetUserAnalyticsByHour(ctx context.Context, userID string, startTime, endTime time.Time, currency string) (*UserAnalyticsResponse, error) {
+	return r.userAnalytics(ctx, "user_hourly_snapshots", "snapshot_hour", userID, startTime, endTime, currency)
+}
 
-	err := r.db.QueryRowContext(ctx, query, userID, startDate, endDate).Scan(
-		&analytics.UserID,
-		&analytics.TotalSent,
-		&analytics.TotalReceived,
-		&analytics.TransactionCount,
-		&analytics.TotalFeesPaid,
-		&lastTxAt,
-	)
+func (r *repository) userAnalytics(ctx context.Context, table, column, userID string, startDate, endDate time.Time, currency string) (*UserAnalyticsResponse, error) {
+	query := fmt.Sprintf(`
+		SELECT 
+			currency,
+			SUM(total_sent) as total_sent,
+			SUM(total_received) as total_received,
+			SUM(transaction_count) as transaction_count,
+			SUM(total_fees_paid) as total_fees_paid,
+			MAX(last_transaction_at) as last_transaction_at
+		FROM %s
+		WHERE user_id = $1 AND %s BETWEEN $2 AND $3 AND ($4 = '' OR currency = $4)
+		GROUP BY currency
+		ORDER BY currency
+	`, table, column)
 
-	if err == sql.ErrNoRows {
-		// Return empty analytics for user with no data
-		return &UserAnalyticsResponse{
-			UserID:           userID,
-			Period:           fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
-			TotalSent:        0,
-			TotalReceived:    0,
-			NetAmount:        0,
-			TransactionCount: 0,
-			TotalFeesPaid:    0,
-		}, nil
-	}
+	rows, err := r.db.QueryContext(ctx, query, userID, startDate, endDate, currency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user analytics: %w", err)
 	}
+	defer rows.Close()
 
-	if lastTxAt.Valid {
-		analytics.LastTransactionAt = &lastTxAt.Time
+	analytics := UserAnalyticsResponse{
+		UserID:     userID,
+		Period:     fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
+		Currency:   currency,
+		ByCurrency: []UserCurrencyTotals{},
 	}
+	for rows.Next() {
+		var c UserCurrencyTotals
+		var lastTxAt sql.NullTime
+		if err := rows.Scan(
+			&c.Currency,
+			&c.TotalSent,
+			&c.TotalReceived,
+			&c.TransactionCount,
+			&c.TotalFeesPaid,
+			&lastTxAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user analytics: %w", err)
+		}
+		c.NetAmount = c.TotalReceived.Sub(c.TotalSent)
 
-	analytics.NetAmount = analytics.TotalReceived - analytics.TotalSent
-	analytics.Period = fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+		analytics.ByCurrency = append(analytics.ByCurrency, c)
+		analytics.TransactionCount += c.TransactionCount
+		if lastTxAt.Valid && (analytics.LastTransactionAt == nil || lastTxAt.Time.After(*analytics.LastTransactionAt)) {
+			t := lastTxAt.Time
+			analytics.LastTransactionAt = &t
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user analytics: %w", err)
+	}
 
 	return &analytics, nil
 }
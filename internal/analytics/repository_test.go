@@ -0,0 +1,112 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/db"
+)
+
+// testDB returns a connection to a fresh schema with the analytics migrations
+// applied, or skips when PostgreSQL is not available
+// NOTE: Only the "+goose Up" half of each migration is applied
+func testDB(t *testing.T) *sql.DB {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	cfg := config.DatabaseConfig{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", "5432"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "postgres"),
+		DBName:   getEnv("DB_NAME", "postgres"),
+	}
+
+	admin, err := sql.Open("postgres", db.DSN(cfg))
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+
+	schema := fmt.Sprintf("analytics_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	conn, err := sql.Open("postgres", db.DSN(cfg)+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if cleanup, err := sql.Open("postgres", db.DSN(cfg)); err == nil {
+			cleanup.Exec("DROP SCHEMA " + schema + " CASCADE")
+			cleanup.Close()
+		}
+	})
+
+	files, err := filepath.Glob("../../migrations/analytics/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Failed to find analytics migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		up := string(migration)
+		if _, after, ok := strings.Cut(up, "-- +goose Up"); ok {
+			up = after
+		}
+		if _, err := conn.Exec(up); err != nil {
+			t.Fatalf("Failed to apply %s: %v", file, err)
+		}
+	}
+
+	return conn
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// queryStrings returns the first column of every row
+func queryStrings(t *testing.T, conn *sql.DB, query string, args ...interface{}) []string {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	return values
+}
@@ -0,0 +1,454 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+// retryBatchSize is how many failed events one retry pass claims
+const retryBatchSize = 100
+
+// FailedEvent is an event processing log row that did not get processed
+type FailedEvent struct {
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Topic         string          `json:"topic"`
+	Partition     int             `json:"partition"`
+	Offset        int64           `json:"offset"`
+	Status        string          `json:"status"`
+	ErrorMessage  *string         `json:"error_message,omitempty"`
+	RetryCount    int             `json:"retry_count"`
+	LastAttemptAt time.Time       `json:"last_attempt_at"`
+	NextRetryAt   *time.Time      `json:"next_retry_at,omitempty"` // Only while the worker will still retry
+	CreatedAt     time.Time       `json:"created_at"`
+	EventData     json.RawMessage `json:"event_data,omitempty"`
+}
+
+// RetryWorker re-processes events that failed, from the event data stored in
+// event_processing_log
+// NOTE: An event becomes due again RetryBackoff after its last attempt,
+// doubled for every retry so far (up to RetryMaxBackoff). Once retry_count,
+// which also counts the consumer's own retries, reaches RetryMaxAttempts the
+// event is marked exhausted and left to an operator. Claimed rows are set to
+// retrying under FOR UPDATE SKIP LOCKED, so replicas may all run the worker.
+type RetryWorker struct {
+	db      *sql.DB
+	service Service
+	cfg     config.AnalyticsConfig
+	logger  *logger.Logger
+}
+
+func NewRetryWorker(db *sql.DB, service Service, cfg config.AnalyticsConfig, log *logger.Logger) *RetryWorker {
+	return &RetryWorker{
+		db:      db,
+		service: service,
+		cfg:     cfg,
+		logger:  log,
+	}
+}
+
+// Start retries due events every interval until ctx is done
+func (w *RetryWorker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RetryDue(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Errorf("Failed event retry pass failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RetryDue gives up on events out of attempts, then retries one batch of the
+// events whose backoff has elapsed
+func (w *RetryWorker) RetryDue(ctx context.Context) error {
+	exhausted, err := w.giveUp(ctx)
+	if err != nil {
+		return err
+	}
+	for _, eventID := range exhausted {
+		w.logger.Warnf("Giving up on event %s after %d attempts", eventID, w.cfg.RetryMaxAttempts)
+	}
+
+	events, err := w.claimDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	retried := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := w.retry(ctx, event); err != nil {
+			w.logger.Warnf("Retry %d of event %s failed: %v", event.RetryCount+1, event.EventID, err)
+			continue
+		}
+		retried++
+	}
+	if retried > 0 {
+		w.logger.Infof("Retried %d failed events", retried)
+	}
+
+	return nil
+}
+
+// giveUp marks failed events that are out of attempts as exhausted
+func (w *RetryWorker) giveUp(ctx context.Context) ([]string, error) {
+	rows, err := w.db.QueryContext(ctx, `
+		UPDATE event_processing_log
+		SET status = $1
+		WHERE status IN ($2, $3) AND retry_count >= $4
+		RETURNING event_id
+	`, EventStatusExhausted, EventStatusFailed, EventStatusRetrying, w.cfg.RetryMaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to give up on events: %w", err)
+	}
+	defer rows.Close()
+
+	var eventIDs []string
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("failed to scan event id: %w", err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	return eventIDs, rows.Err()
+}
+
+// claimDue marks a batch of due events as retrying and returns them
+// NOTE: processed_at is moved to the claim time, so an event left retrying by
+// a crashed worker becomes due again after the next backoff
+func (w *RetryWorker) claimDue(ctx context.Context) ([]*FailedEvent, error) {
+	rows, err := w.db.QueryContext(ctx, `
+		UPDATE event_processing_log
+		SET status = $1, processed_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id
+			FROM event_processing_log
+			WHERE status IN ($2, $1) AND retry_count < $3
+				AND processed_at + make_interval(secs => LEAST($4 * power(2, retry_count), $5)) <= CURRENT_TIMESTAMP
+			ORDER BY processed_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING event_id, event_type, topic, partition, "offset", status, error_message,
+			retry_count, processed_at, created_at, event_data
+	`, EventStatusRetrying, EventStatusFailed, w.cfg.RetryMaxAttempts,
+		w.cfg.RetryBackoff.Seconds(), w.cfg.RetryMaxBackoff.Seconds(), retryBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim failed events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*FailedEvent
+	for rows.Next() {
+		event, err := scanFailedEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// retry processes an event again from its stored data
+// NOTE: The Process methods log the outcome, bumping retry_count on failure;
+// an event processed meanwhile by a redelivery is left alone
+func (w *RetryWorker) retry(ctx context.Context, failed *FailedEvent) error {
+	if len(failed.EventData) == 0 {
+		return w.abandon(ctx, failed.EventID, "no event data stored")
+	}
+
+	switch failed.EventType {
+	case kafka.EventTypeTransactionFailed:
+		var event TransactionFailedEvent
+		if err := json.Unmarshal(failed.EventData, &event); err != nil {
+			return w.abandon(ctx, failed.EventID, fmt.Sprintf("failed to decode event data: %v", err))
+		}
+		event.EventID = failed.EventID
+		return w.service.ProcessTransactionFailed(ctx, &event)
+	case kafka.EventTypeFeeCharged:
+		var event FeeChargedEvent
+		if err := json.Unmarshal(failed.EventData, &event); err != nil {
+			return w.abandon(ctx, failed.EventID, fmt.Sprintf("failed to decode event data: %v", err))
+		}
+		event.EventID = failed.EventID
+		return w.service.ProcessFeeCharged(ctx, &event)
+	}
+
+	var event LedgerEntryCreatedEvent
+	if err := json.Unmarshal(failed.EventData, &event); err != nil {
+		return w.abandon(ctx, failed.EventID, fmt.Sprintf("failed to decode event data: %v", err))
+	}
+	if event.EventID == "" {
+		event.EventID = failed.EventID
+	}
+
+	return w.service.ProcessLedgerEntryCreated(ctx, &event)
+}
+
+// abandon marks an event that cannot be retried as exhausted
+func (w *RetryWorker) abandon(ctx context.Context, eventID, reason string) error {
+	if _, err := w.db.ExecContext(ctx, `
+		UPDATE event_processing_log
+		SET status = $2, error_message = $3
+		WHERE event_id = $1 AND status <> $4
+	`, eventID, EventStatusExhausted, reason, EventStatusProcessed); err != nil {
+		return fmt.Errorf("failed to give up on event: %w", err)
+	}
+	return fmt.Errorf("%s", reason)
+}
+
+// nextRetryAt returns when the worker will next retry event, nil if it will not
+func (w *RetryWorker) nextRetryAt(event *FailedEvent) *time.Time {
+	if event.Status != EventStatusFailed && event.Status != EventStatusRetrying {
+		return nil
+	}
+	if event.RetryCount >= w.cfg.RetryMaxAttempts {
+		return nil
+	}
+
+	delay := w.cfg.RetryBackoff
+	for i := 0; i < event.RetryCount && delay < w.cfg.RetryMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.cfg.RetryMaxBackoff {
+		delay = w.cfg.RetryMaxBackoff
+	}
+
+	next := event.LastAttemptAt.Add(delay)
+	return &next
+}
+
+// ListFailedEvents returns the most recent unprocessed events, optionally
+// filtered by status
+func (w *RetryWorker) ListFailedEvents(ctx context.Context, status string, limit int) ([]*FailedEvent, error) {
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT event_id, event_type, topic, partition, "offset", status, error_message,
+			retry_count, processed_at, created_at, event_data
+		FROM event_processing_log
+		WHERE status <> $1 AND ($2 = '' OR status = $2)
+		ORDER BY processed_at DESC, id DESC
+		LIMIT $3
+	`, EventStatusProcessed, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*FailedEvent{}
+	for rows.Next() {
+		event, err := scanFailedEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		event.NextRetryAt = w.nextRetryAt(event)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetFailedEvent returns an event's log row; nil if the event was never logged
+func (w *RetryWorker) GetFailedEvent(ctx context.Context, eventID string) (*FailedEvent, error) {
+	row := w.db.QueryRowContext(ctx, `
+		SELECT event_id, event_type, topic, partition, "offset", status, error_message,
+			retry_count, processed_at, created_at, event_data
+		FROM event_processing_log
+		WHERE event_id = $1
+	`, eventID)
+
+	event, err := scanFailedEvent(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.NextRetryAt = w.nextRetryAt(event)
+	return event, nil
+}
+
+// RetryNow re-processes an unprocessed event immediately, whatever its status
+// and attempts so far, and returns its log row afterwards
+func (w *RetryWorker) RetryNow(ctx context.Context, event *FailedEvent) (*FailedEvent, error) {
+	retryErr := w.retry(ctx, event)
+
+	updated, err := w.GetFailedEvent(ctx, event.EventID)
+	if err != nil {
+		return nil, err
+	}
+	return updated, retryErr
+}
+
+// SkipEvent sets an unprocessed event aside so it is no longer retried;
+// false if the event is unknown or already processed
+// NOTE: A later Kafka delivery of the event still processes it
+func (w *RetryWorker) SkipEvent(ctx context.Context, eventID string) (bool, error) {
+	res, err := w.db.ExecContext(ctx, `
+		UPDATE event_processing_log
+		SET status = $2
+		WHERE event_id = $1 AND status <> $3
+	`, eventID, EventStatusSkipped, EventStatusProcessed)
+	if err != nil {
+		return false, fmt.Errorf("failed to skip event: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to skip event: %w", err)
+	}
+	return n == 1, nil
+}
+
+func scanFailedEvent(row interface{ Scan(...interface{}) error }) (*FailedEvent, error) {
+	var event FailedEvent
+	var data []byte
+	err := row.Scan(
+		&event.EventID, &event.EventType, &event.Topic, &event.Partition, &event.Offset,
+		&event.Status, &event.ErrorMessage, &event.RetryCount, &event.LastAttemptAt,
+		&event.CreatedAt, &data,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan event log: %w", err)
+	}
+	if len(data) > 0 {
+		event.EventData = json.RawMessage(data)
+	}
+	return &event, nil
+}
+
+// RetryHandler exposes failed events to operators
+type RetryHandler struct {
+	worker *RetryWorker
+}
+
+func NewRetryHandler(w *RetryWorker) *RetryHandler {
+	return &RetryHandler{worker: w}
+}
+
+// RegisterInternalRoutes registers the failed event admin routes
+// NOTE: Operator actions, so they are mTLS only
+func (h *RetryHandler) RegisterInternalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/internal/analytics/failed-events", h.ListFailedEvents)
+	mux.HandleFunc("POST /api/v1/internal/analytics/failed-events/{event_id}/retry", h.RetryEvent)
+	mux.HandleFunc("POST /api/v1/internal/analytics/failed-events/{event_id}/skip", h.SkipEvent)
+}
+
+// ListFailedEvents handles GET /api/v1/internal/analytics/failed-events?status=&limit=
+func (h *RetryHandler) ListFailedEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	switch status {
+	case "", EventStatusFailed, EventStatusRetrying, EventStatusExhausted, EventStatusSkipped:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_status", "status must be failed, retrying, exhausted or skipped")
+		return
+	}
+
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.worker.ListFailedEvents(r.Context(), status, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list failed events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"total":  len(events),
+	})
+}
+
+// RetryEvent handles POST /api/v1/internal/analytics/failed-events/{event_id}/retry
+func (h *RetryHandler) RetryEvent(w http.ResponseWriter, r *http.Request) {
+	event, ok := h.unprocessedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.worker.RetryNow(r.Context(), event)
+	if updated == nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to retry event")
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":   "retry_failed",
+			"message": err.Error(),
+			"event":   updated,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// SkipEvent handles POST /api/v1/internal/analytics/failed-events/{event_id}/skip
+func (h *RetryHandler) SkipEvent(w http.ResponseWriter, r *http.Request) {
+	event, ok := h.unprocessedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	skipped, err := h.worker.SkipEvent(r.Context(), event.EventID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to skip event")
+		return
+	}
+	if !skipped {
+		writeError(w, http.StatusConflict, "already_processed", "event has already been processed")
+		return
+	}
+
+	event.Status = EventStatusSkipped
+	event.NextRetryAt = nil
+	writeJSON(w, http.StatusOK, event)
+}
+
+// unprocessedEvent loads the path's event, writing an error response if it is
+// unknown or already processed
+func (h *RetryHandler) unprocessedEvent(w http.ResponseWriter, r *http.Request) (*FailedEvent, bool) {
+	event, err := h.worker.GetFailedEvent(r.Context(), r.PathValue("event_id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch event")
+		return nil, false
+	}
+	if event == nil {
+		writeError(w, http.StatusNotFound, "not_found", "event not found")
+		return nil, false
+	}
+	if event.Status == EventStatusProcessed {
+		writeError(w, http.StatusConflict, "already_processed", "event has already been processed")
+		return nil, false
+	}
+	return event, true
+}
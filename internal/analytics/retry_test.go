@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+)
+
+func TestNextRetryAt(t *testing.T) {
+	w := &RetryWorker{cfg: config.AnalyticsConfig{
+		RetryBackoff:     time.Minute,
+		RetryMaxBackoff:  10 * time.Minute,
+		RetryMaxAttempts: 8,
+	}}
+	last := time.Date(2025, 3, 10, 5, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		status     string
+		retryCount int
+		want       time.Duration // From the last attempt; 0 means no retry
+	}{
+		{"first retry", EventStatusFailed, 0, time.Minute},
+		{"doubles per retry", EventStatusFailed, 1, 2 * time.Minute},
+		{"still doubling", EventStatusRetrying, 3, 8 * time.Minute},
+		{"capped", EventStatusFailed, 4, 10 * time.Minute},
+		{"stays capped", EventStatusFailed, 7, 10 * time.Minute},
+		{"out of attempts", EventStatusFailed, 8, 0},
+		{"exhausted", EventStatusExhausted, 2, 0},
+		{"skipped", EventStatusSkipped, 2, 0},
+		{"processed", EventStatusProcessed, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := w.nextRetryAt(&FailedEvent{Status: tt.status, RetryCount: tt.retryCount, LastAttemptAt: last})
+
+			switch {
+			case tt.want == 0 && got != nil:
+				t.Errorf("Expected no retry, got %v", got)
+			case tt.want != 0 && (got == nil || !got.Equal(last.Add(tt.want))):
+				t.Errorf("nextRetryAt() = %v, want %v", got, last.Add(tt.want))
+			}
+		})
+	}
+}
@@ -18,10 +18,15 @@ func SetupRoutes(mux *http.ServeMux, handler *Handler, jwtSecret string) {
 	mux.Handle("GET /api/v1/analytics/daily", protected(http.HandlerFunc(handler.GetDailyMetrics)))
 	mux.Handle("GET /api/v1/analytics/hourly", protected(http.HandlerFunc(handler.GetHourlyMetrics)))
 	mux.Handle("GET /api/v1/analytics/summary", protected(http.HandlerFunc(handler.GetMetricsSummary)))
+	mux.Handle("GET /api/v1/analytics/percentiles", protected(http.HandlerFunc(handler.GetPercentiles)))
+	mux.Handle("GET /api/v1/analytics/cohorts", protected(http.HandlerFunc(handler.GetCohorts)))
+	mux.Handle("GET /api/v1/analytics/active-users", protected(http.HandlerFunc(handler.GetActiveUsers)))
+	mux.Handle("GET /api/v1/analytics/rollup", protected(http.HandlerFunc(handler.GetRollup)))
 	
 	// Protected - user-specific analytics (NO {user_id} in path - extracted from JWT)
 	mux.Handle("GET /api/v1/analytics/me", protected(http.HandlerFunc(handler.GetUserAnalytics)))
 	mux.Handle("GET /api/v1/analytics/me/snapshots", protected(http.HandlerFunc(handler.GetUserSnapshots)))
+	mux.Handle("GET /api/v1/analytics/me/counterparties", protected(http.HandlerFunc(handler.GetTopCounterparties)))
 }
 
 // SetupInternalRoutes - INTERNAL API (mTLS only, NO JWT needed)
@@ -2,81 +2,146 @@ package analytics
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/money"
 	"github.com/kmassidik/mercuria/internal/common/redis"
+	"github.com/kmassidik/mercuria/internal/common/sketch"
 )
 
 type Service interface {
 	// Event Processing
 	ProcessLedgerEntryCreated(ctx context.Context, event *LedgerEntryCreatedEvent) error
 	ProcessKafkaEvent(ctx context.Context, value []byte) error
+	ProcessTransactionFailed(ctx context.Context, event *TransactionFailedEvent) error
+	ProcessFeeCharged(ctx context.Context, event *FeeChargedEvent) error
+	ProcessTransactionEvent(ctx context.Context, value []byte) error
 	IsEventProcessed(ctx context.Context, eventID string) (bool, error)
 
 	// Metrics Retrieval
-	GetDailyMetrics(ctx context.Context, startDate, endDate time.Time) ([]*DailyMetric, error)
-	GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time) ([]*HourlyMetric, error)
-	GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period string) (*MetricsSummaryResponse, error)
+	// NOTE: currency filters to one currency; "" returns every currency. Dates
+	// are calendar days in loc; days outside UTC are rolled up from hourly rows.
+	GetDailyMetrics(ctx context.Context, startDate, endDate time.Time, currency string, loc *time.Location) ([]*DailyMetric, error)
+	GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HourlyMetric, error)
+	GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period, currency string, loc *time.Location) (*MetricsSummaryResponse, error)
+	GetRollup(ctx context.Context, startDate, endDate time.Time, interval, currency string, loc *time.Location) (*RollupResponse, error)
+	GetPercentiles(ctx context.Context, startTime, endTime time.Time, currency string) (*PercentilesResponse, error)
 
 	// User Analytics
-	GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time) (*UserAnalyticsResponse, error)
-	GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time) ([]*UserSnapshot, error)
+	GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time, currency string) (*UserAnalyticsResponse, error)
+	GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time, currency string) ([]*UserSnapshot, error)
 
-	GetUserAnalyticsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time) (*UserAnalyticsResponse, error)
-	GetUserSnapshotsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time) ([]*UserSnapshot, error)
+	GetUserAnalyticsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency string, loc *time.Location) (*UserAnalyticsResponse, error)
+	GetUserSnapshotsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency string, loc *time.Location) ([]*UserSnapshot, error)
+	GetTopCounterparties(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency, direction string, limit int) (*CounterpartiesResponse, error)
+
+	// Engagement
+	GetCohorts(ctx context.Context, startMonth, endMonth time.Time) (*CohortsResponse, error)
+	GetActiveUsers(ctx context.Context, startDate, endDate time.Time) ([]ActiveUsersPoint, error)
 }
 
 type service struct {
-	repo  Repository
-	redis *redis.Client
+	repo    Repository
+	redis   *redis.Client
+	users   *uniqueUsers
+	offsets *kafka.OffsetStore // nil unless KAFKA_DB_OFFSETS is enabled
+	rates   *RateTable         // nil unless ANALYTICS_REPORTING_CURRENCY is set
 }
 
-func NewService(repo Repository, redisClient *redis.Client) Service {
+// NewService creates the analytics service
+// NOTE: offsets may be nil; when set, consumed offsets are stored in the same
+// transaction as the metric updates. rates may be nil; when set, summaries
+// include a total converted to the reporting currency.
+func NewService(repo Repository, redisClient *redis.Client, offsets *kafka.OffsetStore, rates *RateTable) Service {
 	return &service{
-		repo:  repo,
-		redis: redisClient,
+		repo:    repo,
+		redis:   redisClient,
+		users:   newUniqueUsers(redisClient),
+		offsets: offsets,
+		rates:   rates,
 	}
 }
 
+// errAlreadyProcessed rolls back a transaction that lost the race to log an event
+var errAlreadyProcessed = errors.New("event already processed")
+
 // ProcessKafkaEvent processes incoming Kafka events
 func (s *service) ProcessKafkaEvent(ctx context.Context, value []byte) error {
-	// Parse the ledger event from Kafka
-	var event struct {
-		EventID       string                 `json:"event_id"`
-		EntryID       string                 `json:"entry_id"`
-		TransactionID string                 `json:"transaction_id"`
-		WalletID      string                 `json:"wallet_id"`
-		EntryType     string                 `json:"entry_type"`
-		Amount        string                 `json:"amount"`
-		Currency      string                 `json:"currency"`
-		Balance       string                 `json:"balance"`
-		CreatedAt     string                 `json:"created_at"`
-		Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	ledgerEvent, err := decodeLedgerEvent(value)
+	if err != nil {
+		return err
+	}
+
+	// Process the event
+	return s.ProcessLedgerEntryCreated(ctx, ledgerEvent)
+}
+
+// decodeLedgerEvent converts a ledger.entry_created message into the event
+// the aggregations work on
+func decodeLedgerEvent(value []byte) (*LedgerEntryCreatedEvent, error) {
+	// Parse the ledger event envelope from Kafka
+	// Decode failures cannot be fixed by retrying: dead-letter them directly
+	env, err := kafka.DecodeEnvelope(value)
+	if err != nil {
+		return nil, kafka.Permanent(fmt.Errorf("failed to decode ledger event: %w", err))
 	}
 
-	if err := json.Unmarshal(value, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal ledger event: %w", err)
+	var event kafka.LedgerEntryCreated
+	if err := env.Decode(&event); err != nil {
+		return nil, kafka.Permanent(fmt.Errorf("failed to decode ledger event: %w", err))
+	}
+
+	// Envelope id is stable across outbox retries; legacy payloads without
+	// an event_id fall back to the entry id
+	eventID := env.ID
+	if eventID == "" {
+		eventID = event.EntryID
+	}
+
+	amount, err := money.Parse(event.Amount)
+	if err != nil {
+		return nil, kafka.Permanent(fmt.Errorf("invalid ledger event amount: %w", err))
+	}
+
+	// Legacy payloads without a currency are kept apart from real currencies
+	currency := event.Currency
+	if currency == "" {
+		currency = UnknownCurrency
+	}
+
+	// Set by the ledger from transaction.completed initiated_at
+	var initiatedAt *time.Time
+	if v, ok := event.Metadata["transaction_initiated_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			initiatedAt = &t
+		}
 	}
 
 	// Convert to LedgerEntryCreatedEvent
-	ledgerEvent := &LedgerEntryCreatedEvent{
-		EventID:         event.EventID,
+	return &LedgerEntryCreatedEvent{
+		EventID:         eventID,
 		LedgerID:        event.EntryID,
 		TransactionID:   event.TransactionID,
 		FromWalletID:    event.WalletID,
 		ToWalletID:      getToWalletID(event.EntryType, event.Metadata),
-		Amount:          parseAmount(event.Amount),
-		Fee:             0,
+		Amount:          amount,
+		Fee:             money.Zero(),
+		Currency:        currency,
 		Status:          TransactionStatusCompleted,
 		TransactionType: event.EntryType,
-		CreatedAt:       parseTime(event.CreatedAt),
+		CreatedAt:       event.CreatedAt,
+		InitiatedAt:     initiatedAt,
 		Metadata:        event.Metadata,
-	}
-
-	// Process the event
-	return s.ProcessLedgerEntryCreated(ctx, ledgerEvent)
+	}, nil
 }
 
 // Helper to get opposite wallet from metadata
@@ -94,67 +159,105 @@ func getToWalletID(entryType string, metadata map[string]interface{}) string {
 	return ""
 }
 
-// Helper to parse amount string to float64
-func parseAmount(amount string) float64 {
-	var result float64
-	fmt.Sscanf(amount, "%f", &result)
-	return result
-}
+// ProcessLedgerEntryCreated processes a ledger entry created event
+func (s *service) ProcessLedgerEntryCreated(ctx context.Context, event *LedgerEntryCreatedEvent) error {
+	startTime := time.Now()
+
+	applied, err := s.processOnce(ctx, event.EventID, kafka.EventTypeLedgerEntryCreated, event, func(repo Repository) error {
+		// Process the event and update metrics
+		if err := s.processEvent(ctx, repo, event); err != nil {
+			return err
+		}
+		return s.recordHistograms(ctx, repo, event, time.Since(startTime))
+	})
+	if err != nil || !applied {
+		return err
+	}
+
+	// Invalidate Redis cache for affected date
+	if err := s.invalidateCacheForDate(ctx, event.CreatedAt); err != nil {
+		// Log but don't fail - cache invalidation is not critical
+		fmt.Printf("Warning: failed to invalidate cache: %v\n", err)
+	}
 
-// Helper to parse time string
-func parseTime(timeStr string) time.Time {
-	t, _ := time.Parse(time.RFC3339, timeStr)
-	return t
+	// Live streams are best effort; clients resync from the hourly metrics
+	if err := publishStreamEntry(ctx, s.redis, event); err != nil {
+		fmt.Printf("Warning: failed to publish stream entry: %v\n", err)
+	}
+
+	return nil
 }
 
-// ProcessLedgerEntryCreated processes a ledger entry created event
-func (s *service) ProcessLedgerEntryCreated(ctx context.Context, event *LedgerEntryCreatedEvent) error {
+// processOnce runs apply for an event that has not been processed yet and
+// reports whether this call applied it
+// NOTE: apply's updates, the processing log entry and (optionally) the consumer
+// offset commit in one transaction, so an event is counted exactly once. A
+// failure is logged with the event data for the retry worker.
+func (s *service) processOnce(ctx context.Context, eventID, eventType string, event interface{}, apply func(repo Repository) error) (bool, error) {
 	startTime := time.Now()
 
 	// Check idempotency - have we processed this event before?
-	processed, err := s.IsEventProcessed(ctx, event.EventID)
+	processed, err := s.IsEventProcessed(ctx, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to check event processing status: %w", err)
+		return false, fmt.Errorf("failed to check event processing status: %w", err)
 	}
 	if processed {
-		return nil // Already processed, skip
+		return false, nil // Already processed, skip
 	}
 
 	// Marshal event data for storage
 	eventData, err := MarshalEventData(event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event data: %w", err)
-	}
+		return false, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	applied := false
+	err = s.repo.WithTx(ctx, func(tx *sql.Tx, repo Repository) error {
+		if s.offsets != nil {
+			claimed, err := s.offsets.ClaimTx(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return nil // Offset already stored - applied before
+			}
+		}
 
-	// Process the event and update metrics
-	if err := s.processEvent(ctx, event); err != nil {
-		// Log failed processing
+		if err := apply(repo); err != nil {
+			return err
+		}
+
+		// Log successful processing; a concurrent delivery that logged first wins
 		processingTime := int(time.Since(startTime).Milliseconds())
-		errMsg := err.Error()
-		logErr := s.logEventProcessing(ctx, event, eventData, processingTime, EventStatusFailed, &errMsg, 0)
-		if logErr != nil {
-			return fmt.Errorf("failed to log event processing error: %w (original error: %v)", logErr, err)
+		logged, err := s.logEventProcessing(ctx, repo, eventID, eventType, eventData, processingTime, EventStatusProcessed, nil, 0)
+		if err != nil {
+			return fmt.Errorf("failed to log event processing: %w", err)
+		}
+		if !logged {
+			return errAlreadyProcessed
 		}
-		return err
-	}
 
-	// Log successful processing
-	processingTime := int(time.Since(startTime).Milliseconds())
-	if err := s.logEventProcessing(ctx, event, eventData, processingTime, EventStatusProcessed, nil, 0); err != nil {
-		return fmt.Errorf("failed to log event processing: %w", err)
+		applied = true
+		return nil
+	})
+	if errors.Is(err, errAlreadyProcessed) {
+		return false, nil
 	}
-
-	// Invalidate Redis cache for affected date
-	if err := s.invalidateCacheForDate(ctx, event.CreatedAt); err != nil {
-		// Log but don't fail - cache invalidation is not critical
-		fmt.Printf("Warning: failed to invalidate cache: %v\n", err)
+	if err != nil {
+		// Log failed processing outside the rolled-back transaction
+		processingTime := int(time.Since(startTime).Milliseconds())
+		errMsg := err.Error()
+		if _, logErr := s.logEventProcessing(ctx, s.repo, eventID, eventType, eventData, processingTime, EventStatusFailed, &errMsg, 0); logErr != nil {
+			return false, fmt.Errorf("failed to log event processing error: %w (original error: %v)", logErr, err)
+		}
+		return false, err
 	}
 
-	return nil
+	return applied, nil
 }
 
 // processEvent performs the actual metric aggregation
-func (s *service) processEvent(ctx context.Context, event *LedgerEntryCreatedEvent) error {
+func (s *service) processEvent(ctx context.Context, repo Repository, event *LedgerEntryCreatedEvent) error {
 	txDate := event.CreatedAt.Truncate(24 * time.Hour)
 	txHour := event.CreatedAt.Truncate(time.Hour)
 
@@ -168,29 +271,35 @@ func (s *service) processEvent(ctx context.Context, event *LedgerEntryCreatedEve
 		failCount = 1
 	}
 
+	// Distinct users so far in this hour and day; the upserts keep the larger
+	// count so a Redis outage never lowers a stored value
+	hourUsers, dayUsers := s.countUniqueUsers(ctx, event, txHour, txDate)
+
 	// Update daily metrics
 	dailyMetric := &DailyMetric{
 		MetricDate:             txDate,
+		Currency:               event.Currency,
 		TotalTransactions:      1,
 		TotalVolume:            event.Amount,
 		TotalFees:              event.Fee,
-		UniqueUsers:            1, // Will be calculated properly in aggregation
+		UniqueUsers:            dayUsers,
 		SuccessfulTransactions: successCount,
 		FailedTransactions:     failCount,
 		AvgTransactionValue:    event.Amount,
 	}
 
-	if err := s.repo.UpsertDailyMetric(ctx, dailyMetric); err != nil {
+	if err := repo.UpsertDailyMetric(ctx, dailyMetric); err != nil {
 		return fmt.Errorf("failed to update daily metric: %w", err)
 	}
 
 	// Update hourly metrics
 	hourlyMetric := &HourlyMetric{
 		MetricHour:             txHour,
+		Currency:               event.Currency,
 		TotalTransactions:      1,
 		TotalVolume:            event.Amount,
 		TotalFees:              event.Fee,
-		UniqueUsers:            1,
+		UniqueUsers:            hourUsers,
 		SuccessfulTransactions: successCount,
 		FailedTransactions:     failCount,
 		AvgTransactionValue:    event.Amount,
@@ -199,20 +308,109 @@ func (s *service) processEvent(ctx context.Context, event *LedgerEntryCreatedEve
 		AvgProcessingTimeMs:    0, // Could be extracted from metadata
 	}
 
-	if err := s.repo.UpsertHourlyMetric(ctx, hourlyMetric); err != nil {
+	if err := repo.UpsertHourlyMetric(ctx, hourlyMetric); err != nil {
 		return fmt.Errorf("failed to update hourly metric: %w", err)
 	}
 
 	// Update user snapshots for both sender and receiver
-	if err := s.updateUserSnapshot(ctx, event, txDate); err != nil {
+	if err := s.updateUserSnapshot(ctx, repo, event, txDate); err != nil {
 		return fmt.Errorf("failed to update user snapshots: %w", err)
 	}
 
+	if err := s.updateEngagement(ctx, repo, event, txDate); err != nil {
+		return fmt.Errorf("failed to update engagement: %w", err)
+	}
+
 	return nil
 }
 
+// updateEngagement records the entry's wallet as active and adds the entry to
+// its counterparty totals
+// NOTE: Every ledger entry belongs to FromWalletID; ToWalletID is the other
+// side (the payee of a debit, the payer of a credit)
+func (s *service) updateEngagement(ctx context.Context, repo Repository, event *LedgerEntryCreatedEvent, activityDate time.Time) error {
+	if event.FromWalletID == "" {
+		return nil
+	}
+
+	if err := repo.RecordWalletActivity(ctx, event.FromWalletID, event.CreatedAt); err != nil {
+		return err
+	}
+
+	if event.ToWalletID == "" {
+		return nil
+	}
+
+	activity := &CounterpartyActivity{
+		ActivityDate:         activityDate,
+		WalletID:             event.FromWalletID,
+		CounterpartyWalletID: event.ToWalletID,
+		Currency:             event.Currency,
+		TotalSent:            money.Zero(),
+		TotalReceived:        money.Zero(),
+		LastTransactionAt:    event.CreatedAt,
+	}
+	switch event.TransactionType {
+	case "debit":
+		activity.TotalSent, activity.SentCount = event.Amount, 1
+	case "credit":
+		activity.TotalReceived, activity.ReceivedCount = event.Amount, 1
+	default:
+		return nil
+	}
+
+	return repo.UpsertCounterpartyActivity(ctx, activity)
+}
+
+// recordHistograms adds the event's value and latencies to its hour's histograms
+// NOTE: Settlement and end-to-end latency need the initiation time, which
+// events from before it was published do not carry
+func (s *service) recordHistograms(ctx context.Context, repo Repository, event *LedgerEntryCreatedEvent, processing time.Duration) error {
+	now := time.Now()
+	buckets := map[string]int{
+		HistogramValue:        sketch.Bucket(event.Amount.Float64()),
+		HistogramAnalyticsLag: sketch.Bucket(millis(now.Sub(event.CreatedAt))),
+		HistogramProcessing:   sketch.Bucket(millis(processing)),
+	}
+	if event.InitiatedAt != nil {
+		buckets[HistogramSettlement] = sketch.Bucket(millis(event.CreatedAt.Sub(*event.InitiatedAt)))
+		buckets[HistogramEndToEnd] = sketch.Bucket(millis(now.Sub(*event.InitiatedAt)))
+	}
+
+	if err := repo.IncrementHistograms(ctx, event.CreatedAt.Truncate(time.Hour), event.Currency, buckets); err != nil {
+		return fmt.Errorf("failed to update histograms: %w", err)
+	}
+	return nil
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// countUniqueUsers records the sender and returns the distinct users of the
+// event's hour and day, falling back to 1 when Redis is unavailable
+func (s *service) countUniqueUsers(ctx context.Context, event *LedgerEntryCreatedEvent, hour, day time.Time) (int64, int64) {
+	if event.FromWalletID == "" {
+		return 1, 1
+	}
+
+	currencies := []string{event.Currency}
+	err := s.users.Add(ctx, userVisit{Currency: event.Currency, UserID: event.FromWalletID, At: event.CreatedAt})
+	if err == nil {
+		var hourUsers, dayUsers int64
+		if hourUsers, err = s.users.Count(ctx, currencies, hour, hour); err == nil {
+			if dayUsers, err = s.users.Count(ctx, currencies, day, day.Add(23*time.Hour)); err == nil {
+				return hourUsers, dayUsers
+			}
+		}
+	}
+
+	fmt.Printf("Warning: failed to count unique users: %v\n", err)
+	return 1, 1
+}
+
 // updateUserSnapshot updates snapshots for both sender and receiver
-func (s *service) updateUserSnapshot(ctx context.Context, event *LedgerEntryCreatedEvent, snapshotDate time.Time) error {
+func (s *service) updateUserSnapshot(ctx context.Context, repo Repository, event *LedgerEntryCreatedEvent, snapshotDate time.Time) error {
 	// Extract user IDs from wallet IDs (assuming wallet ID contains user info)
 	// In a real system, you'd query the wallet service to get user IDs
 	// For now, we'll use wallet IDs as proxy for user IDs
@@ -224,8 +422,9 @@ func (s *service) updateUserSnapshot(ctx context.Context, event *LedgerEntryCrea
 		senderSnapshot := &UserSnapshot{
 			UserID:            fromUserID,
 			SnapshotDate:      snapshotDate,
+			Currency:          event.Currency,
 			TotalSent:         event.Amount,
-			TotalReceived:     0,
+			TotalReceived:     money.Zero(),
 			TransactionCount:  1,
 			SentCount:         1,
 			ReceivedCount:     0,
@@ -233,7 +432,10 @@ func (s *service) updateUserSnapshot(ctx context.Context, event *LedgerEntryCrea
 			LastTransactionAt: &event.CreatedAt,
 		}
 
-		if err := s.repo.UpsertUserSnapshot(ctx, senderSnapshot); err != nil {
+		if err := repo.UpsertUserSnapshot(ctx, senderSnapshot); err != nil {
+			return fmt.Errorf("failed to update sender snapshot: %w", err)
+		}
+		if err := upsertUserHourlySnapshot(ctx, repo, senderSnapshot, event.CreatedAt); err != nil {
 			return fmt.Errorf("failed to update sender snapshot: %w", err)
 		}
 	}
@@ -243,16 +445,20 @@ func (s *service) updateUserSnapshot(ctx context.Context, event *LedgerEntryCrea
 		receiverSnapshot := &UserSnapshot{
 			UserID:            toUserID,
 			SnapshotDate:      snapshotDate,
-			TotalSent:         0,
+			Currency:          event.Currency,
+			TotalSent:         money.Zero(),
 			TotalReceived:     event.Amount,
 			TransactionCount:  1,
 			SentCount:         0,
 			ReceivedCount:     1,
-			TotalFeesPaid:     0,
+			TotalFeesPaid:     money.Zero(),
 			LastTransactionAt: &event.CreatedAt,
 		}
 
-		if err := s.repo.UpsertUserSnapshot(ctx, receiverSnapshot); err != nil {
+		if err := repo.UpsertUserSnapshot(ctx, receiverSnapshot); err != nil {
+			return fmt.Errorf("failed to update receiver snapshot: %w", err)
+		}
+		if err := upsertUserHourlySnapshot(ctx, repo, receiverSnapshot, event.CreatedAt); err != nil {
 			return fmt.Errorf("failed to update receiver snapshot: %w", err)
 		}
 	}
@@ -260,14 +466,26 @@ func (s *service) updateUserSnapshot(ctx context.Context, event *LedgerEntryCrea
 	return nil
 }
 
+// upsertUserHourlySnapshot adds a daily snapshot delta to the hour of at, so
+// the user's days can be rolled up in any timezone
+func upsertUserHourlySnapshot(ctx context.Context, repo Repository, daily *UserSnapshot, at time.Time) error {
+	hourly := *daily
+	hourly.SnapshotDate = at.UTC().Truncate(time.Hour)
+	return repo.UpsertUserHourlySnapshot(ctx, &hourly)
+}
+
 // logEventProcessing creates an event processing log entry
-func (s *service) logEventProcessing(ctx context.Context, event *LedgerEntryCreatedEvent, eventData []byte, processingTimeMs int, status string, errorMsg *string, retryCount int) error {
+// NOTE: Event types share their topic's name
+func (s *service) logEventProcessing(ctx context.Context, repo Repository, eventID, eventType string, eventData []byte, processingTimeMs int, status string, errorMsg *string, retryCount int) (bool, error) {
+	// Partition and offset are known when called from the Kafka consumer
+	pos, fromKafka := kafka.PositionFromContext(ctx)
+
 	log := &EventProcessingLog{
-		EventID:          event.EventID,
-		EventType:        "ledger.entry_created",
-		Topic:            "ledger.entry_created",
-		Partition:        0, // Will be set by Kafka consumer
-		Offset:           0, // Will be set by Kafka consumer
+		EventID:          eventID,
+		EventType:        eventType,
+		Topic:            eventType,
+		Partition:        pos.Partition,
+		Offset:           pos.Offset,
 		EventData:        eventData,
 		ProcessedAt:      time.Now(),
 		ProcessingTimeMs: processingTimeMs,
@@ -276,7 +494,7 @@ func (s *service) logEventProcessing(ctx context.Context, event *LedgerEntryCrea
 		RetryCount:       retryCount,
 	}
 
-	return s.repo.CreateEventLog(ctx, log)
+	return repo.CreateEventLog(ctx, log, fromKafka)
 }
 
 // IsEventProcessed checks if an event has already been processed (idempotency)
@@ -285,13 +503,18 @@ func (s *service) IsEventProcessed(ctx context.Context, eventID string) (bool, e
 	if err != nil {
 		return false, err
 	}
-	return log != nil, nil
+	// A failed attempt is retried, not treated as done
+	return log != nil && log.Status == EventStatusProcessed, nil
 }
 
 // GetDailyMetrics retrieves daily metrics with caching
-func (s *service) GetDailyMetrics(ctx context.Context, startDate, endDate time.Time) ([]*DailyMetric, error) {
+func (s *service) GetDailyMetrics(ctx context.Context, startDate, endDate time.Time, currency string, loc *time.Location) ([]*DailyMetric, error) {
+	if !isUTC(loc) {
+		return s.getLocalDailyMetrics(ctx, startDate, endDate, currency, loc)
+	}
+
 	// Try cache first
-	cacheKey := fmt.Sprintf("analytics:daily:%s:%s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	cacheKey := fmt.Sprintf("analytics:daily:%s:%s:%s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), cacheCurrency(currency))
 	cached, err := s.redis.Get(ctx, cacheKey).Result()
 	if err == nil {
 		var metrics []*DailyMetric
@@ -301,7 +524,7 @@ func (s *service) GetDailyMetrics(ctx context.Context, startDate, endDate time.T
 	}
 
 	// Fetch from database
-	metrics, err := s.repo.GetDailyMetrics(ctx, startDate, endDate)
+	metrics, err := s.repo.GetDailyMetrics(ctx, startDate, endDate, currency)
 	if err != nil {
 		return nil, err
 	}
@@ -314,20 +537,184 @@ func (s *service) GetDailyMetrics(ctx context.Context, startDate, endDate time.T
 	return metrics, nil
 }
 
+// getLocalDailyMetrics rolls hourly metrics up into the days of loc
+// NOTE: Not cached; cache invalidation works on UTC dates
+func (s *service) getLocalDailyMetrics(ctx context.Context, startDate, endDate time.Time, currency string, loc *time.Location) ([]*DailyMetric, error) {
+	rollup, err := s.rollup(ctx, startDate, endDate, IntervalDay, currency, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*DailyMetric, 0, len(rollup))
+	for _, r := range rollup {
+		day, _ := time.Parse("2006-01-02", r.PeriodStart)
+		metrics = append(metrics, &DailyMetric{
+			MetricDate:             day,
+			Currency:               r.Currency,
+			TotalTransactions:      r.TotalTransactions,
+			TotalVolume:            r.TotalVolume,
+			TotalFees:              r.TotalFees,
+			UniqueUsers:            r.UniqueUsers,
+			SuccessfulTransactions: r.SuccessfulTransactions,
+			FailedTransactions:     r.FailedTransactions,
+			AvgTransactionValue:    r.AvgTransactionValue,
+		})
+	}
+	// Newest day first, like the daily table
+	sort.Slice(metrics, func(i, j int) bool {
+		if !metrics[i].MetricDate.Equal(metrics[j].MetricDate) {
+			return metrics[i].MetricDate.After(metrics[j].MetricDate)
+		}
+		return metrics[i].Currency < metrics[j].Currency
+	})
+
+	return metrics, nil
+}
+
+// GetRollup sums hourly metrics into the days, weeks or months of loc
+func (s *service) GetRollup(ctx context.Context, startDate, endDate time.Time, interval, currency string, loc *time.Location) (*RollupResponse, error) {
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		return nil, fmt.Errorf("invalid interval: must be 'day', 'week' or 'month'")
+	}
+
+	metrics, err := s.rollup(ctx, startDate, endDate, interval, currency, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollupResponse{
+		Interval:  interval,
+		Timezone:  loc.String(),
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+		Currency:  currency,
+		Metrics:   metrics,
+	}, nil
+}
+
+// rollup sums the hourly metrics of the local days startDate..endDate into
+// periods and counts each period's unique users from the sketches
+// NOTE: Periods at the edges only cover the days in range
+func (s *service) rollup(ctx context.Context, startDate, endDate time.Time, interval, currency string, loc *time.Location) ([]*RollupMetric, error) {
+	from, last := localHours(startDate, endDate, loc)
+	hourly, err := s.repo.GetHourlyMetrics(ctx, from, last, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	rollup := rollupHourly(hourly, loc, interval)
+	for _, r := range rollup {
+		period, _ := time.Parse("2006-01-02", r.PeriodStart)
+		periodFrom, periodLast := localHours(period, nextPeriod(period, interval).AddDate(0, 0, -1), loc)
+		if periodFrom.Before(from) {
+			periodFrom = from
+		}
+		if periodLast.After(last) {
+			periodLast = last
+		}
+
+		users, err := s.users.Count(ctx, []string{r.Currency}, periodFrom, periodLast)
+		if err != nil {
+			// Keep the hourly maximum as a lower bound
+			fmt.Printf("Warning: failed to count unique users: %v\n", err)
+			break
+		}
+		if users > 0 {
+			r.UniqueUsers = users
+		}
+	}
+
+	return rollup, nil
+}
+
 // GetHourlyMetrics retrieves hourly metrics
-func (s *service) GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time) ([]*HourlyMetric, error) {
-	return s.repo.GetHourlyMetrics(ctx, startTime, endTime)
+func (s *service) GetHourlyMetrics(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HourlyMetric, error) {
+	return s.repo.GetHourlyMetrics(ctx, startTime, endTime, currency)
+}
+
+// GetPercentiles merges the hourly histograms of a time range
+func (s *service) GetPercentiles(ctx context.Context, startTime, endTime time.Time, currency string) (*PercentilesResponse, error) {
+	buckets, err := s.repo.GetHistogramBuckets(ctx, startTime, endTime, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values only merge within a currency; latencies merge across currencies
+	values := make(map[string]*sketch.Histogram)
+	latencies := map[string]*sketch.Histogram{
+		HistogramSettlement:   {},
+		HistogramAnalyticsLag: {},
+		HistogramEndToEnd:     {},
+		HistogramProcessing:   {},
+	}
+	for _, b := range buckets {
+		if b.Metric == HistogramValue {
+			if values[b.Currency] == nil {
+				values[b.Currency] = &sketch.Histogram{}
+			}
+			values[b.Currency].AddBucket(b.Bucket, b.Count)
+		} else if h, ok := latencies[b.Metric]; ok {
+			h.AddBucket(b.Bucket, b.Count)
+		}
+	}
+
+	result := &PercentilesResponse{
+		StartTime:        startTime,
+		EndTime:          endTime,
+		Currency:         currency,
+		TransactionValue: []ValuePercentiles{},
+		LatencyMs:        make(map[string]LatencyPercentiles),
+	}
+	for code, h := range values {
+		result.TransactionValue = append(result.TransactionValue, ValuePercentiles{
+			Currency: code,
+			Count:    h.Count(),
+			P50:      quantileAmount(h, 0.5),
+			P90:      quantileAmount(h, 0.9),
+			P99:      quantileAmount(h, 0.99),
+		})
+	}
+	sort.Slice(result.TransactionValue, func(i, j int) bool {
+		return result.TransactionValue[i].Currency < result.TransactionValue[j].Currency
+	})
+	for metric, h := range latencies {
+		result.LatencyMs[strings.TrimSuffix(metric, "_ms")] = LatencyPercentiles{
+			Count: h.Count(),
+			P50:   quantileMillis(h, 0.5),
+			P90:   quantileMillis(h, 0.9),
+			P99:   quantileMillis(h, 0.99),
+		}
+	}
+
+	return result, nil
+}
+
+// quantileAmount rounds a value quantile to an amount
+func quantileAmount(h *sketch.Histogram, q float64) money.Amount {
+	amount, err := money.Parse(strconv.FormatFloat(h.Quantile(q), 'f', money.Scale, 64))
+	if err != nil {
+		return money.Zero()
+	}
+	return amount
+}
+
+// quantileMillis rounds a latency quantile to 0.1ms
+func quantileMillis(h *sketch.Histogram, q float64) float64 {
+	return math.Round(h.Quantile(q)*10) / 10
 }
 
 // GetMetricsSummary retrieves aggregated metrics summary
-func (s *service) GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period string) (*MetricsSummaryResponse, error) {
+func (s *service) GetMetricsSummary(ctx context.Context, startDate, endDate time.Time, period, currency string, loc *time.Location) (*MetricsSummaryResponse, error) {
 	// Validate period
 	if period != "daily" && period != "hourly" {
 		return nil, fmt.Errorf("invalid period: must be 'daily' or 'hourly'")
 	}
 
 	// Try cache first
-	cacheKey := fmt.Sprintf("analytics:summary:%s:%s:%s", period, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	cacheKey := fmt.Sprintf("analytics:summary:%s:%s:%s:%s", period, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), cacheCurrency(currency))
+	if !isUTC(loc) {
+		cacheKey += ":" + loc.String()
+	}
 	cached, err := s.redis.Get(ctx, cacheKey).Result()
 	if err == nil {
 		var summary MetricsSummaryResponse
@@ -336,11 +723,39 @@ func (s *service) GetMetricsSummary(ctx context.Context, startDate, endDate time
 		}
 	}
 
-	// Fetch from database
-	summary, err := s.repo.GetMetricsSummary(ctx, startDate, endDate, period)
+	// Fetch from database; local days outside UTC are summed from hourly rows
+	// NOTE: Hourly summaries cover start_date 00:00 to end_date 00:00, like the
+	// rows they read
+	first, last := startDate, endDate.Add(23*time.Hour)
+	if period == "hourly" {
+		last = endDate
+	}
+	var summary *MetricsSummaryResponse
+	if isUTC(loc) {
+		summary, err = s.repo.GetMetricsSummary(ctx, startDate, endDate, period, currency)
+	} else {
+		first, last = localHours(startDate, endDate, loc)
+		if period == "hourly" {
+			last = ceilHour(localMidnight(endDate, loc))
+		}
+		summary, err = s.repo.GetMetricsSummary(ctx, first, last, "hourly", currency)
+	}
 	if err != nil {
 		return nil, err
 	}
+	summary.Period = period
+	s.rates.convertSummary(summary)
+
+	// Merge the per-window sketches; stored rows only hold per-window counts
+	currencies := make([]string, 0, len(summary.ByCurrency))
+	for _, c := range summary.ByCurrency {
+		currencies = append(currencies, c.Currency)
+	}
+	if users, err := s.users.Count(ctx, currencies, first, last); err != nil {
+		fmt.Printf("Warning: failed to count unique users: %v\n", err)
+	} else if users > 0 {
+		summary.UniqueUsers = users
+	}
 
 	// Cache the result
 	if data, err := json.Marshal(summary); err == nil {
@@ -351,13 +766,26 @@ func (s *service) GetMetricsSummary(ctx context.Context, startDate, endDate time
 }
 
 // GetUserAnalytics retrieves user-specific analytics
-func (s *service) GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time) (*UserAnalyticsResponse, error) {
-	return s.repo.GetUserAnalytics(ctx, userID, startDate, endDate)
+func (s *service) GetUserAnalytics(ctx context.Context, userID string, startDate, endDate time.Time, currency string) (*UserAnalyticsResponse, error) {
+	analytics, err := s.repo.GetUserAnalytics(ctx, userID, startDate, endDate, currency)
+	if err != nil {
+		return nil, err
+	}
+	s.rates.convertUserAnalytics(analytics)
+	return analytics, nil
 }
 
 // GetUserSnapshots retrieves user snapshots
-func (s *service) GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time) ([]*UserSnapshot, error) {
-	return s.repo.GetUserSnapshots(ctx, userID, startDate, endDate)
+func (s *service) GetUserSnapshots(ctx context.Context, userID string, startDate, endDate time.Time, currency string) ([]*UserSnapshot, error) {
+	return s.repo.GetUserSnapshots(ctx, userID, startDate, endDate, currency)
+}
+
+// cacheCurrency is the cache key segment for a currency filter
+func cacheCurrency(currency string) string {
+	if currency == "" {
+		return "all"
+	}
+	return currency
 }
 
 // invalidateCacheForDate invalidates Redis cache for a specific date
@@ -375,51 +803,79 @@ func (s *service) invalidateCacheForDate(ctx context.Context, date time.Time) er
 	return iter.Err()
 }
 
-func (s *service) GetUserAnalyticsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time) (*UserAnalyticsResponse, error) {
+// GetUserAnalyticsByWallets aggregates analytics across wallets, per currency
+// NOTE: Outside UTC the user's days are summed from hourly snapshots
+func (s *service) GetUserAnalyticsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency string, loc *time.Location) (*UserAnalyticsResponse, error) {
+	result := &UserAnalyticsResponse{
+		Period:     fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
+		Currency:   currency,
+		ByCurrency: []UserCurrencyTotals{},
+	}
 	if len(walletIDs) == 0 {
-		return &UserAnalyticsResponse{
-			UserID:           "",
-			Period:           fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
-			TotalSent:        0,
-			TotalReceived:    0,
-			NetAmount:        0,
-			TransactionCount: 0,
-			TotalFeesPaid:    0,
-		}, nil
+		s.rates.convertUserAnalytics(result)
+		return result, nil
 	}
+	result.UserID = walletIDs[0] // First wallet as reference
 
-	// Aggregate across all wallets
-	var totalSent, totalReceived, totalFees float64
-	var totalCount int64
-
+	// Aggregate across all wallets, keeping currencies apart
+	from, last := localHours(startDate, endDate, loc)
+	totals := make(map[string]*UserCurrencyTotals)
 	for _, walletID := range walletIDs {
-		analytics, err := s.repo.GetUserAnalytics(ctx, walletID, startDate, endDate)
+		var analytics *UserAnalyticsResponse
+		var err error
+		if isUTC(loc) {
+			analytics, err = s.repo.GetUserAnalytics(ctx, walletID, startDate, endDate, currency)
+		} else {
+			analytics, err = s.repo.GetUserAnalyticsByHour(ctx, walletID, from, last, currency)
+		}
 		if err != nil {
 			continue // Skip failed wallets
 		}
 
-		totalSent += analytics.TotalSent
-		totalReceived += analytics.TotalReceived
-		totalCount += analytics.TransactionCount
-		totalFees += analytics.TotalFeesPaid
+		for _, c := range analytics.ByCurrency {
+			t, ok := totals[c.Currency]
+			if !ok {
+				t = &UserCurrencyTotals{Currency: c.Currency}
+				totals[c.Currency] = t
+			}
+			t.TotalSent = t.TotalSent.Add(c.TotalSent)
+			t.TotalReceived = t.TotalReceived.Add(c.TotalReceived)
+			t.TotalFeesPaid = t.TotalFeesPaid.Add(c.TotalFeesPaid)
+			t.TransactionCount += c.TransactionCount
+		}
+		result.TransactionCount += analytics.TransactionCount
+		if analytics.LastTransactionAt != nil && (result.LastTransactionAt == nil || analytics.LastTransactionAt.After(*result.LastTransactionAt)) {
+			result.LastTransactionAt = analytics.LastTransactionAt
+		}
 	}
 
-	return &UserAnalyticsResponse{
-		UserID:           walletIDs[0], // First wallet as reference
-		Period:           fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
-		TotalSent:        totalSent,
-		TotalReceived:    totalReceived,
-		NetAmount:        totalReceived - totalSent,
-		TransactionCount: totalCount,
-		TotalFeesPaid:    totalFees,
-	}, nil
+	for _, t := range totals {
+		t.NetAmount = t.TotalReceived.Sub(t.TotalSent)
+		result.ByCurrency = append(result.ByCurrency, *t)
+	}
+	sort.Slice(result.ByCurrency, func(i, j int) bool {
+		return result.ByCurrency[i].Currency < result.ByCurrency[j].Currency
+	})
+
+	s.rates.convertUserAnalytics(result)
+	return result, nil
 }
 
-func (s *service) GetUserSnapshotsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time) ([]*UserSnapshot, error) {
+func (s *service) GetUserSnapshotsByWallets(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency string, loc *time.Location) ([]*UserSnapshot, error) {
 	var allSnapshots []*UserSnapshot
 
+	from, last := localHours(startDate, endDate, loc)
 	for _, walletID := range walletIDs {
-		snapshots, err := s.repo.GetUserSnapshots(ctx, walletID, startDate, endDate)
+		if !isUTC(loc) {
+			hourly, err := s.repo.GetUserHourlySnapshots(ctx, walletID, from, last, currency)
+			if err != nil {
+				continue
+			}
+			allSnapshots = append(allSnapshots, rollupUserSnapshots(hourly, loc)...)
+			continue
+		}
+
+		snapshots, err := s.repo.GetUserSnapshots(ctx, walletID, startDate, endDate, currency)
 		if err != nil {
 			continue
 		}
@@ -427,4 +883,68 @@ func (s *service) GetUserSnapshotsByWallets(ctx context.Context, walletIDs []str
 	}
 
 	return allSnapshots, nil
-}
\ No newline at end of file
+}
+
+// GetTopCounterparties ranks whom the wallets paid (or were paid by) the most
+func (s *service) GetTopCounterparties(ctx context.Context, walletIDs []string, startDate, endDate time.Time, currency, direction string, limit int) (*CounterpartiesResponse, error) {
+	result := &CounterpartiesResponse{
+		Period:         fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
+		Currency:       currency,
+		Direction:      direction,
+		Counterparties: []CounterpartyTotals{},
+	}
+	if len(walletIDs) == 0 {
+		return result, nil
+	}
+
+	counterparties, err := s.repo.GetTopCounterparties(ctx, walletIDs, startDate, endDate, currency, direction, limit)
+	if err != nil {
+		return nil, err
+	}
+	result.Counterparties = counterparties
+
+	return result, nil
+}
+
+// GetCohorts returns the monthly activity of the cohorts first active between
+// startMonth and endMonth
+func (s *service) GetCohorts(ctx context.Context, startMonth, endMonth time.Time) (*CohortsResponse, error) {
+	activity, err := s.repo.GetCohortActivity(ctx, startMonth, endMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CohortsResponse{
+		StartMonth: startMonth.Format("2006-01"),
+		EndMonth:   endMonth.Format("2006-01"),
+		Cohorts:    []CohortRow{},
+	}
+
+	// Rows arrive ordered by cohort, then month; the cohort month comes first
+	// and holds every wallet of the cohort
+	var row *CohortRow
+	for _, a := range activity {
+		cohort := a.CohortMonth.Format("2006-01")
+		if row == nil || row.CohortMonth != cohort {
+			result.Cohorts = append(result.Cohorts, CohortRow{CohortMonth: cohort, Months: []CohortMonth{}})
+			row = &result.Cohorts[len(result.Cohorts)-1]
+		}
+		if a.ActivityMonth.Equal(a.CohortMonth) {
+			row.Size = a.ActiveWallets
+		}
+
+		offset := (a.ActivityMonth.Year()-a.CohortMonth.Year())*12 + int(a.ActivityMonth.Month()-a.CohortMonth.Month())
+		month := CohortMonth{Offset: offset, ActiveWallets: a.ActiveWallets}
+		if row.Size > 0 {
+			month.Retention = float64(a.ActiveWallets) / float64(row.Size)
+		}
+		row.Months = append(row.Months, month)
+	}
+
+	return result, nil
+}
+
+// GetActiveUsers returns the daily DAU/MAU series
+func (s *service) GetActiveUsers(ctx context.Context, startDate, endDate time.Time) ([]ActiveUsersPoint, error) {
+	return s.repo.GetActiveUsers(ctx, startDate, endDate)
+}
@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/sketch"
+)
+
+// fakeRepository serves canned rows; methods it does not override panic
+type fakeRepository struct {
+	Repository
+	cohorts []*CohortActivity
+	buckets []*HistogramBucket
+}
+
+func (f *fakeRepository) GetCohortActivity(ctx context.Context, startMonth, endMonth time.Time) ([]*CohortActivity, error) {
+	return f.cohorts, nil
+}
+
+func (f *fakeRepository) GetHistogramBuckets(ctx context.Context, startTime, endTime time.Time, currency string) ([]*HistogramBucket, error) {
+	return f.buckets, nil
+}
+
+func month(s string) time.Time {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestGetCohorts(t *testing.T) {
+	repo := &fakeRepository{cohorts: []*CohortActivity{
+		{CohortMonth: month("2024-11"), ActivityMonth: month("2024-11"), ActiveWallets: 10},
+		{CohortMonth: month("2024-11"), ActivityMonth: month("2024-12"), ActiveWallets: 4},
+		{CohortMonth: month("2024-11"), ActivityMonth: month("2025-02"), ActiveWallets: 1},
+		{CohortMonth: month("2024-12"), ActivityMonth: month("2024-12"), ActiveWallets: 8},
+		{CohortMonth: month("2024-12"), ActivityMonth: month("2025-01"), ActiveWallets: 6},
+	}}
+	s := &service{repo: repo}
+
+	result, err := s.GetCohorts(context.Background(), month("2024-11"), month("2024-12"))
+	if err != nil {
+		t.Fatalf("GetCohorts failed: %v", err)
+	}
+
+	want := []CohortRow{
+		{CohortMonth: "2024-11", Size: 10, Months: []CohortMonth{
+			{Offset: 0, ActiveWallets: 10, Retention: 1},
+			{Offset: 1, ActiveWallets: 4, Retention: 0.4},
+			{Offset: 3, ActiveWallets: 1, Retention: 0.1},
+		}},
+		{CohortMonth: "2024-12", Size: 8, Months: []CohortMonth{
+			{Offset: 0, ActiveWallets: 8, Retention: 1},
+			{Offset: 1, ActiveWallets: 6, Retention: 0.75},
+		}},
+	}
+	if result.StartMonth != "2024-11" || result.EndMonth != "2024-12" {
+		t.Errorf("Unexpected range: %s to %s", result.StartMonth, result.EndMonth)
+	}
+	if !reflect.DeepEqual(result.Cohorts, want) {
+		t.Errorf("Cohorts = %+v, want %+v", result.Cohorts, want)
+	}
+}
+
+func TestGetCohortsEmpty(t *testing.T) {
+	s := &service{repo: &fakeRepository{}}
+
+	result, err := s.GetCohorts(context.Background(), month("2025-01"), month("2025-01"))
+	if err != nil || result.Cohorts == nil || len(result.Cohorts) != 0 {
+		t.Errorf("Expected an empty cohort list, got %+v, %v", result, err)
+	}
+}
+
+func TestGetTopCounterpartiesWithoutWallets(t *testing.T) {
+	s := &service{repo: &fakeRepository{}} // Must not reach the repository
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := s.GetTopCounterparties(context.Background(), nil, start, start.AddDate(0, 0, 30), "USD", "sent", 10)
+	if err != nil || result.Counterparties == nil || len(result.Counterparties) != 0 {
+		t.Errorf("Expected no counterparties, got %+v, %v", result, err)
+	}
+	if result.Period != "2025-01-01 to 2025-01-31" {
+		t.Errorf("Unexpected period %q", result.Period)
+	}
+}
+
+func TestGetPercentiles(t *testing.T) {
+	repo := &fakeRepository{buckets: []*HistogramBucket{
+		{Currency: "USD", Metric: HistogramValue, Bucket: sketch.Bucket(100), Count: 60},
+		{Currency: "USD", Metric: HistogramValue, Bucket: sketch.Bucket(1000), Count: 40},
+		{Currency: "EUR", Metric: HistogramValue, Bucket: sketch.Bucket(5), Count: 1},
+		// Latencies merge across currencies
+		{Currency: "USD", Metric: HistogramSettlement, Bucket: sketch.Bucket(20), Count: 95},
+		{Currency: "EUR", Metric: HistogramSettlement, Bucket: sketch.Bucket(2000), Count: 5},
+		{Currency: "USD", Metric: "unknown_ms", Bucket: sketch.Bucket(1), Count: 1},
+	}}
+	s := &service{repo: repo}
+
+	result, err := s.GetPercentiles(context.Background(), time.Time{}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetPercentiles failed: %v", err)
+	}
+
+	near := func(got, want float64) bool { return math.Abs(got-want) <= want*0.01+0.1 }
+
+	if len(result.TransactionValue) != 2 || result.TransactionValue[0].Currency != "EUR" || result.TransactionValue[1].Currency != "USD" {
+		t.Fatalf("Expected EUR and USD values, got %+v", result.TransactionValue)
+	}
+	usd := result.TransactionValue[1]
+	if usd.Count != 100 || !near(usd.P50.Float64(), 100) || !near(usd.P90.Float64(), 1000) {
+		t.Errorf("Unexpected USD percentiles: %+v", usd)
+	}
+
+	if len(result.LatencyMs) != 4 {
+		t.Errorf("Expected 4 latency metrics, got %v", result.LatencyMs)
+	}
+	settlement := result.LatencyMs["settlement"]
+	if settlement.Count != 100 || !near(settlement.P50, 20) || !near(settlement.P99, 2000) {
+		t.Errorf("Unexpected settlement percentiles: %+v", settlement)
+	}
+	if lag := result.LatencyMs["analytics_lag"]; lag.Count != 0 || lag.P50 != 0 {
+		t.Errorf("Expected empty analytics lag, got %+v", lag)
+	}
+}
@@ -0,0 +1,394 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/middleware"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/internal/common/redis"
+)
+
+// streamChannel is the Redis pub/sub channel every replica publishes processed
+// ledger entries to
+const streamChannel = "analytics:stream:entries"
+
+// Stream event names, sent as the SSE "event:" field
+const (
+	StreamEventMetricDelta = "metric_delta"
+	StreamEventUserEntry   = "user_entry"
+	StreamEventTPS         = "tps"
+)
+
+// streamBufferSize is how many events a slow client may fall behind before it
+// is disconnected
+const streamBufferSize = 256
+
+// tpsWindow is the number of seconds averaged by the tps event
+const tpsWindow = 10
+
+// streamEntry is a processed ledger entry as published over Redis
+type streamEntry struct {
+	EventID        string       `json:"event_id"`
+	TransactionID  string       `json:"transaction_id"`
+	WalletID       string       `json:"wallet_id"`
+	CounterpartyID string       `json:"counterparty_wallet_id,omitempty"`
+	EntryType      string       `json:"entry_type"`
+	Amount         money.Amount `json:"amount"`
+	Fee            money.Amount `json:"fee"`
+	Currency       string       `json:"currency"`
+	Status         string       `json:"status"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// MetricDelta is what one processed ledger entry added to daily_metrics and
+// hourly_metrics; dashboards add it to the rows they already hold
+// NOTE: Wallets are left out - the system-wide stream is open to every user
+type MetricDelta struct {
+	MetricHour             time.Time    `json:"metric_hour"`
+	MetricDate             string       `json:"metric_date"`
+	Currency               string       `json:"currency"`
+	TotalTransactions      int64        `json:"total_transactions"`
+	TotalVolume            money.Amount `json:"total_volume"`
+	TotalFees              money.Amount `json:"total_fees"`
+	SuccessfulTransactions int64        `json:"successful_transactions"`
+	FailedTransactions     int64        `json:"failed_transactions"`
+}
+
+// UserEntry is a processed ledger entry on one of the streaming user's wallets
+type UserEntry struct {
+	TransactionID string       `json:"transaction_id"`
+	WalletID      string       `json:"wallet_id"`
+	Direction     string       `json:"direction"` // sent or received
+	Amount        money.Amount `json:"amount"`
+	Fee           money.Amount `json:"fee"`
+	Currency      string       `json:"currency"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// TPSUpdate is the live transactions-per-second counter
+// NOTE: Counts transfers (debit entries), not ledger entries
+type TPSUpdate struct {
+	At      time.Time `json:"at"`
+	TPS     int64     `json:"tps"`     // Transfers in the last second
+	Average float64   `json:"avg_10s"` // Per second over the last 10 seconds
+}
+
+// publishStreamEntry announces a processed ledger entry to every replica
+func publishStreamEntry(ctx context.Context, redisClient *redis.Client, event *LedgerEntryCreatedEvent) error {
+	data, err := json.Marshal(streamEntry{
+		EventID:        event.EventID,
+		TransactionID:  event.TransactionID,
+		WalletID:       event.FromWalletID,
+		CounterpartyID: event.ToWalletID,
+		EntryType:      event.TransactionType,
+		Amount:         event.Amount,
+		Fee:            event.Fee,
+		Currency:       event.Currency,
+		Status:         event.Status,
+		CreatedAt:      event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream entry: %w", err)
+	}
+
+	if err := redisClient.Publish(ctx, streamChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish stream entry: %w", err)
+	}
+	return nil
+}
+
+// streamFrame is one SSE event ready to write
+type streamFrame struct {
+	event string
+	data  []byte
+}
+
+// streamSubscriber is one connected SSE client
+type streamSubscriber struct {
+	wallets map[string]bool // nil for the system-wide stream
+	frames  chan streamFrame
+}
+
+// StreamBroker fans processed ledger entries out to SSE clients
+// NOTE: Every replica subscribes to the same Redis channel, so a client sees
+// entries processed by any replica. A client that falls streamBufferSize
+// events behind is disconnected rather than silently missing deltas; it
+// should reload the hourly metrics and reconnect.
+type StreamBroker struct {
+	redis  *redis.Client
+	logger *logger.Logger
+
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[*streamSubscriber]struct{}
+	transfers   int64 // Debit entries seen in the current second
+	window      [tpsWindow]int64
+	windowPos   int
+}
+
+func NewStreamBroker(redisClient *redis.Client, log *logger.Logger) *StreamBroker {
+	return &StreamBroker{
+		redis:       redisClient,
+		logger:      log,
+		subscribers: make(map[*streamSubscriber]struct{}),
+	}
+}
+
+// Run relays the Redis channel to subscribers until ctx is done, then
+// disconnects every subscriber
+func (b *StreamBroker) Run(ctx context.Context) {
+	pubsub := b.redis.Subscribe(ctx, streamChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	b.logger.Infof("Analytics stream listening on Redis channel %s", streamChannel)
+	for {
+		select {
+		case <-ctx.Done():
+			b.closeAll()
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				b.closeAll()
+				return
+			}
+			var entry streamEntry
+			if err := json.Unmarshal([]byte(msg.Payload), &entry); err != nil {
+				b.logger.Warnf("Ignoring malformed stream entry: %v", err)
+				continue
+			}
+			b.dispatch(&entry)
+		case now := <-ticker.C:
+			b.tick(now)
+		}
+	}
+}
+
+// subscribe registers a client; wallets scopes it to one user's entries, nil
+// means the system-wide stream
+func (b *StreamBroker) subscribe(wallets []string) (*streamSubscriber, func()) {
+	sub := &streamSubscriber{frames: make(chan streamFrame, streamBufferSize)}
+	if wallets != nil {
+		sub.wallets = make(map[string]bool, len(wallets))
+		for _, id := range wallets {
+			sub.wallets[id] = true
+		}
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		close(sub.frames) // Shutting down: the handler returns at once
+	} else {
+		b.subscribers[sub] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	return sub, func() { b.remove(sub) }
+}
+
+// remove unregisters a subscriber and closes its frames, once
+func (b *StreamBroker) remove(sub *streamSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(sub)
+}
+
+func (b *StreamBroker) removeLocked(sub *streamSubscriber) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.frames)
+	}
+}
+
+func (b *StreamBroker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.removeLocked(sub)
+	}
+}
+
+// dispatch sends an entry to the system-wide stream and to the streams of the
+// user owning its wallet
+func (b *StreamBroker) dispatch(entry *streamEntry) {
+	success, failed := int64(1), int64(0)
+	if entry.Status != TransactionStatusCompleted {
+		success, failed = 0, 1
+	}
+	created := entry.CreatedAt.UTC()
+	delta, _ := json.Marshal(MetricDelta{
+		MetricHour:             created.Truncate(time.Hour),
+		MetricDate:             created.Format("2006-01-02"),
+		Currency:               entry.Currency,
+		TotalTransactions:      1,
+		TotalVolume:            entry.Amount,
+		TotalFees:              entry.Fee,
+		SuccessfulTransactions: success,
+		FailedTransactions:     failed,
+	})
+
+	direction := "received"
+	if entry.EntryType == "debit" {
+		direction = "sent"
+	}
+	userEntry, _ := json.Marshal(UserEntry{
+		TransactionID: entry.TransactionID,
+		WalletID:      entry.WalletID,
+		Direction:     direction,
+		Amount:        entry.Amount,
+		Fee:           entry.Fee,
+		Currency:      entry.Currency,
+		CreatedAt:     entry.CreatedAt,
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry.EntryType == "debit" {
+		b.transfers++
+	}
+	for sub := range b.subscribers {
+		switch {
+		case sub.wallets == nil:
+			b.sendLocked(sub, streamFrame{event: StreamEventMetricDelta, data: delta})
+		case sub.wallets[entry.WalletID]:
+			b.sendLocked(sub, streamFrame{event: StreamEventUserEntry, data: userEntry})
+		}
+	}
+}
+
+// tick closes the current second and sends the tps counter
+func (b *StreamBroker) tick(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	last := b.transfers
+	b.transfers = 0
+	b.window[b.windowPos] = last
+	b.windowPos = (b.windowPos + 1) % tpsWindow
+
+	var total int64
+	for _, n := range b.window {
+		total += n
+	}
+	data, _ := json.Marshal(TPSUpdate{
+		At:      now.UTC().Truncate(time.Second),
+		TPS:     last,
+		Average: float64(total) / tpsWindow,
+	})
+
+	for sub := range b.subscribers {
+		if sub.wallets == nil {
+			b.sendLocked(sub, streamFrame{event: StreamEventTPS, data: data})
+		}
+	}
+}
+
+// sendLocked queues a frame, disconnecting the subscriber if it is full
+func (b *StreamBroker) sendLocked(sub *streamSubscriber, frame streamFrame) {
+	select {
+	case sub.frames <- frame:
+	default:
+		b.logger.Warnf("Disconnecting slow analytics stream client")
+		b.removeLocked(sub)
+	}
+}
+
+// StreamHandler serves the SSE endpoints
+type StreamHandler struct {
+	broker *StreamBroker
+	wallet *WalletClient
+}
+
+func NewStreamHandler(broker *StreamBroker) *StreamHandler {
+	return &StreamHandler{
+		broker: broker,
+		wallet: NewWalletClient(),
+	}
+}
+
+// RegisterRoutes registers the streaming routes
+func (h *StreamHandler) RegisterRoutes(mux *http.ServeMux, jwtSecret string) {
+	protected := middleware.JWTAuth(jwtSecret)
+
+	mux.Handle("GET /api/v1/analytics/stream", protected(http.HandlerFunc(h.StreamMetrics)))
+	mux.Handle("GET /api/v1/analytics/me/stream", protected(http.HandlerFunc(h.StreamUser)))
+}
+
+// StreamMetrics handles GET /api/v1/analytics/stream
+// Pushes metric_delta for every processed entry and tps every second
+func (h *StreamHandler) StreamMetrics(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, nil)
+}
+
+// StreamUser handles GET /api/v1/analytics/me/stream
+// Pushes user_entry for entries on the authenticated user's wallets
+// NOTE: Wallets are resolved on connect; reconnect to pick up new wallets
+func (h *StreamHandler) StreamUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	walletIDs, err := h.wallet.GetUserWalletIDs(r.Context(), userID, r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "wallet_service_error", fmt.Sprintf("Failed to fetch user wallets: %v", err))
+		return
+	}
+	if walletIDs == nil {
+		walletIDs = []string{}
+	}
+
+	h.serve(w, r, walletIDs)
+}
+
+// serve writes subscriber frames as SSE until the client or broker goes away
+func (h *StreamHandler) serve(w http.ResponseWriter, r *http.Request, wallets []string) {
+	// The stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	sub, unsubscribe := h.broker.subscribe(wallets)
+	defer unsubscribe()
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	// Comments keep proxies from closing an idle stream
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case frame, ok := <-sub.frames:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", frame.event, frame.data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
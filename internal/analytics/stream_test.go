@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+func testEntry(walletID, entryType string) *streamEntry {
+	return &streamEntry{
+		TransactionID: "txn-1",
+		WalletID:      walletID,
+		EntryType:     entryType,
+		Amount:        money.MustParse("10"),
+		Currency:      "USD",
+		Status:        TransactionStatusCompleted,
+		CreatedAt:     time.Date(2025, 3, 10, 5, 30, 0, 0, time.UTC),
+	}
+}
+
+// drain returns the frames queued for sub and whether it is still connected
+func drain(sub *streamSubscriber) ([]streamFrame, bool) {
+	frames := []streamFrame{}
+	for {
+		select {
+		case frame, ok := <-sub.frames:
+			if !ok {
+				return frames, false
+			}
+			frames = append(frames, frame)
+		default:
+			return frames, true
+		}
+	}
+}
+
+func TestStreamBrokerEvictsSlowClient(t *testing.T) {
+	b := NewStreamBroker(nil, logger.New("test"))
+	slow, _ := b.subscribe(nil)
+	fast, unsubscribe := b.subscribe(nil)
+	defer unsubscribe()
+
+	for i := 0; i < streamBufferSize; i++ {
+		b.dispatch(testEntry("w1", "debit"))
+		if frames, open := drain(fast); len(frames) != 1 || !open {
+			t.Fatalf("Expected fast client to get every frame, got %d (open %v)", len(frames), open)
+		}
+	}
+	b.dispatch(testEntry("w1", "debit"))
+
+	frames, open := drain(slow)
+	if open {
+		t.Error("Expected slow client to be disconnected")
+	}
+	if len(frames) != streamBufferSize {
+		t.Errorf("Expected slow client to keep its %d buffered frames, got %d", streamBufferSize, len(frames))
+	}
+	if _, open := drain(fast); !open {
+		t.Error("Expected fast client to stay connected")
+	}
+	if len(b.subscribers) != 1 {
+		t.Errorf("Expected 1 subscriber left, got %d", len(b.subscribers))
+	}
+}
+
+func TestStreamBrokerDispatch(t *testing.T) {
+	b := NewStreamBroker(nil, logger.New("test"))
+	system, _ := b.subscribe(nil)
+	alice, _ := b.subscribe([]string{"w1"})
+	bob, _ := b.subscribe([]string{"w2"})
+
+	b.dispatch(testEntry("w1", "debit"))
+
+	frames, _ := drain(system)
+	if len(frames) != 1 || frames[0].event != StreamEventMetricDelta {
+		t.Fatalf("Expected one metric delta, got %v", frames)
+	}
+	var delta MetricDelta
+	if err := json.Unmarshal(frames[0].data, &delta); err != nil {
+		t.Fatalf("Failed to decode delta: %v", err)
+	}
+	if delta.MetricDate != "2025-03-10" || !delta.MetricHour.Equal(time.Date(2025, 3, 10, 5, 0, 0, 0, time.UTC)) ||
+		delta.SuccessfulTransactions != 1 || delta.TotalVolume.String() != "10.0000" {
+		t.Errorf("Unexpected delta: %+v", delta)
+	}
+
+	frames, _ = drain(alice)
+	if len(frames) != 1 || frames[0].event != StreamEventUserEntry {
+		t.Fatalf("Expected one user entry, got %v", frames)
+	}
+	var entry UserEntry
+	if err := json.Unmarshal(frames[0].data, &entry); err != nil {
+		t.Fatalf("Failed to decode user entry: %v", err)
+	}
+	if entry.Direction != "sent" || entry.WalletID != "w1" {
+		t.Errorf("Unexpected user entry: %+v", entry)
+	}
+
+	if frames, _ := drain(bob); len(frames) != 0 {
+		t.Errorf("Expected other users to get nothing, got %v", frames)
+	}
+}
+
+func TestStreamBrokerTick(t *testing.T) {
+	b := NewStreamBroker(nil, logger.New("test"))
+	system, _ := b.subscribe(nil)
+	user, _ := b.subscribe([]string{"w1"})
+
+	b.dispatch(testEntry("w1", "debit"))
+	b.dispatch(testEntry("w2", "credit")) // The other side of a transfer
+	b.dispatch(testEntry("w1", "debit"))
+	drain(system)
+	drain(user)
+
+	now := time.Date(2025, 3, 10, 5, 30, 1, 500, time.UTC)
+	b.tick(now)
+
+	frames, _ := drain(system)
+	if len(frames) != 1 || frames[0].event != StreamEventTPS {
+		t.Fatalf("Expected one tps update, got %v", frames)
+	}
+	var tps TPSUpdate
+	if err := json.Unmarshal(frames[0].data, &tps); err != nil {
+		t.Fatalf("Failed to decode tps: %v", err)
+	}
+	if tps.TPS != 2 || tps.Average != 0.2 || !tps.At.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Unexpected tps update: %+v", tps)
+	}
+
+	if frames, _ := drain(user); len(frames) != 0 {
+		t.Errorf("Expected user streams not to get tps, got %v", frames)
+	}
+}
+
+func TestStreamBrokerCloseAll(t *testing.T) {
+	b := NewStreamBroker(nil, logger.New("test"))
+	sub, unsubscribe := b.subscribe(nil)
+
+	b.closeAll()
+	if _, open := drain(sub); open {
+		t.Error("Expected subscriber to be disconnected")
+	}
+	unsubscribe() // Must not close twice
+
+	late, _ := b.subscribe(nil)
+	if _, open := drain(late); open {
+		t.Error("Expected subscriptions after shutdown to be closed at once")
+	}
+}
@@ -0,0 +1,202 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+// Rollup intervals
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week" // ISO weeks, starting on Monday
+	IntervalMonth = "month"
+)
+
+// LoadTimezone resolves an IANA timezone name; empty means UTC
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("invalid timezone: %s", name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", name)
+	}
+	return loc, nil
+}
+
+// isUTC reports whether loc's days are UTC days, so the daily tables apply
+func isUTC(loc *time.Location) bool {
+	return loc == nil || loc.String() == "UTC" || loc.String() == "Etc/UTC"
+}
+
+// localHours returns the first and last UTC hour of the local days
+// startDate..endDate (inclusive), for BETWEEN queries on hourly rows
+// NOTE: An hour belongs to the local day in which it starts. In zones whose
+// offset is not a whole hour (e.g. Asia/Kolkata) day boundaries therefore
+// fall up to 45 minutes after local midnight.
+func localHours(startDate, endDate time.Time, loc *time.Location) (time.Time, time.Time) {
+	from := localMidnight(startDate, loc)
+	to := localMidnight(endDate.AddDate(0, 0, 1), loc)
+	return ceilHour(from), ceilHour(to).Add(-time.Hour)
+}
+
+// localMidnight is the start of date's calendar day in loc
+func localMidnight(date time.Time, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc).UTC()
+}
+
+func ceilHour(t time.Time) time.Time {
+	hour := t.Truncate(time.Hour)
+	if hour.Before(t) {
+		hour = hour.Add(time.Hour)
+	}
+	return hour
+}
+
+// localPeriod returns the local period (day, week or month) that the hour
+// starting at t belongs to, as a date at UTC midnight
+func localPeriod(t time.Time, loc *time.Location, interval string) time.Time {
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch interval {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextPeriod returns the period after one returned by localPeriod
+func nextPeriod(period time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return period.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return period.AddDate(0, 1, 0)
+	}
+	return period.AddDate(0, 0, 1)
+}
+
+// rollupHourly sums hourly metrics into local periods, one per currency
+// NOTE: unique_users is left at the largest hourly value; callers replace it
+// with a sketch count where one is available
+func rollupHourly(metrics []*HourlyMetric, loc *time.Location, interval string) []*RollupMetric {
+	type key struct {
+		period   time.Time
+		currency string
+	}
+	periods := make(map[key]*RollupMetric)
+
+	for _, m := range metrics {
+		k := key{localPeriod(m.MetricHour, loc, interval), m.Currency}
+		r, ok := periods[k]
+		if !ok {
+			r = &RollupMetric{
+				PeriodStart:         k.period.Format("2006-01-02"),
+				Currency:            m.Currency,
+				TotalVolume:         money.Zero(),
+				TotalFees:           money.Zero(),
+				MaxTransactionValue: money.Zero(),
+				MinTransactionValue: money.Zero(),
+			}
+			periods[k] = r
+		}
+
+		// Hours with only failures or fees hold no transaction values
+		if m.SuccessfulTransactions > 0 {
+			if r.SuccessfulTransactions == 0 || m.MaxTransactionValue.Cmp(r.MaxTransactionValue) > 0 {
+				r.MaxTransactionValue = m.MaxTransactionValue
+			}
+			if r.SuccessfulTransactions == 0 || m.MinTransactionValue.Cmp(r.MinTransactionValue) < 0 {
+				r.MinTransactionValue = m.MinTransactionValue
+			}
+		}
+
+		r.TotalTransactions += m.TotalTransactions
+		r.TotalVolume = r.TotalVolume.Add(m.TotalVolume)
+		r.TotalFees = r.TotalFees.Add(m.TotalFees)
+		r.SuccessfulTransactions += m.SuccessfulTransactions
+		r.FailedTransactions += m.FailedTransactions
+		if m.UniqueUsers > r.UniqueUsers {
+			r.UniqueUsers = m.UniqueUsers
+		}
+	}
+
+	rollup := make([]*RollupMetric, 0, len(periods))
+	for _, r := range periods {
+		r.AvgTransactionValue = money.Zero()
+		if r.SuccessfulTransactions > 0 {
+			r.AvgTransactionValue = r.TotalVolume.Div(r.SuccessfulTransactions)
+		}
+		rollup = append(rollup, r)
+	}
+	sort.Slice(rollup, func(i, j int) bool {
+		if rollup[i].PeriodStart != rollup[j].PeriodStart {
+			return rollup[i].PeriodStart < rollup[j].PeriodStart
+		}
+		return rollup[i].Currency < rollup[j].Currency
+	})
+
+	return rollup
+}
+
+// rollupUserSnapshots sums hourly user snapshots into local days
+// NOTE: Newest day first, like GetUserSnapshots
+func rollupUserSnapshots(hourly []*UserSnapshot, loc *time.Location) []*UserSnapshot {
+	type key struct {
+		user     string
+		day      time.Time
+		currency string
+	}
+	days := make(map[key]*UserSnapshot)
+
+	for _, h := range hourly {
+		k := key{h.UserID, localPeriod(h.SnapshotDate, loc, IntervalDay), h.Currency}
+		d, ok := days[k]
+		if !ok {
+			d = &UserSnapshot{
+				UserID:        h.UserID,
+				SnapshotDate:  k.day,
+				Currency:      h.Currency,
+				TotalSent:     money.Zero(),
+				TotalReceived: money.Zero(),
+				TotalFeesPaid: money.Zero(),
+			}
+			days[k] = d
+		}
+
+		d.TotalSent = d.TotalSent.Add(h.TotalSent)
+		d.TotalReceived = d.TotalReceived.Add(h.TotalReceived)
+		d.TransactionCount += h.TransactionCount
+		d.SentCount += h.SentCount
+		d.ReceivedCount += h.ReceivedCount
+		d.TotalFeesPaid = d.TotalFeesPaid.Add(h.TotalFeesPaid)
+		if h.LastTransactionAt != nil && (d.LastTransactionAt == nil || h.LastTransactionAt.After(*d.LastTransactionAt)) {
+			d.LastTransactionAt = h.LastTransactionAt
+		}
+	}
+
+	snapshots := make([]*UserSnapshot, 0, len(days))
+	for _, d := range days {
+		snapshots = append(snapshots, d)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].SnapshotDate.Equal(snapshots[j].SnapshotDate) {
+			return snapshots[i].SnapshotDate.After(snapshots[j].SnapshotDate)
+		}
+		return snapshots[i].Currency < snapshots[j].Currency
+	})
+
+	return snapshots
+}
@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+func loadTimezone(t *testing.T, name string) *time.Location {
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		t.Fatalf("LoadTimezone(%s) failed: %v", name, err)
+	}
+	return loc
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse("2006-01-02T15", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestLoadTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", "UTC", false},
+		{" Europe/Berlin ", "Europe/Berlin", false},
+		{"Local", "", true},
+		{"Mars/Olympus", "", true},
+	}
+
+	for _, tt := range tests {
+		loc, err := LoadTimezone(tt.name)
+		if (err != nil) != tt.wantErr || (err == nil && loc.String() != tt.want) {
+			t.Errorf("LoadTimezone(%q) = %v, %v", tt.name, loc, err)
+		}
+	}
+}
+
+func TestLocalHours(t *testing.T) {
+	tests := []struct {
+		name      string
+		zone      string
+		start     string
+		end       string
+		wantFirst string
+		wantLast  string
+	}{
+		{"utc day", "UTC", "2025-01-10", "2025-01-10", "2025-01-10T00", "2025-01-10T23"},
+		{"spring forward has 23 hours", "America/New_York", "2025-03-09", "2025-03-09", "2025-03-09T05", "2025-03-10T03"},
+		{"fall back has 25 hours", "America/New_York", "2025-11-02", "2025-11-02", "2025-11-02T04", "2025-11-03T04"},
+		{"range across dst", "Europe/Berlin", "2025-03-29", "2025-03-31", "2025-03-28T23", "2025-03-31T21"},
+		{"half-hour offset", "Asia/Kolkata", "2025-01-10", "2025-01-10", "2025-01-09T19", "2025-01-10T18"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, _ := time.Parse("2006-01-02", tt.start)
+			end, _ := time.Parse("2006-01-02", tt.end)
+
+			first, last := localHours(start, end, loadTimezone(t, tt.zone))
+			if !first.Equal(utc(tt.wantFirst)) || !last.Equal(utc(tt.wantLast)) {
+				t.Errorf("localHours() = %v .. %v, want %s .. %s", first, last, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestLocalPeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		hour     string
+		zone     string
+		interval string
+		want     string
+	}{
+		{"last hour before midnight edt", "2025-03-10T03", "America/New_York", IntervalDay, "2025-03-09"},
+		{"midnight edt", "2025-03-10T04", "America/New_York", IntervalDay, "2025-03-10"},
+		{"repeated hour after fall back", "2025-11-02T06", "America/New_York", IntervalDay, "2025-11-02"},
+		{"sunday belongs to the week before", "2025-03-10T03", "America/New_York", IntervalWeek, "2025-03-03"},
+		{"monday starts a week", "2025-03-10T04", "America/New_York", IntervalWeek, "2025-03-10"},
+		{"month boundary", "2025-03-01T04", "America/New_York", IntervalMonth, "2025-02-01"},
+		{"half-hour offset before midnight", "2025-01-09T18", "Asia/Kolkata", IntervalDay, "2025-01-09"},
+		{"half-hour offset after midnight", "2025-01-09T19", "Asia/Kolkata", IntervalDay, "2025-01-10"},
+		{"ahead of utc", "2024-12-31T23", "Asia/Tokyo", IntervalMonth, "2025-01-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := localPeriod(utc(tt.hour), loadTimezone(t, tt.zone), tt.interval)
+			if got.Format("2006-01-02") != tt.want || got.Location() != time.UTC {
+				t.Errorf("localPeriod(%s) = %v, want %s", tt.hour, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollupHourlyAcrossDST(t *testing.T) {
+	loc := loadTimezone(t, "America/New_York")
+
+	// Every hour of the short local day 2025-03-09, then the first hour of the next
+	metrics := []*HourlyMetric{}
+	for hour := utc("2025-03-09T05"); !hour.After(utc("2025-03-10T04")); hour = hour.Add(time.Hour) {
+		metrics = append(metrics, &HourlyMetric{
+			MetricHour:             hour,
+			Currency:               "USD",
+			TotalTransactions:      1,
+			TotalVolume:            money.MustParse("10"),
+			SuccessfulTransactions: 1,
+			MaxTransactionValue:    money.MustParse("10"),
+			MinTransactionValue:    money.MustParse("10"),
+			UniqueUsers:            1,
+		})
+	}
+
+	rollup := rollupHourly(metrics, loc, IntervalDay)
+	if len(rollup) != 2 {
+		t.Fatalf("Expected 2 days, got %d", len(rollup))
+	}
+	if r := rollup[0]; r.PeriodStart != "2025-03-09" || r.TotalTransactions != 23 || r.TotalVolume.String() != "230.0000" {
+		t.Errorf("Unexpected short day: %+v", r)
+	}
+	if r := rollup[1]; r.PeriodStart != "2025-03-10" || r.TotalTransactions != 1 {
+		t.Errorf("Unexpected next day: %+v", r)
+	}
+}
+
+func TestRollupHourly(t *testing.T) {
+	metrics := []*HourlyMetric{
+		{
+			MetricHour: utc("2025-03-10T01"), Currency: "USD",
+			TotalTransactions: 2, TotalVolume: money.MustParse("30"), SuccessfulTransactions: 2,
+			MaxTransactionValue: money.MustParse("20"), MinTransactionValue: money.MustParse("10"), UniqueUsers: 2,
+		},
+		{
+			// Only failures: no transaction values to compare
+			MetricHour: utc("2025-03-10T02"), Currency: "USD",
+			TotalTransactions: 1, FailedTransactions: 1, UniqueUsers: 1,
+		},
+		{
+			MetricHour: utc("2025-03-10T03"), Currency: "USD",
+			TotalTransactions: 1, TotalVolume: money.MustParse("5"), TotalFees: money.MustParse("0.5"), SuccessfulTransactions: 1,
+			MaxTransactionValue: money.MustParse("5"), MinTransactionValue: money.MustParse("5"), UniqueUsers: 1,
+		},
+		{
+			MetricHour: utc("2025-03-10T03"), Currency: "EUR",
+			TotalTransactions: 1, FailedTransactions: 1,
+		},
+	}
+
+	rollup := rollupHourly(metrics, time.UTC, IntervalWeek)
+	if len(rollup) != 2 {
+		t.Fatalf("Expected one row per currency, got %d", len(rollup))
+	}
+
+	eur, usd := rollup[0], rollup[1]
+	if eur.Currency != "EUR" || eur.PeriodStart != "2025-03-10" || eur.AvgTransactionValue.String() != "0.0000" ||
+		eur.MinTransactionValue.String() != "0.0000" {
+		t.Errorf("Unexpected EUR rollup: %+v", eur)
+	}
+	if usd.TotalTransactions != 4 || usd.SuccessfulTransactions != 3 || usd.FailedTransactions != 1 {
+		t.Errorf("Unexpected USD counts: %+v", usd)
+	}
+	if usd.TotalVolume.String() != "35.0000" || usd.TotalFees.String() != "0.5000" || usd.AvgTransactionValue.String() != "11.6667" {
+		t.Errorf("Unexpected USD totals: %+v", usd)
+	}
+	if usd.MaxTransactionValue.String() != "20.0000" || usd.MinTransactionValue.String() != "5.0000" {
+		t.Errorf("Unexpected USD min/max: %s/%s", usd.MinTransactionValue, usd.MaxTransactionValue)
+	}
+	if usd.UniqueUsers != 2 {
+		t.Errorf("Expected unique users to be the largest hourly value, got %d", usd.UniqueUsers)
+	}
+}
@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/money"
+)
+
+// ProcessTransactionEvent processes transaction.failed and
+// transaction.fee_charged messages
+func (s *service) ProcessTransactionEvent(ctx context.Context, value []byte) error {
+	// Decode failures cannot be fixed by retrying: dead-letter them directly
+	env, err := kafka.DecodeEnvelope(value)
+	if err != nil {
+		return kafka.Permanent(fmt.Errorf("failed to decode transaction event: %w", err))
+	}
+
+	switch env.Type {
+	case kafka.EventTypeTransactionFailed:
+		event, err := decodeTransactionFailed(env)
+		if err != nil {
+			return kafka.Permanent(err)
+		}
+		return s.ProcessTransactionFailed(ctx, event)
+	case kafka.EventTypeFeeCharged:
+		event, err := decodeFeeCharged(env)
+		if err != nil {
+			return kafka.Permanent(err)
+		}
+		return s.ProcessFeeCharged(ctx, event)
+	}
+
+	return nil // Not analysed
+}
+
+func decodeTransactionFailed(env *kafka.Envelope) (*TransactionFailedEvent, error) {
+	var event kafka.TransactionFailed
+	if err := env.Decode(&event); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction failed event: %w", err)
+	}
+
+	amount, err := money.Parse(event.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction failed event amount: %w", err)
+	}
+
+	// A transaction fails at most once, so its id is a stable fallback
+	eventID := env.ID
+	if eventID == "" {
+		eventID = event.TransactionID
+	}
+
+	currency := event.Currency
+	if currency == "" {
+		currency = UnknownCurrency
+	}
+
+	return &TransactionFailedEvent{
+		EventID:       eventID,
+		TransactionID: event.TransactionID,
+		FromWalletID:  event.FromWalletID,
+		ToWalletID:    event.ToWalletID,
+		Amount:        amount,
+		Currency:      currency,
+		Reason:        event.Reason,
+		CreatedAt:     event.FailedAt,
+	}, nil
+}
+
+func decodeFeeCharged(env *kafka.Envelope) (*FeeChargedEvent, error) {
+	var event kafka.FeeCharged
+	if err := env.Decode(&event); err != nil {
+		return nil, fmt.Errorf("failed to decode fee charged event: %w", err)
+	}
+
+	// A transaction may be charged several fees, so only the envelope id is stable
+	if env.ID == "" {
+		return nil, fmt.Errorf("fee charged event has no id")
+	}
+
+	fee, err := money.Parse(event.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fee charged event amount: %w", err)
+	}
+
+	currency := event.Currency
+	if currency == "" {
+		currency = UnknownCurrency
+	}
+
+	return &FeeChargedEvent{
+		EventID:       env.ID,
+		TransactionID: event.TransactionID,
+		WalletID:      event.WalletID,
+		Fee:           fee,
+		Currency:      currency,
+		CreatedAt:     event.ChargedAt,
+	}, nil
+}
+
+// ProcessTransactionFailed counts a failed transfer in its day and hour
+// NOTE: Failed transfers move no money, so volume, unique users and user
+// snapshots are left alone
+func (s *service) ProcessTransactionFailed(ctx context.Context, event *TransactionFailedEvent) error {
+	applied, err := s.processOnce(ctx, event.EventID, kafka.EventTypeTransactionFailed, event, func(repo Repository) error {
+		return repo.AddFailuresAndFees(ctx, event.CreatedAt, event.Currency, 1, money.Zero())
+	})
+	if err != nil || !applied {
+		return err
+	}
+
+	s.invalidateAfter(ctx, event.CreatedAt)
+	return nil
+}
+
+// ProcessFeeCharged adds a fee to the fee totals of its day and hour and to
+// the paying wallet's snapshots
+func (s *service) ProcessFeeCharged(ctx context.Context, event *FeeChargedEvent) error {
+	applied, err := s.processOnce(ctx, event.EventID, kafka.EventTypeFeeCharged, event, func(repo Repository) error {
+		if err := repo.AddFailuresAndFees(ctx, event.CreatedAt, event.Currency, 0, event.Fee); err != nil {
+			return err
+		}
+		if event.WalletID == "" {
+			return nil
+		}
+
+		snapshot := &UserSnapshot{
+			UserID:        event.WalletID,
+			SnapshotDate:  event.CreatedAt.Truncate(24 * time.Hour),
+			Currency:      event.Currency,
+			TotalSent:     money.Zero(),
+			TotalReceived: money.Zero(),
+			TotalFeesPaid: event.Fee,
+		}
+		if err := repo.UpsertUserSnapshot(ctx, snapshot); err != nil {
+			return fmt.Errorf("failed to update fee payer snapshot: %w", err)
+		}
+		if err := upsertUserHourlySnapshot(ctx, repo, snapshot, event.CreatedAt); err != nil {
+			return fmt.Errorf("failed to update fee payer snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil || !applied {
+		return err
+	}
+
+	s.invalidateAfter(ctx, event.CreatedAt)
+	return nil
+}
+
+// invalidateAfter drops the cached metrics of at's date once an event is applied
+func (s *service) invalidateAfter(ctx context.Context, at time.Time) {
+	if err := s.invalidateCacheForDate(ctx, at); err != nil {
+		// Log but don't fail - cache invalidation is not critical
+		fmt.Printf("Warning: failed to invalidate cache: %v\n", err)
+	}
+}
@@ -0,0 +1,112 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/internal/common/redis"
+)
+
+// testService returns a service on a fresh analytics schema, or skips when
+// PostgreSQL or Redis is not available
+func testService(t *testing.T) (Service, *sql.DB) {
+	conn := testDB(t)
+
+	client, err := redis.Connect(config.RedisConfig{
+		Host: getEnv("REDIS_HOST", "localhost"),
+		Port: getEnv("REDIS_PORT", "6379"),
+	}, logger.New("test"))
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return NewService(NewRepository(conn), client, nil, nil), conn
+}
+
+func TestProcessTransactionFailed(t *testing.T) {
+	service, conn := testService(t)
+	ctx := context.Background()
+	at := time.Date(2025, 3, 10, 5, 30, 0, 0, time.UTC)
+
+	failed := func(eventID string) *TransactionFailedEvent {
+		return &TransactionFailedEvent{
+			EventID: eventID, TransactionID: "t-" + eventID, FromWalletID: "w1", ToWalletID: "w2",
+			Amount: money.MustParse("10"), Currency: "USD", Reason: "insufficient balance", CreatedAt: at,
+		}
+	}
+
+	for _, eventID := range []string{"f1", "f1", "f2"} { // f1 is redelivered
+		if err := service.ProcessTransactionFailed(ctx, failed(eventID)); err != nil {
+			t.Fatalf("ProcessTransactionFailed(%s) failed: %v", eventID, err)
+		}
+	}
+
+	// Failures count as transactions but move no money
+	daily := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_date, currency, total_transactions, failed_transactions, total_volume, total_fees)
+		FROM daily_metrics`)
+	if !reflect.DeepEqual(daily, []string{"2025-03-10|USD|2|2|0.0000|0.0000"}) {
+		t.Errorf("Unexpected daily metrics: %v", daily)
+	}
+	hourly := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_hour, total_transactions, failed_transactions, total_volume)
+		FROM hourly_metrics`)
+	if !reflect.DeepEqual(hourly, []string{"2025-03-10 05:00:00|2|2|0.0000"}) {
+		t.Errorf("Unexpected hourly metrics: %v", hourly)
+	}
+	if users := queryStrings(t, conn, `SELECT user_id FROM user_snapshots`); len(users) != 0 {
+		t.Errorf("Expected no user snapshots, got %v", users)
+	}
+}
+
+func TestProcessFeeCharged(t *testing.T) {
+	service, conn := testService(t)
+	ctx := context.Background()
+	at := time.Date(2025, 3, 10, 5, 30, 0, 0, time.UTC)
+
+	events := []*FeeChargedEvent{
+		{EventID: "c1", TransactionID: "t1", WalletID: "w1", Fee: money.MustParse("0.5"), Currency: "USD", CreatedAt: at},
+		{EventID: "c1", TransactionID: "t1", WalletID: "w1", Fee: money.MustParse("0.5"), Currency: "USD", CreatedAt: at}, // Redelivered
+		{EventID: "c2", TransactionID: "t2", WalletID: "w1", Fee: money.MustParse("0.25"), Currency: "USD", CreatedAt: at.Add(time.Hour)},
+		{EventID: "c3", TransactionID: "t3", Fee: money.MustParse("1"), Currency: "USD", CreatedAt: at}, // Payer unknown
+	}
+	for _, event := range events {
+		if err := service.ProcessFeeCharged(ctx, event); err != nil {
+			t.Fatalf("ProcessFeeCharged(%s) failed: %v", event.EventID, err)
+		}
+	}
+
+	// Fees are revenue, not transactions
+	daily := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_date, currency, total_transactions, total_volume, total_fees)
+		FROM daily_metrics`)
+	if !reflect.DeepEqual(daily, []string{"2025-03-10|USD|0|0.0000|1.7500"}) {
+		t.Errorf("Unexpected daily metrics: %v", daily)
+	}
+	hourly := queryStrings(t, conn, `
+		SELECT concat_ws('|', metric_hour, total_transactions, total_fees)
+		FROM hourly_metrics ORDER BY metric_hour`)
+	if !reflect.DeepEqual(hourly, []string{"2025-03-10 05:00:00|0|1.5000", "2025-03-10 06:00:00|0|0.2500"}) {
+		t.Errorf("Unexpected hourly metrics: %v", hourly)
+	}
+
+	users := queryStrings(t, conn, `
+		SELECT concat_ws('|', user_id, snapshot_date, total_sent, total_fees_paid)
+		FROM user_snapshots`)
+	if !reflect.DeepEqual(users, []string{"w1|2025-03-10|0.0000|0.7500"}) {
+		t.Errorf("Unexpected user snapshots: %v", users)
+	}
+	hourlyUsers := queryStrings(t, conn, `
+		SELECT concat_ws('|', user_id, snapshot_hour, total_fees_paid)
+		FROM user_hourly_snapshots ORDER BY snapshot_hour`)
+	if !reflect.DeepEqual(hourlyUsers, []string{"w1|2025-03-10 05:00:00|0.5000", "w1|2025-03-10 06:00:00|0.2500"}) {
+		t.Errorf("Unexpected user hourly snapshots: %v", hourlyUsers)
+	}
+}
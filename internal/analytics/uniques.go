@@ -0,0 +1,123 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/kmassidik/mercuria/internal/common/redis"
+)
+
+// hourlyUsersRetention bounds how long per-hour sketches are kept; day and
+// month sketches are kept for good
+const hourlyUsersRetention = 90 * 24 * time.Hour
+
+// userVisit is one user seen transacting in a currency
+type userVisit struct {
+	Currency string
+	UserID   string
+	At       time.Time
+}
+
+// uniqueUsers counts distinct users per hour, day and month with Redis
+// HyperLogLog sketches
+// NOTE: Adding a user twice is a no-op, so redelivered events never inflate
+// the counts. Sketches of adjacent windows merge (PFCOUNT over several keys),
+// which answers arbitrary ranges with a standard error of about 0.8%. Keys use
+// the hll: prefix so cache invalidation (analytics:*) leaves them alone.
+type uniqueUsers struct {
+	redis *redis.Client
+}
+
+func newUniqueUsers(redisClient *redis.Client) *uniqueUsers {
+	return &uniqueUsers{redis: redisClient}
+}
+
+// Add records the visits in every window they fall in
+func (u *uniqueUsers) Add(ctx context.Context, visits ...userVisit) error {
+	if len(visits) == 0 {
+		return nil
+	}
+
+	_, err := u.redis.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, v := range visits {
+			at := v.At.UTC()
+			hour := at.Truncate(time.Hour)
+
+			pipe.PFAdd(ctx, monthUsersKey(v.Currency, at), v.UserID)
+			pipe.PFAdd(ctx, dayUsersKey(v.Currency, at), v.UserID)
+			pipe.PFAdd(ctx, hourUsersKey(v.Currency, hour), v.UserID)
+			pipe.ExpireAt(ctx, hourUsersKey(v.Currency, hour), hour.Add(hourlyUsersRetention))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record unique users: %w", err)
+	}
+	return nil
+}
+
+// Count returns the number of distinct users seen in any of the currencies
+// between the hours from and to, both inclusive
+func (u *uniqueUsers) Count(ctx context.Context, currencies []string, from, to time.Time) (int64, error) {
+	keys := []string{}
+	expired := time.Now().Add(-hourlyUsersRetention)
+	for _, currency := range currencies {
+		keys = append(keys, usersWindowKeys(currency, from, to, expired)...)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	count, err := u.redis.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unique users: %w", err)
+	}
+	return count, nil
+}
+
+// usersWindowKeys covers the hours from..to (inclusive) with as few sketches
+// as possible: whole months, then whole days, then single hours
+// NOTE: Hours up to expired have lost their sketch, so a partial day there is
+// widened to the whole day; the count may then include users seen in the
+// day's other hours, but never misses any.
+func usersWindowKeys(currency string, from, to, expired time.Time) []string {
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC().Truncate(time.Hour)
+
+	keys := []string{}
+	for t := from; !t.After(to); {
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		nextMonth := month.AddDate(0, 1, 0)
+		if t.Equal(month) && nextMonth.Add(-time.Hour).Compare(to) <= 0 {
+			keys = append(keys, monthUsersKey(currency, t))
+			t = nextMonth
+			continue
+		}
+
+		day := t.Truncate(24 * time.Hour)
+		nextDay := day.Add(24 * time.Hour)
+		if (t.Equal(day) && nextDay.Add(-time.Hour).Compare(to) <= 0) || !t.After(expired) {
+			keys = append(keys, dayUsersKey(currency, t))
+			t = nextDay
+			continue
+		}
+
+		keys = append(keys, hourUsersKey(currency, t))
+		t = t.Add(time.Hour)
+	}
+	return keys
+}
+
+func monthUsersKey(currency string, t time.Time) string {
+	return fmt.Sprintf("hll:analytics:users:month:%s:%s", t.Format("2006-01"), currency)
+}
+
+func dayUsersKey(currency string, t time.Time) string {
+	return fmt.Sprintf("hll:analytics:users:day:%s:%s", t.Format("2006-01-02"), currency)
+}
+
+func hourUsersKey(currency string, t time.Time) string {
+	return fmt.Sprintf("hll:analytics:users:hour:%s:%s", t.Format("2006-01-02T15"), currency)
+}
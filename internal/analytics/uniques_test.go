@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsersWindowKeys(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02T15", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	day := func(s string) string { return "hll:analytics:users:day:" + s + ":USD" }
+	hour := func(s string) string { return "hll:analytics:users:hour:" + s + ":USD" }
+	month := func(s string) string { return "hll:analytics:users:month:" + s + ":USD" }
+	never := at("2000-01-01T00")
+
+	tests := []struct {
+		name     string
+		from, to string
+		expired  time.Time
+		want     []string
+	}{
+		{"single hour", "2025-03-10T05", "2025-03-10T05", never, []string{hour("2025-03-10T05")}},
+		{"whole day", "2025-03-10T00", "2025-03-10T23", never, []string{day("2025-03-10")}},
+		{"whole month", "2025-02-01T00", "2025-02-28T23", never, []string{month("2025-02")}},
+		{"hours then day then hours", "2025-03-09T22", "2025-03-11T01", never, []string{
+			hour("2025-03-09T22"), hour("2025-03-09T23"),
+			day("2025-03-10"),
+			hour("2025-03-11T00"), hour("2025-03-11T01"),
+		}},
+		{"days then month", "2025-01-30T00", "2025-02-28T23", never, []string{
+			day("2025-01-30"), day("2025-01-31"), month("2025-02"),
+		}},
+		{"expired partial day widens", "2025-03-10T05", "2025-03-10T06", at("2025-03-20T00"), []string{day("2025-03-10")}},
+		{"expiry ends mid-range", "2025-03-10T22", "2025-03-11T01", at("2025-03-10T23"), []string{
+			day("2025-03-10"),
+			hour("2025-03-11T00"), hour("2025-03-11T01"),
+		}},
+		{"empty range", "2025-03-10T05", "2025-03-10T04", never, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := usersWindowKeys("USD", at(tt.from), at(tt.to), tt.expired)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("usersWindowKeys(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
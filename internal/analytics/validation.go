@@ -2,9 +2,13 @@ package analytics
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 )
 
+// currencyRegex matches ISO 4217 currency codes
+var currencyRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
 // ValidateDateRange validates start and end dates
 func ValidateDateRange(startDate, endDate time.Time, maxDays int) error {
 	if endDate.Before(startDate) {
@@ -29,6 +33,14 @@ func ValidatePeriod(period string) error {
 	return nil
 }
 
+// ValidateCurrency validates a currency code filter or rate table entry
+func ValidateCurrency(currency string) error {
+	if !currencyRegex.MatchString(currency) {
+		return fmt.Errorf("invalid currency %q: must be a 3-letter ISO 4217 code", currency)
+	}
+	return nil
+}
+
 // ValidateUserID validates user ID format
 func ValidateUserID(userID string) error {
 	if userID == "" {
@@ -56,14 +68,18 @@ func ValidateLedgerEvent(event *LedgerEntryCreatedEvent) error {
 		return fmt.Errorf("transaction_id is required")
 	}
 
-	if event.Amount < 0 {
+	if event.Amount.Sign() < 0 {
 		return fmt.Errorf("amount must be non-negative")
 	}
 
-	if event.Fee < 0 {
+	if event.Fee.Sign() < 0 {
 		return fmt.Errorf("fee must be non-negative")
 	}
 
+	if err := ValidateCurrency(event.Currency); err != nil {
+		return err
+	}
+
 	if event.Status == "" {
 		return fmt.Errorf("status is required")
 	}
@@ -89,11 +105,11 @@ func ValidateDailyMetric(metric *DailyMetric) error {
 		return fmt.Errorf("total_transactions cannot be negative")
 	}
 
-	if metric.TotalVolume < 0 {
+	if metric.TotalVolume.Sign() < 0 {
 		return fmt.Errorf("total_volume cannot be negative")
 	}
 
-	if metric.TotalFees < 0 {
+	if metric.TotalFees.Sign() < 0 {
 		return fmt.Errorf("total_fees cannot be negative")
 	}
 
@@ -118,19 +134,19 @@ func ValidateHourlyMetric(metric *HourlyMetric) error {
 		return fmt.Errorf("total_transactions cannot be negative")
 	}
 
-	if metric.TotalVolume < 0 {
+	if metric.TotalVolume.Sign() < 0 {
 		return fmt.Errorf("total_volume cannot be negative")
 	}
 
-	if metric.MaxTransactionValue < 0 {
+	if metric.MaxTransactionValue.Sign() < 0 {
 		return fmt.Errorf("max_transaction_value cannot be negative")
 	}
 
-	if metric.MinTransactionValue < 0 {
+	if metric.MinTransactionValue.Sign() < 0 {
 		return fmt.Errorf("min_transaction_value cannot be negative")
 	}
 
-	if metric.MaxTransactionValue < metric.MinTransactionValue {
+	if metric.MaxTransactionValue.Cmp(metric.MinTransactionValue) < 0 {
 		return fmt.Errorf("max_transaction_value must be >= min_transaction_value")
 	}
 
@@ -151,11 +167,11 @@ func ValidateUserSnapshot(snapshot *UserSnapshot) error {
 		return fmt.Errorf("snapshot_date is required")
 	}
 
-	if snapshot.TotalSent < 0 {
+	if snapshot.TotalSent.Sign() < 0 {
 		return fmt.Errorf("total_sent cannot be negative")
 	}
 
-	if snapshot.TotalReceived < 0 {
+	if snapshot.TotalReceived.Sign() < 0 {
 		return fmt.Errorf("total_received cannot be negative")
 	}
 
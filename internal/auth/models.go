@@ -11,6 +11,7 @@ type User struct {
 	PasswordHash string    `json:"-"` // Never expose in JSON
 	FirstName    string    `json:"first_name,omitempty"`
 	LastName     string    `json:"last_name,omitempty"`
+	Timezone     string    `json:"timezone"` // IANA name, e.g. Asia/Jakarta
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -31,6 +32,13 @@ type RegisterRequest struct {
 	Password  string `json:"password"`
 	FirstName string `json:"first_name,omitempty"`
 	LastName  string `json:"last_name,omitempty"`
+	Timezone  string `json:"timezone,omitempty"` // Defaults to UTC
+}
+
+// UpdateProfileRequest represents a profile update request
+// NOTE: Omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Timezone *string `json:"timezone,omitempty"`
 }
 
 // LoginRequest represents a login request
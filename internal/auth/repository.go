@@ -24,8 +24,8 @@ func NewRepository(database *db.DB, log *logger.Logger) *Repository {
 // CreateUser creates a new user
 func (r *Repository) CreateUser(ctx context.Context, user *User) (*User, error) {
 	query := `
-		INSERT INTO users (email, password_hash, first_name, last_name)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (email, password_hash, first_name, last_name, timezone)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -36,6 +36,7 @@ func (r *Repository) CreateUser(ctx context.Context, user *User) (*User, error)
 		user.PasswordHash,
 		user.FirstName,
 		user.LastName,
+		user.Timezone,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -49,7 +50,7 @@ func (r *Repository) CreateUser(ctx context.Context, user *User) (*User, error)
 // GetUserByEmail retrieves a user by email
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, email, password_hash, first_name, last_name, created_at, updated_at
+		SELECT id, email, password_hash, first_name, last_name, timezone, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -61,6 +62,7 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*User, e
 		&user.PasswordHash,
 		&user.FirstName,
 		&user.LastName,
+		&user.Timezone,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -78,7 +80,7 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*User, e
 // GetUserByID retrieves a user by ID
 func (r *Repository) GetUserByID(ctx context.Context, id string) (*User, error) {
 	query := `
-		SELECT id, email, password_hash, first_name, last_name, created_at, updated_at
+		SELECT id, email, password_hash, first_name, last_name, timezone, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -90,6 +92,7 @@ func (r *Repository) GetUserByID(ctx context.Context, id string) (*User, error)
 		&user.PasswordHash,
 		&user.FirstName,
 		&user.LastName,
+		&user.Timezone,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -104,6 +107,30 @@ func (r *Repository) GetUserByID(ctx context.Context, id string) (*User, error)
 	return user, nil
 }
 
+// UpdateTimezone sets a user's profile timezone
+func (r *Repository) UpdateTimezone(ctx context.Context, id, timezone string) error {
+	query := `
+		UPDATE users
+		SET timezone = $2
+		WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, timezone)
+	if err != nil {
+		return fmt.Errorf("failed to update timezone: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update timezone: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
 // CreateRefreshToken creates a refresh token
 func (r *Repository) CreateRefreshToken(ctx context.Context, token *RefreshToken) (*RefreshToken, error) {
 	query := `
@@ -15,4 +15,5 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, jwtSecret string) {
 	// Protected routes
 	protected := middleware.JWTAuth(jwtSecret)
 	mux.Handle("GET /api/v1/me", protected(http.HandlerFunc(h.Me)))
+	mux.Handle("PATCH /api/v1/me", protected(http.HandlerFunc(h.UpdateMe)))
 }
\ No newline at end of file
@@ -51,6 +51,7 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*AuthResp
 		PasswordHash: passwordHash,
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
+		Timezone:     req.Timezone,
 	}
 
 	createdUser, err := s.repo.CreateUser(ctx, user)
@@ -59,7 +60,7 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*AuthResp
 	}
 
 	// Generate tokens
-	accessToken, err := middleware.GenerateToken(createdUser.ID, createdUser.Email, s.config)
+	accessToken, err := middleware.GenerateTokenWithTimezone(createdUser.ID, createdUser.Email, createdUser.Timezone, s.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -109,7 +110,7 @@ func (s *Service) Login(ctx context.Context, req *LoginRequest) (*AuthResponse,
 	}
 
 	// Generate tokens
-	accessToken, err := middleware.GenerateToken(user.ID, user.Email, s.config)
+	accessToken, err := middleware.GenerateTokenWithTimezone(user.ID, user.Email, user.Timezone, s.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -172,7 +173,7 @@ func (s *Service) RefreshAccessToken(ctx context.Context, refreshTokenString str
 	}
 
 	// Generate new access token
-	accessToken, err := middleware.GenerateToken(user.ID, user.Email, s.config)
+	accessToken, err := middleware.GenerateTokenWithTimezone(user.ID, user.Email, user.Timezone, s.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -220,6 +221,23 @@ func (s *Service) GetCurrentUser(ctx context.Context, userID string) (*User, err
 	return user, nil
 }
 
+// UpdateProfile updates the current user's profile
+// NOTE: Access tokens carry the timezone, so services see a new one once the
+// client refreshes its token
+func (s *Service) UpdateProfile(ctx context.Context, userID string, req *UpdateProfileRequest) (*User, error) {
+	if err := ValidateUpdateProfileRequest(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if err := s.repo.UpdateTimezone(ctx, userID, *req.Timezone); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Profile updated for user: %s", userID)
+
+	return s.repo.GetUserByID(ctx, userID)
+}
+
 // hashToken creates a SHA-256 hash of a token
 func hashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
@@ -58,6 +59,45 @@ func ValidateRegisterRequest(req *RegisterRequest) error {
 	req.FirstName = strings.TrimSpace(req.FirstName)
 	req.LastName = strings.TrimSpace(req.LastName)
 
+	timezone, err := ValidateTimezone(req.Timezone)
+	if err != nil {
+		return err
+	}
+	req.Timezone = timezone
+
+	return nil
+}
+
+// ValidateTimezone validates an IANA timezone name; empty means UTC
+func ValidateTimezone(timezone string) (string, error) {
+	timezone = strings.TrimSpace(timezone)
+	if timezone == "" {
+		return "UTC", nil
+	}
+
+	// LoadLocation also accepts "Local", which means nothing to other services
+	if timezone == "Local" {
+		return "", fmt.Errorf("invalid timezone: %s", timezone)
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return "", fmt.Errorf("invalid timezone: %s", timezone)
+	}
+
+	return timezone, nil
+}
+
+// ValidateUpdateProfileRequest validates a profile update request
+func ValidateUpdateProfileRequest(req *UpdateProfileRequest) error {
+	if req.Timezone == nil {
+		return fmt.Errorf("nothing to update")
+	}
+
+	timezone, err := ValidateTimezone(*req.Timezone)
+	if err != nil {
+		return err
+	}
+	req.Timezone = &timezone
+
 	return nil
 }
 
@@ -13,7 +13,11 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	Kafka    KafkaConfig
-	JWT      JWTConfig
+	Outbox    OutboxConfig
+	Analytics AnalyticsConfig
+	Ledger    LedgerConfig
+	Transaction TransactionConfig
+	JWT       JWTConfig
 }
 
 type ServiceConfig struct {
@@ -41,8 +45,44 @@ type RedisConfig struct {
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	GroupID string
+	Brokers         []string
+	GroupID         string
+	MaxRetries      int           // Handler retries before a message is dead-lettered
+	RetryBackoff    time.Duration // First retry delay, doubled per attempt
+	RetryMaxBackoff time.Duration // Upper bound for the retry delay
+	Workers         int           // Consumer goroutines; same-key messages stay on one worker
+	MaxInFlight     int           // Uncommitted messages before the consumer stops fetching
+	OffsetsInDB     bool          // Store consumed offsets in the service DB with the business writes
+}
+
+type OutboxConfig struct {
+	Retention time.Duration // Published events older than this are deleted (0 = keep forever)
+}
+
+type AnalyticsConfig struct {
+	ReportingCurrency string            // Currency converted totals are reported in ("" = no conversion)
+	ExchangeRates     map[string]string // Units of ReportingCurrency per unit of each currency
+
+	AnomalyThreshold     float64 // z-score at which a value is flagged
+	AnomalyBaselineWeeks int     // Weeks of the same hour-of-week an hour is compared with
+	AnomalyUserDays      int     // Days of snapshot history a user's spending is compared with
+
+	RetryMaxAttempts int           // Attempts after which a failed event is given up
+	RetryBackoff     time.Duration // First retry delay for a failed event, doubled per attempt
+	RetryMaxBackoff  time.Duration // Upper bound for the retry delay
+}
+
+type LedgerConfig struct {
+	ArchiveDir           string        // Where archived monthly partitions are written
+	PartitionMonthsAhead int           // Future monthly partitions kept created
+	HotMonths            int           // Months kept in Postgres before they may be archived
+	AutoArchive          bool          // Archive months past HotMonths without an operator
+	MaintenanceInterval  time.Duration // How often partitions are created and archived
+}
+
+type TransactionConfig struct {
+	FeeRate    string            // Fraction of each transfer charged as a fee ("" = no fees)
+	FeeWallets map[string]string // Wallet collecting fees, per currency; other currencies are not charged
 }
 
 type JWTConfig struct {
@@ -95,8 +135,40 @@ func Load(serviceName string) (*Config, error) {
 			DB:       getEnvAsInt("REDIS_DB", 0),
 		},
 		Kafka: KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
-			GroupID: fmt.Sprintf("%s-group", serviceName),
+			Brokers:         []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
+			GroupID:         fmt.Sprintf("%s-group", serviceName),
+			MaxRetries:      getEnvAsInt("KAFKA_MAX_RETRIES", 3),
+			RetryBackoff:    getEnvAsDuration("KAFKA_RETRY_BACKOFF", 1*time.Second),
+			RetryMaxBackoff: getEnvAsDuration("KAFKA_RETRY_MAX_BACKOFF", 30*time.Second),
+			Workers:         getEnvAsInt("KAFKA_CONSUMER_WORKERS", 8),
+			MaxInFlight:     getEnvAsInt("KAFKA_MAX_IN_FLIGHT", 256),
+			OffsetsInDB:     getEnvAsBool("KAFKA_DB_OFFSETS", false),
+		},
+		Outbox: OutboxConfig{
+			Retention: getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		},
+		Analytics: AnalyticsConfig{
+			ReportingCurrency: strings.ToUpper(getEnv("ANALYTICS_REPORTING_CURRENCY", "")),
+			ExchangeRates:     getEnvAsMap("ANALYTICS_EXCHANGE_RATES"),
+
+			AnomalyThreshold:     getEnvAsFloat("ANALYTICS_ANOMALY_THRESHOLD", 4),
+			AnomalyBaselineWeeks: getEnvAsInt("ANALYTICS_ANOMALY_BASELINE_WEEKS", 8),
+			AnomalyUserDays:      getEnvAsInt("ANALYTICS_ANOMALY_USER_DAYS", 30),
+
+			RetryMaxAttempts: getEnvAsInt("ANALYTICS_RETRY_MAX_ATTEMPTS", 10),
+			RetryBackoff:     getEnvAsDuration("ANALYTICS_RETRY_BACKOFF", time.Minute),
+			RetryMaxBackoff:  getEnvAsDuration("ANALYTICS_RETRY_MAX_BACKOFF", 6*time.Hour),
+		},
+		Ledger: LedgerConfig{
+			ArchiveDir:           getEnv("LEDGER_ARCHIVE_DIR", "./archives/ledger"),
+			PartitionMonthsAhead: getEnvAsInt("LEDGER_PARTITION_MONTHS_AHEAD", 3),
+			HotMonths:            getEnvAsInt("LEDGER_HOT_MONTHS", 24),
+			AutoArchive:          getEnvAsBool("LEDGER_AUTO_ARCHIVE", false),
+			MaintenanceInterval:  getEnvAsDuration("LEDGER_MAINTENANCE_INTERVAL", 24*time.Hour),
+		},
+		Transaction: TransactionConfig{
+			FeeRate:    getEnv("TRANSACTION_FEE_RATE", ""),
+			FeeWallets: getEnvAsMap("TRANSACTION_FEE_WALLETS"),
 		},
 		JWT: JWTConfig{
 			Secret:          getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
@@ -141,4 +213,36 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsMap parses "KEY=value,KEY=value"; keys are upper-cased and entries
+// without "=" are skipped
+func getEnvAsMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		result[strings.ToUpper(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return result
+}
@@ -88,4 +88,91 @@ func TestGetEnvAsDuration(t *testing.T) {
 	if duration != 2*time.Minute {
 		t.Errorf("Expected 2m, got %v", duration)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetEnvAsBool(t *testing.T) {
+	os.Setenv("TEST_BOOL", "true")
+	defer os.Unsetenv("TEST_BOOL")
+
+	if !getEnvAsBool("TEST_BOOL", false) {
+		t.Error("Expected true")
+	}
+
+	// Invalid values fall back to the default
+	os.Setenv("TEST_BOOL", "maybe")
+	if !getEnvAsBool("TEST_BOOL", true) {
+		t.Error("Expected default true for invalid value")
+	}
+
+	if getEnvAsBool("NON_EXISTENT", false) {
+		t.Error("Expected default false")
+	}
+}
+
+func TestGetEnvAsFloat(t *testing.T) {
+	os.Setenv("TEST_FLOAT", "2.5")
+	defer os.Unsetenv("TEST_FLOAT")
+
+	if got := getEnvAsFloat("TEST_FLOAT", 1); got != 2.5 {
+		t.Errorf("Expected 2.5, got %v", got)
+	}
+
+	// Invalid values fall back to the default
+	os.Setenv("TEST_FLOAT", "high")
+	if got := getEnvAsFloat("TEST_FLOAT", 4); got != 4 {
+		t.Errorf("Expected default 4 for invalid value, got %v", got)
+	}
+}
+
+func TestGetEnvAsMap(t *testing.T) {
+	os.Setenv("TEST_MAP", "idr=0.000063, JPY = 0.0066,broken")
+	defer os.Unsetenv("TEST_MAP")
+
+	got := getEnvAsMap("TEST_MAP")
+	if len(got) != 2 || got["IDR"] != "0.000063" || got["JPY"] != "0.0066" {
+		t.Errorf("getEnvAsMap = %v", got)
+	}
+
+	if len(getEnvAsMap("NON_EXISTENT")) != 0 {
+		t.Error("Expected empty map")
+	}
+}
+
+func TestLoadLedgerConfig(t *testing.T) {
+	t.Setenv("LEDGER_HOT_MONTHS", "36")
+	t.Setenv("LEDGER_AUTO_ARCHIVE", "1")
+	t.Setenv("LEDGER_PARTITION_MONTHS_AHEAD", "soon")
+
+	cfg, err := Load("ledger")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := LedgerConfig{
+		ArchiveDir:           "./archives/ledger",
+		PartitionMonthsAhead: 3,
+		HotMonths:            36,
+		AutoArchive:          true,
+		MaintenanceInterval:  24 * time.Hour,
+	}
+	if cfg.Ledger != want {
+		t.Errorf("Ledger = %+v, want %+v", cfg.Ledger, want)
+	}
+}
+
+func TestLoadTransactionConfig(t *testing.T) {
+	t.Setenv("TRANSACTION_FEE_RATE", "0.005")
+	t.Setenv("TRANSACTION_FEE_WALLETS", "usd=w1,EUR=w2")
+
+	cfg, err := Load("transaction")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Transaction.FeeRate != "0.005" {
+		t.Errorf("FeeRate = %q, want 0.005", cfg.Transaction.FeeRate)
+	}
+	if len(cfg.Transaction.FeeWallets) != 2 || cfg.Transaction.FeeWallets["USD"] != "w1" || cfg.Transaction.FeeWallets["EUR"] != "w2" {
+		t.Errorf("Unexpected FeeWallets: %v", cfg.Transaction.FeeWallets)
+	}
+}
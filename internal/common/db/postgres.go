@@ -18,14 +18,18 @@ type DB struct {
 
 type TxFunc func(ctx context.Context, tx *sql.Tx) error
 
-// Connect establishes a connection to PostgreSQL
-func Connect(cfg config.DatabaseConfig, log *logger.Logger) (*DB, error) {
-	dsn := fmt.Sprintf(
+// DSN builds the lib/pq connection string for cfg
+// NOTE: Also used for dedicated connections such as LISTEN
+func DSN(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+// Connect establishes a connection to PostgreSQL
+func Connect(cfg config.DatabaseConfig, log *logger.Logger) (*DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -3,7 +3,11 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/config"
@@ -11,14 +15,81 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// Headers added to dead-lettered messages
+const (
+	HeaderDLQError        = "x-dlq-error"
+	HeaderDLQTopic        = "x-dlq-original-topic"
+	HeaderDLQPartition    = "x-dlq-original-partition"
+	HeaderDLQOffset       = "x-dlq-original-offset"
+	HeaderDLQGroup        = "x-dlq-consumer-group"
+	HeaderDLQAttempts     = "x-dlq-attempts"
+	HeaderDLQFailedAt     = "x-dlq-failed-at"
+	HeaderDLQReplayedFrom = "x-dlq-replayed-from"
+)
+
+// DLQTopic returns the dead-letter topic for a topic
+func DLQTopic(topic string) string {
+	return topic + ".dlq"
+}
+
 type Consumer struct {
-	reader *kafka.Reader
-	logger *logger.Logger
+	reader      *kafka.Reader
+	dlq         *kafka.Writer
+	topic       string
+	group       string
+	retry       RetryPolicy
+	workers     int
+	maxInFlight int
+	byPartition bool // Order per partition instead of per key (stored offsets)
+	logger      *logger.Logger
+}
+
+// RetryPolicy controls how often a failing message is retried before it is
+// routed to the dead-letter topic
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration // First retry delay, doubled per attempt
+	MaxBackoff time.Duration
+}
+
+// delay returns the backoff before retry number attempt (1-based)
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
 }
 
 // EventHandler is a function that processes Kafka events
 type EventHandler func(ctx context.Context, key []byte, value []byte) error
 
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler error so the message skips retries and goes
+// straight to the dead-letter topic (e.g. malformed or unknown events)
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(cfg config.KafkaConfig, topic string, log *logger.Logger) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
@@ -32,55 +103,254 @@ func NewConsumer(cfg config.KafkaConfig, topic string, log *logger.Logger) *Cons
 		MaxWait:        500 * time.Millisecond,
 	})
 
-	log.Infof("Kafka consumer initialized for topic: %s", topic)
+	dlq := &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Topic:                  DLQTopic(topic),
+		Balancer:               &kafka.LeastBytes{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	maxInFlight := cfg.MaxInFlight
+	if maxInFlight < workers {
+		maxInFlight = workers
+	}
+
+	log.Infof("Kafka consumer initialized for topic: %s (workers=%d, max_in_flight=%d, retries=%d, dlq=%s)",
+		topic, workers, maxInFlight, cfg.MaxRetries, DLQTopic(topic))
 
 	return &Consumer{
 		reader: reader,
-		logger: log,
+		dlq:    dlq,
+		topic:  topic,
+		group:  cfg.GroupID,
+		retry: RetryPolicy{
+			MaxRetries: cfg.MaxRetries,
+			Backoff:    cfg.RetryBackoff,
+			MaxBackoff: cfg.RetryMaxBackoff,
+		},
+		workers:     workers,
+		maxInFlight: maxInFlight,
+		logger:      log,
 	}
 }
 
 // Consume starts consuming messages and calls the handler for each message
-func (c *Consumer) Consume(ctx context.Context, handler EventHandler) error {
+// NOTE: Messages are spread over workers by key, so events with the same key
+// are handled in order while different keys run in parallel. A partition is
+// committed up to its lowest contiguous processed offset, and fetching pauses
+// once maxInFlight messages are uncommitted. A failing message is retried with
+// backoff, then dead-lettered and committed, so one poison message cannot
+// stall its partition.
+func (c *Consumer) Consume(ctx context.Context, handler EventHandler) (err error) {
 	c.logger.Info("Starting Kafka consumer")
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// A worker that cannot dead-letter a message stops the whole consumer
+	var failure error
+	var failOnce sync.Once
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+
+	tracker := newOffsetTracker()
+	inFlight := make(chan struct{}, c.maxInFlight)
+
+	queues := make([]chan kafka.Message, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, c.maxInFlight)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.work(ctx, queue, handler, tracker, inFlight, fail)
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+		if failure != nil {
+			err = failure
+		}
+	}()
+
 	for {
+		// Backpressure: wait for a free slot before fetching more
 		select {
 		case <-ctx.Done():
 			c.logger.Info("Consumer context cancelled")
 			return ctx.Err()
-		default:
-			msg, err := c.reader.FetchMessage(ctx)
-			if err != nil {
-				if err == context.Canceled || err == context.DeadlineExceeded {
-					c.logger.Info("Consumer stopped")
-					return err
-				}
-				c.logger.Errorf("Failed to fetch message: %v", err)
-				time.Sleep(1 * time.Second) // Backoff on error
-				continue
+		case inFlight <- struct{}{}:
+		}
+
+		msg, fetchErr := c.reader.FetchMessage(ctx)
+		if fetchErr != nil {
+			<-inFlight
+			if ctx.Err() != nil || fetchErr == context.Canceled || fetchErr == context.DeadlineExceeded {
+				c.logger.Info("Consumer stopped")
+				return ctx.Err()
 			}
+			c.logger.Errorf("Failed to fetch message: %v", fetchErr)
+			time.Sleep(1 * time.Second) // Backoff on error
+			continue
+		}
+
+		c.logger.Debugf("Received message from topic %s: key=%s", msg.Topic, string(msg.Key))
+
+		tracker.track(msg.Partition, msg.Offset)
+		queues[c.worker(msg)] <- msg
+	}
+}
 
-			c.logger.Debugf("Received message from topic %s: key=%s", msg.Topic, string(msg.Key))
+// work processes one worker's queue; it stops the consumer if a message can
+// neither be handled nor dead-lettered
+func (c *Consumer) work(ctx context.Context, queue <-chan kafka.Message, handler EventHandler, tracker *offsetTracker, inFlight <-chan struct{}, fail func(error)) {
+	for msg := range queue {
+		if ctx.Err() != nil {
+			// Shutting down: leave the rest uncommitted for the next run
+			<-inFlight
+			continue
+		}
 
-			// Process message
-			if err := handler(ctx, msg.Key, msg.Value); err != nil {
-				c.logger.Errorf("Failed to process message: %v", err)
-				// Don't commit on error - message will be retried
+		if attempts, err := c.handle(ctx, msg, handler); err != nil {
+			if ctx.Err() != nil {
+				<-inFlight
 				continue
 			}
+			if err := c.deadLetter(ctx, msg, err, attempts); err != nil {
+				<-inFlight
+				fail(err)
+				continue
+			}
+		}
 
-			// Commit message
-			if err := c.reader.CommitMessages(ctx, msg); err != nil {
+		if offset, ok := tracker.done(msg.Partition, msg.Offset); ok {
+			commit := kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: offset}
+			if err := c.reader.CommitMessages(ctx, commit); err != nil {
 				c.logger.Errorf("Failed to commit message: %v", err)
 			}
 		}
+		<-inFlight
+	}
+}
+
+// worker picks the worker for a message by key; keyless messages stay ordered
+// per partition
+func (c *Consumer) worker(msg kafka.Message) int {
+	key := msg.Key
+	if len(key) == 0 || c.byPartition {
+		key = []byte(strconv.Itoa(msg.Partition))
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// handle runs the handler with retries and returns the attempts made
+// NOTE: The handler's ctx carries the message Position (see OffsetStore)
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message, handler EventHandler) (int, error) {
+	ctx = ContextWithPosition(ctx, Position{
+		Group:     c.group,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+
+	attempt := 1
+	for {
+		err := handler(ctx, msg.Key, msg.Value)
+		if err == nil {
+			return attempt, nil
+		}
+
+		if IsPermanent(err) || attempt > c.retry.MaxRetries {
+			return attempt, err
+		}
+
+		delay := c.retry.delay(attempt)
+		c.logger.Warnf("Failed to process message %s[%d]@%d (attempt %d/%d), retrying in %s: %v",
+			msg.Topic, msg.Partition, msg.Offset, attempt, c.retry.MaxRetries+1, delay, err)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return attempt, err
+		}
+		attempt++
+	}
+}
+
+// deadLetter publishes a failed message to the dead-letter topic
+// NOTE: Retries until the DLQ accepts the message - committing without it
+// would lose the event
+func (c *Consumer) deadLetter(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	c.logger.Errorf("Dead-lettering message %s[%d]@%d after %d attempt(s): %v",
+		msg.Topic, msg.Partition, msg.Offset, attempts, cause)
+
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderDLQGroup, Value: []byte(c.group)},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	dlqMsg := kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.dlq.WriteMessages(ctx, dlqMsg)
+		if err == nil {
+			return nil
+		}
+
+		delay := c.retry.delay(attempt)
+		c.logger.Errorf("Failed to publish to %s (retrying in %s): %v", DLQTopic(c.topic), delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		d = time.Second
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
 }
 
 // Close closes the consumer
 func (c *Consumer) Close() error {
 	c.logger.Info("Closing Kafka consumer")
+	if err := c.dlq.Close(); err != nil {
+		c.logger.Errorf("Failed to close DLQ writer: %v", err)
+	}
 	return c.reader.Close()
 }
 
@@ -90,4 +360,4 @@ func UnmarshalEvent(value []byte, v interface{}) error {
 		return fmt.Errorf("failed to unmarshal event: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 1 * time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("bad payload")
+
+	if IsPermanent(base) {
+		t.Error("Expected plain error not to be permanent")
+	}
+
+	wrapped := fmt.Errorf("handler: %w", Permanent(base))
+	if !IsPermanent(wrapped) {
+		t.Error("Expected wrapped permanent error to be permanent")
+	}
+	if !errors.Is(wrapped, base) {
+		t.Error("Expected permanent error to unwrap to the cause")
+	}
+
+	if Permanent(nil) != nil {
+		t.Error("Expected Permanent(nil) to be nil")
+	}
+}
+
+func TestToDLQMessage(t *testing.T) {
+	msg := kafka.Message{
+		Partition: 1,
+		Offset:    42,
+		Key:       []byte("txn-1"),
+		Value:     []byte(`{"id":"evt-1"}`),
+		Headers: []kafka.Header{
+			{Key: HeaderDLQError, Value: []byte("boom")},
+			{Key: HeaderDLQTopic, Value: []byte("transaction.completed")},
+			{Key: HeaderDLQPartition, Value: []byte("3")},
+			{Key: HeaderDLQOffset, Value: []byte("1000")},
+			{Key: HeaderDLQAttempts, Value: []byte("4")},
+			{Key: HeaderDLQFailedAt, Value: []byte("2025-01-02T03:04:05Z")},
+		},
+	}
+
+	m := toDLQMessage(msg)
+	if m.Error != "boom" || m.OriginalTopic != "transaction.completed" {
+		t.Errorf("Unexpected headers: %+v", m)
+	}
+	if m.OriginalPartition != 3 || m.OriginalOffset != 1000 || m.Attempts != 4 {
+		t.Errorf("Unexpected numeric headers: %+v", m)
+	}
+	if m.FailedAt.IsZero() {
+		t.Error("Expected failed_at to be parsed")
+	}
+
+	// Non-JSON payloads stay printable
+	msg.Value = []byte("not json")
+	if m := toDLQMessage(msg); string(m.Value) != `"not json"` {
+		t.Errorf("Expected quoted value, got %s", m.Value)
+	}
+
+	if DLQTopic("ledger.entry_created") != "ledger.entry_created.dlq" {
+		t.Error("Unexpected DLQ topic name")
+	}
+}
+
+func TestOffsetTrackerCommitsContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	for _, offset := range []int64{10, 11, 13, 14} {
+		tracker.track(0, offset)
+	}
+	tracker.track(1, 5)
+
+	steps := []struct {
+		partition int
+		offset    int64
+		want      int64
+		ok        bool
+	}{
+		{0, 11, 0, false}, // 10 still in flight
+		{0, 14, 0, false},
+		{1, 5, 5, true}, // partitions advance independently
+		{0, 10, 11, true},
+		{0, 13, 14, true}, // gap at 12 was never fetched
+	}
+
+	for _, s := range steps {
+		got, ok := tracker.done(s.partition, s.offset)
+		if got != s.want || ok != s.ok {
+			t.Errorf("done(%d, %d) = %d, %v, want %d, %v", s.partition, s.offset, got, ok, s.want, s.ok)
+		}
+	}
+}
+
+func TestOffsetTrackerResetsOnRewind(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(0, 20)
+	tracker.track(0, 21)
+
+	// After a rebalance the reader redelivers from the committed offset
+	tracker.track(0, 20)
+
+	if got, ok := tracker.done(0, 20); !ok || got != 20 {
+		t.Errorf("done(0, 20) = %d, %v, want 20, true", got, ok)
+	}
+}
+
+func TestConsumerWorkerKeepsKeyOnOneWorker(t *testing.T) {
+	c := &Consumer{workers: 8}
+
+	first := c.worker(kafka.Message{Key: []byte("wallet-1"), Partition: 0})
+	for p := 1; p < 4; p++ {
+		if got := c.worker(kafka.Message{Key: []byte("wallet-1"), Partition: p}); got != first {
+			t.Errorf("Expected key to map to worker %d, got %d", first, got)
+		}
+	}
+
+	if got := c.worker(kafka.Message{Partition: 3}); got != c.worker(kafka.Message{Partition: 3}) {
+		t.Error("Expected keyless messages of a partition to share a worker")
+	}
+}
+
+func TestConsumerWorkerByPartition(t *testing.T) {
+	c := &Consumer{workers: 8, byPartition: true}
+
+	a := c.worker(kafka.Message{Key: []byte("wallet-1"), Partition: 2})
+	b := c.worker(kafka.Message{Key: []byte("wallet-2"), Partition: 2})
+	if a != b {
+		t.Errorf("Expected messages of one partition on one worker, got %d and %d", a, b)
+	}
+}
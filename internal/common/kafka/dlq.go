@@ -0,0 +1,351 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/segmentio/kafka-go"
+)
+
+// DLQMessage is a dead-lettered message with its failure details
+type DLQMessage struct {
+	Partition         int             `json:"partition"`
+	Offset            int64           `json:"offset"`
+	Key               string          `json:"key"`
+	Value             json.RawMessage `json:"value"`
+	Error             string          `json:"error"`
+	OriginalTopic     string          `json:"original_topic"`
+	OriginalPartition int             `json:"original_partition"`
+	OriginalOffset    int64           `json:"original_offset"`
+	ConsumerGroup     string          `json:"consumer_group"`
+	Attempts          int             `json:"attempts"`
+	FailedAt          time.Time       `json:"failed_at"`
+}
+
+// DLQAdmin inspects, replays and discards dead-lettered messages
+// NOTE: Progress is tracked as the committed offset of a dedicated consumer
+// group (<group>-dlq-admin): messages below it have been replayed or discarded
+type DLQAdmin struct {
+	cfg    config.KafkaConfig
+	topic  string
+	dlq    string
+	group  string
+	client *kafka.Client
+	logger *logger.Logger
+}
+
+func NewDLQAdmin(cfg config.KafkaConfig, topic string, log *logger.Logger) *DLQAdmin {
+	return &DLQAdmin{
+		cfg:    cfg,
+		topic:  topic,
+		dlq:    DLQTopic(topic),
+		group:  cfg.GroupID + "-dlq-admin",
+		client: &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: 10 * time.Second},
+		logger: log,
+	}
+}
+
+// List returns up to limit pending messages, oldest first per partition
+func (a *DLQAdmin) List(ctx context.Context, partition int, limit int) ([]DLQMessage, error) {
+	messages := []DLQMessage{}
+
+	err := a.eachPending(ctx, partition, -1, func(msg kafka.Message) error {
+		if len(messages) >= limit {
+			return errStopRead
+		}
+		messages = append(messages, toDLQMessage(msg))
+		return nil
+	})
+	return messages, err
+}
+
+// Replay republishes pending messages up to and including offset (-1 = all)
+// to their original topic and marks them handled
+func (a *DLQAdmin) Replay(ctx context.Context, partition int, offset int64) (int, error) {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(a.cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	count := 0
+	err := a.eachPending(ctx, partition, offset, func(msg kafka.Message) error {
+		original := toDLQMessage(msg)
+		if original.OriginalTopic == "" {
+			original.OriginalTopic = a.topic
+		}
+
+		err := writer.WriteMessages(ctx, kafka.Message{
+			Topic: original.OriginalTopic,
+			Key:   msg.Key,
+			Value: msg.Value,
+			Headers: []kafka.Header{{
+				Key:   HeaderDLQReplayedFrom,
+				Value: []byte(fmt.Sprintf("%s:%d:%d", a.dlq, msg.Partition, msg.Offset)),
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to replay %s[%d]@%d: %w", a.dlq, msg.Partition, msg.Offset, err)
+		}
+
+		// Commit per message so a failure part-way never replays twice
+		if err := a.commit(ctx, msg.Partition, msg.Offset+1); err != nil {
+			return err
+		}
+
+		count++
+		a.logger.Infof("Replayed %s[%d]@%d to %s", a.dlq, msg.Partition, msg.Offset, original.OriginalTopic)
+		return nil
+	})
+	return count, err
+}
+
+// Discard marks pending messages up to and including offset as handled
+// without replaying them
+func (a *DLQAdmin) Discard(ctx context.Context, partition int, offset int64) (int, error) {
+	if partition < 0 || offset < 0 {
+		return 0, fmt.Errorf("discard needs an explicit partition and offset")
+	}
+
+	count := 0
+	err := a.eachPending(ctx, partition, offset, func(msg kafka.Message) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := a.commit(ctx, partition, offset+1); err != nil {
+		return 0, err
+	}
+
+	a.logger.Warnf("Discarded %d message(s) from %s[%d] up to offset %d", count, a.dlq, partition, offset)
+	return count, nil
+}
+
+// eachPending calls fn for pending messages up to and including upTo (-1 = all)
+func (a *DLQAdmin) eachPending(ctx context.Context, partition int, upTo int64, fn func(kafka.Message) error) error {
+	partitions, err := a.partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	committed, err := a.committed(ctx, partitions)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		if partition >= 0 && p != partition {
+			continue
+		}
+
+		first, last, err := partitionOffsets(ctx, a.cfg, a.dlq, p)
+		if err != nil {
+			return err
+		}
+
+		start := committed[p]
+		if start < first {
+			start = first
+		}
+		end := last
+		if upTo >= 0 && upTo+1 < end {
+			end = upTo + 1
+		}
+
+		stopped := false
+		err = readPartition(ctx, a.cfg, a.dlq, p, start, end, func(msg kafka.Message) error {
+			if err := fn(msg); err != nil {
+				if errors.Is(err, errStopRead) {
+					stopped = true
+				}
+				return err
+			}
+			return nil
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitions lists the DLQ topic's partitions; a missing topic has none
+func (a *DLQAdmin) partitions(ctx context.Context) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", a.cfg.Brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	defer conn.Close()
+
+	parts, err := conn.ReadPartitions(a.dlq)
+	if err != nil {
+		if errors.Is(err, kafka.UnknownTopicOrPartition) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read partitions for topic %s: %w", a.dlq, err)
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+// committed returns the admin group's committed offset per partition (-1 = none)
+func (a *DLQAdmin) committed(ctx context.Context, partitions []int) (map[int]int64, error) {
+	offsets := make(map[int]int64, len(partitions))
+	if len(partitions) == 0 {
+		return offsets, nil
+	}
+
+	resp, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: a.group,
+		Topics:  map[string][]int{a.dlq: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch DLQ offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to fetch DLQ offsets: %w", resp.Error)
+	}
+
+	for _, p := range partitions {
+		offsets[p] = -1
+	}
+	for _, p := range resp.Topics[a.dlq] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch DLQ offset for partition %d: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p.CommittedOffset
+	}
+	return offsets, nil
+}
+
+func (a *DLQAdmin) commit(ctx context.Context, partition int, offset int64) error {
+	resp, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      a.group,
+		GenerationID: -1, // standalone commit, no group membership
+		Topics: map[string][]kafka.OffsetCommit{
+			a.dlq: {{Partition: partition, Offset: offset}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit DLQ offset: %w", err)
+	}
+
+	for _, p := range resp.Topics[a.dlq] {
+		if p.Error != nil {
+			return fmt.Errorf("failed to commit DLQ offset for partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return nil
+}
+
+func toDLQMessage(msg kafka.Message) DLQMessage {
+	m := DLQMessage{
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     json.RawMessage(msg.Value),
+	}
+	if !json.Valid(msg.Value) {
+		// Keep undecodable payloads printable
+		m.Value, _ = json.Marshal(string(msg.Value))
+	}
+
+	for _, h := range msg.Headers {
+		v := string(h.Value)
+		switch h.Key {
+		case HeaderDLQError:
+			m.Error = v
+		case HeaderDLQTopic:
+			m.OriginalTopic = v
+		case HeaderDLQPartition:
+			m.OriginalPartition, _ = strconv.Atoi(v)
+		case HeaderDLQOffset:
+			m.OriginalOffset, _ = strconv.ParseInt(v, 10, 64)
+		case HeaderDLQGroup:
+			m.ConsumerGroup = v
+		case HeaderDLQAttempts:
+			m.Attempts, _ = strconv.Atoi(v)
+		case HeaderDLQFailedAt:
+			m.FailedAt, _ = time.Parse(time.RFC3339, v)
+		}
+	}
+	return m
+}
+
+// RunDLQCommand implements the `dlq` subcommand shared by the consuming services:
+//
+//	dlq list    [-partition N] [-limit N]
+//	dlq replay  [-partition N] [-offset N]
+//	dlq discard  -partition N   -offset N
+//
+// Exit code 0 = success, 2 = error
+func RunDLQCommand(ctx context.Context, cfg config.KafkaConfig, topic string, args []string, out io.Writer, log *logger.Logger) int {
+	if len(args) == 0 {
+		fmt.Fprintln(out, "usage: dlq list|replay|discard [flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("dlq "+args[0], flag.ContinueOnError)
+	partition := fs.Int("partition", -1, "DLQ partition (-1 = all)")
+	offset := fs.Int64("offset", -1, "act on pending messages up to and including this offset (-1 = all)")
+	limit := fs.Int("limit", 20, "list: maximum messages to show")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	admin := NewDLQAdmin(cfg, topic, log)
+	enc := json.NewEncoder(out)
+
+	switch args[0] {
+	case "list":
+		messages, err := admin.List(ctx, *partition, *limit)
+		if err != nil {
+			log.Errorf("DLQ list failed: %v", err)
+			return 2
+		}
+		for _, m := range messages {
+			enc.Encode(m)
+		}
+
+	case "replay":
+		n, err := admin.Replay(ctx, *partition, *offset)
+		if err != nil {
+			log.Errorf("DLQ replay failed after %d message(s): %v", n, err)
+			return 2
+		}
+		enc.Encode(map[string]int{"replayed": n})
+
+	case "discard":
+		n, err := admin.Discard(ctx, *partition, *offset)
+		if err != nil {
+			log.Errorf("DLQ discard failed: %v", err)
+			return 2
+		}
+		enc.Encode(map[string]int{"discarded": n})
+
+	default:
+		fmt.Fprintf(out, "unknown dlq command %q (want list, replay or discard)\n", args[0])
+		return 2
+	}
+
+	return 0
+}
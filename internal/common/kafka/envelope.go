@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LegacyVersion marks a bare payload published before envelopes existed
+const LegacyVersion = 0
+
+// ErrUnsupportedVersion is returned when an event is newer than the consumer understands
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// Envelope wraps every event published to Kafka
+// NOTE: ID is the producing service's outbox row id, so it stays the same when
+// the outbox retries a publish - consumers deduplicate on it
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	Source        string          `json:"source"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CausationID   string          `json:"causation_id,omitempty"`
+	TraceParent   string          `json:"traceparent,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Event is implemented by the typed payload of every event
+type Event interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// DecodeEnvelope parses a Kafka message value
+// NOTE: Messages published before envelopes existed are returned as a
+// LegacyVersion envelope around the whole value; their event_type and
+// event_id fields are used when present
+func DecodeEnvelope(value []byte) (*Envelope, error) {
+	var probe struct {
+		ID        string          `json:"id"`
+		Type      string          `json:"type"`
+		Version   *int            `json:"version"`
+		Payload   json.RawMessage `json:"payload"`
+		EventType string          `json:"event_type"`
+		EventID   string          `json:"event_id"`
+	}
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	if probe.Type != "" && probe.Version != nil && len(probe.Payload) > 0 {
+		var env Envelope
+		if err := json.Unmarshal(value, &env); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event envelope: %w", err)
+		}
+		return &env, nil
+	}
+
+	return &Envelope{
+		ID:      probe.EventID,
+		Type:    probe.EventType,
+		Version: LegacyVersion,
+		Payload: json.RawMessage(bytes.Clone(value)),
+	}, nil
+}
+
+// Decode unmarshals the payload into a typed event
+// NOTE: Schema changes within a version are additive only, so any version up to
+// the one the consumer was built with decodes into the current struct. A
+// breaking change gets a new version and a new case here.
+func (e *Envelope) Decode(event Event) error {
+	// Legacy payloads may carry an unrelated event_type field, so only enveloped
+	// events are checked
+	if e.Version != LegacyVersion && e.Type != event.EventType() {
+		return fmt.Errorf("cannot decode %s event as %s", e.Type, event.EventType())
+	}
+	if e.Version > event.SchemaVersion() {
+		return fmt.Errorf("%w: %s v%d (supported up to v%d)", ErrUnsupportedVersion, e.Type, e.Version, event.SchemaVersion())
+	}
+
+	if err := json.Unmarshal(e.Payload, event); err != nil {
+		return fmt.Errorf("failed to unmarshal %s payload: %w", event.EventType(), err)
+	}
+	return nil
+}
+
+// Trace carries correlation and causation ids from a request or consumed
+// event to the events it causes
+type Trace struct {
+	CorrelationID string
+	CausationID   string
+	TraceParent   string
+}
+
+type traceKey struct{}
+
+// ContextWithTrace stores trace context for events saved further down the call
+func ContextWithTrace(ctx context.Context, trace Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// TraceFromContext returns the trace context, if any
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	trace, ok := ctx.Value(traceKey{}).(Trace)
+	return trace, ok
+}
+
+// ChildTrace returns the trace context for events caused by this one
+func (e *Envelope) ChildTrace() Trace {
+	correlationID := e.CorrelationID
+	if correlationID == "" {
+		correlationID = e.ID
+	}
+
+	return Trace{
+		CorrelationID: correlationID,
+		CausationID:   e.ID,
+		TraceParent:   e.TraceParent,
+	}
+}
@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeEnvelope(t *testing.T) {
+	payload, _ := json.Marshal(TransactionCompleted{
+		TransactionID: "txn-1",
+		FromWalletID:  "w1",
+		ToWalletID:    "w2",
+		Amount:        "10.0000",
+		Currency:      "USD",
+		Type:          "p2p",
+		CompletedAt:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	value, _ := json.Marshal(Envelope{
+		ID:            "evt-1",
+		Type:          EventTypeTransactionCompleted,
+		Version:       1,
+		Source:        "transaction-service",
+		CorrelationID: "corr-1",
+		Payload:       payload,
+	})
+
+	env, err := DecodeEnvelope(value)
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+	if env.ID != "evt-1" || env.Version != 1 || env.Source != "transaction-service" {
+		t.Errorf("Unexpected envelope: %+v", env)
+	}
+
+	var event TransactionCompleted
+	if err := env.Decode(&event); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if event.TransactionID != "txn-1" || event.Amount != "10.0000" {
+		t.Errorf("Unexpected payload: %+v", event)
+	}
+
+	// Decoding as the wrong type fails
+	var other LedgerEntryCreated
+	if err := env.Decode(&other); err == nil {
+		t.Error("Expected error decoding as a different event type")
+	}
+}
+
+func TestDecodeEnvelopeLegacy(t *testing.T) {
+	value := []byte(`{"event_id":"entry-1","entry_id":"entry-1","transaction_id":"txn-1","type":"p2p","amount":"5.0000"}`)
+
+	env, err := DecodeEnvelope(value)
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+	if env.Version != LegacyVersion {
+		t.Errorf("Expected legacy version, got %d", env.Version)
+	}
+	if env.ID != "entry-1" {
+		t.Errorf("Expected id from event_id, got '%s'", env.ID)
+	}
+
+	var event LedgerEntryCreated
+	if err := env.Decode(&event); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if event.TransactionID != "txn-1" {
+		t.Errorf("Expected transaction_id 'txn-1', got '%s'", event.TransactionID)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	env := &Envelope{
+		Type:    EventTypeLedgerEntryCreated,
+		Version: 2,
+		Payload: json.RawMessage(`{}`),
+	}
+
+	var event LedgerEntryCreated
+	if err := env.Decode(&event); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestChildTrace(t *testing.T) {
+	env := &Envelope{ID: "evt-1", TraceParent: "tp"}
+
+	trace := env.ChildTrace()
+	if trace.CorrelationID != "evt-1" || trace.CausationID != "evt-1" || trace.TraceParent != "tp" {
+		t.Errorf("Unexpected child trace: %+v", trace)
+	}
+
+	env.CorrelationID = "corr-1"
+	ctx := ContextWithTrace(context.Background(), env.ChildTrace())
+	got, ok := TraceFromContext(ctx)
+	if !ok || got.CorrelationID != "corr-1" || got.CausationID != "evt-1" {
+		t.Errorf("Unexpected trace from context: %+v", got)
+	}
+}
+
+func TestPositionFromContext(t *testing.T) {
+	if _, ok := PositionFromContext(context.Background()); ok {
+		t.Error("Expected no position in empty context")
+	}
+
+	ctx := ContextWithPosition(context.Background(), Position{Group: "g", Topic: "t", Partition: 1, Offset: 42})
+	pos, ok := PositionFromContext(ctx)
+	if !ok || pos.Offset != 42 || pos.Partition != 1 {
+		t.Errorf("Unexpected position %+v (ok=%v)", pos, ok)
+	}
+
+	// A zero position hides the outer one
+	if _, ok := PositionFromContext(ContextWithPosition(ctx, Position{})); ok {
+		t.Error("Expected zero position to hide the message position")
+	}
+}
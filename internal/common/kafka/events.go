@@ -0,0 +1,156 @@
+package kafka
+
+import "time"
+
+// Event types
+const (
+	EventTypeWalletCreated        = "wallet.created"
+	EventTypeWalletBalanceUpdated = "wallet.balance_updated"
+	EventTypeTransactionCompleted = "transaction.completed"
+	EventTypeTransactionFailed    = "transaction.failed"
+	EventTypeFeeCharged           = "transaction.fee_charged"
+	EventTypeBatchCompleted       = "batch.completed"
+	EventTypeLedgerEntryCreated   = "ledger.entry_created"
+	EventTypeAnomalyDetected      = "analytics.anomaly_detected"
+)
+
+// Topics
+// NOTE: batch.completed shares the transaction.completed topic so a batch and
+// the single transfers around it stay in one ordered stream
+const (
+	TopicWalletCreated        = "wallet.created"
+	TopicWalletBalanceUpdated = "wallet.balance_updated"
+	TopicTransactionCompleted = "transaction.completed"
+	TopicTransactionFailed    = "transaction.failed"
+	TopicFeeCharged           = "transaction.fee_charged"
+	TopicLedgerEntryCreated   = "ledger.entry_created"
+	TopicAnomalyDetected      = "analytics.anomaly_detected"
+)
+
+// WalletCreated - wallet.created v1
+type WalletCreated struct {
+	WalletID  string    `json:"wallet_id"`
+	UserID    string    `json:"user_id"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (WalletCreated) EventType() string  { return EventTypeWalletCreated }
+func (WalletCreated) SchemaVersion() int { return 1 }
+
+// WalletBalanceUpdated - wallet.balance_updated v1
+type WalletBalanceUpdated struct {
+	WalletID      string    `json:"wallet_id"`
+	UserID        string    `json:"user_id"`
+	Operation     string    `json:"event_type"` // deposit, withdrawal, wallet.transfer_in, wallet.transfer_out
+	Amount        string    `json:"amount"`
+	BalanceBefore string    `json:"balance_before"`
+	BalanceAfter  string    `json:"balance_after"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+func (WalletBalanceUpdated) EventType() string  { return EventTypeWalletBalanceUpdated }
+func (WalletBalanceUpdated) SchemaVersion() int { return 1 }
+
+// TransactionCompleted - transaction.completed v1 (p2p and scheduled transfers)
+type TransactionCompleted struct {
+	TransactionID string    `json:"transaction_id"`
+	FromWalletID  string    `json:"from_wallet_id"`
+	ToWalletID    string    `json:"to_wallet_id"`
+	Amount        string    `json:"amount"`
+	Currency      string    `json:"currency"`
+	Type          string    `json:"type"` // p2p, scheduled
+	CompletedAt   time.Time `json:"completed_at"`
+	InitiatedAt   time.Time `json:"initiated_at"` // Zero in events published before it existed
+}
+
+func (TransactionCompleted) EventType() string  { return EventTypeTransactionCompleted }
+func (TransactionCompleted) SchemaVersion() int { return 1 }
+
+// TransactionFailed - transaction.failed v1, a recorded transfer that could
+// not be executed
+type TransactionFailed struct {
+	TransactionID string    `json:"transaction_id"`
+	FromWalletID  string    `json:"from_wallet_id"`
+	ToWalletID    string    `json:"to_wallet_id"`
+	Amount        string    `json:"amount"`
+	Currency      string    `json:"currency"`
+	Type          string    `json:"type"` // p2p, scheduled
+	Reason        string    `json:"reason"`
+	FailedAt      time.Time `json:"failed_at"`
+}
+
+func (TransactionFailed) EventType() string  { return EventTypeTransactionFailed }
+func (TransactionFailed) SchemaVersion() int { return 1 }
+
+// FeeCharged - transaction.fee_charged v1, a fee taken from a wallet for a
+// transaction
+// NOTE: Published by the transaction service when TRANSACTION_FEE_RATE is set
+type FeeCharged struct {
+	TransactionID string    `json:"transaction_id"`
+	WalletID      string    `json:"wallet_id"` // Wallet that paid the fee
+	Amount        string    `json:"amount"`
+	Currency      string    `json:"currency"`
+	ChargedAt     time.Time `json:"charged_at"`
+}
+
+func (FeeCharged) EventType() string  { return EventTypeFeeCharged }
+func (FeeCharged) SchemaVersion() int { return 1 }
+
+// BatchCompleted - batch.completed v1, one leg per recipient
+type BatchCompleted struct {
+	BatchID      string     `json:"batch_id"`
+	FromWalletID string     `json:"from_wallet_id"`
+	Currency     string     `json:"currency"`
+	TotalAmount  string     `json:"total_amount"`
+	Count        int        `json:"count"`
+	Legs         []BatchLeg `json:"legs"`
+	CompletedAt  time.Time  `json:"completed_at"`
+	InitiatedAt  time.Time  `json:"initiated_at"` // Zero in events published before it existed
+}
+
+// BatchLeg - a single recipient of a batch, posted under its own transaction_id
+type BatchLeg struct {
+	TransactionID string `json:"transaction_id"`
+	ToWalletID    string `json:"to_wallet_id"`
+	Amount        string `json:"amount"`
+	Description   string `json:"description,omitempty"`
+}
+
+func (BatchCompleted) EventType() string  { return EventTypeBatchCompleted }
+func (BatchCompleted) SchemaVersion() int { return 1 }
+
+// LedgerEntryCreated - ledger.entry_created v1
+type LedgerEntryCreated struct {
+	EntryID       string                 `json:"entry_id"`
+	TransactionID string                 `json:"transaction_id"`
+	WalletID      string                 `json:"wallet_id"`
+	EntryType     string                 `json:"entry_type"`
+	Amount        string                 `json:"amount"`
+	Currency      string                 `json:"currency"`
+	Balance       string                 `json:"balance"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func (LedgerEntryCreated) EventType() string  { return EventTypeLedgerEntryCreated }
+func (LedgerEntryCreated) SchemaVersion() int { return 1 }
+
+// AnomalyDetected - analytics.anomaly_detected v1
+// NOTE: Observed and Expected are amounts for volume and spending anomalies
+// and plain counts for count anomalies
+type AnomalyDetected struct {
+	AnomalyID   int64     `json:"anomaly_id"`
+	Kind        string    `json:"kind"` // hourly_volume, hourly_count, user_spending
+	WalletID    string    `json:"wallet_id,omitempty"`
+	Currency    string    `json:"currency"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Observed    string    `json:"observed"`
+	Expected    string    `json:"expected"`
+	Score       float64   `json:"score"` // z-score against the baseline
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+func (AnomalyDetected) EventType() string  { return EventTypeAnomalyDetected }
+func (AnomalyDetected) SchemaVersion() int { return 1 }
@@ -0,0 +1,57 @@
+package kafka
+
+import "sync"
+
+// offsetTracker follows dispatched offsets per partition while messages are
+// processed out of order and reports how far each partition can be committed
+// NOTE: Only the lowest contiguous processed offset is ever committed, so a
+// crash re-delivers everything that was still in flight
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionProgress
+}
+
+type partitionProgress struct {
+	pending []int64 // dispatched, not yet committable offsets in fetch order
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionProgress)}
+}
+
+// track records a fetched offset before it is handed to a worker
+func (t *offsetTracker) track(partition int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok || (len(p.pending) > 0 && offset <= p.pending[len(p.pending)-1]) {
+		// New partition, or the reader rewound after a rebalance: start over
+		// from the redelivered offset
+		p = &partitionProgress{done: make(map[int64]bool)}
+		t.partitions[partition] = p
+	}
+	p.pending = append(p.pending, offset)
+}
+
+// done marks an offset processed and returns the highest offset that can now
+// be committed, or false if the partition cannot advance yet
+func (t *offsetTracker) done(partition int, offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok {
+		return 0, false
+	}
+	p.done[offset] = true
+
+	commit, advanced := int64(0), false
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		commit, advanced = p.pending[0], true
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+	}
+	return commit, advanced
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/segmentio/kafka-go"
+)
+
+// Position identifies the message a handler is processing
+type Position struct {
+	Group     string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+type positionKey struct{}
+
+// ContextWithPosition stores the position of the message being handled
+// NOTE: Passing a zero Position hides the position from code further down
+func ContextWithPosition(ctx context.Context, pos Position) context.Context {
+	return context.WithValue(ctx, positionKey{}, pos)
+}
+
+// PositionFromContext returns the position of the message being handled, if any
+func PositionFromContext(ctx context.Context) (Position, bool) {
+	pos, ok := ctx.Value(positionKey{}).(Position)
+	return pos, ok && pos.Topic != ""
+}
+
+// OffsetStore keeps consumer offsets in the service database so they commit
+// atomically with the writes a message causes
+// NOTE: Requires the kafka_consumer_offsets table (see the service migrations)
+type OffsetStore struct {
+	db *sql.DB
+}
+
+func NewOffsetStore(db *sql.DB) *OffsetStore {
+	return &OffsetStore{db: db}
+}
+
+// ClaimTx records the message in ctx as processed inside tx
+// NOTE: Returns false if the stored offset is already past this message - it
+// was processed before and the transaction should make no changes. Returns
+// true when ctx carries no position (e.g. HTTP requests).
+func (s *OffsetStore) ClaimTx(ctx context.Context, tx *sql.Tx) (bool, error) {
+	pos, ok := PositionFromContext(ctx)
+	if !ok {
+		return true, nil
+	}
+
+	query := `
+		INSERT INTO kafka_consumer_offsets (consumer_group, topic, partition, next_offset)
+		VALUES ($1, $2, $3, $4 + 1)
+		ON CONFLICT (consumer_group, topic, partition) DO UPDATE
+		SET next_offset = EXCLUDED.next_offset, updated_at = CURRENT_TIMESTAMP
+		WHERE kafka_consumer_offsets.next_offset <= $4
+	`
+
+	res, err := tx.ExecContext(ctx, query, pos.Group, pos.Topic, pos.Partition, pos.Offset)
+	if err != nil {
+		return false, fmt.Errorf("failed to store consumer offset: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to store consumer offset: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// Load returns the next offset to consume per partition
+func (s *OffsetStore) Load(ctx context.Context, group, topic string) (map[int]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT partition, next_offset
+		FROM kafka_consumer_offsets
+		WHERE consumer_group = $1 AND topic = $2
+	`, group, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consumer offsets: %w", err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("failed to scan consumer offset: %w", err)
+		}
+		offsets[partition] = offset
+	}
+
+	return offsets, rows.Err()
+}
+
+// NewStoredOffsetConsumer creates a consumer whose progress lives in the
+// service database (KAFKA_DB_OFFSETS)
+// NOTE: Before joining the group, Kafka's committed offsets are moved forward
+// to the stored ones so processing resumes where the DB says. That commit is
+// refused while other members are active; handlers still skip anything already
+// stored via ClaimTx. Messages are distributed by partition rather than key so
+// each partition is processed strictly in offset order.
+func NewStoredOffsetConsumer(ctx context.Context, cfg config.KafkaConfig, topic string, store *OffsetStore, log *logger.Logger) (*Consumer, error) {
+	stored, err := store.Load(ctx, cfg.GroupID, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stored) > 0 {
+		if err := seekGroup(ctx, cfg, topic, stored, log); err != nil {
+			log.Warnf("Could not move %s offsets for %s to the stored ones, relying on duplicate checks: %v", cfg.GroupID, topic, err)
+		}
+	}
+
+	consumer := NewConsumer(cfg, topic, log)
+	consumer.byPartition = true
+	return consumer, nil
+}
+
+// seekGroup commits stored offsets for the group where Kafka's are behind
+func seekGroup(ctx context.Context, cfg config.KafkaConfig, topic string, stored map[int]int64, log *logger.Logger) error {
+	client := &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: 10 * time.Second}
+
+	partitions := make([]int, 0, len(stored))
+	for p := range stored {
+		partitions = append(partitions, p)
+	}
+
+	resp, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: cfg.GroupID,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch group offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("failed to fetch group offsets: %w", resp.Error)
+	}
+
+	committed := make(map[int]int64)
+	for _, p := range resp.Topics[topic] {
+		committed[p.Partition] = p.CommittedOffset
+	}
+
+	commits := []kafka.OffsetCommit{}
+	for p, offset := range stored {
+		if offset > committed[p] {
+			commits = append(commits, kafka.OffsetCommit{Partition: p, Offset: offset})
+			log.Infof("Moving %s %s[%d] from offset %d to stored offset %d", cfg.GroupID, topic, p, committed[p], offset)
+		}
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	commitResp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      cfg.GroupID,
+		GenerationID: -1, // standalone commit, no group membership
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit stored offsets: %w", err)
+	}
+	for _, p := range commitResp.Topics[topic] {
+		if p.Error != nil {
+			return fmt.Errorf("failed to commit stored offset for partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/db"
+)
+
+// testOffsetStore returns a store on a fresh schema with the consumer offsets
+// table, or skips when PostgreSQL is not available
+func testOffsetStore(t *testing.T) (*OffsetStore, *sql.DB) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	cfg := config.DatabaseConfig{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", "5432"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "postgres"),
+		DBName:   getEnv("DB_NAME", "postgres"),
+	}
+
+	admin, err := sql.Open("postgres", db.DSN(cfg))
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+
+	schema := fmt.Sprintf("offsets_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	conn, err := sql.Open("postgres", db.DSN(cfg)+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if cleanup, err := sql.Open("postgres", db.DSN(cfg)); err == nil {
+			cleanup.Exec("DROP SCHEMA " + schema + " CASCADE")
+			cleanup.Close()
+		}
+	})
+
+	// Every service that stores offsets ships the same table
+	migration, err := os.ReadFile("../../../migrations/ledger/006_create_kafka_consumer_offsets_table.sql")
+	if err != nil {
+		t.Fatalf("Failed to read migration: %v", err)
+	}
+	if _, err := conn.Exec(string(migration)); err != nil {
+		t.Fatalf("Failed to apply migration: %v", err)
+	}
+
+	return NewOffsetStore(conn), conn
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func TestOffsetStoreClaimTx(t *testing.T) {
+	store, conn := testOffsetStore(t)
+
+	claim := func(ctx context.Context) bool {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		claimed, err := store.ClaimTx(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("ClaimTx failed: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		return claimed
+	}
+	at := func(partition int, offset int64) context.Context {
+		return ContextWithPosition(context.Background(), Position{
+			Group: "ledger-group", Topic: "transaction.completed", Partition: partition, Offset: offset,
+		})
+	}
+	stored := func() map[int]int64 {
+		offsets, err := store.Load(context.Background(), "ledger-group", "transaction.completed")
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return offsets
+	}
+
+	if !claim(at(0, 10)) {
+		t.Error("Expected the first message to be claimed")
+	}
+	if got := stored()[0]; got != 11 {
+		t.Errorf("Expected next offset 11, got %d", got)
+	}
+
+	if claim(at(0, 10)) || claim(at(0, 3)) {
+		t.Error("Expected replayed offsets to be refused")
+	}
+	if got := stored()[0]; got != 11 {
+		t.Errorf("Expected replays to leave the offset at 11, got %d", got)
+	}
+
+	// Offsets can skip (compaction, transactional markers)
+	if !claim(at(0, 15)) {
+		t.Error("Expected an offset after a gap to be claimed")
+	}
+	if claim(at(0, 12)) {
+		t.Error("Expected an offset inside the gap to be refused")
+	}
+
+	if !claim(at(1, 0)) {
+		t.Error("Expected partitions to be tracked separately")
+	}
+
+	if !claim(context.Background()) || !claim(ContextWithPosition(context.Background(), Position{})) {
+		t.Error("Expected contexts without a position to be claimed")
+	}
+	if got := stored(); len(got) != 2 || got[0] != 16 || got[1] != 1 {
+		t.Errorf("Unexpected stored offsets: %v", got)
+	}
+}
+
+func TestOffsetStoreClaimTxRollback(t *testing.T) {
+	store, conn := testOffsetStore(t)
+	ctx := ContextWithPosition(context.Background(), Position{
+		Group: "ledger-group", Topic: "transaction.completed", Partition: 0, Offset: 7,
+	})
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if claimed, err := store.ClaimTx(ctx, tx); err != nil || !claimed {
+		t.Fatalf("ClaimTx() = %v, %v", claimed, err)
+	}
+	tx.Rollback()
+
+	// A rolled back claim leaves the message to be processed again
+	offsets, err := store.Load(context.Background(), "ledger-group", "transaction.completed")
+	if err != nil || len(offsets) != 0 {
+		t.Errorf("Expected no stored offset, got %v, %v", offsets, err)
+	}
+}
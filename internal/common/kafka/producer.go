@@ -3,7 +3,9 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/config"
 	"github.com/kmassidik/mercuria/internal/common/logger"
@@ -17,11 +19,15 @@ type Producer struct {
 
 // NewProducer creates a new Kafka producer
 func NewProducer(cfg config.KafkaConfig, log *logger.Logger) *Producer {
+	// NOTE: Hash keeps every event of an aggregate on one partition, in order.
+	// Writes are synchronous, so the batch timeout is the latency a lone
+	// message waits for company before it is sent.
 	writer := &kafka.Writer{
 		Addr:                   kafka.TCP(cfg.Brokers...),
-		Balancer:               &kafka.LeastBytes{},
+		Balancer:               &kafka.Hash{},
 		RequiredAcks:           kafka.RequireAll,
 		Async:                  false,
+		BatchTimeout:           10 * time.Millisecond,
 		AllowAutoTopicCreation: true,
 	}
 
@@ -55,6 +61,77 @@ func (p *Producer) PublishEvent(ctx context.Context, topic string, key string, e
 	return nil
 }
 
+// Record is one event for PublishEvents
+type Record struct {
+	Topic string
+	Key   string
+	Event interface{}
+}
+
+// BatchError reports which records of a PublishEvents call failed
+// NOTE: Errors has one entry per record, nil for records that were written
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("failed to publish %d of %d events", failed, len(e.Errors))
+}
+
+// PublishEvents publishes records in one batched write
+// NOTE: Records with the same key land on one partition in slice order. On
+// partial failure a *BatchError tells which records were not written.
+func (p *Producer) PublishEvents(ctx context.Context, records []Record) error {
+	errs := make([]error, len(records))
+	msgs := make([]kafka.Message, 0, len(records))
+	index := make([]int, 0, len(records)) // msgs[i] is records[index[i]]
+
+	for i, r := range records {
+		value, err := json.Marshal(r.Event)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to marshal event: %w", err)
+			continue
+		}
+		msgs = append(msgs, kafka.Message{Topic: r.Topic, Key: []byte(r.Key), Value: value})
+		index = append(index, i)
+	}
+
+	failed := len(msgs) < len(records)
+
+	if len(msgs) > 0 {
+		if err := p.writer.WriteMessages(ctx, msgs...); err != nil {
+			p.logger.Errorf("Failed to publish batch of %d events: %v", len(msgs), err)
+
+			var writeErrs kafka.WriteErrors
+			if errors.As(err, &writeErrs) && len(writeErrs) == len(msgs) {
+				for i, werr := range writeErrs {
+					if werr != nil {
+						errs[index[i]] = fmt.Errorf("failed to publish event: %w", werr)
+					}
+				}
+			} else {
+				for _, i := range index {
+					errs[i] = fmt.Errorf("failed to publish event: %w", err)
+				}
+			}
+			failed = true
+		}
+	}
+
+	if failed {
+		return &BatchError{Errors: errs}
+	}
+
+	p.logger.Debugf("Published batch of %d events", len(msgs))
+	return nil
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
 	p.logger.Info("Closing Kafka producer")
@@ -0,0 +1,205 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplayMessage is a message read back from a topic's history
+type ReplayMessage struct {
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
+// ReplayHandler processes a replayed message
+type ReplayHandler func(ctx context.Context, msg ReplayMessage) error
+
+// Replay reads a topic from offset up to the current end of each partition
+// NOTE: No consumer group is used, so replaying never moves committed offsets.
+// A negative offset starts at the oldest retained message; partition -1 means all.
+func Replay(ctx context.Context, cfg config.KafkaConfig, topic string, partition int, offset int64, handler ReplayHandler, log *logger.Logger) error {
+	partitions, err := topicPartitions(ctx, cfg, topic)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, p := range partitions {
+		if partition >= 0 && p != partition {
+			continue
+		}
+		found = true
+
+		if err := replayPartition(ctx, cfg, topic, p, offset, handler, log); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("topic %s has no partition %d", topic, partition)
+	}
+	return nil
+}
+
+// ReplaySince is like Replay over all partitions, but starts each partition at
+// the first message written at or after since
+// NOTE: Uses the broker's message timestamps, i.e. when an event was published
+func ReplaySince(ctx context.Context, cfg config.KafkaConfig, topic string, since time.Time, handler ReplayHandler, log *logger.Logger) error {
+	partitions, err := topicPartitions(ctx, cfg, topic)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		offset, err := offsetAt(ctx, cfg, topic, p, since)
+		if err != nil {
+			return err
+		}
+		if offset < 0 {
+			log.Infof("Replay %s[%d]: no messages since %s", topic, p, since.Format(time.RFC3339))
+			continue
+		}
+
+		if err := replayPartition(ctx, cfg, topic, p, offset, handler, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topicPartitions returns the partition ids of a topic
+func topicPartitions(ctx context.Context, cfg config.KafkaConfig, topic string) ([]int, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("no kafka brokers configured")
+	}
+
+	conn, err := kafka.DialContext(ctx, "tcp", cfg.Brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions for topic %s: %w", topic, err)
+	}
+
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+// offsetAt returns the first offset written at or after t, or -1 if none
+func offsetAt(ctx context.Context, cfg config.KafkaConfig, topic string, partition int, t time.Time) (int64, error) {
+	leader, err := kafka.DialLeader(ctx, "tcp", cfg.Brokers[0], topic, partition)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to partition %d leader: %w", partition, err)
+	}
+	defer leader.Close()
+
+	offset, err := leader.ReadOffset(t)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find offset for partition %d at %s: %w", partition, t.Format(time.RFC3339), err)
+	}
+	return offset, nil
+}
+
+func replayPartition(ctx context.Context, cfg config.KafkaConfig, topic string, partition int, offset int64, handler ReplayHandler, log *logger.Logger) error {
+	first, last, err := partitionOffsets(ctx, cfg, topic, partition)
+	if err != nil {
+		return err
+	}
+
+	start := offset
+	if start < first {
+		start = first
+	}
+	if start >= last {
+		log.Infof("Replay %s[%d]: nothing to read (offsets %d-%d)", topic, partition, first, last)
+		return nil
+	}
+
+	log.Infof("Replay %s[%d]: reading offsets %d to %d", topic, partition, start, last-1)
+
+	return readPartition(ctx, cfg, topic, partition, start, last, func(msg kafka.Message) error {
+		err := handler(ctx, ReplayMessage{
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Time:      msg.Time,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to replay %s[%d]@%d: %w", topic, partition, msg.Offset, err)
+		}
+		return nil
+	})
+}
+
+// partitionOffsets returns the first retained and the next offset of a partition
+func partitionOffsets(ctx context.Context, cfg config.KafkaConfig, topic string, partition int) (int64, int64, error) {
+	leader, err := kafka.DialLeader(ctx, "tcp", cfg.Brokers[0], topic, partition)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to partition %d leader: %w", partition, err)
+	}
+	defer leader.Close()
+
+	first, last, err := leader.ReadOffsets()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read offsets for partition %d: %w", partition, err)
+	}
+	return first, last, nil
+}
+
+// errStopRead ends readPartition early without an error
+var errStopRead = errors.New("stop reading")
+
+// readPartition calls fn for each message from start up to (excluding) end
+func readPartition(ctx context.Context, cfg config.KafkaConfig, topic string, partition int, start, end int64, fn func(kafka.Message) error) error {
+	if start >= end {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   cfg.Brokers,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+		MaxWait:   500 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(start); err != nil {
+		return fmt.Errorf("failed to seek partition %d: %w", partition, err)
+	}
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read partition %d: %w", partition, err)
+		}
+
+		if err := fn(msg); err != nil {
+			if errors.Is(err, errStopRead) {
+				return nil
+			}
+			return err
+		}
+
+		// Offsets can have gaps (compaction, transaction markers)
+		if msg.Offset >= end-1 {
+			return nil
+		}
+	}
+}
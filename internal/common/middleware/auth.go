@@ -14,14 +14,16 @@ import (
 type contextKey string
 
 const (
-	UserIDKey contextKey = "user_id"
-	EmailKey  contextKey = "email"
+	UserIDKey   contextKey = "user_id"
+	EmailKey    contextKey = "email"
+	TimezoneKey contextKey = "timezone"
 )
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	Timezone string `json:"tz,omitempty"` // Profile timezone (IANA name)
 	jwt.RegisteredClaims
 }
 
@@ -63,6 +65,7 @@ func JWTAuth(jwtSecret string) func(http.Handler) http.Handler {
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 			ctx = context.WithValue(ctx, EmailKey, claims.Email)
+			ctx = context.WithValue(ctx, TimezoneKey, claims.Timezone)
 
 			// Call next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -72,9 +75,16 @@ func JWTAuth(jwtSecret string) func(http.Handler) http.Handler {
 
 // GenerateToken generates a JWT access token
 func GenerateToken(userID, email string, cfg config.JWTConfig) (string, error) {
+	return GenerateTokenWithTimezone(userID, email, "", cfg)
+}
+
+// GenerateTokenWithTimezone generates a JWT access token carrying the user's
+// profile timezone
+func GenerateTokenWithTimezone(userID, email, timezone string, cfg config.JWTConfig) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:   userID,
+		Email:    email,
+		Timezone: timezone,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -108,4 +118,11 @@ func GetUserIDFromContext(ctx context.Context) (string, bool) {
 func GetEmailFromContext(ctx context.Context) (string, bool) {
 	email, ok := ctx.Value(EmailKey).(string)
 	return email, ok
-}
\ No newline at end of file
+}
+
+// GetTimezoneFromContext extracts the profile timezone from request context
+// NOTE: Empty for tokens issued before timezones were added
+func GetTimezoneFromContext(ctx context.Context) (string, bool) {
+	timezone, ok := ctx.Value(TimezoneKey).(string)
+	return timezone, ok && timezone != ""
+}
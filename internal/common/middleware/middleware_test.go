@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
 )
 
@@ -82,6 +83,47 @@ func TestJWTAuth(t *testing.T) {
 	}
 }
 
+func TestJWTAuthTimezone(t *testing.T) {
+	cfg := config.JWTConfig{
+		Secret:         "test-secret",
+		AccessTokenTTL: 15 * time.Minute,
+	}
+
+	withTimezone, err := GenerateTokenWithTimezone("user-123", "test@example.com", "Asia/Jakarta", cfg)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	withoutTimezone, err := GenerateToken("user-123", "test@example.com", cfg)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		want   string
+		wantOK bool
+	}{
+		{name: "profile timezone", token: withTimezone, want: "Asia/Jakarta", wantOK: true},
+		{name: "no timezone", token: withoutTimezone, want: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := JWTAuth(cfg.Secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				timezone, ok := GetTimezoneFromContext(r.Context())
+				if timezone != tt.want || ok != tt.wantOK {
+					t.Errorf("GetTimezoneFromContext = (%q, %v), want (%q, %v)", timezone, ok, tt.want, tt.wantOK)
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
 func TestLogging(t *testing.T) {
 	log := logger.New("test")
 
@@ -134,4 +176,37 @@ func TestCORS(t *testing.T) {
 	if rr.Header().Get("Access-Control-Allow-Origin") != "*" {
 		t.Error("Expected CORS header to be set")
 	}
-}
\ No newline at end of file
+}
+func TestTracing(t *testing.T) {
+	var got kafka.Trace
+	handler := Tracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = kafka.TraceFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Incoming correlation id is kept
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(CorrelationIDHeader, "corr-123")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got.CorrelationID != "corr-123" {
+		t.Errorf("Expected correlation id 'corr-123', got '%s'", got.CorrelationID)
+	}
+	if got.TraceParent == "" {
+		t.Error("Expected traceparent in context")
+	}
+	if rr.Header().Get(CorrelationIDHeader) != "corr-123" {
+		t.Error("Expected correlation id echoed in response")
+	}
+
+	// Missing correlation id is generated
+	req = httptest.NewRequest("GET", "/test", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got.CorrelationID == "" || rr.Header().Get(CorrelationIDHeader) != got.CorrelationID {
+		t.Errorf("Expected generated correlation id, got '%s'", got.CorrelationID)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+)
+
+// CorrelationIDHeader carries the correlation id across services
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// Tracing middleware stores the request's correlation id and W3C traceparent
+// in the context, so outbox events saved while handling it carry them
+// NOTE: A correlation id is generated when the caller did not send one
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(CorrelationIDHeader)
+		if correlationID == "" || len(correlationID) > 255 {
+			correlationID = newCorrelationID()
+		}
+
+		// traceparent is fixed-length: version-traceid-parentid-flags
+		traceParent := r.Header.Get("traceparent")
+		if len(traceParent) != 55 {
+			traceParent = ""
+		}
+
+		w.Header().Set(CorrelationIDHeader, correlationID)
+
+		ctx := kafka.ContextWithTrace(r.Context(), kafka.Trace{
+			CorrelationID: correlationID,
+			TraceParent:   traceParent,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,254 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount carries, matching the
+// NUMERIC(20,4) columns used by every service
+const Scale = 4
+
+var unit = big.NewInt(10000) // 10^Scale
+
+// decimalPattern is the only accepted syntax for amounts and rates
+// NOTE: big.Rat.SetString alone would also take "0x10", "1_000", "1e3" or "+5"
+var decimalPattern = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// Amount is an exact decimal amount with Scale decimal places
+// NOTE: The zero value is 0. Amounts are immutable - arithmetic returns new
+// values - so they can be copied and shared freely.
+type Amount struct {
+	units *big.Int // amount * 10^Scale
+}
+
+// Zero returns a zero amount
+func Zero() Amount {
+	return Amount{}
+}
+
+// Parse reads a plain decimal amount such as "12", "-0.5" or "100.2500"
+// NOTE: Digits beyond Scale are rounded half away from zero, as the string
+// helpers this package replaced did, so older events with extra decimals
+// still parse. Request amounts are limited to Scale decimals by validation.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return Amount{}, fmt.Errorf("invalid amount: %q", s)
+	}
+
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount: %q", s)
+	}
+
+	return Amount{units: roundRat(value.Mul(value, new(big.Rat).SetInt(unit)))}, nil
+}
+
+// MustParse is like Parse but panics on invalid input; meant for constants
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) int() *big.Int {
+	if a.units == nil {
+		return new(big.Int)
+	}
+	return a.units
+}
+
+// Add returns a + b
+func (a Amount) Add(b Amount) Amount {
+	return Amount{units: new(big.Int).Add(a.int(), b.int())}
+}
+
+// Sub returns a - b
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{units: new(big.Int).Sub(a.int(), b.int())}
+}
+
+// Cmp returns -1, 0 or +1 as a is less than, equal to or greater than b
+func (a Amount) Cmp(b Amount) int {
+	return a.int().Cmp(b.int())
+}
+
+// Sign returns -1, 0 or +1 for negative, zero and positive amounts
+func (a Amount) Sign() int {
+	return a.int().Sign()
+}
+
+// IsZero reports whether the amount is 0
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// String formats the amount with exactly Scale decimals, e.g. "-12.5000"
+func (a Amount) String() string {
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(a.int()), unit, new(big.Int))
+
+	sign := ""
+	if a.Sign() < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%s.%0*s", sign, q.String(), Scale, r.String())
+}
+
+// MarshalJSON encodes the amount as a JSON string so clients never see a
+// binary float
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts a JSON string or number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("invalid amount: %w", err)
+		}
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (a *Amount) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return fmt.Errorf("cannot scan NULL into money.Amount")
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value implements driver.Valuer; the amount is sent as decimal text
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Float64 returns the nearest float64; meant for statistics, never for sums
+func (a Amount) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(a.int(), unit).Float64()
+	return f
+}
+
+// Div returns a / n rounded half away from zero to Scale decimals
+func (a Amount) Div(n int64) Amount {
+	return Amount{units: roundRat(new(big.Rat).SetFrac(a.int(), big.NewInt(n)))}
+}
+
+// Convert returns the amount in another currency at the given rate, rounded
+// half away from zero to Scale decimals
+func (a Amount) Convert(rate Rate) Amount {
+	return Amount{units: roundRat(new(big.Rat).Mul(new(big.Rat).SetInt(a.int()), rate.rat))}
+}
+
+// roundRat rounds x (in units) half away from zero to an integer
+func roundRat(x *big.Rat) *big.Int {
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(x.Num()), x.Denom(), new(big.Int))
+	if r.Lsh(r, 1).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q
+}
+
+// Rate is an exchange rate: units of the target currency per unit of the
+// source currency
+type Rate struct {
+	rat *big.Rat
+}
+
+// ParseRate reads a positive decimal exchange rate such as "0.000063"
+// NOTE: Unlike amounts, rates may have any number of decimals
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return Rate{}, fmt.Errorf("invalid rate: %q", s)
+	}
+
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok || rat.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate: %q", s)
+	}
+	return Rate{rat: rat}, nil
+}
+
+// OneToOne is the rate between a currency and itself
+func OneToOne() Rate {
+	return Rate{rat: big.NewRat(1, 1)}
+}
+
+// Add adds two decimal strings, returning the sum formatted with Scale decimals
+func Add(a, b string) (string, error) {
+	x, err := Parse(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := Parse(b)
+	if err != nil {
+		return "", err
+	}
+	return x.Add(y).String(), nil
+}
+
+// Sub subtracts two decimal strings, returning the difference formatted with
+// Scale decimals
+// NOTE: The result may be negative; callers enforce their own balance rules
+func Sub(a, b string) (string, error) {
+	x, err := Parse(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := Parse(b)
+	if err != nil {
+		return "", err
+	}
+	return x.Sub(y).String(), nil
+}
+
+// Covers reports whether balance is at least amount
+// NOTE: Invalid input never covers anything
+func Covers(balance, amount string) bool {
+	x, err := Parse(balance)
+	if err != nil {
+		return false
+	}
+	y, err := Parse(amount)
+	if err != nil {
+		return false
+	}
+	return x.Cmp(y) >= 0
+}
@@ -0,0 +1,188 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "0", want: "0.0000"},
+		{input: "12", want: "12.0000"},
+		{input: "0.1", want: "0.1000"},
+		{input: "-0.5", want: "-0.5000"},
+		{input: " 100.2500 ", want: "100.2500"},
+		{input: "1.23450000", want: "1.2345"},
+		{input: "99999999999999999999.9999", want: "99999999999999999999.9999"},
+		{input: "1.23456", want: "1.2346"},
+		{input: "1.23454", want: "1.2345"},
+		{input: "-0.00005", want: "-0.0001"},
+		{input: "", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "1/3", wantErr: true},
+		{input: "0x10", wantErr: true},
+		{input: "0b101", wantErr: true},
+		{input: "1_000", wantErr: true},
+		{input: "1e3", wantErr: true},
+		{input: "+5", wantErr: true},
+		{input: ".5", wantErr: true},
+		{input: "5.", wantErr: true},
+		{input: "- 5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) expected error, got %s", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	// 0.1 added ten times is exactly 1 - it is not with float64
+	total := Zero()
+	for i := 0; i < 10; i++ {
+		total = total.Add(MustParse("0.1"))
+	}
+	if total.Cmp(MustParse("1")) != 0 {
+		t.Errorf("sum = %s, want 1.0000", total)
+	}
+
+	if got := MustParse("10").Sub(MustParse("10.0001")).String(); got != "-0.0001" {
+		t.Errorf("Sub = %s, want -0.0001", got)
+	}
+
+	var zero Amount
+	if !zero.IsZero() || zero.String() != "0.0000" {
+		t.Errorf("zero value = %s, want 0.0000", zero)
+	}
+
+	if got := MustParse("-12.25").Float64(); got != -12.25 {
+		t.Errorf("Float64 = %v, want -12.25", got)
+	}
+}
+
+func TestDivAndConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want string
+	}{
+		{name: "div exact", got: MustParse("10").Div(4), want: "2.5000"},
+		{name: "div rounds half up", got: MustParse("0.0005").Div(2), want: "0.0003"},
+		{name: "div rounds down", got: MustParse("10").Div(3), want: "3.3333"},
+		{name: "div negative", got: MustParse("-0.0005").Div(2), want: "-0.0003"},
+		{name: "convert", got: MustParse("1500000").Convert(mustRate(t, "0.000063")), want: "94.5000"},
+		{name: "convert rounds", got: MustParse("1").Convert(mustRate(t, "0.00006349")), want: "0.0001"},
+		{name: "convert same currency", got: MustParse("12.3456").Convert(OneToOne()), want: "12.3456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "0", "-1", "abc", "1/2", "0x10", "1e-3", "+0.5", "1_0"} {
+		if _, err := ParseRate(invalid); err == nil {
+			t.Errorf("ParseRate(%q) expected error", invalid)
+		}
+	}
+}
+
+func mustRate(t *testing.T, s string) Rate {
+	t.Helper()
+	r, err := ParseRate(s)
+	if err != nil {
+		t.Fatalf("ParseRate(%q) error = %v", s, err)
+	}
+	return r
+}
+
+func TestStringHelpers(t *testing.T) {
+	sum, err := Add("100.50", "0.2500")
+	if err != nil || sum != "100.7500" {
+		t.Errorf("Add = %s, %v; want 100.7500", sum, err)
+	}
+
+	diff, err := Sub("5", "7.5")
+	if err != nil || diff != "-2.5000" {
+		t.Errorf("Sub = %s, %v; want -2.5000", diff, err)
+	}
+
+	if _, err := Add("1", "x"); err == nil {
+		t.Error("Add with invalid amount expected error")
+	}
+
+	if !Covers("10.0000", "10") {
+		t.Error("Covers(10, 10) = false, want true")
+	}
+	if Covers("9.9999", "10") {
+		t.Error("Covers(9.9999, 10) = true, want false")
+	}
+	if Covers("invalid", "0") {
+		t.Error("Covers with invalid balance = true, want false")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Amount Amount `json:"amount"`
+		Fee    Amount `json:"fee"`
+	}
+
+	// Strings and plain numbers are both accepted
+	if err := json.Unmarshal([]byte(`{"amount":"12.34","fee":0.5}`), &v); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error = %v", err)
+	}
+	if string(data) != `{"amount":"12.3400","fee":"0.5000"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount":"0.00006"}`), &v); err != nil || v.Amount.String() != "0.0001" {
+		t.Errorf("Unmarshal of too precise amount = %s, %v; want 0.0001", v.Amount, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount":1e3}`), &v); err == nil {
+		t.Error("Unmarshal of exponent amount expected error")
+	}
+}
+
+func TestScan(t *testing.T) {
+	var a Amount
+	if err := a.Scan([]byte("1234.5600")); err != nil || a.String() != "1234.5600" {
+		t.Errorf("Scan([]byte) = %s, %v", a, err)
+	}
+	if err := a.Scan(int64(7)); err != nil || a.String() != "7.0000" {
+		t.Errorf("Scan(int64) = %s, %v", a, err)
+	}
+	if err := a.Scan(nil); err == nil {
+		t.Error("Scan(nil) expected error")
+	}
+
+	v, err := MustParse("-3.1").Value()
+	if err != nil || v != "-3.1000" {
+		t.Errorf("Value = %v, %v; want -3.1000", v, err)
+	}
+}
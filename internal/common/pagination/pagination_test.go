@@ -0,0 +1,149 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	original := Cursor{
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		ID:        "5f0c6f3e-1b1a-4c55-9d53-3a1f7c2a9b10",
+	}
+
+	decoded, err := Decode(original.Encode())
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if !decoded.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", decoded.CreatedAt, original.CreatedAt)
+	}
+	if decoded.ID != original.ID {
+		t.Errorf("ID = %s, want %s", decoded.ID, original.ID)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "%%%"},
+		{name: "not json", cursor: "bm90LWpzb24"},
+		{name: "missing id", cursor: Cursor{CreatedAt: time.Now()}.Encode()},
+		{name: "missing time", cursor: Cursor{ID: "5f0c6f3e-1b1a-4c55-9d53-3a1f7c2a9b10"}.Encode()},
+		{name: "id not a uuid", cursor: Cursor{CreatedAt: time.Now(), ID: "abc"}.Encode()},
+		{name: "id with sql", cursor: Cursor{CreatedAt: time.Now(), ID: "5f0c6f3e-1b1a-4c55-9d53-3a1f7c2a9b10' OR '1'='1"}.Encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.cursor); err == nil {
+				t.Errorf("Decode(%q) expected error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	validCursor := Cursor{CreatedAt: time.Now().UTC(), ID: "5f0c6f3e-1b1a-4c55-9d53-3a1f7c2a9b10"}.Encode()
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantLimit  int
+		wantOffset int
+		wantCursor bool
+		wantErr    bool
+	}{
+		{
+			name:      "defaults",
+			query:     url.Values{},
+			wantLimit: 20,
+		},
+		{
+			name:       "limit and offset",
+			query:      url.Values{"limit": {"10"}, "offset": {"30"}},
+			wantLimit:  10,
+			wantOffset: 30,
+		},
+		{
+			name:      "limit capped at max",
+			query:     url.Values{"limit": {"1000"}},
+			wantLimit: 100,
+		},
+		{
+			name:      "invalid limit falls back to default",
+			query:     url.Values{"limit": {"abc"}, "offset": {"-1"}},
+			wantLimit: 20,
+		},
+		{
+			name:       "cursor wins over offset",
+			query:      url.Values{"cursor": {validCursor}, "offset": {"30"}},
+			wantLimit:  20,
+			wantCursor: true,
+		},
+		{
+			name:    "invalid cursor",
+			query:   url.Values{"cursor": {"garbage!"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := FromQuery(tt.query, 20, 100)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if p.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", p.Limit, tt.wantLimit)
+			}
+			if p.Offset != tt.wantOffset {
+				t.Errorf("Offset = %d, want %d", p.Offset, tt.wantOffset)
+			}
+			if (p.Cursor != nil) != tt.wantCursor {
+				t.Errorf("Cursor set = %v, want %v", p.Cursor != nil, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	type row struct {
+		id string
+		at time.Time
+	}
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := func(r row) Cursor { return Cursor{CreatedAt: r.at, ID: r.id} }
+
+	rows := []row{
+		{id: "00000000-0000-0000-0000-00000000000c", at: base.Add(3 * time.Second)},
+		{id: "00000000-0000-0000-0000-00000000000b", at: base.Add(2 * time.Second)},
+		{id: "00000000-0000-0000-0000-00000000000a", at: base.Add(1 * time.Second)},
+	}
+
+	page, next := Page(rows, 2, key)
+	if len(page) != 2 {
+		t.Fatalf("len(page) = %d, want 2", len(page))
+	}
+
+	c, err := Decode(next)
+	if err != nil {
+		t.Fatalf("next cursor invalid: %v", err)
+	}
+	if c.ID != rows[1].id {
+		t.Errorf("next cursor ID = %s, want %s", c.ID, rows[1].id)
+	}
+
+	page, next = Page(rows, 3, key)
+	if len(page) != 3 || next != "" {
+		t.Errorf("last page: len = %d, next = %q; want 3 and empty", len(page), next)
+	}
+}
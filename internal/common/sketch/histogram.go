@@ -0,0 +1,104 @@
+package sketch
+
+import (
+	"math"
+	"sort"
+)
+
+// RelativeAccuracy is the largest relative error of a quantile estimate
+const RelativeAccuracy = 0.01
+
+// ZeroBucket holds observations of zero or less (e.g. latencies under clock skew)
+const ZeroBucket = math.MinInt32
+
+var (
+	gamma    = (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma = math.Log(gamma)
+)
+
+// Bucket returns the bucket index of v
+// NOTE: Bucket i holds values in (gamma^(i-1), gamma^i]. Boundaries are fixed,
+// so histograms built anywhere - and persisted per bucket - merge by adding
+// counts.
+func Bucket(v float64) int {
+	if v <= 0 || math.IsNaN(v) {
+		return ZeroBucket
+	}
+	return int(math.Ceil(math.Log(v) / logGamma))
+}
+
+// bucketValue is the value reported for bucket i; it is within
+// RelativeAccuracy of every value in the bucket
+func bucketValue(i int) float64 {
+	if i == ZeroBucket {
+		return 0
+	}
+	return 2 * math.Pow(gamma, float64(i)) / (gamma + 1)
+}
+
+// Histogram is a mergeable log-bucketed histogram (a DDSketch without
+// bucket collapsing)
+// NOTE: The zero value is an empty histogram ready to use
+type Histogram struct {
+	counts map[int]int64
+	total  int64
+}
+
+// Add records one observation
+func (h *Histogram) Add(v float64) {
+	h.AddBucket(Bucket(v), 1)
+}
+
+// AddBucket adds n observations to bucket i
+func (h *Histogram) AddBucket(i int, n int64) {
+	if n <= 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make(map[int]int64)
+	}
+	h.counts[i] += n
+	h.total += n
+}
+
+// Merge adds every observation of o
+func (h *Histogram) Merge(o *Histogram) {
+	for i, n := range o.counts {
+		h.AddBucket(i, n)
+	}
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Quantile returns the estimated q-quantile (0 <= q <= 1), or 0 when empty
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	if q < 0 {
+		q = 0
+	}
+	if q > 1 {
+		q = 1
+	}
+
+	buckets := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		buckets = append(buckets, i)
+	}
+	sort.Ints(buckets)
+
+	// Rank of the quantile among the observations, 0-based
+	rank := int64(q * float64(h.total-1))
+	var seen int64
+	for _, i := range buckets {
+		seen += h.counts[i]
+		if seen > rank {
+			return bucketValue(i)
+		}
+	}
+	return bucketValue(buckets[len(buckets)-1])
+}
@@ -0,0 +1,79 @@
+package sketch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantileAccuracy(t *testing.T) {
+	var h Histogram
+	for v := 1; v <= 10000; v++ {
+		h.Add(float64(v))
+	}
+
+	if h.Count() != 10000 {
+		t.Fatalf("Count = %d, want 10000", h.Count())
+	}
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0, want: 1},
+		{q: 0.5, want: 5000},
+		{q: 0.9, want: 9000},
+		{q: 0.99, want: 9900},
+		{q: 1, want: 10000},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if math.Abs(got-tt.want)/tt.want > RelativeAccuracy+0.001 {
+			t.Errorf("Quantile(%v) = %v, want %v within %v", tt.q, got, tt.want, RelativeAccuracy)
+		}
+	}
+}
+
+func TestMergeMatchesSingleHistogram(t *testing.T) {
+	var all, a, b Histogram
+	for v := 1; v <= 1000; v++ {
+		all.Add(float64(v) * 0.37)
+		if v%2 == 0 {
+			a.Add(float64(v) * 0.37)
+		} else {
+			b.Add(float64(v) * 0.37)
+		}
+	}
+
+	// Merging per-bucket counts, as stored rows do, gives the same answers
+	var merged Histogram
+	merged.Merge(&a)
+	for i, n := range b.counts {
+		merged.AddBucket(i, n)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		if merged.Quantile(q) != all.Quantile(q) {
+			t.Errorf("Quantile(%v) = %v after merge, want %v", q, merged.Quantile(q), all.Quantile(q))
+		}
+	}
+}
+
+func TestZeroAndEmpty(t *testing.T) {
+	var h Histogram
+	if h.Quantile(0.5) != 0 {
+		t.Errorf("empty Quantile = %v, want 0", h.Quantile(0.5))
+	}
+
+	h.Add(0)
+	h.Add(-5)
+	h.Add(100)
+	if Bucket(-5) != ZeroBucket {
+		t.Errorf("Bucket(-5) = %d, want ZeroBucket", Bucket(-5))
+	}
+	if h.Quantile(0.5) != 0 {
+		t.Errorf("Quantile(0.5) = %v, want 0", h.Quantile(0.5))
+	}
+	if got := h.Quantile(1); math.Abs(got-100)/100 > RelativeAccuracy {
+		t.Errorf("Quantile(1) = %v, want about 100", got)
+	}
+}
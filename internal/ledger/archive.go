@@ -0,0 +1,486 @@
+package ledger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/db"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+// ArchiveStore - Storage backend for archived ledger partitions
+// NOTE: LocalArchiveStore covers disk/NFS; an object storage backend (S3, GCS)
+// only needs to implement these three methods
+type ArchiveStore interface {
+	Put(ctx context.Context, name string, r io.Reader) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Location(name string) string
+}
+
+// LocalArchiveStore stores archives as files in a directory
+type LocalArchiveStore struct {
+	dir string
+}
+
+func NewLocalArchiveStore(dir string) (*LocalArchiveStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &LocalArchiveStore{dir: dir}, nil
+}
+
+// Put writes to a temp file and renames it, so readers never see partial archives
+func (s *LocalArchiveStore) Put(ctx context.Context, name string, r io.Reader) error {
+	if err := validateObjectName(name); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync archive file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close archive file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *LocalArchiveStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validateObjectName(name); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *LocalArchiveStore) Location(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func validateObjectName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid archive object name %q", name)
+	}
+	return nil
+}
+
+// ArchiveConfig - Partition maintenance and archival settings
+type ArchiveConfig struct {
+	MonthsAhead int           // Future monthly partitions kept ready
+	HotMonths   int           // Months kept in Postgres before they may be archived
+	AutoArchive bool          // Archive eligible months during maintenance
+	Interval    time.Duration // Maintenance interval
+}
+
+// Archiver manages ledger_entries partitions and their archives
+type Archiver struct {
+	repo   *Repository
+	db     *db.DB
+	store  ArchiveStore
+	cfg    ArchiveConfig
+	logger *logger.Logger
+}
+
+func NewArchiver(repo *Repository, database *db.DB, store ArchiveStore, cfg ArchiveConfig, log *logger.Logger) *Archiver {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	return &Archiver{
+		repo:   repo,
+		db:     database,
+		store:  store,
+		cfg:    cfg,
+		logger: log,
+	}
+}
+
+// Start runs partition maintenance now and then on every interval
+func (a *Archiver) Start(ctx context.Context) {
+	a.logger.Infof("Ledger partition maintenance started (every %s, %d months ahead, auto-archive=%v)",
+		a.cfg.Interval, a.cfg.MonthsAhead, a.cfg.AutoArchive)
+
+	a.maintain(ctx)
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.logger.Info("Ledger partition maintenance stopped")
+			return
+		case <-ticker.C:
+			a.maintain(ctx)
+		}
+	}
+}
+
+func (a *Archiver) maintain(ctx context.Context) {
+	if err := a.EnsurePartitions(ctx); err != nil {
+		a.logger.Errorf("Failed to ensure ledger partitions: %v", err)
+	}
+
+	if !a.cfg.AutoArchive {
+		return
+	}
+
+	partitions, err := a.repo.ListPartitions(ctx)
+	if err != nil {
+		a.logger.Errorf("Failed to list ledger partitions: %v", err)
+		return
+	}
+
+	for _, p := range partitions {
+		if !p.PeriodEnd.After(a.archiveCutoff()) {
+			if _, err := a.ArchivePartition(ctx, p.Name); err != nil {
+				a.logger.Warnf("Partition %s not archived: %v", p.Name, err)
+			}
+		}
+	}
+}
+
+// EnsurePartitions creates the current and upcoming monthly partitions
+func (a *Archiver) EnsurePartitions(ctx context.Context) error {
+	current := monthStart(time.Now())
+	for i := 0; i <= a.cfg.MonthsAhead; i++ {
+		if _, err := a.repo.EnsurePartition(ctx, current.AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPartitions returns attached partitions and archived months
+func (a *Archiver) ListPartitions(ctx context.Context) (*PartitionsResponse, error) {
+	partitions, err := a.repo.ListPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archives, err := a.repo.GetArchives(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartitionsResponse{Partitions: partitions, Archives: archives}, nil
+}
+
+// ArchivePartition writes a month to the archive store, verifies it, then drops it
+// NOTE: Only closed accounting periods older than the hot window are eligible
+func (a *Archiver) ArchivePartition(ctx context.Context, name string) (*LedgerArchive, error) {
+	start, err := PartitionMonth(name)
+	if err != nil {
+		return nil, err
+	}
+	end := start.AddDate(0, 1, 0)
+
+	if end.After(a.archiveCutoff()) {
+		return nil, fmt.Errorf("partition %s is inside the %d month hot window", name, a.cfg.HotMonths)
+	}
+
+	closed, err := a.repo.IsRangeClosed(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, fmt.Errorf("partition %s is not inside a closed accounting period", name)
+	}
+
+	if existing, err := a.repo.GetArchive(ctx, name); err == nil && existing.RestoredAt == nil {
+		return nil, fmt.Errorf("partition %s is already archived", name)
+	} else if err == nil {
+		// Restored for an audit: the archive file is still authoritative
+		return existing, a.releaseRestored(ctx, existing)
+	}
+
+	object := name + ".jsonl.gz"
+	checksum, count, err := a.writeArchive(ctx, object, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the stored object back before anything is dropped
+	verifiedCount, err := a.verifyArchive(ctx, object, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedCount != count {
+		return nil, fmt.Errorf("archive %s holds %d entries, expected %d", object, verifiedCount, count)
+	}
+
+	archive := &LedgerArchive{
+		PartitionName: name,
+		PeriodStart:   start,
+		PeriodEnd:     end,
+		Location:      a.store.Location(object),
+		SHA256:        checksum,
+		EntryCount:    count,
+	}
+
+	if err := a.writeManifest(ctx, object, archive); err != nil {
+		return nil, err
+	}
+
+	err = a.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return a.repo.ArchivePartitionTx(ctx, tx, archive)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Infof("Ledger partition %s archived to %s (%d entries, sha256=%s)", name, archive.Location, count, checksum)
+	return archive, nil
+}
+
+// RestoreArchive verifies an archive and re-attaches it as a live partition
+func (a *Archiver) RestoreArchive(ctx context.Context, name string) (int64, error) {
+	archive, err := a.repo.GetArchive(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if archive.RestoredAt != nil {
+		return 0, fmt.Errorf("archive %s is already restored", name)
+	}
+
+	object := filepath.Base(archive.Location)
+	if _, err := a.verifyArchive(ctx, object, archive.SHA256); err != nil {
+		return 0, err
+	}
+
+	var restored int64
+	err = a.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rc, err := a.store.Get(ctx, object)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer gz.Close()
+
+		decoder := json.NewDecoder(gz)
+		next := func() (*LedgerEntry, error) {
+			var entry LedgerEntry
+			if err := decoder.Decode(&entry); err != nil {
+				if err == io.EOF {
+					return nil, io.EOF
+				}
+				return nil, fmt.Errorf("failed to decode archived entry: %w", err)
+			}
+			return &entry, nil
+		}
+
+		restored, err = a.repo.RestorePartitionTx(ctx, tx, archive, next)
+		if err != nil {
+			return err
+		}
+		if restored != archive.EntryCount {
+			return fmt.Errorf("restored %d entries, archive records %d", restored, archive.EntryCount)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	a.logger.Infof("Ledger archive %s restored (%d entries)", name, restored)
+	return restored, nil
+}
+
+// ReadArchive streams archived entries without restoring them
+// NOTE: The checksum is verified before the first entry is returned
+func (a *Archiver) ReadArchive(ctx context.Context, name, walletID string, fn func(*LedgerEntry) error) error {
+	archive, err := a.repo.GetArchive(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	object := filepath.Base(archive.Location)
+	if _, err := a.verifyArchive(ctx, object, archive.SHA256); err != nil {
+		return err
+	}
+
+	return a.readEntries(ctx, object, func(entry *LedgerEntry) error {
+		if walletID != "" && entry.WalletID != walletID {
+			return nil
+		}
+		return fn(entry)
+	})
+}
+
+func (a *Archiver) writeArchive(ctx context.Context, object string, start, end time.Time) (string, int64, error) {
+	pr, pw := io.Pipe()
+	hasher := sha256.New()
+
+	var count int64
+	go func() {
+		gz := gzip.NewWriter(io.MultiWriter(pw, hasher))
+		encoder := json.NewEncoder(gz)
+
+		err := a.repo.StreamEntriesInRange(ctx, start, end, func(entry *LedgerEntry) error {
+			count++
+			return encoder.Encode(entry)
+		})
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	if err := a.store.Put(ctx, object, pr); err != nil {
+		pr.CloseWithError(err)
+		return "", 0, fmt.Errorf("failed to store archive %s: %w", object, err)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), count, nil
+}
+
+// verifyArchive checks the stored checksum and returns the number of entries
+func (a *Archiver) verifyArchive(ctx context.Context, object, checksum string) (int64, error) {
+	rc, err := a.store.Get(ctx, object)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	hasher := sha256.New()
+	tee := io.TeeReader(rc, hasher)
+	gz, err := gzip.NewReader(tee)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive %s: %w", object, err)
+	}
+
+	var count int64
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read archive %s: %w", object, err)
+	}
+
+	// Drain anything gzip did not consume so the hash covers the whole object
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return 0, fmt.Errorf("failed to read archive %s: %w", object, err)
+	}
+
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != checksum {
+		return 0, fmt.Errorf("archive %s checksum mismatch: got %s, want %s", object, got, checksum)
+	}
+
+	return count, nil
+}
+
+func (a *Archiver) readEntries(ctx context.Context, object string, fn func(*LedgerEntry) error) error {
+	rc, err := a.store.Get(ctx, object)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", object, err)
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	for {
+		var entry LedgerEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode archived entry: %w", err)
+		}
+
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *Archiver) writeManifest(ctx context.Context, object string, archive *LedgerArchive) error {
+	manifest := ArchiveManifest{
+		PartitionName: archive.PartitionName,
+		PeriodStart:   archive.PeriodStart,
+		PeriodEnd:     archive.PeriodEnd,
+		Object:        object,
+		Format:        "jsonl+gzip",
+		SHA256:        archive.SHA256,
+		EntryCount:    archive.EntryCount,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive manifest: %w", err)
+	}
+
+	return a.store.Put(ctx, archive.PartitionName+".manifest.json", strings.NewReader(string(data)))
+}
+
+// releaseRestored drops a partition that was restored for an audit
+func (a *Archiver) releaseRestored(ctx context.Context, archive *LedgerArchive) error {
+	err := a.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return a.repo.DropRestoredPartitionTx(ctx, tx, archive)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.logger.Infof("Restored ledger partition %s released back to archive", archive.PartitionName)
+	return nil
+}
+
+func (a *Archiver) archiveCutoff() time.Time {
+	return monthStart(time.Now()).AddDate(0, -a.cfg.HotMonths, 0)
+}
+
+// PartitionMonth parses the month (UTC) from a partition name like ledger_entries_2025_01
+func PartitionMonth(name string) (time.Time, error) {
+	suffix, ok := strings.CutPrefix(name, "ledger_entries_")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid ledger partition name %q", name)
+	}
+
+	t, err := time.Parse("2006_01", suffix)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ledger partition name %q", name)
+	}
+	return t.UTC(), nil
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
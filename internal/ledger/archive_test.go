@@ -0,0 +1,99 @@
+package ledger
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateObjectName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"ledger_entries_2025_01.jsonl.gz", false},
+		{"", true},
+		{"../secret", true},
+		{"a/b", true},
+		{`a\b`, true},
+		{".hidden", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateObjectName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("validateObjectName(%q) = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	zone := time.FixedZone("UTC+9", 9*60*60)
+	got := monthStart(time.Date(2025, 3, 1, 5, 0, 0, 0, zone))
+
+	if want := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("monthStart() = %v, want %v", got, want)
+	}
+}
+
+func TestPartitionMonth(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"ledger_entries_2025_01", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"ledger_entries_2019_12", time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC), false},
+		{"ledger_entries_default", time.Time{}, true},
+		{"ledger_entries_2025_13", time.Time{}, true},
+		{"wallet_events_2025_01", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := PartitionMonth(tt.name)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("PartitionMonth(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestLocalArchiveStore(t *testing.T) {
+	store, err := NewLocalArchiveStore(filepath.Join(t.TempDir(), "archives"))
+	if err != nil {
+		t.Fatalf("NewLocalArchiveStore failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "ledger_entries_2025_01.jsonl.gz", strings.NewReader("first")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put(ctx, "ledger_entries_2025_01.jsonl.gz", strings.NewReader("second")); err != nil {
+		t.Fatalf("Put (overwrite) failed: %v", err)
+	}
+
+	r, err := store.Get(ctx, "ledger_entries_2025_01.jsonl.gz")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "second" {
+		t.Errorf("Get() = %q, %v, want %q", data, err, "second")
+	}
+
+	// No temp files are left behind
+	files, _ := os.ReadDir(filepath.Dir(store.Location("x")))
+	if len(files) != 1 {
+		t.Errorf("Expected 1 file in the archive directory, got %d", len(files))
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x")); err == nil {
+		t.Error("Expected Put to reject a path")
+	}
+	if _, err := store.Get(ctx, "missing.jsonl.gz"); err == nil {
+		t.Error("Expected Get of a missing archive to fail")
+	}
+}
@@ -2,16 +2,23 @@ package ledger
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"strconv"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 )
 
 type Handler struct {
-	service *Service
+	service  *Service
+	archiver *Archiver
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+// NewHandler creates the ledger handler; archiver may be nil to disable archive routes
+func NewHandler(service *Service, archiver *Archiver) *Handler {
+	return &Handler{service: service, archiver: archiver}
 }
 
 // GET /api/v1/ledger/{id}
@@ -40,17 +47,17 @@ func (h *Handler) GetTransactionLedger(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ledger)
 }
 
-// GET /api/v1/ledger/wallet?wallet_id=xxx&limit=20&offset=0
+// GET /api/v1/ledger/wallet?wallet_id=xxx&limit=20&cursor=xxx (or &offset=0)
 func (h *Handler) GetWalletLedger(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	walletID := q.Get("wallet_id")
-	limit, _ := strconv.Atoi(q.Get("limit"))
-	offset, _ := strconv.Atoi(q.Get("offset"))
-	if limit == 0 {
-		limit = 20
+	page, err := pagination.FromQuery(q, 20, 500)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	entries, balance, err := h.service.GetWalletLedger(r.Context(), walletID, limit, offset)
+	entries, balance, nextCursor, err := h.service.GetWalletLedger(r.Context(), walletID, page)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -61,6 +68,7 @@ func (h *Handler) GetWalletLedger(w http.ResponseWriter, r *http.Request) {
 		Entries:        entries,
 		CurrentBalance: balance,
 		Total:          len(entries),
+		NextCursor:     nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -82,26 +90,291 @@ func (h *Handler) GetWalletStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
-// GET /api/v1/ledger?limit=50&offset=0
+// GET /api/v1/ledger?limit=50&cursor=xxx (or &offset=0)
 func (h *Handler) GetAllEntries(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	limit, _ := strconv.Atoi(q.Get("limit"))
-	offset, _ := strconv.Atoi(q.Get("offset"))
-	if limit == 0 {
-		limit = 50
+	page, err := pagination.FromQuery(r.URL.Query(), 50, 500)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	entries, err := h.service.GetAllEntries(r.Context(), limit, offset)
+	entries, nextCursor, err := h.service.GetAllEntries(r.Context(), page)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	resp := LedgerEntriesResponse{
-		Entries: entries,
-		Total:   len(entries),
+		Entries:    entries,
+		Total:      len(entries),
+		NextCursor: nextCursor,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GET /api/v1/internal/ledger/trial-balance?as_of=2025-01-31T23:59:59Z
+func (h *Handler) GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	asOf, err := parseTimeParam(r.URL.Query().Get("as_of"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.GetTrialBalance(r.Context(), asOf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GET /api/v1/ledger/balance?wallet_id=xxx&as_of=2025-01-31T23:59:59Z
+func (h *Handler) GetBalanceAsOf(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	asOf, err := parseTimeParam(q.Get("as_of"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.service.GetBalanceAsOf(r.Context(), q.Get("wallet_id"), asOf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balance)
+}
+
+// POST /api/v1/internal/ledger/periods/close
+// NOTE: Served on the mTLS listener; the client certificate names the closer
+func (h *Handler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	var req ClosePeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		req.ClosedBy = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	period, err := h.service.ClosePeriod(r.Context(), &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(period)
+}
+
+// GET /api/v1/ledger/periods
+func (h *Handler) GetPeriods(w http.ResponseWriter, r *http.Request) {
+	periods, err := h.service.GetPeriods(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := AccountingPeriodsResponse{
+		Periods: periods,
+		Total:   len(periods),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GET /api/v1/internal/ledger/periods/{id}
+func (h *Handler) GetPeriod(w http.ResponseWriter, r *http.Request) {
+	period, err := h.service.GetPeriod(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(period)
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain dates (2006-01-02, UTC midnight)
+func parseTimeParam(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or YYYY-MM-DD", value)
+}
+
+// GET /api/v1/ledger/statement?wallet_id=xxx&from=2025-01-01&to=2025-01-31&format=csv|ofx|camt053
+// NOTE: A date-only "to" includes the whole day
+func (h *Handler) ExportStatement(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	walletID := q.Get("wallet_id")
+
+	format, err := ParseStatementFormat(q.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(q.Get("from"), now.AddDate(0, -1, 0))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(q.Get("to")) == len("2006-01-02") {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if walletID == "" || !to.After(from) {
+		http.Error(w, "wallet_id is required and to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	stmt, err := h.service.OpenStatement(r.Context(), walletID, from, to)
+	switch {
+	case errors.Is(err, ErrNoLedgerEntries):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrArchived):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer stmt.Close()
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s",
+		walletID, from.UTC().Format("20060102"), to.UTC().Format("20060102"), format.FileExtension())
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Large statements can outlive the server write timeout, so each chunk
+	// gets its own deadline instead
+	out := &deadlineWriter{w: w, rc: http.NewResponseController(w), timeout: statementWriteTimeout}
+	if err := stmt.Write(r.Context(), format, out); err != nil {
+		// Headers are already sent; the truncated body is the only signal left
+		h.service.logger.Errorf("Statement export failed for wallet %s: %v", walletID, err)
+	}
+}
+
+// statementWriteTimeout bounds each chunk of a streamed statement
+const statementWriteTimeout = 30 * time.Second
+
+// deadlineWriter flushes every write and extends the write deadline before it,
+// so a stalled client is cut off without capping the whole response
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	_ = d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+	n, err := d.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := d.rc.Flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// GET /api/v1/internal/ledger/partitions
+func (h *Handler) GetPartitions(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.archiver.ListPartitions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// POST /api/v1/internal/ledger/archives/{partition}
+func (h *Handler) ArchivePartition(w http.ResponseWriter, r *http.Request) {
+	archive, err := h.archiver.ArchivePartition(r.Context(), r.PathValue("partition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(archive)
+}
+
+// POST /api/v1/internal/ledger/archives/{partition}/restore
+func (h *Handler) RestoreArchive(w http.ResponseWriter, r *http.Request) {
+	partition := r.PathValue("partition")
+
+	// Restores can take longer than the server write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	restored, err := h.archiver.RestoreArchive(r.Context(), partition)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"partition_name":   partition,
+		"restored_entries": restored,
+	})
+}
+
+// GET /api/v1/internal/ledger/archives/{partition}/entries?wallet_id=xxx
+// NOTE: Streams newline-delimited JSON straight from the archive file
+func (h *Handler) GetArchivedEntries(w http.ResponseWriter, r *http.Request) {
+	partition := r.PathValue("partition")
+	walletID := r.URL.Query().Get("wallet_id")
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	headerSent := false
+	encoder := json.NewEncoder(w)
+	err := h.archiver.ReadArchive(r.Context(), partition, walletID, func(entry *LedgerEntry) error {
+		if !headerSent {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			headerSent = true
+		}
+		return encoder.Encode(entry)
+	})
+
+	if err != nil {
+		if !headerSent {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.service.logger.Errorf("Reading archive %s failed mid-stream: %v", partition, err)
+		return
+	}
+
+	if !headerSent {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	_ = rc.Flush()
+}
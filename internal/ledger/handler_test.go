@@ -0,0 +1,42 @@
+package ledger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	fallback := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", fallback, false},
+		{"2025-01-31", time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2025-01-31T12:30:00Z", time.Date(2025, 1, 31, 12, 30, 0, 0, time.UTC), false},
+		{"31/01/2025", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeParam(tt.value, fallback)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseTimeParam(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestDeadlineWriterFlushesEachWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := &deadlineWriter{w: rec, rc: http.NewResponseController(rec), timeout: time.Second}
+
+	if _, err := out.Write([]byte("date,amount\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !rec.Flushed || rec.Body.String() != "date,amount\n" {
+		t.Errorf("Expected the chunk to be flushed, got flushed=%v body=%q", rec.Flushed, rec.Body.String())
+	}
+}
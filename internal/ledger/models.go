@@ -50,6 +50,9 @@ type CreateLedgerEntriesRequest struct {
 	FromBalanceAfter  string // Balance after transaction
 	ToBalanceBefore   string // Balance before transaction
 	ToBalanceAfter    string // Balance after transaction
+
+	// When the transfer was initiated (transaction.completed initiated_at); zero if unknown
+	InitiatedAt time.Time
 }
 
 // API Response types
@@ -61,8 +64,9 @@ type LedgerEntryResponse struct {
 
 // LedgerEntriesResponse - List of entries response
 type LedgerEntriesResponse struct {
-	Entries []LedgerEntry `json:"entries"`
-	Total   int           `json:"total"`
+	Entries    []LedgerEntry `json:"entries"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
 // TransactionLedgerResponse - All entries for a transaction
@@ -78,6 +82,7 @@ type WalletLedgerResponse struct {
 	Entries       []LedgerEntry `json:"entries"`
 	CurrentBalance string       `json:"current_balance"`
 	Total         int           `json:"total"`
+	NextCursor    string        `json:"next_cursor,omitempty"`
 }
 
 // ErrorResponse - Standard error response
@@ -121,4 +126,149 @@ type LedgerStats struct {
 	EntryCount   int    `json:"entry_count"`
 	FirstEntry   *time.Time `json:"first_entry,omitempty"`
 	LastEntry    *time.Time `json:"last_entry,omitempty"`
-}
\ No newline at end of file
+}
+// TrialBalanceLine - Debit/credit totals for one currency
+// NOTE: In a healthy ledger total debits always equal total credits
+type TrialBalanceLine struct {
+	Currency     string `json:"currency"`
+	TotalDebits  string `json:"total_debits"`
+	TotalCredits string `json:"total_credits"`
+	Difference   string `json:"difference"` // credits - debits, must be 0
+	WalletCount  int    `json:"wallet_count"`
+	EntryCount   int    `json:"entry_count"`
+	Balanced     bool   `json:"balanced"`
+}
+
+// TrialBalance - Trial balance report at a point in time
+type TrialBalance struct {
+	AsOf     time.Time          `json:"as_of"`
+	Lines    []TrialBalanceLine `json:"lines"`
+	Balanced bool               `json:"balanced"`
+}
+
+// WalletBalanceAsOf - Wallet balance at a point in time
+type WalletBalanceAsOf struct {
+	WalletID string    `json:"wallet_id"`
+	AsOf     time.Time `json:"as_of"`
+	Balance  string    `json:"balance"`
+}
+
+// AccountingPeriod - A closed accounting period [PeriodStart, PeriodEnd)
+type AccountingPeriod struct {
+	ID          string          `json:"id"`
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	Status      string          `json:"status"`
+	ClosedBy    string          `json:"closed_by,omitempty"`
+	ClosedAt    time.Time       `json:"closed_at"`
+	Balances    []PeriodBalance `json:"balances,omitempty"`
+}
+
+// Period statuses
+const (
+	PeriodStatusClosed = "closed"
+)
+
+// PeriodBalance - Snapshot of a wallet balance taken when a period is closed
+type PeriodBalance struct {
+	PeriodID       string `json:"period_id"`
+	WalletID       string `json:"wallet_id"`
+	Currency       string `json:"currency"`
+	OpeningBalance string `json:"opening_balance"`
+	ClosingBalance string `json:"closing_balance"`
+	TotalDebits    string `json:"total_debits"`
+	TotalCredits   string `json:"total_credits"`
+	EntryCount     int    `json:"entry_count"`
+}
+
+// ClosePeriodRequest - Request to close an accounting period
+type ClosePeriodRequest struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	ClosedBy    string    `json:"-"`
+}
+
+// AccountingPeriodsResponse - List of closed periods
+type AccountingPeriodsResponse struct {
+	Periods []AccountingPeriod `json:"periods"`
+	Total   int                `json:"total"`
+}
+
+// LedgerPartition - A monthly partition of ledger_entries
+type LedgerPartition struct {
+	Name        string    `json:"name"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+// LedgerArchive - An archived (detached and dropped) monthly partition
+type LedgerArchive struct {
+	PartitionName string     `json:"partition_name"`
+	PeriodStart   time.Time  `json:"period_start"`
+	PeriodEnd     time.Time  `json:"period_end"`
+	Location      string     `json:"location"`
+	SHA256        string     `json:"sha256"`
+	EntryCount    int64      `json:"entry_count"`
+	ArchivedAt    time.Time  `json:"archived_at"`
+	RestoredAt    *time.Time `json:"restored_at,omitempty"`
+}
+
+// ArchiveManifest - Sidecar file written next to every archive
+type ArchiveManifest struct {
+	PartitionName string    `json:"partition_name"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	Object        string    `json:"object"`
+	Format        string    `json:"format"` // jsonl+gzip
+	SHA256        string    `json:"sha256"`
+	EntryCount    int64     `json:"entry_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PartitionsResponse - Live partitions and archived months
+type PartitionsResponse struct {
+	Partitions []LedgerPartition `json:"partitions"`
+	Archives   []LedgerArchive   `json:"archives"`
+}
+
+// RebuildReport - Result of replaying transaction history into a rebuild schema
+type RebuildReport struct {
+	Schema             string              `json:"schema"`
+	Partial            bool                `json:"partial"`
+	EventsRead         int                 `json:"events_read"`
+	Duplicates         int                 `json:"duplicates"`
+	Skipped            int                 `json:"skipped"`
+	Transactions       int                 `json:"transactions"`
+	Entries            int                 `json:"entries"`
+	From               *time.Time          `json:"from,omitempty"`
+	To                 *time.Time          `json:"to,omitempty"`
+	MissingCount       int                 `json:"missing_count"`
+	Missing            []string            `json:"missing"`
+	UnexpectedCount    int                 `json:"unexpected_count"`
+	Unexpected         []string            `json:"unexpected"`
+	ArchivedCount      int                 `json:"archived_count"`
+	Mismatched         []EntryDifference   `json:"mismatched"`
+	BalanceDifferences []BalanceDifference `json:"balance_differences"`
+}
+
+// HasDifferences reports whether the rebuilt ledger disagrees with the live one
+func (r *RebuildReport) HasDifferences() bool {
+	return r.MissingCount > 0 || r.UnexpectedCount > 0 ||
+		len(r.Mismatched) > 0 || len(r.BalanceDifferences) > 0
+}
+
+// EntryDifference - A field that differs between a live and a rebuilt entry
+type EntryDifference struct {
+	TransactionID string `json:"transaction_id"`
+	EntryType     string `json:"entry_type"`
+	Field         string `json:"field"`
+	Live          string `json:"live"`
+	Rebuilt       string `json:"rebuilt"`
+}
+
+// BalanceDifference - A wallet whose live and rebuilt balances differ
+type BalanceDifference struct {
+	WalletID string `json:"wallet_id"`
+	Live     string `json:"live"`
+	Rebuilt  string `json:"rebuilt"`
+}
@@ -0,0 +1,446 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/db"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/lib/pq"
+)
+
+// maxReportedDifferences caps how many ids each report section lists
+const maxReportedDifferences = 100
+
+var schemaNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Rebuilder replays transaction.completed history into a separate schema
+// and compares the result with the live ledger.
+// NOTE: Deduplication relies on transaction_id only - the first event seen for a
+// transaction wins, redeliveries and outbox retries are counted as duplicates
+type Rebuilder struct {
+	db     *db.DB
+	schema string
+	logger *logger.Logger
+
+	eventsRead int
+	duplicates int
+	skipped    int
+}
+
+func NewRebuilder(database *db.DB, schema string, log *logger.Logger) (*Rebuilder, error) {
+	if !schemaNamePattern.MatchString(schema) || schema == "public" || schema == "pg_catalog" {
+		return nil, fmt.Errorf("invalid rebuild schema %q", schema)
+	}
+
+	return &Rebuilder{
+		db:     database,
+		schema: schema,
+		logger: log,
+	}, nil
+}
+
+// table returns a schema-qualified table name in the rebuild schema
+func (r *Rebuilder) table(name string) string {
+	return pq.QuoteIdentifier(r.schema) + "." + pq.QuoteIdentifier(name)
+}
+
+// Prepare creates the rebuild schema with an empty copy of ledger_entries
+// NOTE: The schema must not exist yet unless reset is set, so a rebuild never
+// mixes with the results of an earlier run
+func (r *Rebuilder) Prepare(ctx context.Context, reset bool) error {
+	return r.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if reset {
+			if _, err := tx.ExecContext(ctx, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(r.schema)+` CASCADE`); err != nil {
+				return fmt.Errorf("failed to drop rebuild schema: %w", err)
+			}
+		}
+
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)`, r.schema,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check rebuild schema: %w", err)
+		}
+		if exists {
+			return fmt.Errorf("schema %s already exists (use a new schema or reset it)", r.schema)
+		}
+
+		statements := []string{
+			`CREATE SCHEMA ` + pq.QuoteIdentifier(r.schema),
+			// Replayed events, one row per transaction
+			`CREATE TABLE ` + r.table("replayed_events") + ` (
+				seq BIGSERIAL,
+				transaction_id VARCHAR(255) PRIMARY KEY,
+				from_wallet_id VARCHAR(255) NOT NULL,
+				to_wallet_id VARCHAR(255) NOT NULL,
+				amount NUMERIC(20, 4) NOT NULL,
+				currency VARCHAR(3) NOT NULL,
+				transaction_type VARCHAR(20) NOT NULL,
+				completed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				source VARCHAR(100) NOT NULL
+			)`,
+			`CREATE TABLE ` + r.table("ledger_entries") + ` (LIKE ledger_entries INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`,
+			`CREATE UNIQUE INDEX ON ` + r.table("ledger_entries") + ` (transaction_id, entry_type)`,
+			`CREATE INDEX ON ` + r.table("ledger_entries") + ` (wallet_id, created_at DESC, id DESC)`,
+		}
+
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to prepare rebuild schema: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Add records one transaction.completed topic event
+// NOTE: Batch events contribute one row per leg. Payloads with nothing to post
+// (legacy batch summaries without legs) and payloads the live consumer
+// dead-letters (unknown types, malformed transfers) are counted as skipped
+func (r *Rebuilder) Add(ctx context.Context, env *kafka.Envelope, fallbackTime time.Time, source string) error {
+	r.eventsRead++
+
+	_, events, err := parseTransactionEvents(env)
+	if err != nil || len(events) == 0 {
+		r.skipped++
+		r.logger.Debugf("Skipping replayed event from %s: %v", source, err)
+		return nil
+	}
+
+	query := `
+		INSERT INTO ` + r.table("replayed_events") + ` (
+			transaction_id, from_wallet_id, to_wallet_id, amount, currency,
+			transaction_type, completed_at, source
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (transaction_id) DO NOTHING
+	`
+
+	for _, event := range events {
+		completedAt := event.CompletedAt
+		if completedAt.IsZero() {
+			completedAt = fallbackTime
+		}
+
+		res, err := r.db.ExecContext(ctx, query,
+			event.TransactionID,
+			event.FromWalletID,
+			event.ToWalletID,
+			event.Amount,
+			event.Currency,
+			event.Type,
+			completedAt,
+			source,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store replayed event %s: %w", event.TransactionID, err)
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			r.duplicates++
+		}
+	}
+	return nil
+}
+
+// LoadFromKafka replays the transaction.completed topic from offset
+func (r *Rebuilder) LoadFromKafka(ctx context.Context, cfg config.KafkaConfig, partition int, offset int64) error {
+	return kafka.Replay(ctx, cfg, "transaction.completed", partition, offset, func(ctx context.Context, msg kafka.ReplayMessage) error {
+		source := fmt.Sprintf("kafka:%d:%d", msg.Partition, msg.Offset)
+
+		env, err := kafka.DecodeEnvelope(msg.Value)
+		if err != nil {
+			r.eventsRead++
+			r.skipped++
+			r.logger.Debugf("Skipping replayed event from %s: %v", source, err)
+			return nil
+		}
+		return r.Add(ctx, env, msg.Time, source)
+	}, r.logger)
+}
+
+// LoadFromOutbox replays transaction.completed events from the transaction
+// service's outbox table, including events not yet published
+func (r *Rebuilder) LoadFromOutbox(ctx context.Context, outboxDB *sql.DB, since time.Time) error {
+	query := `
+		SELECT id, event_type, schema_version, payload, created_at
+		FROM outbox_events
+		WHERE topic = 'transaction.completed' AND created_at >= $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := outboxDB.QueryContext(ctx, query, since)
+	if err != nil {
+		return fmt.Errorf("failed to read outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		env := &kafka.Envelope{}
+		var payload []byte
+		if err := rows.Scan(&env.ID, &env.Type, &env.Version, &payload, &env.OccurredAt); err != nil {
+			return fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		env.Payload = payload
+
+		if err := r.Add(ctx, env, env.OccurredAt, "outbox:"+env.ID); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Build turns the replayed events into double-entry rows with running balances
+// NOTE: Events are applied in completion order; descriptions and metadata
+// follow CreateLedgerEntries so rows compare one-to-one with the live ledger
+func (r *Rebuilder) Build(ctx context.Context) (int, error) {
+	query := `
+		INSERT INTO ` + r.table("ledger_entries") + ` (
+			transaction_id, wallet_id, entry_type, amount, currency, balance,
+			description, metadata, created_at
+		)
+		SELECT
+			transaction_id, wallet_id, entry_type, amount, currency, balance_after,
+			description,
+			jsonb_build_object(
+				counterparty_key, counterparty,
+				'balance_before', (balance_after - signed_amount)::NUMERIC(20, 4)::TEXT,
+				'balance_after', balance_after::TEXT
+			),
+			completed_at
+		FROM (
+			SELECT e.*,
+				SUM(signed_amount) OVER (
+					PARTITION BY wallet_id
+					ORDER BY completed_at, seq, entry_type DESC
+					ROWS UNBOUNDED PRECEDING
+				)::NUMERIC(20, 4) AS balance_after
+			FROM (
+				SELECT seq, transaction_id, from_wallet_id AS wallet_id, 'debit' AS entry_type,
+					amount, currency, -amount AS signed_amount, completed_at,
+					'to_wallet_id' AS counterparty_key, to_wallet_id AS counterparty,
+					format('Transfer to %s: %s transfer', to_wallet_id, transaction_type) AS description
+				FROM ` + r.table("replayed_events") + `
+				UNION ALL
+				SELECT seq, transaction_id, to_wallet_id, 'credit',
+					amount, currency, amount, completed_at,
+					'from_wallet_id', from_wallet_id,
+					format('Transfer from %s: %s transfer', from_wallet_id, transaction_type)
+				FROM ` + r.table("replayed_events") + `
+			) e
+		) x
+		ORDER BY completed_at, seq, entry_type DESC
+	`
+
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build rebuilt ledger: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Verify compares the rebuilt ledger with the live ledger
+// NOTE: For a partial replay (later offset, single partition, or a start time)
+// running balances cannot match, so only transactions inside the replayed
+// window are compared and balance fields are ignored
+func (r *Rebuilder) Verify(ctx context.Context, partial bool) (*RebuildReport, error) {
+	report := &RebuildReport{
+		Schema:     r.schema,
+		Partial:    partial,
+		EventsRead: r.eventsRead,
+		Duplicates: r.duplicates,
+		Skipped:    r.skipped,
+	}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), MIN(completed_at), MAX(completed_at)
+		FROM `+r.table("replayed_events"),
+	).Scan(&report.Transactions, &report.From, &report.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize replayed events: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+r.table("ledger_entries")).Scan(&report.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rebuilt entries: %w", err)
+	}
+
+	// Live transactions that the replay never saw
+	window := `TRUE`
+	if partial {
+		window = `l.created_at >= (SELECT MIN(completed_at) FROM ` + r.table("replayed_events") + `)`
+	}
+	report.MissingCount, report.Missing, err = r.listTransactions(ctx, `
+		SELECT DISTINCT l.transaction_id
+		FROM ledger_entries l
+		WHERE `+window+`
+		  AND NOT EXISTS (
+			SELECT 1 FROM `+r.table("replayed_events")+` e WHERE e.transaction_id = l.transaction_id
+		  )
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replayed transactions with no live entries; months that were archived
+	// out of Postgres are counted separately
+	unexpected := `
+		SELECT e.transaction_id
+		FROM ` + r.table("replayed_events") + ` e
+		WHERE NOT EXISTS (SELECT 1 FROM ledger_entries l WHERE l.transaction_id = e.transaction_id)
+		  AND %s EXISTS (
+			SELECT 1 FROM ledger_archives a
+			WHERE a.restored_at IS NULL
+			  AND e.completed_at >= a.period_start AND e.completed_at < a.period_end
+		  )
+	`
+	report.UnexpectedCount, report.Unexpected, err = r.listTransactions(ctx, fmt.Sprintf(unexpected, "NOT"))
+	if err != nil {
+		return nil, err
+	}
+	report.ArchivedCount, _, err = r.listTransactions(ctx, fmt.Sprintf(unexpected, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Mismatched, err = r.mismatchedEntries(ctx, partial); err != nil {
+		return nil, err
+	}
+
+	if !partial {
+		if report.BalanceDifferences, err = r.balanceDifferences(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// listTransactions counts the ids a query returns and keeps the first few
+func (r *Rebuilder) listTransactions(ctx context.Context, query string) (int, []string, error) {
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY 1`)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to compare transactions: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan transaction id: %w", err)
+		}
+		if count < maxReportedDifferences {
+			ids = append(ids, id)
+		}
+		count++
+	}
+
+	return count, ids, rows.Err()
+}
+
+func (r *Rebuilder) mismatchedEntries(ctx context.Context, partial bool) ([]EntryDifference, error) {
+	query := `
+		SELECT r.transaction_id, r.entry_type,
+			l.wallet_id, r.wallet_id,
+			l.amount::TEXT, r.amount::TEXT,
+			l.currency, r.currency,
+			l.balance::TEXT, r.balance::TEXT
+		FROM ` + r.table("ledger_entries") + ` r
+		JOIN ledger_entries l
+		  ON l.transaction_id = r.transaction_id AND l.entry_type = r.entry_type
+		WHERE (l.wallet_id, l.amount, l.currency) IS DISTINCT FROM (r.wallet_id, r.amount, r.currency)
+		   OR (NOT $1 AND l.balance <> r.balance)
+		ORDER BY r.created_at, r.transaction_id, r.entry_type
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, partial, maxReportedDifferences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare entries: %w", err)
+	}
+	defer rows.Close()
+
+	diffs := []EntryDifference{}
+	for rows.Next() {
+		var txID, entryType string
+		var live, rebuilt [4]string
+		err := rows.Scan(&txID, &entryType,
+			&live[0], &rebuilt[0],
+			&live[1], &rebuilt[1],
+			&live[2], &rebuilt[2],
+			&live[3], &rebuilt[3],
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan entry difference: %w", err)
+		}
+
+		for i, field := range []string{"wallet_id", "amount", "currency", "balance"} {
+			if live[i] == rebuilt[i] || (partial && field == "balance") {
+				continue
+			}
+			diffs = append(diffs, EntryDifference{
+				TransactionID: txID,
+				EntryType:     entryType,
+				Field:         field,
+				Live:          live[i],
+				Rebuilt:       rebuilt[i],
+			})
+		}
+	}
+
+	return diffs, rows.Err()
+}
+
+func (r *Rebuilder) balanceDifferences(ctx context.Context) ([]BalanceDifference, error) {
+	query := `
+		SELECT wallet_id, live_balance::TEXT, rebuilt_balance::TEXT
+		FROM (
+			SELECT w.wallet_id,
+				ledger_balance_as_of(w.wallet_id, 'infinity') AS live_balance,
+				COALESCE((
+					SELECT SUM(CASE WHEN entry_type = 'credit' THEN amount ELSE -amount END)
+					FROM ` + r.table("ledger_entries") + ` r
+					WHERE r.wallet_id = w.wallet_id
+				), 0)::NUMERIC(20, 4) AS rebuilt_balance
+			FROM (
+				SELECT wallet_id FROM ` + r.table("ledger_entries") + `
+				UNION
+				SELECT wallet_id FROM ledger_entries
+				UNION
+				SELECT wallet_id FROM ledger_archive_balances
+			) w
+		) b
+		WHERE live_balance <> rebuilt_balance
+		ORDER BY wallet_id
+		LIMIT $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, maxReportedDifferences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare balances: %w", err)
+	}
+	defer rows.Close()
+
+	diffs := []BalanceDifference{}
+	for rows.Next() {
+		var d BalanceDifference
+		if err := rows.Scan(&d.WalletID, &d.Live, &d.Rebuilt); err != nil {
+			return nil, fmt.Errorf("failed to scan balance difference: %w", err)
+		}
+		diffs = append(diffs, d)
+	}
+
+	return diffs, rows.Err()
+}
@@ -0,0 +1,131 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+func TestNewRebuilder(t *testing.T) {
+	tests := []struct {
+		schema  string
+		wantErr bool
+	}{
+		{"ledger_rebuild", false},
+		{"_rebuild2", false},
+		{"public", true},
+		{"pg_catalog", true},
+		{"Rebuild", true},
+		{"2rebuild", true},
+		{"rebuild; DROP TABLE ledger_entries", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRebuilder(nil, tt.schema, logger.New("test"))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewRebuilder(%q) error = %v, want error %v", tt.schema, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRebuilderTable(t *testing.T) {
+	r, err := NewRebuilder(nil, "ledger_rebuild", logger.New("test"))
+	if err != nil {
+		t.Fatalf("NewRebuilder failed: %v", err)
+	}
+
+	if got := r.table("ledger_entries"); got != `"ledger_rebuild"."ledger_entries"` {
+		t.Errorf("table() = %s", got)
+	}
+}
+
+func TestRebuildVerify(t *testing.T) {
+	service, database := testService(t)
+	ctx := context.Background()
+
+	postTransfer(t, service, "t1", "wallet-a", "wallet-b", "10")
+	postTransfer(t, service, "t2", "wallet-a", "wallet-c", "5")
+	postTransfer(t, service, "t3", "wallet-c", "wallet-d", "1")
+
+	schema := fmt.Sprintf("ledger_rebuild_test_%d", time.Now().UnixNano())
+	rebuilder, err := NewRebuilder(database, schema, logger.New("test"))
+	if err != nil {
+		t.Fatalf("NewRebuilder failed: %v", err)
+	}
+	t.Cleanup(func() { database.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE") })
+	if err := rebuilder.Prepare(ctx, false); err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	// t1 is never replayed, t2 is replayed with another amount, and t3 matches
+	// but lands on a different running balance
+	completedAt := time.Now().UTC()
+	replay := func(id, from, to, amount string, at time.Time) {
+		env, err := kafka.DecodeEnvelope([]byte(fmt.Sprintf(
+			`{"id":"e-%s","type":"transaction.completed","version":1,"payload":{"transaction_id":%q,"from_wallet_id":%q,"to_wallet_id":%q,"amount":%q,"currency":"USD","type":"p2p","completed_at":%q}}`,
+			id, id, from, to, amount, at.Format(time.RFC3339Nano),
+		)))
+		if err != nil {
+			t.Fatalf("DecodeEnvelope failed: %v", err)
+		}
+		if err := rebuilder.Add(ctx, env, at, "test"); err != nil {
+			t.Fatalf("Add(%s) failed: %v", id, err)
+		}
+	}
+	replay("t2", "wallet-a", "wallet-c", "6", completedAt)
+	replay("t3", "wallet-c", "wallet-d", "1", completedAt.Add(time.Second))
+	replay("t3", "wallet-c", "wallet-d", "1", completedAt.Add(time.Second))
+
+	if n, err := rebuilder.Build(ctx); err != nil || n != 4 {
+		t.Fatalf("Build() = %d, %v, want 4 entries", n, err)
+	}
+
+	report, err := rebuilder.Verify(ctx, false)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	if report.EventsRead != 3 || report.Duplicates != 1 || report.Transactions != 2 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if report.MissingCount != 1 || !reflect.DeepEqual(report.Missing, []string{"t1"}) {
+		t.Errorf("Expected t1 to be missing, got %v", report.Missing)
+	}
+	if report.UnexpectedCount != 0 {
+		t.Errorf("Expected no unexpected transactions, got %v", report.Unexpected)
+	}
+
+	mismatched := map[string]EntryDifference{}
+	for _, d := range report.Mismatched {
+		mismatched[d.TransactionID+" "+d.EntryType+" "+d.Field] = d
+	}
+	if d, ok := mismatched["t2 debit amount"]; !ok || d.Live != "5.0000" || d.Rebuilt != "6.0000" {
+		t.Errorf("Expected the t2 debit amount to differ, got %+v", report.Mismatched)
+	}
+	if d, ok := mismatched["t3 debit balance"]; !ok || d.Live != "4.0000" || d.Rebuilt != "5.0000" {
+		t.Errorf("Expected the t3 debit balance to differ, got %+v", report.Mismatched)
+	}
+	if _, ok := mismatched["t3 debit amount"]; ok {
+		t.Errorf("Expected the t3 amount to match, got %+v", report.Mismatched)
+	}
+	if _, ok := mismatched["t3 credit balance"]; ok {
+		t.Errorf("Expected the t3 credit to match, got %+v", report.Mismatched)
+	}
+
+	wallets := []string{}
+	for _, d := range report.BalanceDifferences {
+		wallets = append(wallets, d.WalletID)
+	}
+	if !reflect.DeepEqual(wallets, []string{"wallet-a", "wallet-b", "wallet-c"}) {
+		t.Errorf("Expected balances of wallets a, b and c to differ, got %+v", report.BalanceDifferences)
+	}
+	if !report.HasDifferences() {
+		t.Error("Expected the report to have differences")
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
+	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/db"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
+	"github.com/lib/pq"
 )
 
 type Repository struct {
@@ -15,6 +20,13 @@ type Repository struct {
 	logger *logger.Logger
 }
 
+// queryer is satisfied by both the pool and a transaction, for reads that
+// run either way
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 func NewRepository(database *db.DB, log *logger.Logger) *Repository {
 	return &Repository{
 		db:     database,
@@ -65,8 +77,53 @@ func (r *Repository) CreateLedgerEntry(ctx context.Context, entry *LedgerEntry)
 	return entry, nil
 }
 
+// MarkTransactionProcessedTx claims a transaction_id for posting
+// NOTE: Returns false when the transaction was already posted; the row lock
+// also serializes concurrent deliveries of the same message
+func (r *Repository) MarkTransactionProcessedTx(ctx context.Context, tx *sql.Tx, transactionID string) (bool, error) {
+	query := `
+		INSERT INTO ledger_processed_transactions (transaction_id)
+		VALUES ($1)
+		ON CONFLICT (transaction_id) DO NOTHING
+	`
+
+	res, err := tx.ExecContext(ctx, query, transactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark transaction processed: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark transaction processed: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// LockWalletsTx takes a transaction-scoped lock on each wallet
+// NOTE: Events for different transactions are posted concurrently; the lock
+// makes reading the latest balance and appending the next entry atomic per
+// wallet. Wallets are locked in sorted order so two transfers between the
+// same pair cannot deadlock.
+func (r *Repository) LockWalletsTx(ctx context.Context, tx *sql.Tx, walletIDs ...string) error {
+	ids := append([]string(nil), walletIDs...)
+	sort.Strings(ids)
+
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('ledger_wallet:' || $1, 0))`, id); err != nil {
+			return fmt.Errorf("failed to lock wallet %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
 // CreateLedgerEntryTx creates entry within existing transaction
-// NOTE: Used when creating entry + outbox event atomically
+// NOTE: Used when creating entry + outbox event atomically. created_at is the
+// insert time, not the transaction start, so entries appended under the wallet
+// lock are ordered the same way as their running balances
 func (r *Repository) CreateLedgerEntryTx(ctx context.Context, tx *sql.Tx, entry *LedgerEntry) (*LedgerEntry, error) {
 	var metadataJSON []byte
 	var err error
@@ -81,9 +138,9 @@ func (r *Repository) CreateLedgerEntryTx(ctx context.Context, tx *sql.Tx, entry
 	query := `
 		INSERT INTO ledger_entries (
 			transaction_id, wallet_id, entry_type, amount, currency, 
-			balance, description, metadata
+			balance, description, metadata, created_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, clock_timestamp())
 		RETURNING id, created_at
 	`
 
@@ -180,7 +237,7 @@ func (r *Repository) GetEntriesByWallet(ctx context.Context, walletID string, li
 			balance, description, metadata, created_at
 		FROM ledger_entries
 		WHERE wallet_id = $1
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT $2 OFFSET $3
 	`
 
@@ -193,21 +250,43 @@ func (r *Repository) GetEntriesByWallet(ctx context.Context, walletID string, li
 	return r.scanEntries(rows)
 }
 
-// GetLatestBalance retrieves the most recent balance for a wallet
-func (r *Repository) GetLatestBalance(ctx context.Context, walletID string) (string, error) {
+// GetEntriesByWalletAfter retrieves wallet entries older than the cursor (keyset pagination)
+func (r *Repository) GetEntriesByWalletAfter(ctx context.Context, walletID string, cursor *pagination.Cursor, limit int) ([]LedgerEntry, error) {
 	query := `
-		SELECT balance
+		SELECT 
+			id, transaction_id, wallet_id, entry_type, amount, currency,
+			balance, description, metadata, created_at
 		FROM ledger_entries
-		WHERE wallet_id = $1
-		ORDER BY created_at DESC
-		LIMIT 1
+		WHERE wallet_id = $1 AND (created_at, id) < ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
 	`
 
-	var balance string
-	err := r.db.QueryRowContext(ctx, query, walletID).Scan(&balance)
-	if err == sql.ErrNoRows {
-		return "0.0000", nil // No entries yet
+	rows, err := r.db.QueryContext(ctx, query, walletID, cursor.CreatedAt, cursor.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet entries: %w", err)
 	}
+	defer rows.Close()
+
+	return r.scanEntries(rows)
+}
+
+// GetLatestBalance retrieves the most recent balance for a wallet
+// NOTE: Falls back to archived months, "0.0000" if the wallet has no entries yet
+func (r *Repository) GetLatestBalance(ctx context.Context, walletID string) (string, error) {
+	return r.latestBalance(ctx, r.db, walletID)
+}
+
+// GetLatestBalanceTx is GetLatestBalance inside a transaction
+func (r *Repository) GetLatestBalanceTx(ctx context.Context, tx *sql.Tx, walletID string) (string, error) {
+	return r.latestBalance(ctx, tx, walletID)
+}
+
+func (r *Repository) latestBalance(ctx context.Context, q queryer, walletID string) (string, error) {
+	query := `SELECT ledger_balance_as_of($1, 'infinity')`
+
+	var balance string
+	err := q.QueryRowContext(ctx, query, walletID).Scan(&balance)
 	if err != nil {
 		return "", fmt.Errorf("failed to get latest balance: %w", err)
 	}
@@ -243,23 +322,38 @@ func (r *Repository) VerifyTransactionBalance(ctx context.Context, transactionID
 }
 
 // GetWalletStats calculates statistics for a wallet
-// NOTE: Useful for analytics and reporting
+// NOTE: Useful for analytics and reporting; includes archived months
 func (r *Repository) GetWalletStats(ctx context.Context, walletID string) (*LedgerStats, error) {
 	query := `
 		SELECT 
-			COALESCE(SUM(CASE WHEN entry_type = 'debit' THEN amount ELSE 0 END), 0) as total_debits,
-			COALESCE(SUM(CASE WHEN entry_type = 'credit' THEN amount ELSE 0 END), 0) as total_credits,
-			COUNT(*) as entry_count,
-			MIN(created_at) as first_entry,
-			MAX(created_at) as last_entry
-		FROM ledger_entries
-		WHERE wallet_id = $1
+			COALESCE(SUM(total_debits), 0) as total_debits,
+			COALESCE(SUM(total_credits), 0) as total_credits,
+			COALESCE(SUM(total_credits - total_debits), 0) as net_change,
+			COALESCE(SUM(entry_count), 0) as entry_count,
+			MIN(first_entry) as first_entry,
+			MAX(last_entry) as last_entry
+		FROM (
+			SELECT
+				SUM(CASE WHEN entry_type = 'debit' THEN amount ELSE 0 END) as total_debits,
+				SUM(CASE WHEN entry_type = 'credit' THEN amount ELSE 0 END) as total_credits,
+				COUNT(*) as entry_count,
+				MIN(created_at) as first_entry,
+				MAX(created_at) as last_entry
+			FROM ledger_entries
+			WHERE wallet_id = $1
+			UNION ALL
+			SELECT b.total_debits, b.total_credits, b.entry_count, b.first_entry_at, b.last_entry_at
+			FROM ledger_archive_balances b
+			JOIN ledger_archives a ON a.partition_name = b.partition_name
+			WHERE b.wallet_id = $1 AND a.restored_at IS NULL
+		) totals
 	`
 
 	stats := &LedgerStats{WalletID: walletID}
 	err := r.db.QueryRowContext(ctx, query, walletID).Scan(
 		&stats.TotalDebits,
 		&stats.TotalCredits,
+		&stats.NetChange,
 		&stats.EntryCount,
 		&stats.FirstEntry,
 		&stats.LastEntry,
@@ -269,10 +363,6 @@ func (r *Repository) GetWalletStats(ctx context.Context, walletID string) (*Ledg
 		return nil, fmt.Errorf("failed to get stats: %w", err)
 	}
 
-	// Calculate net change (credits - debits)
-	// TODO: Use proper decimal arithmetic
-	stats.NetChange = "0.0000" // Placeholder
-
 	return stats, nil
 }
 
@@ -284,7 +374,7 @@ func (r *Repository) GetAllEntriesPaginated(ctx context.Context, limit, offset i
 			id, transaction_id, wallet_id, entry_type, amount, currency,
 			balance, description, metadata, created_at
 		FROM ledger_entries
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT $1 OFFSET $2
 	`
 
@@ -297,45 +387,802 @@ func (r *Repository) GetAllEntriesPaginated(ctx context.Context, limit, offset i
 	return r.scanEntries(rows)
 }
 
+// GetAllEntriesAfter retrieves ledger entries older than the cursor (keyset pagination)
+func (r *Repository) GetAllEntriesAfter(ctx context.Context, cursor *pagination.Cursor, limit int) ([]LedgerEntry, error) {
+	query := `
+		SELECT 
+			id, transaction_id, wallet_id, entry_type, amount, currency,
+			balance, description, metadata, created_at
+		FROM ledger_entries
+		WHERE (created_at, id) < ($1, $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, cursor.CreatedAt, cursor.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entries: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanEntries(rows)
+}
+
 func (r *Repository) scanEntries(rows *sql.Rows) ([]LedgerEntry, error) {
 	var entries []LedgerEntry
 
 	for rows.Next() {
-		var entry LedgerEntry
-		var metadataJSON []byte
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.TransactionID,
-			&entry.WalletID,
-			&entry.EntryType,
-			&entry.Amount,
-			&entry.Currency,
-			&entry.Balance,
-			&entry.Description,
-			&metadataJSON,
-			&entry.CreatedAt,
+		entry, err := r.scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *Repository) scanEntry(rows *sql.Rows) (*LedgerEntry, error) {
+	var entry LedgerEntry
+	var metadataJSON []byte
+
+	err := rows.Scan(
+		&entry.ID,
+		&entry.TransactionID,
+		&entry.WalletID,
+		&entry.EntryType,
+		&entry.Amount,
+		&entry.Currency,
+		&entry.Balance,
+		&entry.Description,
+		&metadataJSON,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan entry: %w", err)
+	}
+
+	// ✅ FIX: Safely unmarshal metadata (handle NULL)
+	if len(metadataJSON) > 0 && string(metadataJSON) != "null" {
+		if err := json.Unmarshal(metadataJSON, &entry.Metadata); err != nil {
+			r.logger.Warnf("Failed to unmarshal metadata: %v", err)
+			entry.Metadata = make(map[string]interface{})
+		}
+	} else {
+		entry.Metadata = make(map[string]interface{})
+	}
+
+	return &entry, nil
+}
+
+// GetBalanceAsOf retrieves the running balance of a wallet at a point in time
+// NOTE: Returns "0.0000" if the wallet had no entries yet
+func (r *Repository) GetBalanceAsOf(ctx context.Context, walletID string, asOf time.Time) (string, error) {
+	return r.balanceAsOf(ctx, r.db, walletID, asOf)
+}
+
+// GetBalanceAsOfTx is GetBalanceAsOf inside a transaction
+func (r *Repository) GetBalanceAsOfTx(ctx context.Context, tx *sql.Tx, walletID string, asOf time.Time) (string, error) {
+	return r.balanceAsOf(ctx, tx, walletID, asOf)
+}
+
+func (r *Repository) balanceAsOf(ctx context.Context, q queryer, walletID string, asOf time.Time) (string, error) {
+	query := `SELECT ledger_balance_as_of($1, $2)`
+
+	var balance string
+	err := q.QueryRowContext(ctx, query, walletID, asOf).Scan(&balance)
+	if err != nil {
+		return "", fmt.Errorf("failed to get balance as of %s: %w", asOf.Format(time.RFC3339), err)
+	}
+
+	return balance, nil
+}
+
+// GetTrialBalance sums debits and credits per currency up to asOf
+// NOTE: Sums are done in NUMERIC so the comparison is exact; archived
+// months contribute their stored totals
+func (r *Repository) GetTrialBalance(ctx context.Context, asOf time.Time) ([]TrialBalanceLine, error) {
+	return r.trialBalance(ctx, r.db, asOf)
+}
+
+// GetTrialBalanceTx is GetTrialBalance inside a transaction
+func (r *Repository) GetTrialBalanceTx(ctx context.Context, tx *sql.Tx, asOf time.Time) ([]TrialBalanceLine, error) {
+	return r.trialBalance(ctx, tx, asOf)
+}
+
+func (r *Repository) trialBalance(ctx context.Context, q queryer, asOf time.Time) ([]TrialBalanceLine, error) {
+	query := `
+		SELECT
+			currency,
+			COALESCE(SUM(total_debits), 0) as total_debits,
+			COALESCE(SUM(total_credits), 0) as total_credits,
+			COALESCE(SUM(total_credits - total_debits), 0) as difference,
+			COUNT(DISTINCT wallet_id) as wallet_count,
+			COALESCE(SUM(entry_count), 0) as entry_count
+		FROM (
+			SELECT
+				currency,
+				wallet_id,
+				SUM(CASE WHEN entry_type = 'debit' THEN amount ELSE 0 END) as total_debits,
+				SUM(CASE WHEN entry_type = 'credit' THEN amount ELSE 0 END) as total_credits,
+				COUNT(*) as entry_count
+			FROM ledger_entries
+			WHERE created_at <= $1
+			GROUP BY currency, wallet_id
+			UNION ALL
+			SELECT b.currency, b.wallet_id, b.total_debits, b.total_credits, b.entry_count
+			FROM ledger_archive_balances b
+			JOIN ledger_archives a ON a.partition_name = b.partition_name
+			WHERE a.restored_at IS NULL AND a.period_end <= $1
+		) movements
+		GROUP BY currency
+		ORDER BY currency
+	`
+
+	rows, err := q.QueryContext(ctx, query, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trial balance: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []TrialBalanceLine
+	for rows.Next() {
+		var line TrialBalanceLine
+		if err := rows.Scan(
+			&line.Currency,
+			&line.TotalDebits,
+			&line.TotalCredits,
+			&line.Difference,
+			&line.WalletCount,
+			&line.EntryCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan trial balance: %w", err)
+		}
+		line.Balanced = line.TotalDebits == line.TotalCredits
+		lines = append(lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return lines, nil
+}
+
+// LockForPeriodCloseTx serializes period closes and waits for in-flight inserts
+// NOTE: Entries committed after this point are checked by the closed-period trigger
+func (r *Repository) LockForPeriodCloseTx(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE accounting_periods IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock accounting periods: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE ledger_entries IN SHARE MODE`); err != nil {
+		return fmt.Errorf("failed to lock ledger entries: %w", err)
+	}
+	return nil
+}
+
+// PeriodOverlapsTx checks whether [start, end) overlaps an already closed period
+func (r *Repository) PeriodOverlapsTx(ctx context.Context, tx *sql.Tx, start, end time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM accounting_periods
+			WHERE period_start < $2 AND period_end > $1
 		)
+	`
+
+	var overlaps bool
+	if err := tx.QueryRowContext(ctx, query, start, end).Scan(&overlaps); err != nil {
+		return false, fmt.Errorf("failed to check period overlap: %w", err)
+	}
+
+	return overlaps, nil
+}
+
+// CreatePeriodTx inserts a closed accounting period
+func (r *Repository) CreatePeriodTx(ctx context.Context, tx *sql.Tx, period *AccountingPeriod) (*AccountingPeriod, error) {
+	query := `
+		INSERT INTO accounting_periods (period_start, period_end, status, closed_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, closed_at
+	`
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		period.PeriodStart,
+		period.PeriodEnd,
+		period.Status,
+		period.ClosedBy,
+	).Scan(&period.ID, &period.ClosedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accounting period: %w", err)
+	}
+
+	return period, nil
+}
+
+// SnapshotPeriodBalancesTx stores opening/closing balances of every wallet for a period
+func (r *Repository) SnapshotPeriodBalancesTx(ctx context.Context, tx *sql.Tx, period *AccountingPeriod) (int64, error) {
+	query := `
+		INSERT INTO period_balances (
+			period_id, wallet_id, currency, opening_balance, closing_balance,
+			total_debits, total_credits, entry_count
+		)
+		SELECT
+			$1,
+			w.wallet_id,
+			w.currency,
+			ledger_balance_as_of(w.wallet_id, $2::timestamptz - INTERVAL '1 microsecond'),
+			ledger_balance_as_of(w.wallet_id, $3::timestamptz - INTERVAL '1 microsecond'),
+			COALESCE(m.total_debits, 0),
+			COALESCE(m.total_credits, 0),
+			COALESCE(m.entry_count, 0)
+		FROM (
+			SELECT wallet_id, currency
+			FROM ledger_entries
+			WHERE created_at < $3
+			UNION
+			SELECT b.wallet_id, b.currency
+			FROM ledger_archive_balances b
+			JOIN ledger_archives a ON a.partition_name = b.partition_name
+			WHERE a.restored_at IS NULL AND a.period_end <= $3
+		) w
+		LEFT JOIN (
+			SELECT
+				wallet_id,
+				currency,
+				SUM(CASE WHEN entry_type = 'debit' THEN amount ELSE 0 END) as total_debits,
+				SUM(CASE WHEN entry_type = 'credit' THEN amount ELSE 0 END) as total_credits,
+				COUNT(*) as entry_count
+			FROM ledger_entries
+			WHERE created_at >= $2 AND created_at < $3
+			GROUP BY wallet_id, currency
+		) m ON m.wallet_id = w.wallet_id AND m.currency = w.currency
+	`
+
+	result, err := tx.ExecContext(ctx, query, period.ID, period.PeriodStart, period.PeriodEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snapshot period balances: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// GetPeriods lists closed accounting periods, newest first
+func (r *Repository) GetPeriods(ctx context.Context) ([]AccountingPeriod, error) {
+	query := `
+		SELECT id, period_start, period_end, status, COALESCE(closed_by, ''), closed_at
+		FROM accounting_periods
+		ORDER BY period_start DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounting periods: %w", err)
+	}
+	defer rows.Close()
+
+	var periods []AccountingPeriod
+	for rows.Next() {
+		var p AccountingPeriod
+		if err := rows.Scan(&p.ID, &p.PeriodStart, &p.PeriodEnd, &p.Status, &p.ClosedBy, &p.ClosedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan accounting period: %w", err)
+		}
+		periods = append(periods, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return periods, nil
+}
+
+// GetPeriod retrieves a closed period together with its balance snapshot
+func (r *Repository) GetPeriod(ctx context.Context, id string) (*AccountingPeriod, error) {
+	query := `
+		SELECT id, period_start, period_end, status, COALESCE(closed_by, ''), closed_at
+		FROM accounting_periods
+		WHERE id = $1
+	`
+
+	p := &AccountingPeriod{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&p.ID, &p.PeriodStart, &p.PeriodEnd, &p.Status, &p.ClosedBy, &p.ClosedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("accounting period not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounting period: %w", err)
+	}
+
+	balancesQuery := `
+		SELECT
+			period_id, wallet_id, currency, opening_balance, closing_balance,
+			total_debits, total_credits, entry_count
+		FROM period_balances
+		WHERE period_id = $1
+		ORDER BY currency, wallet_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, balancesQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get period balances: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b PeriodBalance
+		if err := rows.Scan(
+			&b.PeriodID,
+			&b.WalletID,
+			&b.Currency,
+			&b.OpeningBalance,
+			&b.ClosingBalance,
+			&b.TotalDebits,
+			&b.TotalCredits,
+			&b.EntryCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan period balance: %w", err)
+		}
+		p.Balances = append(p.Balances, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return p, nil
+}
+
+// StreamEntriesByWallet calls fn for each wallet entry in [from, to), oldest first
+// NOTE: Rows are read one at a time so large ranges never sit in memory
+func (r *Repository) StreamEntriesByWallet(ctx context.Context, walletID string, from, to time.Time, fn func(*LedgerEntry) error) error {
+	return r.streamEntriesByWallet(ctx, r.db, walletID, from, to, fn)
+}
+
+// StreamEntriesByWalletTx is StreamEntriesByWallet inside a transaction
+func (r *Repository) StreamEntriesByWalletTx(ctx context.Context, tx *sql.Tx, walletID string, from, to time.Time, fn func(*LedgerEntry) error) error {
+	return r.streamEntriesByWallet(ctx, tx, walletID, from, to, fn)
+}
+
+func (r *Repository) streamEntriesByWallet(ctx context.Context, q queryer, walletID string, from, to time.Time, fn func(*LedgerEntry) error) error {
+	query := `
+		SELECT 
+			id, transaction_id, wallet_id, entry_type, amount, currency,
+			balance, description, metadata, created_at
+		FROM ledger_entries
+		WHERE wallet_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := q.QueryContext(ctx, query, walletID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to stream wallet entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := r.scanEntry(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan entry: %w", err)
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
 		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return nil
+}
+
+// GetWalletCurrencyTx returns the currency of the wallet's most recent entry,
+// falling back to its archived months
+// NOTE: Returns "" if the wallet has no entries
+func (r *Repository) GetWalletCurrencyTx(ctx context.Context, tx *sql.Tx, walletID string) (string, error) {
+	query := `
+		SELECT currency FROM (
+			SELECT currency, created_at AS last_at
+			FROM ledger_entries
+			WHERE wallet_id = $1
+			UNION ALL
+			SELECT b.currency, b.last_entry_at
+			FROM ledger_archive_balances b
+			JOIN ledger_archives a ON a.partition_name = b.partition_name
+			WHERE b.wallet_id = $1 AND a.restored_at IS NULL
+		) entries
+		ORDER BY last_at DESC NULLS LAST
+		LIMIT 1
+	`
+
+	var currency string
+	err := tx.QueryRowContext(ctx, query, walletID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get wallet currency: %w", err)
+	}
+
+	return currency, nil
+}
+
+// EnsurePartition creates the monthly partition containing month if missing
+func (r *Repository) EnsurePartition(ctx context.Context, month time.Time) (string, error) {
+	var name string
+	if err := r.db.QueryRowContext(ctx, `SELECT create_ledger_partition($1)`, month).Scan(&name); err != nil {
+		return "", fmt.Errorf("failed to create ledger partition: %w", err)
+	}
+	return name, nil
+}
+
+// ListPartitions lists attached monthly partitions, oldest first
+func (r *Repository) ListPartitions(ctx context.Context) ([]LedgerPartition, error) {
+	query := `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'ledger_entries'
+		ORDER BY c.relname
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []LedgerPartition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan partition: %w", err)
+		}
+
+		start, err := PartitionMonth(name)
+		if err != nil {
+			r.logger.Warnf("Skipping unrecognised ledger partition %s", name)
+			continue
+		}
+
+		partitions = append(partitions, LedgerPartition{
+			Name:        name,
+			PeriodStart: start,
+			PeriodEnd:   start.AddDate(0, 1, 0),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return partitions, nil
+}
+
+// StreamEntriesInRange calls fn for every entry in [from, to), oldest first
+func (r *Repository) StreamEntriesInRange(ctx context.Context, from, to time.Time, fn func(*LedgerEntry) error) error {
+	query := `
+		SELECT 
+			id, transaction_id, wallet_id, entry_type, amount, currency,
+			balance, description, metadata, created_at
+		FROM ledger_entries
+		WHERE created_at >= $1 AND created_at < $2
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to stream entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := r.scanEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return nil
+}
 
-		// ✅ FIX: Safely unmarshal metadata (handle NULL)
-		if len(metadataJSON) > 0 && string(metadataJSON) != "null" {
-			if err := json.Unmarshal(metadataJSON, &entry.Metadata); err != nil {
-				r.logger.Warnf("Failed to unmarshal metadata: %v", err)
-				entry.Metadata = make(map[string]interface{})
+// IsRangeClosed reports whether [from, to) lies inside a closed accounting period
+func (r *Repository) IsRangeClosed(ctx context.Context, from, to time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM accounting_periods
+			WHERE period_start <= $1 AND period_end >= $2
+		)
+	`
+
+	var closed bool
+	if err := r.db.QueryRowContext(ctx, query, from, to).Scan(&closed); err != nil {
+		return false, fmt.Errorf("failed to check closed period: %w", err)
+	}
+	return closed, nil
+}
+
+// ArchivePartitionTx records an archive, keeps per-wallet totals and drops the partition
+// NOTE: Totals are computed from the partition before it is dropped, in the same tx
+func (r *Repository) ArchivePartitionTx(ctx context.Context, tx *sql.Tx, archive *LedgerArchive) error {
+	insertArchive := `
+		INSERT INTO ledger_archives (
+			partition_name, period_start, period_end, location, sha256, entry_count
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING archived_at
+	`
+
+	err := tx.QueryRowContext(
+		ctx,
+		insertArchive,
+		archive.PartitionName,
+		archive.PeriodStart,
+		archive.PeriodEnd,
+		archive.Location,
+		archive.SHA256,
+		archive.EntryCount,
+	).Scan(&archive.ArchivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record archive: %w", err)
+	}
+
+	insertBalances := `
+		INSERT INTO ledger_archive_balances (
+			partition_name, wallet_id, currency, total_debits, total_credits,
+			entry_count, closing_balance, first_entry_at, last_entry_at
+		)
+		SELECT
+			$1,
+			m.wallet_id,
+			m.currency,
+			SUM(CASE WHEN m.entry_type = 'debit' THEN m.amount ELSE 0 END),
+			SUM(CASE WHEN m.entry_type = 'credit' THEN m.amount ELSE 0 END),
+			COUNT(*),
+			(
+				SELECT l.balance FROM ledger_entries l
+				WHERE l.wallet_id = m.wallet_id AND l.created_at >= $2 AND l.created_at < $3
+				ORDER BY l.created_at DESC, l.id DESC
+				LIMIT 1
+			),
+			MIN(m.created_at),
+			MAX(m.created_at)
+		FROM ledger_entries m
+		WHERE m.created_at >= $2 AND m.created_at < $3
+		GROUP BY m.wallet_id, m.currency
+	`
+
+	if _, err := tx.ExecContext(ctx, insertBalances, archive.PartitionName, archive.PeriodStart, archive.PeriodEnd); err != nil {
+		return fmt.Errorf("failed to record archive balances: %w", err)
+	}
+
+	table := pq.QuoteIdentifier(archive.PartitionName)
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE ledger_entries DETACH PARTITION "+table); err != nil {
+		return fmt.Errorf("failed to detach partition: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+table); err != nil {
+		return fmt.Errorf("failed to drop partition: %w", err)
+	}
+
+	return nil
+}
+
+// RestorePartitionTx loads archived entries into a new table and re-attaches it
+// NOTE: ATTACH bypasses the closed-period insert trigger on purpose
+func (r *Repository) RestorePartitionTx(ctx context.Context, tx *sql.Tx, archive *LedgerArchive, next func() (*LedgerEntry, error)) (int64, error) {
+	table := pq.QuoteIdentifier(archive.PartitionName)
+
+	createTable := "CREATE TABLE " + table + " (LIKE ledger_entries INCLUDING DEFAULTS INCLUDING CONSTRAINTS)"
+	if _, err := tx.ExecContext(ctx, createTable); err != nil {
+		return 0, fmt.Errorf("failed to create restore table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		archive.PartitionName,
+		"id", "transaction_id", "wallet_id", "entry_type", "amount", "currency",
+		"balance", "description", "metadata", "created_at",
+	))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare restore copy: %w", err)
+	}
+	defer stmt.Close()
+
+	var count int64
+	for {
+		entry, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// COPY text format: JSONB must be sent as a string, NULL as nil
+		var metadata interface{}
+		if entry.Metadata != nil {
+			metadataJSON, err := json.Marshal(entry.Metadata)
+			if err != nil {
+				return 0, fmt.Errorf("failed to marshal metadata: %w", err)
 			}
-		} else {
-			entry.Metadata = make(map[string]interface{})
+			metadata = string(metadataJSON)
+		}
+
+		if _, err := stmt.ExecContext(
+			ctx,
+			entry.ID,
+			entry.TransactionID,
+			entry.WalletID,
+			entry.EntryType,
+			entry.Amount,
+			entry.Currency,
+			entry.Balance,
+			entry.Description,
+			metadata,
+			entry.CreatedAt,
+		); err != nil {
+			return 0, fmt.Errorf("failed to copy archived entry: %w", err)
 		}
+		count++
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return 0, fmt.Errorf("failed to flush restore copy: %w", err)
+	}
+
+	attach := fmt.Sprintf(
+		"ALTER TABLE ledger_entries ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)",
+		table,
+		pq.QuoteLiteral(archive.PeriodStart.UTC().Format(time.RFC3339)),
+		pq.QuoteLiteral(archive.PeriodEnd.UTC().Format(time.RFC3339)),
+	)
+	if _, err := tx.ExecContext(ctx, attach); err != nil {
+		return 0, fmt.Errorf("failed to attach restored partition: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE ledger_archives SET restored_at = CURRENT_TIMESTAMP WHERE partition_name = $1`,
+		archive.PartitionName,
+	); err != nil {
+		return 0, fmt.Errorf("failed to mark archive restored: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetArchives lists archived months, oldest first
+func (r *Repository) GetArchives(ctx context.Context) ([]LedgerArchive, error) {
+	query := `
+		SELECT partition_name, period_start, period_end, location, sha256,
+			entry_count, archived_at, restored_at
+		FROM ledger_archives
+		ORDER BY period_start
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archives: %w", err)
+	}
+	defer rows.Close()
 
-		entries = append(entries, entry)
+	var archives []LedgerArchive
+	for rows.Next() {
+		var a LedgerArchive
+		if err := rows.Scan(
+			&a.PartitionName, &a.PeriodStart, &a.PeriodEnd, &a.Location, &a.SHA256,
+			&a.EntryCount, &a.ArchivedAt, &a.RestoredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan archive: %w", err)
+		}
+		archives = append(archives, a)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return entries, nil
-}
\ No newline at end of file
+	return archives, nil
+}
+
+// GetArchive retrieves one archived month by partition name
+func (r *Repository) GetArchive(ctx context.Context, partitionName string) (*LedgerArchive, error) {
+	query := `
+		SELECT partition_name, period_start, period_end, location, sha256,
+			entry_count, archived_at, restored_at
+		FROM ledger_archives
+		WHERE partition_name = $1
+	`
+
+	a := &LedgerArchive{}
+	err := r.db.QueryRowContext(ctx, query, partitionName).Scan(
+		&a.PartitionName, &a.PeriodStart, &a.PeriodEnd, &a.Location, &a.SHA256,
+		&a.EntryCount, &a.ArchivedAt, &a.RestoredAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("archive not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archive: %w", err)
+	}
+
+	return a, nil
+}
+
+// GetArchiveCovering returns the unrestored archive containing t, or nil
+func (r *Repository) GetArchiveCovering(ctx context.Context, t time.Time) (*LedgerArchive, error) {
+	query := `
+		SELECT partition_name
+		FROM ledger_archives
+		WHERE restored_at IS NULL AND period_start <= $1 AND period_end > $1
+	`
+
+	var name string
+	err := r.db.QueryRowContext(ctx, query, t).Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check archives: %w", err)
+	}
+
+	return r.GetArchive(ctx, name)
+}
+
+// GetArchiveOverlappingTx returns the first archived partition overlapping [from, to)
+// NOTE: Returns "" if every month in the range is hot or restored
+func (r *Repository) GetArchiveOverlappingTx(ctx context.Context, tx *sql.Tx, from, to time.Time) (string, error) {
+	query := `
+		SELECT partition_name
+		FROM ledger_archives
+		WHERE restored_at IS NULL AND period_start < $2 AND period_end > $1
+		ORDER BY period_start
+		LIMIT 1
+	`
+
+	var name string
+	err := tx.QueryRowContext(ctx, query, from, to).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check archives: %w", err)
+	}
+
+	return name, nil
+}
+
+// DropRestoredPartitionTx detaches and drops a partition that was restored from archive
+func (r *Repository) DropRestoredPartitionTx(ctx context.Context, tx *sql.Tx, archive *LedgerArchive) error {
+	table := pq.QuoteIdentifier(archive.PartitionName)
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE ledger_entries DETACH PARTITION "+table); err != nil {
+		return fmt.Errorf("failed to detach partition: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+table); err != nil {
+		return fmt.Errorf("failed to drop partition: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE ledger_archives SET restored_at = NULL WHERE partition_name = $1`,
+		archive.PartitionName,
+	); err != nil {
+		return fmt.Errorf("failed to mark archive released: %w", err)
+	}
+
+	archive.RestoredAt = nil
+	return nil
+}
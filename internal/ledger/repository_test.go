@@ -0,0 +1,150 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/db"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/pkg/outbox"
+)
+
+// testService returns a service on a fresh schema with the ledger and outbox
+// migrations applied, or skips when PostgreSQL is not available
+func testService(t *testing.T) (*Service, *db.DB) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	cfg := testDatabaseConfig()
+
+	admin, err := sql.Open("postgres", db.DSN(cfg))
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+
+	schema := fmt.Sprintf("ledger_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	conn, err := sql.Open("postgres", db.DSN(cfg)+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if cleanup, err := sql.Open("postgres", db.DSN(cfg)); err == nil {
+			cleanup.Exec("DROP SCHEMA " + schema + " CASCADE")
+			cleanup.Close()
+		}
+	})
+
+	for _, dir := range []string{"ledger", "outbox"} {
+		files, err := filepath.Glob("../../migrations/" + dir + "/*.sql")
+		if err != nil || len(files) == 0 {
+			t.Fatalf("Failed to find %s migrations: %v", dir, err)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			migration, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", file, err)
+			}
+			if _, err := conn.Exec(string(migration)); err != nil {
+				t.Fatalf("Failed to apply %s: %v", file, err)
+			}
+		}
+	}
+
+	log := logger.New("test")
+	database := &db.DB{DB: conn}
+	return NewService(NewRepository(database, log), outbox.NewRepository(conn, log), database, log), database
+}
+
+// testDatabaseConfig points at the PostgreSQL used by integration tests
+func testDatabaseConfig() config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", "5432"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "postgres"),
+		DBName:   getEnv("DB_NAME", "postgres"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// postTransfer posts one transfer through CreateLedgerEntries
+func postTransfer(t *testing.T, service *Service, transactionID, from, to, amount string) []LedgerEntry {
+	entries, err := service.CreateLedgerEntries(context.Background(), &CreateLedgerEntriesRequest{
+		TransactionID: transactionID,
+		FromWalletID:  from,
+		ToWalletID:    to,
+		Amount:        amount,
+		Currency:      "USD",
+		Description:   "p2p transfer",
+	})
+	if err != nil {
+		t.Fatalf("CreateLedgerEntries(%s) failed: %v", transactionID, err)
+	}
+	return entries
+}
+
+func TestMarkTransactionProcessedTx(t *testing.T) {
+	service, database := testService(t)
+	ctx := context.Background()
+
+	mark := func(id string, commit bool) bool {
+		tx, err := database.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		claimed, err := service.repo.MarkTransactionProcessedTx(ctx, tx, id)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("MarkTransactionProcessedTx(%s) failed: %v", id, err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatalf("Failed to end transaction: %v", err)
+		}
+		return claimed
+	}
+
+	if !mark("t1", false) {
+		t.Error("Expected the first claim to succeed")
+	}
+	if !mark("t1", true) {
+		t.Error("Expected a rolled back claim to be released")
+	}
+	if mark("t1", true) {
+		t.Error("Expected a committed transaction to stay claimed")
+	}
+	if !mark("t2", true) {
+		t.Error("Expected other transactions to be claimable")
+	}
+}
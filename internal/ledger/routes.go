@@ -15,4 +15,26 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, jwtSecret string) {
 	mux.Handle("GET /api/v1/ledger/wallet", protected(http.HandlerFunc(h.GetWalletLedger)))
 	mux.Handle("GET /api/v1/ledger/stats", protected(http.HandlerFunc(h.GetWalletStats)))
 	mux.Handle("GET /api/v1/ledger", protected(http.HandlerFunc(h.GetAllEntries)))
+
+	// Reporting
+	mux.Handle("GET /api/v1/ledger/balance", protected(http.HandlerFunc(h.GetBalanceAsOf)))
+	mux.Handle("GET /api/v1/ledger/periods", protected(http.HandlerFunc(h.GetPeriods)))
+	mux.Handle("GET /api/v1/ledger/statement", protected(http.HandlerFunc(h.ExportStatement)))
+}
+
+// RegisterInternalRoutes - INTERNAL API (mTLS only, NO JWT needed)
+// Operator actions live here so that end users cannot reach them
+func (h *Handler) RegisterInternalRoutes(mux *http.ServeMux) {
+	// System-wide totals and every wallet's closing balance
+	mux.HandleFunc("GET /api/v1/internal/ledger/trial-balance", h.GetTrialBalance)
+	mux.HandleFunc("GET /api/v1/internal/ledger/periods/{id}", h.GetPeriod)
+	mux.HandleFunc("POST /api/v1/internal/ledger/periods/close", h.ClosePeriod)
+
+	// Partitions and archives (audit); archived entries span every wallet
+	if h.archiver != nil {
+		mux.HandleFunc("GET /api/v1/internal/ledger/partitions", h.GetPartitions)
+		mux.HandleFunc("POST /api/v1/internal/ledger/archives/{partition}", h.ArchivePartition)
+		mux.HandleFunc("POST /api/v1/internal/ledger/archives/{partition}/restore", h.RestoreArchive)
+		mux.HandleFunc("GET /api/v1/internal/ledger/archives/{partition}/entries", h.GetArchivedEntries)
+	}
 }
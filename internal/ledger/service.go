@@ -4,18 +4,36 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
-	"math/big"
+	"io"
+	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/db"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 	"github.com/kmassidik/mercuria/pkg/outbox"
 )
 
+// duplicateTransactionEvents counts transaction.completed deliveries that were
+// already posted (Kafka redelivery, outbox retries); exported via expvar
+var duplicateTransactionEvents = expvar.NewInt("ledger_duplicate_transaction_events")
+
+var (
+	// ErrArchived is returned for queries that need detail from an archived month
+	ErrArchived = errors.New("archived partition")
+	// ErrNoLedgerEntries is returned for wallets the ledger has never posted to
+	ErrNoLedgerEntries = errors.New("no ledger entries")
+)
+
 type Service struct {
 	repo       *Repository
 	outboxRepo *outbox.Repository
 	db         *db.DB
+	offsets    *kafka.OffsetStore // Set when consumer offsets live in the ledger DB
 	logger     *logger.Logger
 }
 
@@ -33,29 +51,56 @@ func NewService(
 	}
 }
 
+// UseOffsetStore records consumed Kafka offsets in the same DB transaction as
+// the entries they produce (KAFKA_DB_OFFSETS)
+func (s *Service) UseOffsetStore(store *kafka.OffsetStore) {
+	s.offsets = store
+}
+
 // ✅ FIXED: CreateLedgerEntries now properly handles initial balances
 func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntriesRequest) ([]LedgerEntry, error) {
     var entries []LedgerEntry
-
-    // Check if ledger entries already exist for this transaction (idempotency)
-    existingEntries, err := s.repo.GetEntriesByTransaction(ctx, req.TransactionID)
-    if err == nil && len(existingEntries) > 0 {
-        s.logger.Infof("Ledger entries already exist for transaction %s, skipping", req.TransactionID)
-        return existingEntries, nil
-    }
+    duplicate := false
 
     // Execute in transaction to ensure atomicity
-    err = s.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+    err := s.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+        // Stored consumer offset: a message at or below it was already applied
+        if s.offsets != nil {
+            claimed, err := s.offsets.ClaimTx(ctx, tx)
+            if err != nil {
+                return err
+            }
+            if !claimed {
+                duplicate = true
+                return nil
+            }
+        }
+
+        // Idempotency guard: claim the transaction_id before posting anything
+        claimed, err := s.repo.MarkTransactionProcessedTx(ctx, tx, req.TransactionID)
+        if err != nil {
+            return err
+        }
+        if !claimed {
+            duplicate = true
+            return nil
+        }
+
+        // Serialize with other postings to the same wallets until commit
+        if err := s.repo.LockWalletsTx(ctx, tx, req.FromWalletID, req.ToWalletID); err != nil {
+            return err
+        }
+
         // ✅ FIX: Get latest balances from existing ledger entries
         // If this is the first transaction, balances will be "0.0000"
-        fromBalance, err := s.repo.GetLatestBalance(ctx, req.FromWalletID)
+        fromBalance, err := s.repo.GetLatestBalanceTx(ctx, tx, req.FromWalletID)
         if err != nil {
             // If no previous entries exist, start from 0
             fromBalance = "0.0000"
             s.logger.Infof("No previous entries for wallet %s, starting from 0", req.FromWalletID)
         }
 
-        toBalance, err := s.repo.GetLatestBalance(ctx, req.ToWalletID)
+        toBalance, err := s.repo.GetLatestBalanceTx(ctx, tx, req.ToWalletID)
         if err != nil {
             // If no previous entries exist, start from 0
             toBalance = "0.0000"
@@ -67,7 +112,7 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
         // The new balance should reflect the wallet's state AFTER the transaction
         
         // For DEBIT (sender): balance DECREASES by amount
-        newFromBalance, err := subtractAmounts(fromBalance, req.Amount)
+        newFromBalance, err := money.Sub(fromBalance, req.Amount)
         if err != nil {
             // ✅ FIX: If this fails, it means the wallet balance in ledger is out of sync
             // This shouldn't happen if wallet service properly validated the transfer
@@ -79,11 +124,17 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
         }
 
         // For CREDIT (receiver): balance INCREASES by amount
-        newToBalance, err := addAmounts(toBalance, req.Amount)
+        newToBalance, err := money.Add(toBalance, req.Amount)
         if err != nil {
             return fmt.Errorf("failed to calculate to balance: %w", err)
         }
 
+        // Lets analytics measure settlement latency from initiation to posting
+        initiatedAt := ""
+        if !req.InitiatedAt.IsZero() {
+            initiatedAt = req.InitiatedAt.UTC().Format(time.RFC3339Nano)
+        }
+
         // Create DEBIT entry (money leaving sender's wallet)
         debitEntry := &LedgerEntry{
             TransactionID: req.TransactionID,
@@ -100,6 +151,10 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
             },
         }
 
+        if initiatedAt != "" {
+            debitEntry.Metadata["transaction_initiated_at"] = initiatedAt
+        }
+
         createdDebit, err := s.repo.CreateLedgerEntryTx(ctx, tx, debitEntry)
         if err != nil {
             return fmt.Errorf("failed to create debit entry: %w", err)
@@ -122,6 +177,10 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
             },
         }
 
+        if initiatedAt != "" {
+            creditEntry.Metadata["transaction_initiated_at"] = initiatedAt
+        }
+
         createdCredit, err := s.repo.CreateLedgerEntryTx(ctx, tx, creditEntry)
         if err != nil {
             return fmt.Errorf("failed to create credit entry: %w", err)
@@ -132,19 +191,17 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
         for _, entry := range entries {
             event := &outbox.OutboxEvent{
                 AggregateID: entry.ID,
-                EventType:   "ledger.entry_created",
-                Topic:       "ledger.entry_created",
-                Payload: map[string]interface{}{
-                    "event_id":       entry.ID, // Add unique event ID for analytics idempotency
-                    "entry_id":       entry.ID,
-                    "transaction_id": entry.TransactionID,
-                    "wallet_id":      entry.WalletID,
-                    "entry_type":     entry.EntryType,
-                    "amount":         entry.Amount,
-                    "currency":       entry.Currency,
-                    "balance":        entry.Balance,
-                    "created_at":     entry.CreatedAt,
-                    "metadata":       entry.Metadata,
+                Topic:       kafka.TopicLedgerEntryCreated,
+                Payload: kafka.LedgerEntryCreated{
+                    EntryID:       entry.ID,
+                    TransactionID: entry.TransactionID,
+                    WalletID:      entry.WalletID,
+                    EntryType:     entry.EntryType,
+                    Amount:        entry.Amount,
+                    Currency:      entry.Currency,
+                    Balance:       entry.Balance,
+                    CreatedAt:     entry.CreatedAt,
+                    Metadata:      entry.Metadata,
                 },
             }
 
@@ -161,6 +218,12 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
         return nil, err
     }
 
+    if duplicate {
+        duplicateTransactionEvents.Add(1)
+        s.logger.Infof("Transaction %s already posted to the ledger, ignoring duplicate delivery", req.TransactionID)
+        return s.repo.GetEntriesByTransaction(ctx, req.TransactionID)
+    }
+
     // Verify double-entry balance
     balanced, err := s.repo.VerifyTransactionBalance(ctx, req.TransactionID)
     if err != nil {
@@ -175,6 +238,11 @@ func (s *Service) CreateLedgerEntries(ctx context.Context, req *CreateLedgerEntr
     return entries, nil
 }
 
+// DuplicateTransactionEvents returns how many duplicate deliveries were ignored
+func (s *Service) DuplicateTransactionEvents() int64 {
+	return duplicateTransactionEvents.Value()
+}
+
 // GetLedgerEntry retrieves a single ledger entry
 func (s *Service) GetLedgerEntry(ctx context.Context, id string) (*LedgerEntry, error) {
 	return s.repo.GetLedgerEntry(ctx, id)
@@ -197,9 +265,9 @@ func (s *Service) GetTransactionLedger(ctx context.Context, transactionID string
 
 	for _, entry := range entries {
 		if entry.EntryType == EntryTypeDebit {
-			totalDebits, _ = addAmounts(totalDebits, entry.Amount)
+			totalDebits, _ = money.Add(totalDebits, entry.Amount)
 		} else {
-			totalCredits, _ = addAmounts(totalCredits, entry.Amount)
+			totalCredits, _ = money.Add(totalCredits, entry.Amount)
 		}
 	}
 
@@ -213,19 +281,29 @@ func (s *Service) GetTransactionLedger(ctx context.Context, transactionID string
 }
 
 // GetWalletLedger retrieves ledger history for a wallet
-func (s *Service) GetWalletLedger(ctx context.Context, walletID string, limit, offset int) ([]LedgerEntry, string, error) {
-	entries, err := s.repo.GetEntriesByWallet(ctx, walletID, limit, offset)
+// NOTE: Returns entries, current balance and the next page cursor ("" on last page)
+func (s *Service) GetWalletLedger(ctx context.Context, walletID string, page pagination.Params) ([]LedgerEntry, string, string, error) {
+	var entries []LedgerEntry
+	var err error
+
+	if page.Cursor != nil {
+		entries, err = s.repo.GetEntriesByWalletAfter(ctx, walletID, page.Cursor, page.FetchLimit())
+	} else {
+		entries, err = s.repo.GetEntriesByWallet(ctx, walletID, page.FetchLimit(), page.Offset)
+	}
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 
+	entries, nextCursor := pagination.Page(entries, page.Limit, entryCursor)
+
 	// Get current balance
 	balance, err := s.repo.GetLatestBalance(ctx, walletID)
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 
-	return entries, balance, nil
+	return entries, balance, nextCursor, nil
 }
 
 // GetWalletStats retrieves statistics for a wallet
@@ -234,64 +312,368 @@ func (s *Service) GetWalletStats(ctx context.Context, walletID string) (*LedgerS
 }
 
 // GetAllEntries retrieves all ledger entries (admin/audit)
-func (s *Service) GetAllEntries(ctx context.Context, limit, offset int) ([]LedgerEntry, error) {
-	return s.repo.GetAllEntriesPaginated(ctx, limit, offset)
+func (s *Service) GetAllEntries(ctx context.Context, page pagination.Params) ([]LedgerEntry, string, error) {
+	var entries []LedgerEntry
+	var err error
+
+	if page.Cursor != nil {
+		entries, err = s.repo.GetAllEntriesAfter(ctx, page.Cursor, page.FetchLimit())
+	} else {
+		entries, err = s.repo.GetAllEntriesPaginated(ctx, page.FetchLimit(), page.Offset)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries, nextCursor := pagination.Page(entries, page.Limit, entryCursor)
+	return entries, nextCursor, nil
 }
 
-// Helper functions for decimal arithmetic
-func addAmounts(a, b string) (string, error) {
-	aVal := new(big.Float)
-	bVal := new(big.Float)
+func entryCursor(e LedgerEntry) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+}
 
-	if _, ok := aVal.SetString(a); !ok {
-		return "", fmt.Errorf("invalid amount: %s", a)
+// GetBalanceAsOf retrieves a wallet balance at a point in time
+func (s *Service) GetBalanceAsOf(ctx context.Context, walletID string, asOf time.Time) (*WalletBalanceAsOf, error) {
+	if walletID == "" {
+		return nil, fmt.Errorf("wallet_id is required")
 	}
-	if _, ok := bVal.SetString(b); !ok {
-		return "", fmt.Errorf("invalid amount: %s", b)
+	if err := s.checkNotArchived(ctx, asOf); err != nil {
+		return nil, err
 	}
 
-	result := new(big.Float).Add(aVal, bVal)
-	return result.Text('f', 4), nil
+	balance, err := s.repo.GetBalanceAsOf(ctx, walletID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WalletBalanceAsOf{
+		WalletID: walletID,
+		AsOf:     asOf,
+		Balance:  balance,
+	}, nil
 }
 
-func subtractAmounts(a, b string) (string, error) {
-	aVal := new(big.Float)
-	bVal := new(big.Float)
+// GetTrialBalance builds a per-currency trial balance at a point in time
+func (s *Service) GetTrialBalance(ctx context.Context, asOf time.Time) (*TrialBalance, error) {
+	if err := s.checkNotArchived(ctx, asOf); err != nil {
+		return nil, err
+	}
+
+	lines, err := s.repo.GetTrialBalance(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, ok := aVal.SetString(a); !ok {
-		return "", fmt.Errorf("invalid amount: %s", a)
+	return s.trialBalanceReport(asOf, lines), nil
+}
+
+// trialBalanceReport flags the report unbalanced if any currency is
+func (s *Service) trialBalanceReport(asOf time.Time, lines []TrialBalanceLine) *TrialBalance {
+	report := &TrialBalance{
+		AsOf:     asOf,
+		Lines:    lines,
+		Balanced: true,
 	}
-	if _, ok := bVal.SetString(b); !ok {
-		return "", fmt.Errorf("invalid amount: %s", b)
+
+	for _, line := range lines {
+		if !line.Balanced {
+			report.Balanced = false
+			s.logger.Warnf("Trial balance for %s is unbalanced as of %s: debits=%s, credits=%s",
+				line.Currency, asOf.Format(time.RFC3339), line.TotalDebits, line.TotalCredits)
+		}
 	}
 
-	result := new(big.Float).Sub(aVal, bVal)
-	
-	// ✅ RELAXED: Allow negative balances in ledger (overdraft scenario)
-	// The wallet service should prevent this, but ledger records what happened
-	return result.Text('f', 4), nil
+	return report
 }
 
-// ProcessTransactionEvent handles incoming transaction events from Kafka
-func (s *Service) ProcessTransactionEvent(ctx context.Context, key, value []byte) error {
-	s.logger.Debugf("Processing Kafka transaction event, key=%s", string(key))
+// ClosePeriod closes an accounting period and snapshots wallet balances
+// NOTE: Once closed, the closed-period trigger rejects entries dated inside it
+func (s *Service) ClosePeriod(ctx context.Context, req *ClosePeriodRequest) (*AccountingPeriod, error) {
+	if req.PeriodStart.IsZero() || req.PeriodEnd.IsZero() {
+		return nil, fmt.Errorf("period_start and period_end are required")
+	}
+	if !req.PeriodEnd.After(req.PeriodStart) {
+		return nil, fmt.Errorf("period_end must be after period_start")
+	}
+	if req.PeriodEnd.After(time.Now()) {
+		return nil, fmt.Errorf("cannot close a period that has not ended yet")
+	}
+
+	if err := s.checkNotArchived(ctx, req.PeriodEnd); err != nil {
+		return nil, err
+	}
+
+	period := &AccountingPeriod{
+		PeriodStart: req.PeriodStart,
+		PeriodEnd:   req.PeriodEnd,
+		Status:      PeriodStatusClosed,
+		ClosedBy:    req.ClosedBy,
+	}
+
+	var snapshotCount int64
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.repo.LockForPeriodCloseTx(ctx, tx); err != nil {
+			return err
+		}
+
+		// Refuse to freeze a period whose books do not balance; checked under
+		// the lock so it is the state that gets snapshotted
+		lines, err := s.repo.GetTrialBalanceTx(ctx, tx, req.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		if !s.trialBalanceReport(req.PeriodEnd, lines).Balanced {
+			return fmt.Errorf("trial balance is not balanced at %s", req.PeriodEnd.Format(time.RFC3339))
+		}
 
-	// Parse event - match actual Kafka payload structure
-	var event struct {
-		TransactionID string `json:"transaction_id"`
-		FromWalletID  string `json:"from_wallet_id"`
-		ToWalletID    string `json:"to_wallet_id"`
-		Amount        string `json:"amount"`
-		Currency      string `json:"currency"`
-		Type          string `json:"type"`
+		overlaps, err := s.repo.PeriodOverlapsTx(ctx, tx, req.PeriodStart, req.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		if overlaps {
+			return fmt.Errorf("period overlaps an already closed period")
+		}
+
+		if _, err := s.repo.CreatePeriodTx(ctx, tx, period); err != nil {
+			return err
+		}
+
+		snapshotCount, err = s.repo.SnapshotPeriodBalancesTx(ctx, tx, period)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("Failed to close accounting period: %v", err)
+		return nil, err
 	}
 
-	if err := json.Unmarshal(value, &event); err != nil {
-		s.logger.Errorf("Failed to unmarshal transaction event: %v", err)
+	s.logger.Infof("Accounting period %s closed (%s - %s), %d balances snapshotted",
+		period.ID, period.PeriodStart.Format(time.RFC3339), period.PeriodEnd.Format(time.RFC3339), snapshotCount)
+
+	return s.repo.GetPeriod(ctx, period.ID)
+}
+
+// checkNotArchived rejects point-in-time queries inside an archived month
+// NOTE: Only month-end balances are kept for archived months; restore for detail
+func (s *Service) checkNotArchived(ctx context.Context, t time.Time) error {
+	archive, err := s.repo.GetArchiveCovering(ctx, t)
+	if err != nil {
 		return err
 	}
+	if archive != nil {
+		return fmt.Errorf("%s falls in %w %s; restore it first", t.Format(time.RFC3339), ErrArchived, archive.PartitionName)
+	}
+	return nil
+}
+
+// GetPeriods lists closed accounting periods
+func (s *Service) GetPeriods(ctx context.Context) ([]AccountingPeriod, error) {
+	return s.repo.GetPeriods(ctx)
+}
+
+// GetPeriod retrieves a closed period with its balance snapshot
+func (s *Service) GetPeriod(ctx context.Context, id string) (*AccountingPeriod, error) {
+	return s.repo.GetPeriod(ctx, id)
+}
+
+// Statement is an open wallet statement: the header is read, the entries are
+// streamed by Write; both come from one read-only snapshot
+type Statement struct {
+	Header *StatementHeader
+
+	tx     *sql.Tx
+	repo   *Repository
+	logger *logger.Logger
+}
 
-	// Validate required fields
+// OpenStatement reads the statement header for [from, to) in a REPEATABLE READ,
+// READ ONLY transaction that stays open for Write; callers must Close it
+// NOTE: Everything that can be rejected is checked here, before a byte is written
+func (s *Service) OpenStatement(ctx context.Context, walletID string, from, to time.Time) (*Statement, error) {
+	if walletID == "" {
+		return nil, fmt.Errorf("wallet_id is required")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	header, err := s.statementHeader(ctx, tx, walletID, from, to)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	return &Statement{Header: header, tx: tx, repo: s.repo, logger: s.logger}, nil
+}
+
+func (s *Service) statementHeader(ctx context.Context, tx *sql.Tx, walletID string, from, to time.Time) (*StatementHeader, error) {
+	archived, err := s.repo.GetArchiveOverlappingTx(ctx, tx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if archived != "" {
+		return nil, fmt.Errorf("statement range overlaps %w %s; restore it first", ErrArchived, archived)
+	}
+
+	currency, err := s.repo.GetWalletCurrencyTx(ctx, tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		return nil, fmt.Errorf("wallet %s: %w", walletID, ErrNoLedgerEntries)
+	}
+
+	// Postgres stores microseconds, so "<= from-1ns" is "strictly before from"
+	opening, err := s.repo.GetBalanceAsOfTx(ctx, tx, walletID, from.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	closing, err := s.repo.GetBalanceAsOfTx(ctx, tx, walletID, to.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatementHeader{
+		StatementID:    fmt.Sprintf("STMT-%s-%s-%s", walletID, from.UTC().Format("20060102"), to.UTC().Format("20060102")),
+		WalletID:       walletID,
+		Currency:       currency,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		ClosingBalance: closing,
+		GeneratedAt:    time.Now(),
+	}, nil
+}
+
+// Write streams the statement to w in the given format
+// NOTE: Entries are written as they are read; nothing is buffered per statement
+func (st *Statement) Write(ctx context.Context, format StatementFormat, w io.Writer) error {
+	writer := newStatementWriter(format, w)
+	if err := writer.WriteHeader(st.Header); err != nil {
+		return fmt.Errorf("failed to write statement header: %w", err)
+	}
+
+	count := 0
+	err := st.repo.StreamEntriesByWalletTx(ctx, st.tx, st.Header.WalletID, st.Header.From, st.Header.To, func(entry *LedgerEntry) error {
+		count++
+		if err := writer.WriteEntry(entry); err != nil {
+			return fmt.Errorf("failed to write statement entry: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write statement footer: %w", err)
+	}
+
+	st.logger.Infof("Statement %s exported as %s: %d entries", st.Header.StatementID, format, count)
+	return nil
+}
+
+// Close ends the statement's read-only transaction
+func (st *Statement) Close() error {
+	return st.tx.Rollback()
+}
+
+// transactionEvent is a single transfer to post (a p2p/scheduled transfer or one batch leg)
+type transactionEvent struct {
+	TransactionID string
+	FromWalletID  string
+	ToWalletID    string
+	Amount        string
+	Currency      string
+	Type          string
+	CompletedAt   time.Time
+	InitiatedAt   time.Time
+}
+
+// legacyEventType infers the type of a bare payload published before envelopes
+// NOTE: The earliest batch.completed payloads had no event_type, only a batch_id
+func legacyEventType(env *kafka.Envelope) string {
+	if env.Type != "" {
+		return env.Type
+	}
+
+	var probe struct {
+		BatchID string `json:"batch_id"`
+	}
+	if json.Unmarshal(env.Payload, &probe) == nil && probe.BatchID != "" {
+		return kafka.EventTypeBatchCompleted
+	}
+	return kafka.EventTypeTransactionCompleted
+}
+
+// parseTransactionEvents decodes a transaction.completed topic event into
+// the transfers it carries, dispatching explicitly on the event type
+func parseTransactionEvents(env *kafka.Envelope) (string, []transactionEvent, error) {
+	typ := env.Type
+	if env.Version == kafka.LegacyVersion {
+		typ = legacyEventType(env)
+	}
+
+	switch typ {
+	case kafka.EventTypeTransactionCompleted:
+		var completed kafka.TransactionCompleted
+		if err := env.Decode(&completed); err != nil {
+			return typ, nil, err
+		}
+
+		event := transactionEvent{
+			TransactionID: completed.TransactionID,
+			FromWalletID:  completed.FromWalletID,
+			ToWalletID:    completed.ToWalletID,
+			Amount:        completed.Amount,
+			Currency:      completed.Currency,
+			Type:          completed.Type,
+			CompletedAt:   completed.CompletedAt,
+			InitiatedAt:   completed.InitiatedAt,
+		}
+		if err := validateTransactionEvent(&event); err != nil {
+			return typ, nil, err
+		}
+		return typ, []transactionEvent{event}, nil
+
+	case kafka.EventTypeBatchCompleted:
+		var batch kafka.BatchCompleted
+		if err := env.Decode(&batch); err != nil {
+			return typ, nil, err
+		}
+
+		events := make([]transactionEvent, 0, len(batch.Legs))
+		for i, leg := range batch.Legs {
+			event := transactionEvent{
+				TransactionID: leg.TransactionID,
+				FromWalletID:  batch.FromWalletID,
+				ToWalletID:    leg.ToWalletID,
+				Amount:        leg.Amount,
+				Currency:      batch.Currency,
+				Type:          "batch",
+				CompletedAt:   batch.CompletedAt,
+				InitiatedAt:   batch.InitiatedAt,
+			}
+			if err := validateTransactionEvent(&event); err != nil {
+				return typ, nil, fmt.Errorf("batch %s leg %d: %w", batch.BatchID, i, err)
+			}
+			events = append(events, event)
+		}
+		return typ, events, nil
+
+	default:
+		return typ, nil, fmt.Errorf("unknown event type %q", typ)
+	}
+}
+
+// validateTransactionEvent checks the fields needed to post a transfer
+func validateTransactionEvent(event *transactionEvent) error {
 	if event.TransactionID == "" {
 		return fmt.Errorf("missing transaction_id in event")
 	}
@@ -304,7 +686,52 @@ func (s *Service) ProcessTransactionEvent(ctx context.Context, key, value []byte
 	if event.Amount == "" {
 		return fmt.Errorf("missing amount in event")
 	}
+	return nil
+}
+
+// ProcessTransactionEvent handles incoming transaction events from Kafka
+// NOTE: Malformed or unknown events are permanent failures and go straight to
+// the dead-letter topic; database errors are retried by the consumer
+func (s *Service) ProcessTransactionEvent(ctx context.Context, key, value []byte) error {
+	s.logger.Debugf("Processing Kafka transaction event, key=%s", string(key))
+
+	env, err := kafka.DecodeEnvelope(value)
+	if err != nil {
+		return kafka.Permanent(err)
+	}
+
+	typ, events, err := parseTransactionEvents(env)
+	if err != nil {
+		return kafka.Permanent(fmt.Errorf("unprocessable %s event: %w", typ, err))
+	}
+
+	if len(events) == 0 {
+		// batch.completed published before per-leg payloads existed
+		s.logger.Warnf("Batch event %s carries no legs, nothing to post", string(key))
+		return nil
+	}
+
+	// Ledger events caused by this one carry its correlation
+	ctx = kafka.ContextWithTrace(ctx, env.ChildTrace())
+
+	for i, event := range events {
+		// Only the last leg records the message offset, so a crash part-way
+		// through a batch redelivers it
+		legCtx := ctx
+		if i < len(events)-1 {
+			legCtx = kafka.ContextWithPosition(ctx, kafka.Position{})
+		}
+
+		if err := s.postTransactionEvent(legCtx, &event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// postTransactionEvent creates the double-entry records for one transfer
+func (s *Service) postTransactionEvent(ctx context.Context, event *transactionEvent) error {
 	s.logger.Infof("Processing transaction: %s (type=%s, amount=%s %s)", 
 		event.TransactionID, event.Type, event.Amount, event.Currency)
 
@@ -316,6 +743,7 @@ func (s *Service) ProcessTransactionEvent(ctx context.Context, key, value []byte
 		Amount:        event.Amount,
 		Currency:      event.Currency,
 		Description:   fmt.Sprintf("%s transfer", event.Type),
+		InitiatedAt:   event.InitiatedAt,
 	}
 
 	// Create double-entry ledger records
@@ -0,0 +1,270 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+)
+
+func TestParseTransactionEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		wantType string
+		wantIDs  []string
+		wantErr  bool
+	}{
+		{
+			name:     "transaction completed",
+			value:    `{"id":"e1","type":"transaction.completed","version":1,"payload":{"transaction_id":"t1","from_wallet_id":"w1","to_wallet_id":"w2","amount":"10.00","currency":"USD","type":"p2p"}}`,
+			wantType: kafka.EventTypeTransactionCompleted,
+			wantIDs:  []string{"t1"},
+		},
+		{
+			name:     "batch completed legs",
+			value:    `{"id":"e2","type":"batch.completed","version":1,"payload":{"batch_id":"b1","from_wallet_id":"w1","currency":"USD","legs":[{"transaction_id":"t1","to_wallet_id":"w2","amount":"1.00"},{"transaction_id":"t2","to_wallet_id":"w3","amount":"2.00"}]}}`,
+			wantType: kafka.EventTypeBatchCompleted,
+			wantIDs:  []string{"t1", "t2"},
+		},
+		{
+			name:     "legacy transaction",
+			value:    `{"transaction_id":"t1","from_wallet_id":"w1","to_wallet_id":"w2","amount":"10.00","currency":"USD"}`,
+			wantType: kafka.EventTypeTransactionCompleted,
+			wantIDs:  []string{"t1"},
+		},
+		{
+			name:     "legacy batch without legs",
+			value:    `{"batch_id":"b1","from_wallet_id":"w1","currency":"USD"}`,
+			wantType: kafka.EventTypeBatchCompleted,
+			wantIDs:  []string{},
+		},
+		{
+			name:     "missing amount",
+			value:    `{"id":"e3","type":"transaction.completed","version":1,"payload":{"transaction_id":"t1","from_wallet_id":"w1","to_wallet_id":"w2"}}`,
+			wantType: kafka.EventTypeTransactionCompleted,
+			wantErr:  true,
+		},
+		{
+			name:     "batch leg missing wallet",
+			value:    `{"id":"e4","type":"batch.completed","version":1,"payload":{"batch_id":"b1","from_wallet_id":"w1","legs":[{"transaction_id":"t1","amount":"1.00"}]}}`,
+			wantType: kafka.EventTypeBatchCompleted,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown type",
+			value:    `{"id":"e5","type":"wallet.created","version":1,"payload":{}}`,
+			wantType: "wallet.created",
+			wantErr:  true,
+		},
+		{
+			name:     "newer version",
+			value:    `{"id":"e6","type":"transaction.completed","version":2,"payload":{"transaction_id":"t1","from_wallet_id":"w1","to_wallet_id":"w2","amount":"10.00"}}`,
+			wantType: kafka.EventTypeTransactionCompleted,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := kafka.DecodeEnvelope([]byte(tt.value))
+			if err != nil {
+				t.Fatalf("DecodeEnvelope failed: %v", err)
+			}
+
+			typ, events, err := parseTransactionEvents(env)
+			if typ != tt.wantType {
+				t.Errorf("Expected type %q, got %q", tt.wantType, typ)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(events) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d events, got %d", len(tt.wantIDs), len(events))
+			}
+			for i, event := range events {
+				if event.TransactionID != tt.wantIDs[i] {
+					t.Errorf("Event %d: expected transaction %s, got %s", i, tt.wantIDs[i], event.TransactionID)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTransactionEventsBatchFields(t *testing.T) {
+	value := `{"id":"e1","type":"batch.completed","version":1,"payload":{"batch_id":"b1","from_wallet_id":"w1","currency":"EUR","completed_at":"2025-01-02T03:04:05Z","legs":[{"transaction_id":"t1","to_wallet_id":"w2","amount":"1.50"}]}}`
+	env, err := kafka.DecodeEnvelope([]byte(value))
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+
+	_, events, err := parseTransactionEvents(env)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("parseTransactionEvents() = %v, %v", events, err)
+	}
+
+	want := transactionEvent{
+		TransactionID: "t1",
+		FromWalletID:  "w1",
+		ToWalletID:    "w2",
+		Amount:        "1.50",
+		Currency:      "EUR",
+		Type:          "batch",
+		CompletedAt:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if events[0] != want {
+		t.Errorf("Leg event = %+v, want %+v", events[0], want)
+	}
+}
+
+func TestCreateLedgerEntriesIgnoresDuplicates(t *testing.T) {
+	service, database := testService(t)
+
+	first := postTransfer(t, service, "t1", "wallet-a", "wallet-b", "10")
+	before := service.DuplicateTransactionEvents()
+
+	again := postTransfer(t, service, "t1", "wallet-a", "wallet-b", "10")
+	if got := service.DuplicateTransactionEvents() - before; got != 1 {
+		t.Errorf("Expected ledger_duplicate_transaction_events to grow by 1, got %d", got)
+	}
+	ids := map[string]bool{first[0].ID: true, first[1].ID: true}
+	if len(again) != 2 || !ids[again[0].ID] || !ids[again[1].ID] {
+		t.Errorf("Expected the original entries back, got %+v", again)
+	}
+
+	var entries, events int
+	if err := database.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM ledger_entries`).Scan(&entries); err != nil {
+		t.Fatalf("Failed to count entries: %v", err)
+	}
+	if err := database.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM outbox_events`).Scan(&events); err != nil {
+		t.Fatalf("Failed to count outbox events: %v", err)
+	}
+	if entries != 2 || events != 2 {
+		t.Errorf("Expected the duplicate to post nothing, got %d entries and %d outbox events", entries, events)
+	}
+
+	balance, err := service.repo.GetLatestBalance(context.Background(), "wallet-b")
+	if err != nil || balance != "10.0000" {
+		t.Errorf("Expected wallet-b to hold 10.0000, got %s, %v", balance, err)
+	}
+}
+
+func TestProcessBatchRecordsOffsetWithLastLeg(t *testing.T) {
+	service, database := testService(t)
+	service.UseOffsetStore(kafka.NewOffsetStore(database.DB))
+	ctx := kafka.ContextWithPosition(context.Background(), kafka.Position{
+		Group: "ledger-group", Topic: "transaction.completed", Partition: 0, Offset: 41,
+	})
+
+	batch := func(lastAmount string) []byte {
+		return []byte(`{"id":"e1","type":"batch.completed","version":1,"payload":{"batch_id":"b1","from_wallet_id":"w1","currency":"USD","legs":[` +
+			`{"transaction_id":"t1","to_wallet_id":"w2","amount":"1.00"},` +
+			`{"transaction_id":"t2","to_wallet_id":"w3","amount":"2.00"},` +
+			`{"transaction_id":"t3","to_wallet_id":"w4","amount":"` + lastAmount + `"}]}}`)
+	}
+	count := func(query string) int {
+		var n int
+		if err := database.QueryRowContext(context.Background(), query).Scan(&n); err != nil {
+			t.Fatalf("Query %q failed: %v", query, err)
+		}
+		return n
+	}
+
+	// The last leg fails: the earlier legs are posted, the offset is not
+	if err := service.ProcessTransactionEvent(ctx, []byte("w1"), batch("not-a-number")); err == nil {
+		t.Fatal("Expected the last leg to fail")
+	}
+	if n := count(`SELECT COUNT(DISTINCT transaction_id) FROM ledger_entries`); n != 2 {
+		t.Errorf("Expected the first 2 legs to be posted, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM kafka_consumer_offsets`); n != 0 {
+		t.Errorf("Expected no stored offset before the last leg, got %d rows", n)
+	}
+
+	// Redelivery posts the rest and records the offset with the last leg
+	if err := service.ProcessTransactionEvent(ctx, []byte("w1"), batch("3.00")); err != nil {
+		t.Fatalf("ProcessTransactionEvent failed: %v", err)
+	}
+	if n := count(`SELECT COUNT(*) FROM ledger_entries`); n != 6 {
+		t.Errorf("Expected 3 legs of 2 entries, got %d entries", n)
+	}
+	if n := count(`SELECT next_offset FROM kafka_consumer_offsets WHERE topic = 'transaction.completed' AND partition = 0`); n != 42 {
+		t.Errorf("Expected next offset 42, got %d", n)
+	}
+
+	// A later redelivery posts nothing
+	if err := service.ProcessTransactionEvent(ctx, []byte("w1"), batch("3.00")); err != nil {
+		t.Fatalf("ProcessTransactionEvent failed: %v", err)
+	}
+	if n := count(`SELECT COUNT(*) FROM ledger_entries`); n != 6 {
+		t.Errorf("Expected the redelivery to post nothing, got %d entries", n)
+	}
+}
+
+func TestConcurrentPostingsKeepBalanceOrder(t *testing.T) {
+	service, database := testService(t)
+
+	// One connection per posting is enough; a second pool read inside the
+	// transaction would deadlock here
+	database.SetMaxOpenConns(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := service.CreateLedgerEntries(ctx, &CreateLedgerEntriesRequest{
+				TransactionID: fmt.Sprintf("t%d", i),
+				FromWalletID:  "wallet-a",
+				ToWalletID:    fmt.Sprintf("wallet-%d", i),
+				Amount:        "1",
+				Currency:      "USD",
+				Description:   "p2p transfer",
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("CreateLedgerEntries failed: %v", err)
+		}
+	}
+
+	balance, err := service.repo.GetLatestBalance(ctx, "wallet-a")
+	if err != nil || balance != "-20.0000" {
+		t.Errorf("Expected the latest balance to be -20.0000, got %s, %v", balance, err)
+	}
+
+	// Running balances must fall by one per entry in created_at order
+	rows, err := database.QueryContext(ctx, `
+		SELECT balance::TEXT FROM ledger_entries
+		WHERE wallet_id = 'wallet-a'
+		ORDER BY created_at, id
+	`)
+	if err != nil {
+		t.Fatalf("Failed to read entries: %v", err)
+	}
+	defer rows.Close()
+
+	for i := 1; rows.Next(); i++ {
+		var got string
+		if err := rows.Scan(&got); err != nil {
+			t.Fatalf("Failed to scan balance: %v", err)
+		}
+		if want := fmt.Sprintf("-%d.0000", i); got != want {
+			t.Errorf("Entry %d has balance %s, want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// StatementFormat - Supported statement export formats
+type StatementFormat string
+
+const (
+	StatementFormatCSV     StatementFormat = "csv"
+	StatementFormatOFX     StatementFormat = "ofx"
+	StatementFormatCamt053 StatementFormat = "camt053" // ISO 20022 camt.053.001.02
+)
+
+// ParseStatementFormat validates a format query parameter (defaults to CSV)
+func ParseStatementFormat(value string) (StatementFormat, error) {
+	switch StatementFormat(strings.ToLower(value)) {
+	case "", StatementFormatCSV:
+		return StatementFormatCSV, nil
+	case StatementFormatOFX:
+		return StatementFormatOFX, nil
+	case StatementFormatCamt053, "camt.053":
+		return StatementFormatCamt053, nil
+	default:
+		return "", fmt.Errorf("unsupported statement format %q: use csv, ofx or camt053", value)
+	}
+}
+
+// ContentType returns the MIME type for the format
+func (f StatementFormat) ContentType() string {
+	switch f {
+	case StatementFormatOFX:
+		return "application/x-ofx"
+	case StatementFormatCamt053:
+		return "application/xml"
+	default:
+		return "text/csv"
+	}
+}
+
+// FileExtension returns the download file extension for the format
+func (f StatementFormat) FileExtension() string {
+	switch f {
+	case StatementFormatOFX:
+		return "ofx"
+	case StatementFormatCamt053:
+		return "xml"
+	default:
+		return "csv"
+	}
+}
+
+// StatementHeader - Everything known about a statement before entries are streamed
+// NOTE: Closing balance is computed up front because OFX and camt.053 need it
+// before (camt) or independently of (OFX) the entry list
+type StatementHeader struct {
+	StatementID    string
+	WalletID       string
+	Currency       string
+	From           time.Time // Inclusive
+	To             time.Time // Exclusive
+	OpeningBalance string
+	ClosingBalance string
+	GeneratedAt    time.Time
+}
+
+// statementWriter writes one statement; entries arrive oldest first
+type statementWriter interface {
+	WriteHeader(h *StatementHeader) error
+	WriteEntry(e *LedgerEntry) error
+	Close() error
+}
+
+func newStatementWriter(format StatementFormat, w io.Writer) statementWriter {
+	switch format {
+	case StatementFormatOFX:
+		return &ofxStatementWriter{w: w}
+	case StatementFormatCamt053:
+		return &camtStatementWriter{w: w}
+	default:
+		return &csvStatementWriter{w: csv.NewWriter(w)}
+	}
+}
+
+// currencyDecimals - ISO 4217 minor units that differ from the default of 2
+var currencyDecimals = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+}
+
+// formatAmount renders a NUMERIC(20,4) amount with the currency's minor units
+// NOTE: Rounds half away from zero; invalid input is returned unchanged
+func formatAmount(amount, currency string) string {
+	decimals, ok := currencyDecimals[strings.ToUpper(currency)]
+	if !ok {
+		decimals = 2
+	}
+
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return amount
+	}
+
+	return value.FloatString(decimals)
+}
+
+// negateAmount flips the sign of a formatted amount
+func negateAmount(amount string) string {
+	if strings.HasPrefix(amount, "-") {
+		return amount[1:]
+	}
+	if strings.Trim(amount, "0.") == "" {
+		return amount
+	}
+	return "-" + amount
+}
+
+// ===== CSV =====
+
+type csvStatementWriter struct {
+	w      *csv.Writer
+	header *StatementHeader
+}
+
+func (c *csvStatementWriter) WriteHeader(h *StatementHeader) error {
+	c.header = h
+
+	if err := c.w.Write([]string{
+		"date", "entry_id", "transaction_id", "entry_type", "description",
+		"debit", "credit", "balance", "currency",
+	}); err != nil {
+		return err
+	}
+
+	return c.w.Write([]string{
+		h.From.UTC().Format(time.RFC3339), "", "", "", "Opening balance",
+		"", "", formatAmount(h.OpeningBalance, h.Currency), h.Currency,
+	})
+}
+
+func (c *csvStatementWriter) WriteEntry(e *LedgerEntry) error {
+	debit, credit := "", ""
+	if e.EntryType == EntryTypeDebit {
+		debit = formatAmount(e.Amount, e.Currency)
+	} else {
+		credit = formatAmount(e.Amount, e.Currency)
+	}
+
+	return c.w.Write([]string{
+		e.CreatedAt.UTC().Format(time.RFC3339),
+		e.ID,
+		e.TransactionID,
+		e.EntryType,
+		e.Description,
+		debit,
+		credit,
+		formatAmount(e.Balance, e.Currency),
+		e.Currency,
+	})
+}
+
+func (c *csvStatementWriter) Close() error {
+	h := c.header
+	if err := c.w.Write([]string{
+		h.To.UTC().Format(time.RFC3339), "", "", "", "Closing balance",
+		"", "", formatAmount(h.ClosingBalance, h.Currency), h.Currency,
+	}); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ===== OFX 2.2 =====
+
+type ofxStatementWriter struct {
+	w      io.Writer
+	enc    *xml.Encoder
+	header *StatementHeader
+}
+
+type ofxTransaction struct {
+	XMLName  xml.Name `xml:"STMTTRN"`
+	TrnType  string   `xml:"TRNTYPE"`
+	DtPosted string   `xml:"DTPOSTED"`
+	TrnAmt   string   `xml:"TRNAMT"`
+	FitID    string   `xml:"FITID"`
+	RefNum   string   `xml:"REFNUM"`
+	Memo     string   `xml:"MEMO,omitempty"`
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:UTC]"
+}
+
+func (o *ofxStatementWriter) WriteHeader(h *StatementHeader) error {
+	o.header = h
+	o.enc = xml.NewEncoder(o.w)
+
+	_, err := fmt.Fprintf(o.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>%s</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS><CURDEF>%s</CURDEF>
+<BANKACCTFROM><BANKID>MERCURIA</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>
+`,
+		ofxTime(h.GeneratedAt),
+		xmlEscape(h.StatementID),
+		xmlEscape(h.Currency),
+		xmlEscape(h.WalletID),
+		ofxTime(h.From),
+		ofxTime(h.To),
+	)
+	return err
+}
+
+func (o *ofxStatementWriter) WriteEntry(e *LedgerEntry) error {
+	trn := ofxTransaction{
+		TrnType:  "CREDIT",
+		DtPosted: ofxTime(e.CreatedAt),
+		TrnAmt:   formatAmount(e.Amount, e.Currency),
+		FitID:    e.ID,
+		RefNum:   e.TransactionID,
+		Memo:     e.Description,
+	}
+	if e.EntryType == EntryTypeDebit {
+		trn.TrnType = "DEBIT"
+		trn.TrnAmt = negateAmount(trn.TrnAmt)
+	}
+
+	if err := o.enc.Encode(trn); err != nil {
+		return err
+	}
+	if err := o.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(o.w, "\n")
+	return err
+}
+
+func (o *ofxStatementWriter) Close() error {
+	h := o.header
+	// OFX has no opening balance field; BALLIST carries it alongside LEDGERBAL
+	_, err := fmt.Fprintf(o.w, `</BANKTRANLIST>
+<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>
+<BALLIST><BAL><NAME>Opening balance</NAME><DESC>Balance at start of statement period</DESC><BALTYPE>DOLLAR</BALTYPE><VALUE>%s</VALUE><DTASOF>%s</DTASOF></BAL></BALLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`,
+		formatAmount(h.ClosingBalance, h.Currency),
+		ofxTime(h.To),
+		formatAmount(h.OpeningBalance, h.Currency),
+		ofxTime(h.From),
+	)
+	return err
+}
+
+// ===== ISO 20022 camt.053.001.02 =====
+
+type camtStatementWriter struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	XMLName   xml.Name   `xml:"Bal"`
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>DtTm"`
+}
+
+type camtEntry struct {
+	XMLName     xml.Name   `xml:"Ntry"`
+	NtryRef     string     `xml:"NtryRef"`
+	Amount      camtAmount `xml:"Amt"`
+	CdtDbtInd   string     `xml:"CdtDbtInd"`
+	Status      string     `xml:"Sts"`
+	BookingDate string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>DtTm"`
+	TxCode      string     `xml:"BkTxCd>Prtry>Cd"`
+	TxCodeIssr  string     `xml:"BkTxCd>Prtry>Issr"`
+	EndToEndID  string     `xml:"NtryDtls>TxDtls>Refs>EndToEndId"`
+	AddtlInfo   string     `xml:"NtryDtls>TxDtls>AddtlTxInf,omitempty"`
+}
+
+// camtSignedAmount splits a signed amount into absolute value and CRDT/DBIT
+func camtSignedAmount(amount, currency string) (camtAmount, string) {
+	formatted := formatAmount(amount, currency)
+	if strings.HasPrefix(formatted, "-") {
+		return camtAmount{Currency: currency, Value: formatted[1:]}, "DBIT"
+	}
+	return camtAmount{Currency: currency, Value: formatted}, "CRDT"
+}
+
+func (c *camtStatementWriter) WriteHeader(h *StatementHeader) error {
+	c.enc = xml.NewEncoder(c.w)
+
+	_, err := fmt.Fprintf(c.w, `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt>
+<GrpHdr><MsgId>%s</MsgId><CreDtTm>%s</CreDtTm></GrpHdr>
+<Stmt><Id>%s</Id><CreDtTm>%s</CreDtTm>
+<FrToDt><FrDtTm>%s</FrDtTm><ToDtTm>%s</ToDtTm></FrToDt>
+<Acct><Id><Othr><Id>%s</Id></Othr></Id><Ccy>%s</Ccy></Acct>
+`,
+		xmlEscape(h.StatementID),
+		h.GeneratedAt.UTC().Format(time.RFC3339),
+		xmlEscape(h.StatementID),
+		h.GeneratedAt.UTC().Format(time.RFC3339),
+		h.From.UTC().Format(time.RFC3339),
+		h.To.UTC().Format(time.RFC3339),
+		xmlEscape(h.WalletID),
+		xmlEscape(h.Currency),
+	)
+	if err != nil {
+		return err
+	}
+
+	opening, openingInd := camtSignedAmount(h.OpeningBalance, h.Currency)
+	closing, closingInd := camtSignedAmount(h.ClosingBalance, h.Currency)
+
+	balances := []camtBalance{
+		{Code: "OPBD", Amount: opening, CdtDbtInd: openingInd, Date: h.From.UTC().Format(time.RFC3339)},
+		{Code: "CLBD", Amount: closing, CdtDbtInd: closingInd, Date: h.To.UTC().Format(time.RFC3339)},
+	}
+	for _, bal := range balances {
+		if err := c.enc.Encode(bal); err != nil {
+			return err
+		}
+	}
+	if err := c.enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.w, "\n")
+	return err
+}
+
+func (c *camtStatementWriter) WriteEntry(e *LedgerEntry) error {
+	indicator := "CRDT"
+	if e.EntryType == EntryTypeDebit {
+		indicator = "DBIT"
+	}
+
+	entry := camtEntry{
+		NtryRef:     e.ID,
+		Amount:      camtAmount{Currency: e.Currency, Value: formatAmount(e.Amount, e.Currency)},
+		CdtDbtInd:   indicator,
+		Status:      "BOOK",
+		BookingDate: e.CreatedAt.UTC().Format(time.RFC3339),
+		ValueDate:   e.CreatedAt.UTC().Format(time.RFC3339),
+		TxCode:      "TRANSFER",
+		TxCodeIssr:  "MERCURIA",
+		EndToEndID:  e.TransactionID,
+		AddtlInfo:   e.Description,
+	}
+
+	if err := c.enc.Encode(entry); err != nil {
+		return err
+	}
+	if err := c.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c.w, "\n")
+	return err
+}
+
+func (c *camtStatementWriter) Close() error {
+	_, err := io.WriteString(c.w, "</Stmt>\n</BkToCstmrStmt>\n</Document>\n")
+	return err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package ledger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     string
+	}{
+		{"100.0000", "USD", "100.00"},
+		{"12.3450", "usd", "12.35"},
+		{"-12.3450", "EUR", "-12.35"},
+		{"12.3449", "USD", "12.34"},
+		{"1500.5000", "JPY", "1501"},
+		{"1.2345", "KWD", "1.235"},
+		{"0", "USD", "0.00"},
+		{"not-a-number", "USD", "not-a-number"},
+	}
+
+	for _, tt := range tests {
+		if got := formatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("formatAmount(%q, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestNegateAmount(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{"12.34", "-12.34"},
+		{"-12.34", "12.34"},
+		{"0.00", "0.00"},
+		{"0", "0"},
+	}
+
+	for _, tt := range tests {
+		if got := negateAmount(tt.amount); got != tt.want {
+			t.Errorf("negateAmount(%q) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCamtSignedAmount(t *testing.T) {
+	tests := []struct {
+		amount    string
+		wantValue string
+		wantSign  string
+	}{
+		{"25.5000", "25.50", "CRDT"},
+		{"-25.5000", "25.50", "DBIT"},
+		{"0.0000", "0.00", "CRDT"},
+	}
+
+	for _, tt := range tests {
+		value, sign := camtSignedAmount(tt.amount, "USD")
+		if value.Value != tt.wantValue || value.Currency != "USD" || sign != tt.wantSign {
+			t.Errorf("camtSignedAmount(%q) = %+v %s, want %s %s", tt.amount, value, sign, tt.wantValue, tt.wantSign)
+		}
+	}
+}
+
+func TestParseStatementFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    StatementFormat
+		wantErr bool
+	}{
+		{"", StatementFormatCSV, false},
+		{"csv", StatementFormatCSV, false},
+		{"ofx", StatementFormatOFX, false},
+		{"camt053", StatementFormatCamt053, false},
+		{"pdf", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStatementFormat(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStatementFormat(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestCSVStatementWriter(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	writer := newStatementWriter(StatementFormatCSV, &buf)
+
+	header := &StatementHeader{
+		StatementID:    "stmt-1",
+		WalletID:       "wallet-1",
+		Currency:       "USD",
+		From:           from,
+		To:             to,
+		OpeningBalance: "100.0000",
+		ClosingBalance: "74.5000",
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	entry := &LedgerEntry{
+		ID:            "entry-1",
+		TransactionID: "txn-1",
+		EntryType:     EntryTypeDebit,
+		Amount:        "25.5000",
+		Currency:      "USD",
+		Balance:       "74.5000",
+		Description:   "Transfer, to bob",
+		CreatedAt:     time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+	if err := writer.WriteEntry(entry); err != nil {
+		t.Fatalf("WriteEntry failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"date,entry_id,transaction_id,entry_type,description,debit,credit,balance,currency",
+		"2025-01-01T00:00:00Z,,,,Opening balance,,,100.00,USD",
+		`2025-01-15T10:00:00Z,entry-1,txn-1,debit,"Transfer, to bob",25.50,,74.50,USD`,
+		"2025-02-01T00:00:00Z,,,,Closing balance,,,74.50,USD",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV statement:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,112 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/kafka"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/pkg/outbox"
+)
+
+// FeePolicy is the fee charged on completed transfers
+// NOTE: The fee is moved from the payer to the currency's fee wallet as a
+// separate wallet transfer; the recipient still receives the full amount
+type FeePolicy struct {
+	rate    money.Rate
+	wallets map[string]string
+}
+
+// NewFeePolicy builds the policy from config; it returns nil when no fee rate
+// is configured
+func NewFeePolicy(cfg config.TransactionConfig) (*FeePolicy, error) {
+	if cfg.FeeRate == "" {
+		return nil, nil
+	}
+
+	rate, err := money.ParseRate(cfg.FeeRate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fee rate: %w", err)
+	}
+	if len(cfg.FeeWallets) == 0 {
+		return nil, fmt.Errorf("a fee rate needs at least one fee wallet")
+	}
+	return &FeePolicy{rate: rate, wallets: cfg.FeeWallets}, nil
+}
+
+// Fee returns the fee on a transfer of amount in currency and the wallet it
+// goes to; the fee is zero when fees are off or the currency has no fee wallet
+func (p *FeePolicy) Fee(amount, currency string) (money.Amount, string, error) {
+	if p == nil {
+		return money.Zero(), "", nil
+	}
+	wallet, ok := p.wallets[currency]
+	if !ok {
+		return money.Zero(), "", nil
+	}
+
+	a, err := money.Parse(amount)
+	if err != nil {
+		return money.Zero(), "", err
+	}
+	return a.Convert(p.rate), wallet, nil
+}
+
+// withFee returns amount plus its fee, for balance checks
+func (s *Service) withFee(amount, currency string) (string, error) {
+	fee, _, err := s.fees.Fee(amount, currency)
+	if err != nil {
+		return "", err
+	}
+	return money.Add(amount, fee.String())
+}
+
+// chargeFee moves the fee on a completed transfer from the payer to the fee
+// wallet and returns the fee charged
+// NOTE: The transfer has already settled, so a failed fee transfer is logged
+// and not charged rather than failing the transfer
+func (s *Service) chargeFee(ctx context.Context, fromWalletID, amount, currency, idempotencyKey string) money.Amount {
+	fee, feeWallet, err := s.fees.Fee(amount, currency)
+	if err != nil || fee.Sign() <= 0 || feeWallet == fromWalletID {
+		return money.Zero()
+	}
+
+	transferReq := WalletTransferRequest{
+		FromWalletID:   fromWalletID,
+		ToWalletID:     feeWallet,
+		Amount:         fee.String(),
+		IdempotencyKey: idempotencyKey + "-fee",
+	}
+	if err := s.executeWalletTransfer(ctx, &transferReq); err != nil {
+		s.logger.Errorf("Failed to charge fee %s %s to wallet %s: %v", fee, currency, fromWalletID, err)
+		return money.Zero()
+	}
+	return fee
+}
+
+// saveFeeChargedTx publishes transaction.fee_charged through the outbox for a
+// fee returned by chargeFee; nothing is published for a zero fee
+func (s *Service) saveFeeChargedTx(ctx context.Context, tx *sql.Tx, transactionID, walletID, currency string, fee money.Amount) error {
+	if fee.Sign() <= 0 {
+		return nil
+	}
+
+	event := &outbox.OutboxEvent{
+		AggregateID: transactionID,
+		Topic:       kafka.TopicFeeCharged,
+		Payload: kafka.FeeCharged{
+			TransactionID: transactionID,
+			WalletID:      walletID,
+			Amount:        fee.String(),
+			Currency:      currency,
+			ChargedAt:     time.Now(),
+		},
+	}
+	if err := s.outboxRepo.SaveEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("failed to save fee charged event: %w", err)
+	}
+	return nil
+}
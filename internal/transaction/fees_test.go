@@ -0,0 +1,64 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+)
+
+func TestNewFeePolicy(t *testing.T) {
+	if p, err := NewFeePolicy(config.TransactionConfig{}); p != nil || err != nil {
+		t.Errorf("Expected no policy without a fee rate, got %v, %v", p, err)
+	}
+
+	invalid := []config.TransactionConfig{
+		{FeeRate: "abc", FeeWallets: map[string]string{"USD": "w"}},
+		{FeeRate: "0", FeeWallets: map[string]string{"USD": "w"}},
+		{FeeRate: "0.01"},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewFeePolicy(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestFeePolicyFee(t *testing.T) {
+	p, err := NewFeePolicy(config.TransactionConfig{
+		FeeRate:    "0.005",
+		FeeWallets: map[string]string{"USD": "fees-usd"},
+	})
+	if err != nil {
+		t.Fatalf("NewFeePolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *FeePolicy
+		amount   string
+		currency string
+		fee      string
+		wallet   string
+	}{
+		{"rate", p, "100", "USD", "0.5000", "fees-usd"},
+		{"rounds half up", p, "0.01", "USD", "0.0001", "fees-usd"},
+		{"no fee wallet", p, "100", "EUR", "0.0000", ""},
+		{"fees off", nil, "100", "USD", "0.0000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, wallet, err := tt.policy.Fee(tt.amount, tt.currency)
+			if err != nil {
+				t.Fatalf("Fee() error = %v", err)
+			}
+			if fee.String() != tt.fee || wallet != tt.wallet {
+				t.Errorf("Fee() = %s, %q, want %s, %q", fee, wallet, tt.fee, tt.wallet)
+			}
+		})
+	}
+
+	if _, _, err := p.Fee("ten", "USD"); err == nil {
+		t.Error("Expected error for an invalid amount")
+	}
+}
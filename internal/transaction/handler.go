@@ -4,10 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/kmassidik/mercuria/internal/common/logger"
 	"github.com/kmassidik/mercuria/internal/common/middleware"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 )
 
 type ServiceInterface interface {
@@ -15,7 +15,7 @@ type ServiceInterface interface {
 	CreateBatchTransfer(ctx context.Context, req *CreateBatchTransactionRequest) (*BatchTransaction, []Transaction, error)
 	CreateScheduledTransfer(ctx context.Context, req *CreateScheduledTransactionRequest) (*Transaction, error)
 	GetTransaction(ctx context.Context, id string) (*Transaction, error)
-	ListTransactionsByWallet(ctx context.Context, walletID string, limit, offset int) ([]Transaction, error)
+	ListTransactionsByWallet(ctx context.Context, walletID string, page pagination.Params) ([]Transaction, string, error)
 }
 
 type Handler struct {
@@ -185,20 +185,11 @@ func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse pagination
-	limit := 50
-	offset := 0
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
-	}
-
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+	// Parse pagination (cursor preferred, offset kept for older clients)
+	page, err := pagination.FromQuery(r.URL.Query(), 50, 100)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// TODO: Verify user owns wallet
@@ -210,7 +201,7 @@ func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 		ctx = SetAuthorizationInContext(ctx, authHeader)
 	}
 
-	txns, err := h.service.ListTransactionsByWallet(ctx, walletID, limit, offset)
+	txns, nextCursor, err := h.service.ListTransactionsByWallet(ctx, walletID, page)
 	if err != nil {
 		h.logger.Errorf("Failed to list transactions: %v", err)
 		h.respondError(w, http.StatusInternalServerError, "failed to list transactions")
@@ -220,8 +211,9 @@ func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, TransactionListResponse{
 		Transactions: txns,
 		Total:        len(txns),
-		Limit:        limit,
-		Offset:       offset,
+		Limit:        page.Limit,
+		Offset:       page.Offset,
+		NextCursor:   nextCursor,
 	})
 }
 
@@ -126,6 +126,7 @@ type TransactionListResponse struct {
 	Total        int           `json:"total"`
 	Limit        int           `json:"limit"`
 	Offset       int           `json:"offset"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
 }
 
 // ErrorResponse - Standard error response
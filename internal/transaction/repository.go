@@ -7,6 +7,7 @@ import (
 
 	"github.com/kmassidik/mercuria/internal/common/db"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 )
 
 type Repository struct {
@@ -201,6 +202,28 @@ func (r *Repository) MarkTransactionAsFailed(ctx context.Context, id string, rea
 	return nil
 }
 
+// MarkTransactionAsFailedTx marks a transaction as failed within a transaction
+func (r *Repository) MarkTransactionAsFailedTx(ctx context.Context, tx *sql.Tx, id string, reason string) error {
+	query := `
+		UPDATE transactions
+		SET status = $1, failure_reason = $2, processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`
+
+	result, err := tx.ExecContext(ctx, query, StatusFailed, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark transaction as failed: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("transaction not found")
+	}
+
+	r.logger.Warnf("Transaction %s marked as failed: %s", id, reason)
+	return nil
+}
+
 // GetScheduledTransactions retrieves transactions that are due to be processed
 // NOTE: Called by background worker to execute scheduled transfers
 func (r *Repository) GetScheduledTransactions(ctx context.Context, limit int) ([]Transaction, error) {
@@ -257,7 +280,7 @@ func (r *Repository) ListTransactionsByWallet(ctx context.Context, walletID stri
 			processed_at, failure_reason, created_at, updated_at
 		FROM transactions
 		WHERE from_wallet_id = $1 OR to_wallet_id = $1
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT $2 OFFSET $3
 	`
 
@@ -267,11 +290,38 @@ func (r *Repository) ListTransactionsByWallet(ctx context.Context, walletID stri
 	}
 	defer rows.Close()
 
+	return r.scanTransactionList(rows)
+}
+
+// ListTransactionsByWalletAfter lists wallet transactions older than the cursor (keyset pagination)
+func (r *Repository) ListTransactionsByWalletAfter(ctx context.Context, walletID string, cursor *pagination.Cursor, limit int) ([]Transaction, error) {
+	query := `
+		SELECT 
+			id, from_wallet_id, to_wallet_id, amount, currency, type,
+			status, description, idempotency_key, scheduled_at, 
+			processed_at, failure_reason, created_at, updated_at
+		FROM transactions
+		WHERE (from_wallet_id = $1 OR to_wallet_id = $1)
+		  AND (created_at, id) < ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, walletID, cursor.CreatedAt, cursor.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanTransactionList(rows)
+}
+
+func (r *Repository) scanTransactionList(rows *sql.Rows) ([]Transaction, error) {
 	var transactions []Transaction
 	for rows.Next() {
 		var txn Transaction
-		var failureReason sql.NullString // <- ADD THIS
-		
+		var failureReason sql.NullString
+
 		err := rows.Scan(
 			&txn.ID,
 			&txn.FromWalletID,
@@ -284,22 +334,26 @@ func (r *Repository) ListTransactionsByWallet(ctx context.Context, walletID stri
 			&txn.IdempotencyKey,
 			&txn.ScheduledAt,
 			&txn.ProcessedAt,
-			&failureReason, // <- CHANGE THIS
+			&failureReason,
 			&txn.CreatedAt,
 			&txn.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
-		
+
 		// Convert sql.NullString to *string
 		if failureReason.Valid {
 			txn.FailureReason = &failureReason.String
 		}
-		
+
 		transactions = append(transactions, txn)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
 	return transactions, nil
 }
 
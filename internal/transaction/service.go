@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/big"
 	"net/http"
 	"os"
 	"time"
@@ -15,7 +14,9 @@ import (
 	"github.com/kmassidik/mercuria/internal/common/db"
 	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
 	"github.com/kmassidik/mercuria/internal/common/mtls"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 	"github.com/kmassidik/mercuria/internal/common/redis"
 	"github.com/kmassidik/mercuria/pkg/outbox"
 )
@@ -26,6 +27,7 @@ type Service struct {
 	redis         *redis.Client
 	producer      *kafka.Producer
 	db            *db.DB
+	fees          *FeePolicy
 	logger        *logger.Logger
 	walletBaseURL string
 	httpClient    *http.Client
@@ -37,6 +39,7 @@ func NewService(
 	redisClient *redis.Client,
 	producer *kafka.Producer,
 	database *db.DB,
+	fees *FeePolicy,
 	log *logger.Logger,
 ) *Service {
 	// Use environment variable or default to localhost
@@ -73,6 +76,7 @@ func NewService(
 		redis:         redisClient,
 		producer:      producer,
 		db:            database,
+		fees:          fees,
 		logger:        log,
 		walletBaseURL: walletServiceURL,
 		 httpClient: httpClient,
@@ -141,6 +145,14 @@ func (s *Service) executeWalletTransfer(ctx context.Context, req *WalletTransfer
 	if authHeader, ok := GetAuthorizationFromContext(ctx); ok {
 		httpReq.Header.Set("Authorization", authHeader)
 	}
+
+	// Wallet events for this transfer share the request's correlation id
+	if trace, ok := kafka.TraceFromContext(ctx); ok {
+		httpReq.Header.Set("X-Correlation-ID", trace.CorrelationID)
+		if trace.TraceParent != "" {
+			httpReq.Header.Set("traceparent", trace.TraceParent)
+		}
+	}
 	
 	resp, err := s.httpClient.Do(httpReq)
 	if err != nil {
@@ -173,6 +185,8 @@ type WalletInfo struct {
 }
 
 func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionRequest) (*Transaction, error) {
+	initiatedAt := time.Now() // Start of the settlement latency analytics reports
+
 	// 1. Validate request
 	if err := ValidateCreateTransactionRequest(req); err != nil {
 		return nil, fmt.Errorf("validation failed: %w", err)
@@ -203,8 +217,12 @@ func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionR
 		return nil, fmt.Errorf("currency mismatch: %s != %s", fromWallet.Currency, toWallet.Currency)
 	}
 
-	// 5. Check sufficient balance
-	if !hasSufficientBalance(fromWallet.Balance, req.Amount) {
+	// 5. Check sufficient balance, fee included
+	needed, err := s.withFee(req.Amount, fromWallet.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fee: %w", err)
+	}
+	if !money.Covers(fromWallet.Balance, needed) {
 		return nil, fmt.Errorf("insufficient balance")
 	}
 
@@ -219,6 +237,7 @@ func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionR
 	if err := s.executeWalletTransfer(ctx, &transferReq); err != nil {
 		return nil, fmt.Errorf("wallet transfer failed: %w", err)
 	}
+	fee := s.chargeFee(ctx, req.FromWalletID, req.Amount, fromWallet.Currency, req.IdempotencyKey)
 
 	// 7. Create transaction record in local DB
 	var completedTxn *Transaction
@@ -243,16 +262,16 @@ func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionR
 		// 8. Save outbox event
 		event := &outbox.OutboxEvent{
 			AggregateID: createdTxn.ID,
-			EventType:   "transaction.completed",
-			Topic:       "transaction.completed",
-			Payload: map[string]interface{}{
-				"transaction_id": createdTxn.ID,
-				"from_wallet_id": req.FromWalletID,
-				"to_wallet_id":   req.ToWalletID,
-				"amount":         req.Amount,
-				"currency":       fromWallet.Currency,
-				"type":           TypeP2P,
-				"completed_at":   time.Now(),
+			Topic:       kafka.TopicTransactionCompleted,
+			Payload: kafka.TransactionCompleted{
+				TransactionID: createdTxn.ID,
+				FromWalletID:  req.FromWalletID,
+				ToWalletID:    req.ToWalletID,
+				Amount:        req.Amount,
+				Currency:      fromWallet.Currency,
+				Type:          TypeP2P,
+				CompletedAt:   time.Now(),
+				InitiatedAt:   initiatedAt,
 			},
 		}
 
@@ -260,7 +279,7 @@ func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionR
 			return fmt.Errorf("failed to save outbox event: %w", err)
 		}
 
-		return nil
+		return s.saveFeeChargedTx(ctx, tx, createdTxn.ID, req.FromWalletID, fromWallet.Currency, fee)
 	})
 
 	if err != nil {
@@ -278,6 +297,8 @@ func (s *Service) CreateP2PTransfer(ctx context.Context, req *CreateTransactionR
 }
 
 func (s *Service) CreateBatchTransfer(ctx context.Context, req *CreateBatchTransactionRequest) (*BatchTransaction, []Transaction, error) {
+	initiatedAt := time.Now() // Start of the settlement latency analytics reports
+
 	// 1. Validate request
 	if err := ValidateCreateBatchTransactionRequest(req); err != nil {
 		return nil, nil, fmt.Errorf("validation failed: %w", err)
@@ -304,9 +325,13 @@ func (s *Service) CreateBatchTransfer(ctx context.Context, req *CreateBatchTrans
 		return nil, nil, fmt.Errorf("source wallet error: %w", err)
 	}
 
-	// 5. Check sufficient balance for total
-	if !hasSufficientBalance(fromWallet.Balance, totalAmount) {
-		return nil, nil, fmt.Errorf("insufficient balance for batch (need %s, have %s)", totalAmount, fromWallet.Balance)
+	// 5. Check sufficient balance for total, fee included
+	needed, err := s.withFee(totalAmount, fromWallet.Currency)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to calculate fee: %w", err)
+	}
+	if !money.Covers(fromWallet.Balance, needed) {
+		return nil, nil, fmt.Errorf("insufficient balance for batch (need %s, have %s)", needed, fromWallet.Balance)
 	}
 
 	// 6. Execute each transfer via Wallet Service
@@ -331,6 +356,7 @@ func (s *Service) CreateBatchTransfer(ctx context.Context, req *CreateBatchTrans
 		batch = createdBatch
 
 		// Process each transfer
+		legs := make([]kafka.BatchLeg, 0, len(req.Transfers))
 		for i, transfer := range req.Transfers {
 			// Validate recipient wallet exists
 			toWallet, err := s.getWalletFromService(ctx, transfer.ToWalletID)
@@ -372,6 +398,19 @@ func (s *Service) CreateBatchTransfer(ctx context.Context, req *CreateBatchTrans
 				return fmt.Errorf("transfer[%d] record creation failed: %w", i, err)
 			}
 			transactions = append(transactions, *createdTxn)
+
+			legs = append(legs, kafka.BatchLeg{
+				TransactionID: createdTxn.ID,
+				ToWalletID:    transfer.ToWalletID,
+				Amount:        transfer.Amount,
+				Description:   transfer.Description,
+			})
+		}
+
+		// One fee on the batch total
+		fee := s.chargeFee(ctx, req.FromWalletID, totalAmount, fromWallet.Currency, req.IdempotencyKey)
+		if err := s.saveFeeChargedTx(ctx, tx, batch.ID, req.FromWalletID, fromWallet.Currency, fee); err != nil {
+			return err
 		}
 
 		// Update batch status to completed
@@ -381,16 +420,20 @@ func (s *Service) CreateBatchTransfer(ctx context.Context, req *CreateBatchTrans
 		batch.Status = StatusCompleted
 
 		// Save outbox event
+		// NOTE: One multi-leg event per batch; the ledger posts each leg under
+		// its own transaction_id
 		event := &outbox.OutboxEvent{
 			AggregateID: batch.ID,
-			EventType:   "batch.completed",
-			Topic:       "transaction.completed",
-			Payload: map[string]interface{}{
-				"batch_id":       batch.ID,
-				"from_wallet_id": req.FromWalletID,
-				"total_amount":   totalAmount,
-				"count":          len(req.Transfers),
-				"completed_at":   time.Now(),
+			Topic:       kafka.TopicTransactionCompleted,
+			Payload: kafka.BatchCompleted{
+				BatchID:      batch.ID,
+				FromWalletID: req.FromWalletID,
+				Currency:     fromWallet.Currency,
+				TotalAmount:  totalAmount,
+				Count:        len(req.Transfers),
+				Legs:         legs,
+				CompletedAt:  time.Now(),
+				InitiatedAt:  initiatedAt,
 			},
 		}
 
@@ -494,7 +537,9 @@ func (s *Service) ProcessScheduledTransfers(ctx context.Context) (int, error) {
 		if err != nil {
 			s.logger.Errorf("Failed to execute scheduled transfer %s: %v", txn.ID, err)
 			// Mark as failed
-			s.repo.MarkTransactionAsFailed(ctx, txn.ID, err.Error())
+			if err := s.markTransactionAsFailed(ctx, &txn, err.Error()); err != nil {
+				s.logger.Errorf("Failed to mark scheduled transfer %s as failed: %v", txn.ID, err)
+			}
 			continue
 		}
 		processed++
@@ -505,6 +550,8 @@ func (s *Service) ProcessScheduledTransfers(ctx context.Context) (int, error) {
 }
 
 func (s *Service) executeScheduledTransfer(ctx context.Context, txn *Transaction) error {
+	initiatedAt := time.Now() // Start of the settlement latency analytics reports
+
 	// 1. Get wallet info
 	fromWallet, err := s.getWalletFromService(ctx, txn.FromWalletID)
 	if err != nil {
@@ -516,8 +563,12 @@ func (s *Service) executeScheduledTransfer(ctx context.Context, txn *Transaction
 		return fmt.Errorf("destination wallet error: %w", err)
 	}
 
-	// 2. Check balance
-	if !hasSufficientBalance(fromWallet.Balance, txn.Amount) {
+	// 2. Check balance, fee included
+	needed, err := s.withFee(txn.Amount, txn.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to calculate fee: %w", err)
+	}
+	if !money.Covers(fromWallet.Balance, needed) {
 		return fmt.Errorf("insufficient balance")
 	}
 
@@ -532,6 +583,7 @@ func (s *Service) executeScheduledTransfer(ctx context.Context, txn *Transaction
 	if err := s.executeWalletTransfer(ctx, &transferReq); err != nil {
 		return fmt.Errorf("wallet transfer failed: %w", err)
 	}
+	fee := s.chargeFee(ctx, txn.FromWalletID, txn.Amount, txn.Currency, transferReq.IdempotencyKey)
 
 	// 4. Update transaction status in DB
 	return s.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
@@ -543,27 +595,49 @@ func (s *Service) executeScheduledTransfer(ctx context.Context, txn *Transaction
 		// Save outbox event
 		event := &outbox.OutboxEvent{
 			AggregateID: txn.ID,
-			EventType:   "transaction.completed",
-			Topic:       "transaction.completed",
-			Payload: map[string]interface{}{
-				"transaction_id": txn.ID,
-				"from_wallet_id": txn.FromWalletID,
-				"to_wallet_id":   txn.ToWalletID,
-				"amount":         txn.Amount,
-				"type":           TypeScheduled,
-				"completed_at":   time.Now(),
+			Topic:       kafka.TopicTransactionCompleted,
+			Payload: kafka.TransactionCompleted{
+				TransactionID: txn.ID,
+				FromWalletID:  txn.FromWalletID,
+				ToWalletID:    txn.ToWalletID,
+				Amount:        txn.Amount,
+				Currency:      txn.Currency,
+				Type:          TypeScheduled,
+				CompletedAt:   time.Now(),
+				InitiatedAt:   initiatedAt,
 			},
 		}
-		return s.outboxRepo.SaveEvent(ctx, tx, event)
+		if err := s.outboxRepo.SaveEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		return s.saveFeeChargedTx(ctx, tx, txn.ID, txn.FromWalletID, txn.Currency, fee)
 	})
 }
 
-func hasSufficientBalance(balance, amount string) bool {
-	balanceVal := new(big.Float)
-	amountVal := new(big.Float)
-	balanceVal.SetString(balance)
-	amountVal.SetString(amount)
-	return balanceVal.Cmp(amountVal) >= 0
+// markTransactionAsFailed records a failed transfer and publishes
+// transaction.failed through the outbox in the same transaction
+func (s *Service) markTransactionAsFailed(ctx context.Context, txn *Transaction, reason string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.repo.MarkTransactionAsFailedTx(ctx, tx, txn.ID, reason); err != nil {
+			return err
+		}
+
+		event := &outbox.OutboxEvent{
+			AggregateID: txn.ID,
+			Topic:       kafka.TopicTransactionFailed,
+			Payload: kafka.TransactionFailed{
+				TransactionID: txn.ID,
+				FromWalletID:  txn.FromWalletID,
+				ToWalletID:    txn.ToWalletID,
+				Amount:        txn.Amount,
+				Currency:      txn.Currency,
+				Type:          txn.Type,
+				Reason:        reason,
+				FailedAt:      time.Now(),
+			},
+		}
+		return s.outboxRepo.SaveEvent(ctx, tx, event)
+	})
 }
 
 // GetTransaction retrieves a transaction by ID
@@ -581,14 +655,25 @@ func (s *Service) GetTransaction(ctx context.Context, id string) (*Transaction,
 }
 
 // ListTransactionsByWallet lists transactions for a specific wallet
-func (s *Service) ListTransactionsByWallet(ctx context.Context, walletID string, limit, offset int) ([]Transaction, error) {
+// NOTE: Returns the next page cursor ("" on last page)
+func (s *Service) ListTransactionsByWallet(ctx context.Context, walletID string, page pagination.Params) ([]Transaction, string, error) {
 	// NOTE: You would perform the "Verify user owns wallet" TODO here
 
-	// 1. Retrieve transactions from repository
-	txns, err := s.repo.ListTransactionsByWallet(ctx, walletID, limit, offset)
+	var txns []Transaction
+	var err error
+
+	if page.Cursor != nil {
+		txns, err = s.repo.ListTransactionsByWalletAfter(ctx, walletID, page.Cursor, page.FetchLimit())
+	} else {
+		txns, err = s.repo.ListTransactionsByWallet(ctx, walletID, page.FetchLimit(), page.Offset)
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return txns, nil
+	txns, nextCursor := pagination.Page(txns, page.Limit, func(t Transaction) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: t.CreatedAt, ID: t.ID}
+	})
+
+	return txns, nextCursor, nil
 }
\ No newline at end of file
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/money"
 )
 
 var (
@@ -162,20 +164,16 @@ func ValidateCreateScheduledTransactionRequest(req *CreateScheduledTransactionRe
 // CalculateBatchTotal calculates the total amount for a batch transfer
 // NOTE: Used to verify sender has sufficient balance
 func CalculateBatchTotal(transfers []BatchTransferItem) (string, error) {
-	// Use big.Float for precise decimal arithmetic
-	total := 0.0
+	total := money.Zero()
 
 	for _, transfer := range transfers {
-		// Parse amount
-		var amount float64
-		_, err := fmt.Sscanf(transfer.Amount, "%f", &amount)
+		amount, err := money.Parse(transfer.Amount)
 		if err != nil {
 			return "", fmt.Errorf("invalid amount in batch: %s", transfer.Amount)
 		}
 
-		total += amount
+		total = total.Add(amount)
 	}
 
-	// Format with 4 decimal places
-	return fmt.Sprintf("%.4f", total), nil
+	return total.String(), nil
 }
\ No newline at end of file
@@ -4,10 +4,10 @@ import (
 	"context" // <-- You'll need this import
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/kmassidik/mercuria/internal/common/logger"
 	"github.com/kmassidik/mercuria/internal/common/middleware"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 )
 
 // +FIX 1: Define the Service Interface
@@ -17,7 +17,7 @@ type ServiceInterface interface {
 	GetWallet(ctx context.Context, walletID string) (*Wallet, error)
 	Deposit(ctx context.Context, walletID string, req *DepositRequest) (*Wallet, error)
 	Withdraw(ctx context.Context, walletID string, req *WithdrawRequest) (*Wallet, error)
-	GetWalletEvents(ctx context.Context, walletID string, limit, offset int) ([]WalletEvent, error)
+	GetWalletEvents(ctx context.Context, walletID string, page pagination.Params) ([]WalletEvent, string, error)
 	GetWalletsByUserID(ctx context.Context, userID string) ([]Wallet, error) // <- ADD THIS
 	Transfer(ctx context.Context, req *TransferRequest) error // <- ADD THIS
 }
@@ -203,22 +203,13 @@ func (h *Handler) GetWalletEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 50
-	offset := 0
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
-	}
-
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+	page, err := pagination.FromQuery(r.URL.Query(), 50, 100)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	events, err := h.service.GetWalletEvents(r.Context(), walletID, limit, offset)
+	events, nextCursor, err := h.service.GetWalletEvents(r.Context(), walletID, page)
 	if err != nil {
 		h.logger.Errorf("Failed to get events: %v", err)
 		h.respondError(w, http.StatusInternalServerError, "failed to get events")
@@ -226,8 +217,9 @@ func (h *Handler) GetWalletEvents(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.respondJSON(w, http.StatusOK, WalletEventsResponse{
-		Events: events,
-		Total:  len(events),
+		Events:     events,
+		Total:      len(events),
+		NextCursor: nextCursor,
 	})
 }
 
@@ -67,31 +67,16 @@ type WalletResponse struct {
 }
 
 type WalletEventsResponse struct {
-	Events []WalletEvent `json:"events"`
-	Total  int           `json:"total"`
+	Events     []WalletEvent `json:"events"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-// Kafka event payloads
-type WalletCreatedEvent struct {
-	WalletID  string    `json:"wallet_id"`
-	UserID    string    `json:"user_id"`
-	Currency  string    `json:"currency"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-type BalanceUpdatedEvent struct {
-	WalletID      string    `json:"wallet_id"`
-	UserID        string    `json:"user_id"`
-	EventType     string    `json:"event_type"`
-	Amount        string    `json:"amount"`
-	BalanceBefore string    `json:"balance_before"`
-	BalanceAfter  string    `json:"balance_after"`
-	Timestamp     time.Time `json:"timestamp"`
-}
+// Kafka event payloads live in internal/common/kafka (typed, versioned)
 
 type TransferRequest struct {
 	FromWalletID   string `json:"from_wallet_id"`
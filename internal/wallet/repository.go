@@ -8,6 +8,7 @@ import (
 
 	"github.com/kmassidik/mercuria/internal/common/db"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 )
 
 type Repository struct {
@@ -255,7 +256,7 @@ func (r *Repository) GetWalletEvents(ctx context.Context, walletID string, limit
 		SELECT id, wallet_id, event_type, amount, balance_before, balance_after, metadata, created_at
 		FROM wallet_events
 		WHERE wallet_id = $1
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT $2 OFFSET $3
 	`
 
@@ -265,6 +266,29 @@ func (r *Repository) GetWalletEvents(ctx context.Context, walletID string, limit
 	}
 	defer rows.Close()
 
+	return r.scanWalletEvents(rows)
+}
+
+// GetWalletEventsAfter retrieves wallet events older than the cursor (keyset pagination)
+func (r *Repository) GetWalletEventsAfter(ctx context.Context, walletID string, cursor *pagination.Cursor, limit int) ([]WalletEvent, error) {
+	query := `
+		SELECT id, wallet_id, event_type, amount, balance_before, balance_after, metadata, created_at
+		FROM wallet_events
+		WHERE wallet_id = $1 AND (created_at, id) < ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, walletID, cursor.CreatedAt, cursor.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet events: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanWalletEvents(rows)
+}
+
+func (r *Repository) scanWalletEvents(rows *sql.Rows) ([]WalletEvent, error) {
 	var events []WalletEvent
 	for rows.Next() {
 		var event WalletEvent
@@ -293,6 +317,10 @@ func (r *Repository) GetWalletEvents(ctx context.Context, walletID string, limit
 		events = append(events, event)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
 	return events, nil
 }
 
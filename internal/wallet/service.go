@@ -3,14 +3,14 @@ package wallet
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"math/big"
 	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/db"
 	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/kmassidik/mercuria/internal/common/money"
+	"github.com/kmassidik/mercuria/internal/common/pagination"
 	"github.com/kmassidik/mercuria/internal/common/redis"
 	"github.com/kmassidik/mercuria/pkg/outbox"
 )
@@ -83,23 +83,17 @@ func (s *Service) CreateWallet(ctx context.Context, req *CreateWalletRequest) (*
 		created = wallet
 
 		// Save event to outbox (same transaction)
-		eventData := WalletCreatedEvent{
+		eventData := kafka.WalletCreated{
 			WalletID:  created.ID,
 			UserID:    created.UserID,
 			Currency:  created.Currency,
 			CreatedAt: created.CreatedAt,
 		}
 
-		// Convert event to map for outbox
-		eventBytes, _ := json.Marshal(eventData)
-		var eventMap map[string]interface{}
-		json.Unmarshal(eventBytes, &eventMap)
-
 		outboxEvent := &outbox.OutboxEvent{
 			AggregateID: created.ID,
-			EventType:   "wallet.created",
-			Topic:       "wallet.created",
-			Payload:     eventMap,
+			Topic:       kafka.TopicWalletCreated,
+			Payload:     eventData,
 		}
 
 		if err := s.outboxRepo.SaveEvent(ctx, tx, outboxEvent); err != nil {
@@ -189,7 +183,7 @@ func (s *Service) Deposit(ctx context.Context, walletID string, req *DepositRequ
 
 		// Calculate new balance
 		balanceBefore = wallet.Balance
-		newBalance, err := addAmounts(wallet.Balance, req.Amount)
+		newBalance, err := money.Add(wallet.Balance, req.Amount)
 		if err != nil {
 			return fmt.Errorf("failed to calculate new balance: %w", err)
 		}
@@ -218,26 +212,20 @@ func (s *Service) Deposit(ctx context.Context, walletID string, req *DepositRequ
 		}
 
 		// Save balance updated event to outbox
-		balanceEventData := BalanceUpdatedEvent{
+		balanceEventData := kafka.WalletBalanceUpdated{
 			WalletID:      walletID,
 			UserID:        wallet.UserID,
-			EventType:     EventTypeDeposit,
+			Operation:     EventTypeDeposit,
 			Amount:        req.Amount,
 			BalanceBefore: balanceBefore,
 			BalanceAfter:  balanceAfter,
 			Timestamp:     time.Now(),
 		}
 
-		// Convert event to map for outbox
-		eventBytes, _ := json.Marshal(balanceEventData)
-		var eventMap map[string]interface{}
-		json.Unmarshal(eventBytes, &eventMap)
-
 		outboxEvent := &outbox.OutboxEvent{
 			AggregateID: walletID,
-			EventType:   "wallet.balance_updated",
-			Topic:       "wallet.balance_updated",
-			Payload:     eventMap,
+			Topic:       kafka.TopicWalletBalanceUpdated,
+			Payload:     balanceEventData,
 		}
 
 		if err := s.outboxRepo.SaveEvent(ctx, tx, outboxEvent); err != nil {
@@ -308,13 +296,13 @@ func (s *Service) Withdraw(ctx context.Context, walletID string, req *WithdrawRe
 		}
 
 		// Check sufficient balance
-		if !hasSufficientBalance(wallet.Balance, req.Amount) {
+		if !money.Covers(wallet.Balance, req.Amount) {
 			return fmt.Errorf("insufficient balance")
 		}
 
 		// Calculate new balance
 		balanceBefore = wallet.Balance
-		newBalance, err := subtractAmounts(wallet.Balance, req.Amount)
+		newBalance, err := money.Sub(wallet.Balance, req.Amount)
 		if err != nil {
 			return fmt.Errorf("failed to calculate new balance: %w", err)
 		}
@@ -343,26 +331,20 @@ func (s *Service) Withdraw(ctx context.Context, walletID string, req *WithdrawRe
 		}
 
 		// Save balance updated event to outbox
-		balanceEventData := BalanceUpdatedEvent{
+		balanceEventData := kafka.WalletBalanceUpdated{
 			WalletID:      walletID,
 			UserID:        wallet.UserID,
-			EventType:     EventTypeWithdrawal,
+			Operation:     EventTypeWithdrawal,
 			Amount:        req.Amount,
 			BalanceBefore: balanceBefore,
 			BalanceAfter:  balanceAfter,
 			Timestamp:     time.Now(),
 		}
 
-		// Convert event to map for outbox
-		eventBytes, _ := json.Marshal(balanceEventData)
-		var eventMap map[string]interface{}
-		json.Unmarshal(eventBytes, &eventMap)
-
 		outboxEvent := &outbox.OutboxEvent{
 			AggregateID: walletID,
-			EventType:   "wallet.balance_updated",
-			Topic:       "wallet.balance_updated",
-			Payload:     eventMap,
+			Topic:       kafka.TopicWalletBalanceUpdated,
+			Payload:     balanceEventData,
 		}
 
 		if err := s.outboxRepo.SaveEvent(ctx, tx, outboxEvent); err != nil {
@@ -392,54 +374,25 @@ func (s *Service) Withdraw(ctx context.Context, walletID string, req *WithdrawRe
 }
 
 // GetWalletEvents retrieves wallet transaction history
-func (s *Service) GetWalletEvents(ctx context.Context, walletID string, limit, offset int) ([]WalletEvent, error) {
-	events, err := s.repo.GetWalletEvents(ctx, walletID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get wallet events: %w", err)
-	}
+// NOTE: Returns the next page cursor ("" on last page)
+func (s *Service) GetWalletEvents(ctx context.Context, walletID string, page pagination.Params) ([]WalletEvent, string, error) {
+	var events []WalletEvent
+	var err error
 
-	return events, nil
-}
-
-// Helper functions for decimal arithmetic
-func addAmounts(a, b string) (string, error) {
-	aVal := new(big.Float)
-	bVal := new(big.Float)
-
-	if _, ok := aVal.SetString(a); !ok {
-		return "", fmt.Errorf("invalid amount: %s", a)
+	if page.Cursor != nil {
+		events, err = s.repo.GetWalletEventsAfter(ctx, walletID, page.Cursor, page.FetchLimit())
+	} else {
+		events, err = s.repo.GetWalletEvents(ctx, walletID, page.FetchLimit(), page.Offset)
 	}
-	if _, ok := bVal.SetString(b); !ok {
-		return "", fmt.Errorf("invalid amount: %s", b)
-	}
-
-	result := new(big.Float).Add(aVal, bVal)
-	return result.Text('f', 4), nil
-}
-
-func subtractAmounts(a, b string) (string, error) {
-	aVal := new(big.Float)
-	bVal := new(big.Float)
-
-	if _, ok := aVal.SetString(a); !ok {
-		return "", fmt.Errorf("invalid amount: %s", a)
-	}
-	if _, ok := bVal.SetString(b); !ok {
-		return "", fmt.Errorf("invalid amount: %s", b)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get wallet events: %w", err)
 	}
 
-	result := new(big.Float).Sub(aVal, bVal)
-	return result.Text('f', 4), nil
-}
-
-func hasSufficientBalance(balance, amount string) bool {
-	balanceVal := new(big.Float)
-	amountVal := new(big.Float)
-
-	balanceVal.SetString(balance)
-	amountVal.SetString(amount)
+	events, nextCursor := pagination.Page(events, page.Limit, func(e WalletEvent) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
 
-	return balanceVal.Cmp(amountVal) >= 0
+	return events, nextCursor, nil
 }
 
 // GetWalletsByUserID retrieves all wallets for a user
@@ -508,17 +461,17 @@ func (s *Service) Transfer(ctx context.Context, req *TransferRequest) error {
 		}
 
 		// Check sufficient balance
-		if !hasSufficientBalance(fromWallet.Balance, req.Amount) {
+		if !money.Covers(fromWallet.Balance, req.Amount) {
 			return fmt.Errorf("insufficient balance")
 		}
 
 		// Calculate new balances
-		newFromBalance, err := subtractAmounts(fromWallet.Balance, req.Amount)
+		newFromBalance, err := money.Sub(fromWallet.Balance, req.Amount)
 		if err != nil {
 			return fmt.Errorf("failed to calculate source balance: %w", err)
 		}
 
-		newToBalance, err := addAmounts(toWallet.Balance, req.Amount)
+		newToBalance, err := money.Add(toWallet.Balance, req.Amount)
 		if err != nil {
 			return fmt.Errorf("failed to calculate destination balance: %w", err)
 		}
@@ -566,50 +519,40 @@ func (s *Service) Transfer(ctx context.Context, req *TransferRequest) error {
 		}
 
 		// Publish balance updated events to outbox
-		fromBalanceEvent := BalanceUpdatedEvent{
+		fromBalanceEvent := kafka.WalletBalanceUpdated{
 			WalletID:      req.FromWalletID,
 			UserID:        fromWallet.UserID,
-			EventType:     "wallet.transfer_out",
+			Operation:     "wallet.transfer_out",
 			Amount:        req.Amount,
 			BalanceBefore: fromWallet.Balance,
 			BalanceAfter:  newFromBalance,
 			Timestamp:     time.Now(),
 		}
 
-		fromEventBytes, _ := json.Marshal(fromBalanceEvent)
-		var fromEventMap map[string]interface{}
-		json.Unmarshal(fromEventBytes, &fromEventMap)
-
 		fromOutboxEvent := &outbox.OutboxEvent{
 			AggregateID: req.FromWalletID,
-			EventType:   "wallet.balance_updated",
-			Topic:       "wallet.balance_updated",
-			Payload:     fromEventMap,
+			Topic:       kafka.TopicWalletBalanceUpdated,
+			Payload:     fromBalanceEvent,
 		}
 
 		if err := s.outboxRepo.SaveEvent(ctx, tx, fromOutboxEvent); err != nil {
 			return fmt.Errorf("failed to save source outbox event: %w", err)
 		}
 
-		toBalanceEvent := BalanceUpdatedEvent{
+		toBalanceEvent := kafka.WalletBalanceUpdated{
 			WalletID:      req.ToWalletID,
 			UserID:        toWallet.UserID,
-			EventType:     "wallet.transfer_in",
+			Operation:     "wallet.transfer_in",
 			Amount:        req.Amount,
 			BalanceBefore: toWallet.Balance,
 			BalanceAfter:  newToBalance,
 			Timestamp:     time.Now(),
 		}
 
-		toEventBytes, _ := json.Marshal(toBalanceEvent)
-		var toEventMap map[string]interface{}
-		json.Unmarshal(toEventBytes, &toEventMap)
-
 		toOutboxEvent := &outbox.OutboxEvent{
 			AggregateID: req.ToWalletID,
-			EventType:   "wallet.balance_updated",
-			Topic:       "wallet.balance_updated",
-			Payload:     toEventMap,
+			Topic:       kafka.TopicWalletBalanceUpdated,
+			Payload:     toBalanceEvent,
 		}
 
 		if err := s.outboxRepo.SaveEvent(ctx, tx, toOutboxEvent); err != nil {
@@ -0,0 +1,14 @@
+-- +goose Down
+DROP TABLE IF EXISTS kafka_consumer_offsets;
+
+-- +goose Up
+-- Kafka consumer offsets stored next to the metrics (KAFKA_DB_OFFSETS=true)
+-- next_offset is advanced in the same transaction as the metric updates
+CREATE TABLE IF NOT EXISTS kafka_consumer_offsets (
+    consumer_group VARCHAR(255) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    partition INTEGER NOT NULL,
+    next_offset BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (consumer_group, topic, partition)
+);
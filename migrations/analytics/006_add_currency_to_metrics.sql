@@ -0,0 +1,33 @@
+-- +goose Down
+-- NOTE: Fails if a key has rows in several currencies; merge or delete them first
+ALTER TABLE user_snapshots DROP CONSTRAINT IF EXISTS unique_user_snapshot_date_currency;
+ALTER TABLE user_snapshots ADD CONSTRAINT unique_user_snapshot_date UNIQUE (user_id, snapshot_date);
+ALTER TABLE user_snapshots DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE hourly_metrics DROP CONSTRAINT IF EXISTS unique_metric_hour_currency;
+ALTER TABLE hourly_metrics ADD CONSTRAINT unique_metric_hour UNIQUE (metric_hour);
+ALTER TABLE hourly_metrics DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE daily_metrics DROP CONSTRAINT IF EXISTS unique_metric_date_currency;
+ALTER TABLE daily_metrics ADD CONSTRAINT unique_metric_date UNIQUE (metric_date);
+ALTER TABLE daily_metrics DROP COLUMN IF EXISTS currency;
+
+-- +goose Up
+-- Currency is part of every aggregate key so amounts in different currencies
+-- are never summed together
+-- NOTE: Rows aggregated before this migration mixed currencies and cannot be
+-- split; they are kept under 'XXX' (ISO 4217 "no currency")
+ALTER TABLE daily_metrics ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'XXX';
+ALTER TABLE daily_metrics ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE daily_metrics DROP CONSTRAINT IF EXISTS unique_metric_date;
+ALTER TABLE daily_metrics ADD CONSTRAINT unique_metric_date_currency UNIQUE (metric_date, currency);
+
+ALTER TABLE hourly_metrics ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'XXX';
+ALTER TABLE hourly_metrics ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE hourly_metrics DROP CONSTRAINT IF EXISTS unique_metric_hour;
+ALTER TABLE hourly_metrics ADD CONSTRAINT unique_metric_hour_currency UNIQUE (metric_hour, currency);
+
+ALTER TABLE user_snapshots ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'XXX';
+ALTER TABLE user_snapshots ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE user_snapshots DROP CONSTRAINT IF EXISTS unique_user_snapshot_date;
+ALTER TABLE user_snapshots ADD CONSTRAINT unique_user_snapshot_date_currency UNIQUE (user_id, snapshot_date, currency);
@@ -0,0 +1,20 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_hourly_histograms_metric;
+DROP TABLE IF EXISTS hourly_histograms;
+
+-- +goose Up
+-- Create hourly_histograms table: mergeable value and latency histograms
+-- Each row counts the observations of one metric that fell in one bucket
+-- (sketch.Bucket index) during one hour; summing counts over hours gives the
+-- histogram of any range
+CREATE TABLE IF NOT EXISTS hourly_histograms (
+    metric_hour TIMESTAMP NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    metric VARCHAR(30) NOT NULL,
+    bucket INTEGER NOT NULL,
+    count BIGINT DEFAULT 0 NOT NULL,
+    PRIMARY KEY (metric_hour, currency, metric, bucket)
+);
+
+-- Index for range queries of one metric
+CREATE INDEX idx_hourly_histograms_metric ON hourly_histograms(metric, metric_hour);
@@ -0,0 +1,30 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_anomalies_status;
+DROP INDEX IF EXISTS idx_anomalies_detected_at;
+DROP TABLE IF EXISTS anomalies;
+
+-- +goose Up
+-- Create anomalies table for flagged transaction flow
+-- NOTE: analytics.anomaly_detected is published through the outbox, so the
+-- outbox migrations (migrations/outbox) must also be applied to this database
+CREATE TABLE IF NOT EXISTS anomalies (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(30) NOT NULL,                 -- hourly_volume, hourly_count, user_spending
+    wallet_id VARCHAR(36) NOT NULL DEFAULT '', -- Empty for system-wide anomalies
+    currency VARCHAR(3) NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    observed NUMERIC(20, 4) NOT NULL,
+    expected NUMERIC(20, 4) NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, acknowledged
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMP,
+    CONSTRAINT unique_anomaly_window UNIQUE (kind, wallet_id, currency, window_start)
+);
+
+-- Index for listing recent anomalies
+CREATE INDEX idx_anomalies_detected_at ON anomalies(detected_at DESC);
+
+-- Index for open anomalies
+CREATE INDEX idx_anomalies_status ON anomalies(status) WHERE status = 'open';
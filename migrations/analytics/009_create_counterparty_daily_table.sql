@@ -0,0 +1,22 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_counterparty_daily_wallet;
+DROP TABLE IF EXISTS counterparty_daily;
+
+-- +goose Up
+-- Create counterparty_daily table: what each wallet sent to and received from
+-- each other wallet, per day and currency
+CREATE TABLE IF NOT EXISTS counterparty_daily (
+    activity_date DATE NOT NULL,
+    wallet_id VARCHAR(36) NOT NULL,
+    counterparty_wallet_id VARCHAR(36) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    total_sent NUMERIC(20, 4) DEFAULT 0 NOT NULL,
+    sent_count BIGINT DEFAULT 0 NOT NULL,
+    total_received NUMERIC(20, 4) DEFAULT 0 NOT NULL,
+    received_count BIGINT DEFAULT 0 NOT NULL,
+    last_transaction_at TIMESTAMP,
+    PRIMARY KEY (activity_date, wallet_id, counterparty_wallet_id, currency)
+);
+
+-- Index for a wallet's counterparties over a date range
+CREATE INDEX idx_counterparty_daily_wallet ON counterparty_daily(wallet_id, activity_date);
@@ -0,0 +1,28 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_cohort_activity_month;
+DROP TABLE IF EXISTS cohort_activity;
+DROP INDEX IF EXISTS idx_wallet_cohorts_month;
+DROP TABLE IF EXISTS wallet_cohorts;
+
+-- +goose Up
+-- Create wallet_cohorts table: the month each wallet first had a ledger entry
+-- NOTE: Analytics does not see sign-ups, so a wallet's first activity month
+-- stands in for its signup month
+CREATE TABLE IF NOT EXISTS wallet_cohorts (
+    wallet_id VARCHAR(36) PRIMARY KEY,
+    cohort_month DATE NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL
+);
+
+-- Index for reading one range of cohorts
+CREATE INDEX idx_wallet_cohorts_month ON wallet_cohorts(cohort_month);
+
+-- Create cohort_activity table: the months in which each wallet was active
+CREATE TABLE IF NOT EXISTS cohort_activity (
+    wallet_id VARCHAR(36) NOT NULL,
+    activity_month DATE NOT NULL,
+    PRIMARY KEY (wallet_id, activity_month)
+);
+
+-- Index for month-based queries
+CREATE INDEX idx_cohort_activity_month ON cohort_activity(activity_month);
@@ -0,0 +1,15 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_wallet_activity_days_wallet;
+DROP TABLE IF EXISTS wallet_activity_days;
+
+-- +goose Up
+-- Create wallet_activity_days table: the days on which each wallet was active,
+-- for exact DAU and MAU series
+CREATE TABLE IF NOT EXISTS wallet_activity_days (
+    activity_date DATE NOT NULL,
+    wallet_id VARCHAR(36) NOT NULL,
+    PRIMARY KEY (activity_date, wallet_id)
+);
+
+-- Index for a wallet's activity history
+CREATE INDEX idx_wallet_activity_days_wallet ON wallet_activity_days(wallet_id, activity_date);
@@ -0,0 +1,24 @@
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_hourly_snapshots_hour;
+DROP TABLE IF EXISTS user_hourly_snapshots;
+
+-- +goose Up
+-- Create user_hourly_snapshots table: per-user statistics per UTC hour
+-- NOTE: user_snapshots buckets by UTC day; these rows roll up into the days of
+-- any timezone (a user's profile timezone, or ?tz=)
+CREATE TABLE IF NOT EXISTS user_hourly_snapshots (
+    user_id VARCHAR(36) NOT NULL,
+    snapshot_hour TIMESTAMP NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    total_sent NUMERIC(20, 4) DEFAULT 0 NOT NULL,
+    total_received NUMERIC(20, 4) DEFAULT 0 NOT NULL,
+    transaction_count BIGINT DEFAULT 0 NOT NULL,
+    sent_count BIGINT DEFAULT 0 NOT NULL,
+    received_count BIGINT DEFAULT 0 NOT NULL,
+    total_fees_paid NUMERIC(20, 4) DEFAULT 0 NOT NULL,
+    last_transaction_at TIMESTAMP,
+    PRIMARY KEY (user_id, snapshot_hour, currency)
+);
+
+-- Index for hour-based queries
+CREATE INDEX idx_user_hourly_snapshots_hour ON user_hourly_snapshots(snapshot_hour);
@@ -0,0 +1,4 @@
+-- migrations/auth/002_add_user_timezone.sql
+
+-- Add the profile timezone (IANA name) used to bucket a user's analytics by local day
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
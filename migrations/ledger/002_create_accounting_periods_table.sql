@@ -0,0 +1,61 @@
+-- Accounting periods and period-end balance snapshots
+-- NOTE: A closed period is frozen - entries may not be back-dated into it
+
+CREATE TABLE IF NOT EXISTS accounting_periods (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,  -- Inclusive
+    period_end TIMESTAMP WITH TIME ZONE NOT NULL,    -- Exclusive
+    status VARCHAR(20) NOT NULL DEFAULT 'closed',
+    closed_by VARCHAR(255),                          -- User who closed the period
+    closed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CHECK (period_end > period_start),
+    CHECK (status IN ('closed'))
+);
+
+-- Closed periods must never overlap
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounting_periods_start
+    ON accounting_periods(period_start);
+
+CREATE INDEX IF NOT EXISTS idx_accounting_periods_range
+    ON accounting_periods(period_start, period_end);
+
+-- Balances per wallet and currency at the end of a closed period
+CREATE TABLE IF NOT EXISTS period_balances (
+    period_id UUID NOT NULL REFERENCES accounting_periods(id),
+    wallet_id VARCHAR(255) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    opening_balance NUMERIC(20, 4) NOT NULL,         -- Balance at period_start
+    closing_balance NUMERIC(20, 4) NOT NULL,         -- Balance at period_end
+    total_debits NUMERIC(20, 4) NOT NULL DEFAULT 0,  -- Movements inside the period
+    total_credits NUMERIC(20, 4) NOT NULL DEFAULT 0,
+    entry_count INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (period_id, wallet_id, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_period_balances_wallet
+    ON period_balances(wallet_id, period_id);
+
+-- Reject entries whose created_at falls inside a closed period
+-- NOTE: Guard trigger only - it never modifies or deletes ledger rows
+CREATE OR REPLACE FUNCTION reject_entries_in_closed_period()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM accounting_periods
+        WHERE NEW.created_at >= period_start
+          AND NEW.created_at < period_end
+    ) THEN
+        RAISE EXCEPTION 'accounting period containing % is closed', NEW.created_at
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_ledger_entries_closed_period ON ledger_entries;
+CREATE TRIGGER trg_ledger_entries_closed_period
+    BEFORE INSERT ON ledger_entries
+    FOR EACH ROW
+    EXECUTE FUNCTION reject_entries_in_closed_period();
@@ -0,0 +1,9 @@
+-- Keyset (cursor) pagination indexes
+-- NOTE: Pages are ordered by (created_at DESC, id DESC); the id tie-breaker
+-- keeps cursors stable when several entries share a timestamp
+
+CREATE INDEX IF NOT EXISTS idx_ledger_wallet_keyset
+    ON ledger_entries(wallet_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_keyset
+    ON ledger_entries(created_at DESC, id DESC);
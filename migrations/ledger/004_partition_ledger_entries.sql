@@ -0,0 +1,152 @@
+-- Monthly range partitioning of ledger_entries + archive bookkeeping
+-- NOTE: Entries are never deleted. Old partitions are archived to compressed,
+-- checksummed files (retained >= 7 years) and only then detached and dropped.
+-- Archived months can be restored (re-attached) for audits.
+
+-- Create (if missing) the monthly partition containing month_start, in UTC
+CREATE OR REPLACE FUNCTION create_ledger_partition(month_start TIMESTAMPTZ)
+RETURNS TEXT AS $$
+DECLARE
+    start_ts TIMESTAMPTZ := date_trunc('month', month_start AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    end_ts TIMESTAMPTZ := (date_trunc('month', month_start AT TIME ZONE 'UTC') + INTERVAL '1 month') AT TIME ZONE 'UTC';
+    partition_name TEXT := 'ledger_entries_' || to_char(month_start AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    IF to_regclass(partition_name) IS NULL THEN
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF ledger_entries FOR VALUES FROM (%L) TO (%L)',
+            partition_name, start_ts, end_ts
+        );
+    END IF;
+    RETURN partition_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- One-time conversion of the plain table into a partitioned one
+DO $$
+DECLARE
+    first_month TIMESTAMPTZ;
+    m TIMESTAMPTZ;
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_partitioned_table pt
+        JOIN pg_class c ON c.oid = pt.partrelid
+        WHERE c.relname = 'ledger_entries'
+    ) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE ledger_entries RENAME TO ledger_entries_unpartitioned;
+
+    -- Partition key must be part of the primary key
+    CREATE TABLE ledger_entries (
+        id UUID NOT NULL DEFAULT gen_random_uuid(),
+        transaction_id VARCHAR(255) NOT NULL,
+        wallet_id VARCHAR(255) NOT NULL,
+        entry_type VARCHAR(10) NOT NULL,
+        amount NUMERIC(20, 4) NOT NULL,
+        currency VARCHAR(3) NOT NULL,
+        balance NUMERIC(20, 4) NOT NULL,
+        description TEXT,
+        metadata JSONB,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+        PRIMARY KEY (id, created_at),
+        CHECK (entry_type IN ('debit', 'credit')),
+        CHECK (amount > 0)
+    ) PARTITION BY RANGE (created_at);
+
+    SELECT COALESCE(MIN(created_at), CURRENT_TIMESTAMP) INTO first_month
+    FROM ledger_entries_unpartitioned;
+
+    m := date_trunc('month', first_month AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    WHILE m < CURRENT_TIMESTAMP + INTERVAL '3 months' LOOP
+        PERFORM create_ledger_partition(m);
+        m := m + INTERVAL '1 month';
+    END LOOP;
+
+    INSERT INTO ledger_entries (
+        id, transaction_id, wallet_id, entry_type, amount, currency,
+        balance, description, metadata, created_at
+    )
+    SELECT
+        id, transaction_id, wallet_id, entry_type, amount, currency,
+        balance, description, metadata, COALESCE(created_at, CURRENT_TIMESTAMP)
+    FROM ledger_entries_unpartitioned;
+
+    DROP TABLE ledger_entries_unpartitioned;
+END $$;
+
+-- Indexes (created on every partition automatically)
+CREATE INDEX IF NOT EXISTS idx_ledger_transaction
+    ON ledger_entries(transaction_id);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_wallet_keyset
+    ON ledger_entries(wallet_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_keyset
+    ON ledger_entries(created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_wallet_type
+    ON ledger_entries(wallet_id, entry_type, created_at DESC);
+
+-- Closed-period guard from 002 must follow the new table
+DROP TRIGGER IF EXISTS trg_ledger_entries_closed_period ON ledger_entries;
+CREATE TRIGGER trg_ledger_entries_closed_period
+    BEFORE INSERT ON ledger_entries
+    FOR EACH ROW
+    EXECUTE FUNCTION reject_entries_in_closed_period();
+
+-- Archived partitions (one row per archived month)
+CREATE TABLE IF NOT EXISTS ledger_archives (
+    partition_name VARCHAR(63) PRIMARY KEY,        -- e.g. ledger_entries_2025_01
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    period_end TIMESTAMP WITH TIME ZONE NOT NULL,
+    location TEXT NOT NULL,                        -- Object name in the archive store
+    sha256 VARCHAR(64) NOT NULL,                   -- Checksum of the compressed file
+    entry_count BIGINT NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    restored_at TIMESTAMP WITH TIME ZONE           -- Set while re-attached for audit
+);
+
+-- Per-wallet totals of archived months
+-- NOTE: Keeps balances, trial balance and stats correct after partitions are dropped
+CREATE TABLE IF NOT EXISTS ledger_archive_balances (
+    partition_name VARCHAR(63) NOT NULL REFERENCES ledger_archives(partition_name),
+    wallet_id VARCHAR(255) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    total_debits NUMERIC(20, 4) NOT NULL,
+    total_credits NUMERIC(20, 4) NOT NULL,
+    entry_count BIGINT NOT NULL,
+    closing_balance NUMERIC(20, 4) NOT NULL,       -- Running balance at period_end
+    first_entry_at TIMESTAMP WITH TIME ZONE,
+    last_entry_at TIMESTAMP WITH TIME ZONE,
+
+    PRIMARY KEY (partition_name, wallet_id, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_archive_balances_wallet
+    ON ledger_archive_balances(wallet_id);
+
+-- Wallet balance at a point in time, falling back to archived months
+CREATE OR REPLACE FUNCTION ledger_balance_as_of(p_wallet_id VARCHAR, p_as_of TIMESTAMPTZ)
+RETURNS NUMERIC AS $$
+    SELECT COALESCE(
+        (
+            SELECT balance FROM ledger_entries
+            WHERE wallet_id = p_wallet_id AND created_at <= p_as_of
+            ORDER BY created_at DESC, id DESC
+            LIMIT 1
+        ),
+        (
+            SELECT b.closing_balance
+            FROM ledger_archive_balances b
+            JOIN ledger_archives a ON a.partition_name = b.partition_name
+            WHERE b.wallet_id = p_wallet_id
+              AND a.restored_at IS NULL
+              AND a.period_end <= p_as_of
+            ORDER BY a.period_end DESC
+            LIMIT 1
+        ),
+        0
+    )::NUMERIC(20, 4)
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,17 @@
+-- Processed transactions guard (idempotent Kafka consumption)
+-- NOTE: One row per transaction_id, inserted in the same DB transaction as its
+-- ledger entries. A redelivered transaction.completed message conflicts on the
+-- primary key and becomes a no-op instead of posting the transfer twice.
+-- Rows are never archived, so the guard still holds for archived months.
+
+CREATE TABLE IF NOT EXISTS ledger_processed_transactions (
+    transaction_id VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Backfill transactions that were posted before the guard existed
+INSERT INTO ledger_processed_transactions (transaction_id, processed_at)
+SELECT transaction_id, MIN(created_at)
+FROM ledger_entries
+GROUP BY transaction_id
+ON CONFLICT (transaction_id) DO NOTHING;
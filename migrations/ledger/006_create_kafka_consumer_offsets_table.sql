@@ -0,0 +1,14 @@
+-- Kafka consumer offsets stored next to the ledger (KAFKA_DB_OFFSETS=true)
+-- NOTE: next_offset is advanced in the same DB transaction that posts the
+-- entries for a transaction.completed message, so a message is either fully
+-- applied and recorded or not at all. On startup the consumer group is moved
+-- forward to these offsets.
+
+CREATE TABLE IF NOT EXISTS kafka_consumer_offsets (
+    consumer_group VARCHAR(255) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    partition INT NOT NULL,
+    next_offset BIGINT NOT NULL,                -- Next offset to process
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (consumer_group, topic, partition)
+);
@@ -0,0 +1,10 @@
+-- Event envelope metadata
+-- NOTE: The publisher wraps each row in a kafka.Envelope; the row id becomes the
+-- envelope id. schema_version 0 marks rows written before typed events existed,
+-- which consumers decode as legacy bare payloads.
+
+ALTER TABLE outbox_events
+    ADD COLUMN IF NOT EXISTS schema_version INT NOT NULL DEFAULT 0,  -- Payload schema version
+    ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255),            -- Originating request/event
+    ADD COLUMN IF NOT EXISTS causation_id VARCHAR(255),              -- Event that directly caused this one
+    ADD COLUMN IF NOT EXISTS traceparent VARCHAR(55);                -- W3C trace context
@@ -0,0 +1,19 @@
+-- Lease-based claiming so several replicas can run the outbox publisher
+-- NOTE: A publisher claims rows by setting claimed_by/claimed_until; rows whose
+-- lease has expired (crashed replica) are claimed again. sequence gives a strict
+-- insertion order - created_at is the transaction start time, so events saved
+-- in one transaction share it.
+
+ALTER TABLE outbox_events
+    ADD COLUMN IF NOT EXISTS sequence BIGSERIAL,                   -- Insertion order, publish order per aggregate
+    ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255),              -- Publisher instance holding the lease
+    ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE; -- Lease expiry
+
+-- Index for claiming pending events per aggregate in order
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_aggregate
+    ON outbox_events(aggregate_id, sequence)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_sequence
+    ON outbox_events(sequence)
+    WHERE status = 'pending';
@@ -0,0 +1,21 @@
+-- Low-latency dispatch and per-event retry backoff
+-- NOTE: Every insert into outbox_events sends a NOTIFY on the outbox_events
+-- channel so a listening publisher wakes up at once instead of waiting for its
+-- next poll. The notification is sent when the inserting transaction commits.
+-- A failed publish schedules the next attempt in next_attempt_at.
+
+ALTER TABLE outbox_events
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE; -- Earliest retry after a failed publish
+
+CREATE OR REPLACE FUNCTION notify_outbox_event() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('outbox_events', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outbox_events_notify ON outbox_events;
+CREATE TRIGGER outbox_events_notify
+    AFTER INSERT ON outbox_events
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION notify_outbox_event();
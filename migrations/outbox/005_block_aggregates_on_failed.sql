@@ -0,0 +1,9 @@
+-- Failed events hold back their aggregate
+-- NOTE: An event that ran out of publish attempts stays 'failed' and later
+-- events of the same aggregate are not published until an operator replays
+-- or skips it. Claiming looks up the oldest pending or failed event per
+-- aggregate, so the index covers both.
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished_aggregate
+    ON outbox_events(aggregate_id, sequence)
+    WHERE status IN ('pending', 'failed');
@@ -0,0 +1,8 @@
+-- Keyset (cursor) pagination indexes for wallet transaction history
+-- NOTE: Sent and received lookups are combined with a BitmapOr
+
+CREATE INDEX IF NOT EXISTS idx_transactions_from_wallet_keyset
+    ON transactions(from_wallet_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_to_wallet_keyset
+    ON transactions(to_wallet_id, created_at DESC, id DESC);
@@ -0,0 +1,5 @@
+-- Keyset (cursor) pagination index for wallet event history
+-- NOTE: Pages are ordered by (created_at DESC, id DESC)
+
+CREATE INDEX IF NOT EXISTS idx_wallet_events_keyset
+    ON wallet_events(wallet_id, created_at DESC, id DESC);
@@ -0,0 +1,313 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+// metrics are exposed on /debug/vars under "outbox"
+// NOTE: Counters are per process; the gauges are refreshed by the Janitor
+var metrics = expvar.NewMap("outbox")
+
+// EventFilter selects outbox events for listing and replay
+type EventFilter struct {
+	Status      string
+	AggregateID string
+	EventType   string
+	Topic       string
+	Limit       int
+}
+
+// where builds the WHERE clause and arguments for the filter
+func (f EventFilter) where() (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	add := func(column, value string) {
+		if value == "" {
+			return
+		}
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	add("status", f.Status)
+	add("aggregate_id", f.AggregateID)
+	add("event_type", f.EventType)
+	add("topic", f.Topic)
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Stats summarizes the outbox backlog
+type Stats struct {
+	Pending              int64      `json:"pending"`
+	Failed               int64      `json:"failed"`
+	Published            int64      `json:"published"`
+	OldestPendingAt      *time.Time `json:"oldest_pending_at,omitempty"`
+	OldestPendingSeconds float64    `json:"oldest_pending_seconds"`
+	PublishAttempts      int64      `json:"publish_attempts"` // Since process start
+	PublishFailures      int64      `json:"publish_failures"` // Since process start
+	FailureRate          float64    `json:"failure_rate"`     // publish_failures / publish_attempts
+}
+
+// ListEvents returns events matching the filter, newest first
+func (r *Repository) ListEvents(ctx context.Context, filter EventFilter) ([]OutboxEvent, error) {
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+
+	where, args := filter.where()
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM outbox_events
+		WHERE %s
+		ORDER BY sequence DESC
+		LIMIT $%d
+	`, eventColumns, where, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanEvents(rows)
+}
+
+// GetEvent returns a single outbox event
+func (r *Repository) GetEvent(ctx context.Context, id string) (*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+eventColumns+` FROM outbox_events WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox event: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := r.scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("event not found: %s", id)
+	}
+	return &events[0], nil
+}
+
+// ReplayFailed resets failed events matching the filter to pending
+// NOTE: Attempts and backoff start over; last_error is kept for reference.
+// Later events of the same aggregate were held back, so they follow in order.
+func (r *Repository) ReplayFailed(ctx context.Context, filter EventFilter) (int64, error) {
+	filter.Status = StatusFailed
+	where, args := filter.where()
+	args = append(args, StatusPending)
+
+	query := fmt.Sprintf(`
+		UPDATE outbox_events
+		SET status = $%d, attempts = 0, next_attempt_at = NULL,
+			claimed_by = NULL, claimed_until = NULL
+		WHERE %s
+	`, len(args), where)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay failed events: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		r.logger.Infof("Reset %d failed outbox event(s) to pending", n)
+	}
+	return n, nil
+}
+
+// ReplayEvent resets a single failed event to pending
+func (r *Repository) ReplayEvent(ctx context.Context, id string) error {
+	query := `
+		UPDATE outbox_events
+		SET status = $1, attempts = 0, next_attempt_at = NULL,
+			claimed_by = NULL, claimed_until = NULL
+		WHERE id = $2 AND status = $3
+	`
+
+	res, err := r.db.ExecContext(ctx, query, StatusPending, id, StatusFailed)
+	if err != nil {
+		return fmt.Errorf("failed to replay event: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("failed event not found: %s", id)
+	}
+
+	r.logger.Infof("Reset failed outbox event %s to pending", id)
+	return nil
+}
+
+// SkipEvent gives up on a single failed event so that later events of its
+// aggregate can be published
+// NOTE: The event is kept (status skipped) for reference
+func (r *Repository) SkipEvent(ctx context.Context, id string) error {
+	query := `
+		UPDATE outbox_events
+		SET status = $1, next_attempt_at = NULL, claimed_by = NULL, claimed_until = NULL
+		WHERE id = $2 AND status = $3
+	`
+
+	res, err := r.db.ExecContext(ctx, query, StatusSkipped, id, StatusFailed)
+	if err != nil {
+		return fmt.Errorf("failed to skip event: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("failed event not found: %s", id)
+	}
+
+	r.logger.Warnf("Skipped failed outbox event %s; later events of its aggregate will publish", id)
+	return nil
+}
+
+// DeletePublishedBefore removes up to limit events published before cutoff
+// NOTE: Deletes in small batches so cleanup never holds long locks
+func (r *Repository) DeletePublishedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM outbox_events
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE status = $1 AND published_at < $2
+			LIMIT $3
+		)
+	`
+
+	res, err := r.db.ExecContext(ctx, query, StatusPublished, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published events: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// GetStats returns backlog counts and the age of the oldest pending event
+func (r *Repository) GetStats(ctx context.Context) (*Stats, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE status = $1),
+			COUNT(*) FILTER (WHERE status = $2),
+			COUNT(*) FILTER (WHERE status = $3),
+			MIN(created_at) FILTER (WHERE status = $1)
+		FROM outbox_events
+	`
+
+	stats := &Stats{}
+	err := r.db.QueryRowContext(ctx, query, StatusPending, StatusFailed, StatusPublished).Scan(
+		&stats.Pending, &stats.Failed, &stats.Published, &stats.OldestPendingAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox stats: %w", err)
+	}
+
+	if stats.OldestPendingAt != nil {
+		stats.OldestPendingSeconds = time.Since(*stats.OldestPendingAt).Seconds()
+	}
+
+	stats.PublishAttempts = counter("publish_attempts")
+	stats.PublishFailures = counter("publish_failures")
+	if stats.PublishAttempts > 0 {
+		stats.FailureRate = float64(stats.PublishFailures) / float64(stats.PublishAttempts)
+	}
+
+	return stats, nil
+}
+
+func counter(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// Janitor deletes published events past retention and refreshes the backlog
+// gauges in the "outbox" expvar map
+type Janitor struct {
+	repo      *Repository
+	retention time.Duration
+	interval  time.Duration
+	logger    *logger.Logger
+}
+
+func NewJanitor(repo *Repository, retention, interval time.Duration, log *logger.Logger) *Janitor {
+	return &Janitor{
+		repo:      repo,
+		retention: retention,
+		interval:  interval,
+		logger:    log,
+	}
+}
+
+// Start runs cleanup every interval until ctx is cancelled
+func (j *Janitor) Start(ctx context.Context) {
+	j.logger.Infof("Outbox janitor started (retention %s)", j.retention)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	j.run(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("Outbox janitor stopped")
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *Janitor) run(ctx context.Context) {
+	if deleted, err := j.Cleanup(ctx); err != nil {
+		j.logger.Errorf("Outbox cleanup failed: %v", err)
+	} else if deleted > 0 {
+		j.logger.Infof("Deleted %d published outbox event(s) older than %s", deleted, j.retention)
+	}
+
+	stats, err := j.repo.GetStats(ctx)
+	if err != nil {
+		j.logger.Errorf("Failed to refresh outbox metrics: %v", err)
+		return
+	}
+
+	pending, failed, oldest := new(expvar.Int), new(expvar.Int), new(expvar.Float)
+	pending.Set(stats.Pending)
+	failed.Set(stats.Failed)
+	oldest.Set(stats.OldestPendingSeconds)
+	metrics.Set("pending", pending)
+	metrics.Set("failed", failed)
+	metrics.Set("oldest_pending_seconds", oldest)
+}
+
+// Cleanup deletes published events older than the retention period
+func (j *Janitor) Cleanup(ctx context.Context) (int64, error) {
+	if j.retention <= 0 {
+		return 0, nil // Retention disabled
+	}
+
+	cutoff := time.Now().Add(-j.retention)
+	var total int64
+	for {
+		n, err := j.repo.DeletePublishedBefore(ctx, cutoff, 1000)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < 1000 {
+			metrics.Add("deleted", total)
+			return total, nil
+		}
+	}
+}
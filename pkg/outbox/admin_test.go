@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+func TestEventFilterWhere(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    EventFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{"empty", EventFilter{}, "TRUE", []interface{}{}},
+		{"status", EventFilter{Status: StatusFailed}, "TRUE AND status = $1", []interface{}{StatusFailed}},
+		{
+			"several",
+			EventFilter{AggregateID: "w-1", Topic: "wallet.events", Limit: 10},
+			"TRUE AND aggregate_id = $1 AND topic = $2",
+			[]interface{}{"w-1", "wallet.events"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where()
+			if where != tt.wantWhere || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("where() = %q %v, want %q %v", where, args, tt.wantWhere, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestJanitorCleanupDisabled(t *testing.T) {
+	j := NewJanitor(nil, 0, time.Minute, logger.New("test"))
+
+	deleted, err := j.Cleanup(context.Background())
+	if err != nil || deleted != 0 {
+		t.Errorf("Cleanup() = %d, %v, want 0, nil", deleted, err)
+	}
+}
+
+func TestJanitorCleanup(t *testing.T) {
+	repo, conn := testRepository(t)
+	ctx := context.Background()
+
+	ids := saveEvents(t, repo, conn, "a", "b", "c")
+	for _, id := range ids[:2] {
+		if err := repo.MarkAsPublished(ctx, id); err != nil {
+			t.Fatalf("MarkAsPublished failed: %v", err)
+		}
+	}
+	if _, err := conn.Exec(`UPDATE outbox_events SET published_at = NOW() - INTERVAL '2 hours' WHERE id = $1`, ids[0]); err != nil {
+		t.Fatalf("Failed to age event: %v", err)
+	}
+
+	deleted, err := NewJanitor(repo, time.Hour, time.Minute, logger.New("test")).Cleanup(ctx)
+	if err != nil || deleted != 1 {
+		t.Fatalf("Cleanup() = %d, %v, want 1, nil", deleted, err)
+	}
+
+	var left int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM outbox_events`).Scan(&left); err != nil {
+		t.Fatalf("Failed to count events: %v", err)
+	}
+	if left != 2 {
+		t.Errorf("Expected the recent published and the pending event to be kept, %d left", left)
+	}
+}
@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+// Handler exposes outbox inspection and replay for operators
+type Handler struct {
+	repo   *Repository
+	logger *logger.Logger
+}
+
+func NewHandler(repo *Repository, log *logger.Logger) *Handler {
+	return &Handler{
+		repo:   repo,
+		logger: log,
+	}
+}
+
+// RegisterInternalRoutes registers the outbox admin routes
+// NOTE: Mount on the mTLS internal listener only; there is no JWT check
+func (h *Handler) RegisterInternalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/outbox/events", h.ListEvents)
+	mux.HandleFunc("GET /admin/outbox/events/{id}", h.GetEvent)
+	mux.HandleFunc("POST /admin/outbox/events/{id}/replay", h.ReplayEvent)
+	mux.HandleFunc("POST /admin/outbox/events/{id}/skip", h.SkipEvent)
+	mux.HandleFunc("POST /admin/outbox/replay", h.ReplayFailed)
+	mux.HandleFunc("GET /admin/outbox/stats", h.GetStats)
+}
+
+// ListEvents handles GET /admin/outbox/events?status=&aggregate_id=&event_type=&topic=&limit=
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter := filterFromQuery(r)
+	switch filter.Status {
+	case "", StatusPending, StatusPublished, StatusFailed, StatusSkipped:
+	default:
+		writeError(w, http.StatusBadRequest, "status must be pending, published, failed or skipped")
+		return
+	}
+
+	events, err := h.repo.ListEvents(r.Context(), filter)
+	if err != nil {
+		h.logger.Errorf("Failed to list outbox events: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list outbox events")
+		return
+	}
+	views := make([]eventView, 0, len(events))
+	for i := range events {
+		views = append(views, toEventView(&events[i]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": views,
+		"count":  len(views),
+	})
+}
+
+// GetEvent handles GET /admin/outbox/events/{id}
+func (h *Handler) GetEvent(w http.ResponseWriter, r *http.Request) {
+	event, err := h.repo.GetEvent(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		h.logger.Errorf("Failed to get outbox event: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to get outbox event")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toEventView(event))
+}
+
+// ReplayEvent handles POST /admin/outbox/events/{id}/replay
+func (h *Handler) ReplayEvent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.repo.ReplayEvent(r.Context(), id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "no failed event with that id")
+			return
+		}
+		h.logger.Errorf("Failed to replay outbox event: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to replay event")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     id,
+		"status": StatusPending,
+	})
+}
+
+// SkipEvent handles POST /admin/outbox/events/{id}/skip
+func (h *Handler) SkipEvent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.repo.SkipEvent(r.Context(), id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "no failed event with that id")
+			return
+		}
+		h.logger.Errorf("Failed to skip outbox event: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to skip event")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     id,
+		"status": StatusSkipped,
+	})
+}
+
+// ReplayFailed handles POST /admin/outbox/replay?aggregate_id=&event_type=&topic=
+// NOTE: Resets every failed event matching the filters
+func (h *Handler) ReplayFailed(w http.ResponseWriter, r *http.Request) {
+	n, err := h.repo.ReplayFailed(r.Context(), filterFromQuery(r))
+	if err != nil {
+		h.logger.Errorf("Failed to replay outbox events: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to replay events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"replayed": n,
+	})
+}
+
+// GetStats handles GET /admin/outbox/stats
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.repo.GetStats(r.Context())
+	if err != nil {
+		h.logger.Errorf("Failed to get outbox stats: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to get outbox stats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// eventView is the JSON shape of an outbox event for operators
+type eventView struct {
+	ID            string          `json:"id"`
+	Sequence      int64           `json:"sequence"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Topic         string          `json:"topic"`
+	Version       int             `json:"version"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	PublishedAt   *time.Time      `json:"published_at,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+func toEventView(e *OutboxEvent) eventView {
+	v := eventView{
+		ID:            e.ID,
+		Sequence:      e.Sequence,
+		AggregateID:   e.AggregateID,
+		EventType:     e.EventType,
+		Topic:         e.Topic,
+		Version:       e.Version,
+		Status:        e.Status,
+		Attempts:      e.Attempts,
+		LastError:     e.LastError.String,
+		CorrelationID: e.CorrelationID,
+		CreatedAt:     e.CreatedAt,
+	}
+	if e.PublishedAt.Valid {
+		v.PublishedAt = &e.PublishedAt.Time
+	}
+	if raw, ok := e.Payload.(json.RawMessage); ok {
+		v.Payload = raw
+	}
+	return v
+}
+
+func filterFromQuery(r *http.Request) EventFilter {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	return EventFilter{
+		Status:      q.Get("status"),
+		AggregateID: q.Get("aggregate_id"),
+		EventType:   q.Get("event_type"),
+		Topic:       q.Get("topic"),
+		Limit:       limit,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/admin/outbox/events?status=failed&aggregate_id=w-1&event_type=wallet.created&topic=wallet.events&limit=20", nil)
+
+	want := EventFilter{
+		Status:      StatusFailed,
+		AggregateID: "w-1",
+		EventType:   "wallet.created",
+		Topic:       "wallet.events",
+		Limit:       20,
+	}
+	if got := filterFromQuery(r); got != want {
+		t.Errorf("filterFromQuery() = %+v, want %+v", got, want)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/admin/outbox/events?limit=abc", nil)
+	if got := filterFromQuery(r); got != (EventFilter{}) {
+		t.Errorf("Expected an empty filter, got %+v", got)
+	}
+}
+
+func TestToEventView(t *testing.T) {
+	published := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := &OutboxEvent{
+		ID:          "evt-1",
+		AggregateID: "w-1",
+		Status:      StatusPublished,
+		LastError:   sql.NullString{String: "timeout", Valid: true},
+		PublishedAt: sql.NullTime{Time: published, Valid: true},
+		Payload:     json.RawMessage(`{"amount":"1.00"}`),
+	}
+
+	v := toEventView(event)
+	if v.ID != "evt-1" || v.LastError != "timeout" || v.PublishedAt == nil || !v.PublishedAt.Equal(published) {
+		t.Errorf("Unexpected view: %+v", v)
+	}
+	if string(v.Payload) != `{"amount":"1.00"}` {
+		t.Errorf("Expected the raw payload, got %s", v.Payload)
+	}
+
+	v = toEventView(&OutboxEvent{ID: "evt-2", Status: StatusPending})
+	if v.PublishedAt != nil || v.LastError != "" || v.Payload != nil {
+		t.Errorf("Expected optional fields to be empty, got %+v", v)
+	}
+}
+
+func TestListEventsRejectsUnknownStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(nil, logger.New("test")).RegisterInternalRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/outbox/events?status=lost", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestAdminReplayAndSkip(t *testing.T) {
+	repo, conn := testRepository(t)
+	mux := http.NewServeMux()
+	NewHandler(repo, logger.New("test")).RegisterInternalRoutes(mux)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	ids := saveEvents(t, repo, conn, "a", "b", "c")
+	for _, id := range ids {
+		if err := repo.MarkAsFailed(t.Context(), id, "boom"); err != nil {
+			t.Fatalf("MarkAsFailed failed: %v", err)
+		}
+	}
+
+	if w := serve(http.MethodGet, "/admin/outbox/events?status=failed"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":3`) {
+		t.Errorf("Expected 3 failed events, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(http.MethodPost, "/admin/outbox/events/"+ids[0]+"/replay"); w.Code != http.StatusOK {
+		t.Errorf("Expected replay to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPost, "/admin/outbox/events/"+ids[0]+"/replay"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected replaying a pending event to be 404, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/admin/outbox/events/"+ids[1]+"/skip"); w.Code != http.StatusOK {
+		t.Errorf("Expected skip to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPost, "/admin/outbox/replay?aggregate_id=c"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"replayed":1`) {
+		t.Errorf("Expected one event replayed, got %d %s", w.Code, w.Body.String())
+	}
+
+	event, err := repo.GetEvent(t.Context(), ids[1])
+	if err != nil || event.Status != StatusSkipped {
+		t.Errorf("Expected skipped event, got %+v, %v", event, err)
+	}
+
+	stats, err := repo.GetStats(t.Context())
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Pending != 2 || stats.Failed != 0 || stats.OldestPendingAt == nil {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if w := serve(http.MethodGet, "/admin/outbox/events/00000000-0000-0000-0000-000000000000"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown event to be 404, got %d", w.Code)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/kmassidik/mercuria/internal/common/kafka"
 	"github.com/kmassidik/mercuria/internal/common/logger"
+	"github.com/lib/pq"
 )
 
 // OutboxEvent represents an event waiting to be published to Kafka
@@ -32,18 +36,24 @@ type OutboxEvent struct {
     AggregateID  string                 `json:"aggregate_id"`
     EventType    string                 `json:"event_type"`
     Topic        string                 `json:"topic"`
-    Payload      map[string]interface{} `json:"payload"`
+    Payload      interface{}            `json:"payload"`       // Typed kafka event; json.RawMessage when read back
+    Version      int                    `json:"version"`       // Payload schema version (set from kafka.Event)
+    CorrelationID string                `json:"correlation_id"`
+    CausationID  string                 `json:"causation_id"`
+    TraceParent  string                 `json:"traceparent"`
     Status       string                 `json:"status"`
     Attempts     int                    `json:"attempts"`
     LastError    sql.NullString         `json:"last_error"`    // <-- FIX: Changed to sql.NullString
     CreatedAt    time.Time              `json:"created_at"`
     PublishedAt  sql.NullTime           `json:"published_at"`  // <-- GOOD PRACTICE: Changed from *time.Time
+    Sequence     int64                  `json:"sequence"`      // Insertion order; events of an aggregate publish in this order
 }
 
 const (
 	StatusPending   = "pending"
 	StatusPublished = "published"
-	StatusFailed    = "failed"
+	StatusFailed    = "failed"  // Out of attempts; holds back later events of its aggregate
+	StatusSkipped   = "skipped" // Given up on by an operator, never published
 )
 
 type Repository struct {
@@ -67,9 +77,35 @@ func (r *Repository) SaveEvent(ctx context.Context, tx *sql.Tx, event *OutboxEve
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	// Typed events carry their own type and schema version
+	if typed, ok := event.Payload.(kafka.Event); ok {
+		if event.EventType == "" {
+			event.EventType = typed.EventType()
+		}
+		if event.Version == 0 {
+			event.Version = typed.SchemaVersion()
+		}
+	}
+
+	// Inherit correlation from the request or consumed event being handled
+	if trace, ok := kafka.TraceFromContext(ctx); ok {
+		if event.CorrelationID == "" {
+			event.CorrelationID = trace.CorrelationID
+		}
+		if event.CausationID == "" {
+			event.CausationID = trace.CausationID
+		}
+		if event.TraceParent == "" {
+			event.TraceParent = trace.TraceParent
+		}
+	}
+
 	query := `
-		INSERT INTO outbox_events (aggregate_id, event_type, topic, payload, status, attempts)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO outbox_events (
+			aggregate_id, event_type, topic, payload, status, attempts,
+			schema_version, correlation_id, causation_id, traceparent
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
 		RETURNING id, created_at
 	`
 
@@ -85,6 +121,10 @@ func (r *Repository) SaveEvent(ctx context.Context, tx *sql.Tx, event *OutboxEve
 		payloadJSON,
 		event.Status,
 		event.Attempts,
+		event.Version,
+		event.CorrelationID,
+		event.CausationID,
+		event.TraceParent,
 	).Scan(&event.ID, &event.CreatedAt)
 
 	if err != nil {
@@ -95,61 +135,232 @@ func (r *Repository) SaveEvent(ctx context.Context, tx *sql.Tx, event *OutboxEve
 	return nil
 }
 
+// eventColumns are the columns read back by scanEvents
+const eventColumns = `id, aggregate_id, event_type, topic, payload, status, attempts, last_error, created_at, published_at,
+	schema_version, COALESCE(correlation_id, ''), COALESCE(causation_id, ''), COALESCE(traceparent, ''), sequence`
+
 // GetPendingEvents retrieves events that need to be published
-// NOTE: This is called by the background worker to publish events to Kafka
+// NOTE: Read-only - the publisher uses ClaimPendingEvents so replicas never
+// publish the same row concurrently
 func (r *Repository) GetPendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
 	query := `
-        SELECT id, aggregate_id, event_type, topic, payload, status, attempts, last_error, created_at, published_at
-        FROM outbox_events
-        WHERE status = $1 AND attempts < 5
-        ORDER BY created_at ASC
-        LIMIT $2
-    `
+		SELECT ` + eventColumns + `
+		FROM outbox_events
+		WHERE status = $1 AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+		ORDER BY sequence ASC
+		LIMIT $2
+	`
 
 	rows, err := r.db.QueryContext(ctx, query, StatusPending, limit)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get pending events: %w", err)
-    }
-    defer rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending events: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanEvents(rows)
+}
+
+// ClaimPendingEvents leases up to limit pending events to owner for lease
+// NOTE: Rows are locked with FOR UPDATE SKIP LOCKED so replicas never wait on
+// each other. Per aggregate only an unbroken run from its oldest pending event
+// is claimed: if an earlier event is leased by another publisher, backing off
+// after a failed publish, failed for good, or locked, later events of that
+// aggregate wait. Aggregates whose oldest event waits are left out before the
+// limit applies, so they cannot starve the others. Expired leases are claimed
+// again.
+func (r *Repository) ClaimPendingEvents(ctx context.Context, owner string, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin claim: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Oldest unpublished events of aggregates whose first event can go now,
+	// and whether they have to wait
+	rows, err := tx.QueryContext(ctx, `
+		WITH heads AS (
+			SELECT DISTINCT ON (aggregate_id) aggregate_id,
+				COALESCE(status = $4
+					OR (claimed_until > NOW() AND claimed_by IS DISTINCT FROM $2)
+					OR next_attempt_at > NOW(), FALSE) AS waiting
+			FROM outbox_events
+			WHERE status IN ($1, $4)
+			ORDER BY aggregate_id, sequence
+		)
+		SELECT e.id, e.aggregate_id,
+			e.status = $4
+			OR (e.claimed_until > NOW() AND e.claimed_by IS DISTINCT FROM $2)
+			OR e.next_attempt_at > NOW() AS waiting
+		FROM outbox_events e
+		JOIN heads h ON h.aggregate_id = e.aggregate_id AND NOT h.waiting
+		WHERE e.status IN ($1, $4)
+		ORDER BY e.sequence ASC
+		LIMIT $3
+	`, StatusPending, owner, limit, StatusFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending events: %w", err)
+	}
+
+	var candidates []claimCandidate
+	var ids []string
+	for rows.Next() {
+		var c claimCandidate
+		var waiting sql.NullBool
+		if err := rows.Scan(&c.id, &c.aggregateID, &waiting); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending event: %w", err)
+		}
+		c.waiting = waiting.Bool
+		candidates = append(candidates, c)
+		if !c.waiting {
+			ids = append(ids, c.id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending events: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Lock what is still unclaimed; the lease check is re-evaluated on the
+	// latest row version, so a row another publisher just claimed drops out
+	rows, err = tx.QueryContext(ctx, `
+		SELECT id FROM outbox_events
+		WHERE id = ANY($1) AND status = $2
+		  AND (claimed_until IS NULL OR claimed_until <= NOW() OR claimed_by = $3)
+		  AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+		FOR UPDATE SKIP LOCKED
+	`, pq.Array(ids), StatusPending, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock pending events: %w", err)
+	}
+
+	locked := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan locked event: %w", err)
+		}
+		locked[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock pending events: %w", err)
+	}
+
+	claimable := orderedPrefix(candidates, locked)
+	if len(claimable) == 0 {
+		return nil, nil
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		UPDATE outbox_events
+		SET claimed_by = $2, claimed_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = ANY($1)
+		RETURNING `+eventColumns,
+		pq.Array(claimable), owner, lease.Milliseconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim events: %w", err)
+	}
+	events, err := r.scanEvents(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit claim: %w", err)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Sequence < events[j].Sequence })
+	return events, nil
+}
+
+type claimCandidate struct {
+	id          string
+	aggregateID string
+	waiting     bool // Leased by another publisher, backing off or failed
+}
+
+// orderedPrefix returns the candidates (in sequence order) that can be claimed:
+// per aggregate, everything before the first event that has to wait or could
+// not be locked
+func orderedPrefix(candidates []claimCandidate, locked map[string]bool) []string {
+	blocked := make(map[string]bool)
+	ids := []string{}
+
+	for _, c := range candidates {
+		if blocked[c.aggregateID] {
+			continue
+		}
+		if c.waiting || !locked[c.id] {
+			blocked[c.aggregateID] = true
+			continue
+		}
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+// ReleaseClaims drops owner's leases on events it did not publish so they can
+// be claimed again right away
+func (r *Repository) ReleaseClaims(ctx context.Context, owner string) error {
+	query := `
+		UPDATE outbox_events
+		SET claimed_by = NULL, claimed_until = NULL
+		WHERE claimed_by = $1 AND status = $2
+	`
 
+	if _, err := r.db.ExecContext(ctx, query, owner, StatusPending); err != nil {
+		return fmt.Errorf("failed to release claims: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) scanEvents(rows *sql.Rows) ([]OutboxEvent, error) {
 	var events []OutboxEvent
 	for rows.Next() {
 		var event OutboxEvent
 		var payloadJSON []byte
-		// Variables for nullable fields
-        var lastError sql.NullString 
-        var publishedAt sql.NullTime
-		
-		err := rows.Scan(
-            &event.ID,
-            &event.AggregateID,
-            &event.EventType,
-            &event.Topic,
-            &payloadJSON,
-            &event.Status,
-            &event.Attempts,
-            &lastError,          // Scan into sql.NullString
-            &event.CreatedAt,
-            &publishedAt,        // Scan into sql.NullTime
-        )
 
+		err := rows.Scan(
+			&event.ID,
+			&event.AggregateID,
+			&event.EventType,
+			&event.Topic,
+			&payloadJSON,
+			&event.Status,
+			&event.Attempts,
+			&event.LastError,
+			&event.CreatedAt,
+			&event.PublishedAt,
+			&event.Version,
+			&event.CorrelationID,
+			&event.CausationID,
+			&event.TraceParent,
+			&event.Sequence,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan event: %w", err)
 		}
-		
-		// Assign nullable variables back to the struct fields
-        event.LastError = lastError
-        event.PublishedAt = publishedAt
-		
-		// Unmarshal payload
-        if err := json.Unmarshal(payloadJSON, &event.Payload); err != nil {
-            r.logger.Warnf("Failed to unmarshal payload for event %s: %v", event.ID, err)
-            continue
-        }
 
-        events = append(events, event)
+		// Keep the payload as stored; it is wrapped in an envelope on publish
+		if !json.Valid(payloadJSON) {
+			r.logger.Warnf("Invalid payload for event %s", event.ID)
+			continue
+		}
+		event.Payload = json.RawMessage(payloadJSON)
+
+		events = append(events, event)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
 	return events, nil
 }
 
@@ -158,7 +369,7 @@ func (r *Repository) GetPendingEvents(ctx context.Context, limit int) ([]OutboxE
 func (r *Repository) MarkAsPublished(ctx context.Context, eventID string) error {
 	query := `
 		UPDATE outbox_events
-		SET status = $1, published_at = CURRENT_TIMESTAMP
+		SET status = $1, published_at = CURRENT_TIMESTAMP, claimed_by = NULL, claimed_until = NULL
 		WHERE id = $2
 	`
 
@@ -177,11 +388,12 @@ func (r *Repository) MarkAsPublished(ctx context.Context, eventID string) error
 }
 
 // MarkAsFailed marks an event as failed after max retries
-// NOTE: Called when event publishing fails repeatedly
+// NOTE: Called when event publishing fails repeatedly. Later events of the
+// aggregate are held back until the event is replayed or skipped.
 func (r *Repository) MarkAsFailed(ctx context.Context, eventID string, errorMsg string) error {
 	query := `
 		UPDATE outbox_events
-		SET status = $1, attempts = attempts + 1, last_error = $2
+		SET status = $1, attempts = attempts + 1, last_error = $2, claimed_by = NULL, claimed_until = NULL
 		WHERE id = $3
 	`
 
@@ -194,16 +406,19 @@ func (r *Repository) MarkAsFailed(ctx context.Context, eventID string, errorMsg
 	return nil
 }
 
-// IncrementAttempt increments the retry attempt counter
+// IncrementAttempt increments the retry attempt counter and schedules the
+// next attempt after retryIn
 // NOTE: Called when publishing fails but we want to retry
-func (r *Repository) IncrementAttempt(ctx context.Context, eventID string, errorMsg string) error {
+func (r *Repository) IncrementAttempt(ctx context.Context, eventID string, errorMsg string, retryIn time.Duration) error {
 	query := `
 		UPDATE outbox_events
-		SET attempts = attempts + 1, last_error = $1
+		SET attempts = attempts + 1, last_error = $1,
+			next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond',
+			claimed_by = NULL, claimed_until = NULL
 		WHERE id = $2
 	`
 
-	_, err := r.db.ExecContext(ctx, query, errorMsg, eventID)
+	_, err := r.db.ExecContext(ctx, query, errorMsg, eventID, retryIn.Milliseconds())
 	if err != nil {
 		return fmt.Errorf("failed to increment attempt: %w", err)
 	}
@@ -211,24 +426,106 @@ func (r *Repository) IncrementAttempt(ctx context.Context, eventID string, error
 	return nil
 }
 
+// DefaultLease is how long a publisher holds claimed events
+// NOTE: Must comfortably exceed publishing one batch; an expired lease lets
+// another replica publish the same events again
+const DefaultLease = 30 * time.Second
+
+// Retry schedule for events that fail to publish
+const (
+	MaxAttempts   = 10              // Attempts before an event is marked failed
+	RetryBackoff  = 1 * time.Second // Delay after the first failure, doubled per attempt
+	MaxRetryDelay = 5 * time.Minute // Upper bound for the delay
+)
+
+const (
+	notifyChannel = "outbox_events" // Channel the insert trigger notifies
+	batchSize     = 100             // Events claimed and written per round
+)
+
 // Publisher is responsible for publishing outbox events to Kafka
-// NOTE: This runs as a background worker, polling the outbox table
+// NOTE: This runs as a background worker. It wakes up on NOTIFY from the
+// outbox insert trigger when ListenForEvents is used, and polls every interval
+// as a fallback. Several replicas can run it side by side; events are leased
+// before publishing.
 type Publisher struct {
 	repo     *Repository
 	producer *kafka.Producer
+	source   string // Service name stamped on every envelope
+	owner    string // Unique per process, recorded in claimed_by
+	lease    time.Duration
+	listener *pq.Listener
 	logger   *logger.Logger
 	interval time.Duration // How often to poll for new events
 }
 
-func NewPublisher(repo *Repository, producer *kafka.Producer, log *logger.Logger, interval time.Duration) *Publisher {
+func NewPublisher(repo *Repository, producer *kafka.Producer, source string, log *logger.Logger, interval time.Duration) *Publisher {
+	hostname, _ := os.Hostname()
+
 	return &Publisher{
 		repo:     repo,
 		producer: producer,
+		source:   source,
+		owner:    fmt.Sprintf("%s/%s/%d", source, hostname, os.Getpid()),
+		lease:    DefaultLease,
 		logger:   log,
 		interval: interval,
 	}
 }
 
+// ListenForEvents makes the publisher wake up as soon as an event is saved
+// NOTE: Opens a dedicated LISTEN connection to dsn; lib/pq reconnects on its
+// own and the poll interval covers anything missed meanwhile
+func (p *Publisher) ListenForEvents(dsn string) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			p.logger.Warnf("Outbox listener: %v", err)
+		}
+	})
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen on %s: %w", notifyChannel, err)
+	}
+
+	p.listener = listener
+	p.logger.Infof("Outbox publisher listening on channel %s", notifyChannel)
+	return nil
+}
+
+// retryDelay returns the backoff after the given number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	d := RetryBackoff
+	for i := 1; i < attempts && d < MaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > MaxRetryDelay {
+		d = MaxRetryDelay
+	}
+	return d
+}
+
+// envelope wraps an outbox row for publishing
+// NOTE: The envelope id is the outbox row id, stable across publish retries
+func (p *Publisher) envelope(event *OutboxEvent) (*kafka.Envelope, error) {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return &kafka.Envelope{
+		ID:            event.ID,
+		Type:          event.EventType,
+		Version:       event.Version,
+		Source:        p.source,
+		OccurredAt:    event.CreatedAt,
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.CausationID,
+		TraceParent:   event.TraceParent,
+		Payload:       payload,
+	}, nil
+}
+
 // Start begins the background worker that publishes events
 // NOTE: Call this in your main.go after service initialization
 // Example: go publisher.Start(ctx)
@@ -237,54 +534,121 @@ func (p *Publisher) Start(ctx context.Context) {
 	ticker := time.NewTicker(p.interval)
 	defer ticker.Stop()
 
+	// A nil channel never fires, leaving only the ticker
+	var notify <-chan *pq.Notification
+	if p.listener != nil {
+		notify = p.listener.Notify
+		defer p.listener.Close()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			p.logger.Info("Outbox publisher stopped")
 			return
 		case <-ticker.C:
-			if err := p.publishPendingEvents(ctx); err != nil {
+		case <-notify:
+			// nil after a reconnect - events may have been missed, publish anyway
+		}
+
+		// Keep going while full batches come back so a burst drains at once
+		for {
+			n, err := p.publishPendingEvents(ctx)
+			if err != nil {
 				p.logger.Errorf("Failed to publish pending events: %v", err)
+				break
+			}
+			if n < batchSize || ctx.Err() != nil {
+				break
 			}
 		}
 	}
 }
 
-// publishPendingEvents fetches and publishes pending events
-// NOTE: This is the core outbox processing logic
-func (p *Publisher) publishPendingEvents(ctx context.Context) error {
-	// Get pending events (limit to 100 per batch)
-	events, err := p.repo.GetPendingEvents(ctx, 100)
+// publishPendingEvents claims pending events and publishes them in one batch
+// NOTE: This is the core outbox processing logic. Events of one aggregate
+// share a key and therefore a partition, so the broker accepts or rejects
+// them together and their order holds within the batch.
+func (p *Publisher) publishPendingEvents(ctx context.Context) (int, error) {
+	events, err := p.repo.ClaimPendingEvents(ctx, p.owner, p.lease, batchSize)
 	if err != nil {
-		return fmt.Errorf("failed to get pending events: %w", err)
+		return 0, fmt.Errorf("failed to claim pending events: %w", err)
 	}
 
 	if len(events) == 0 {
-		return nil
+		return 0, nil
 	}
 
+	// Hand back whatever was not published so it can be claimed again
+	defer func() {
+		if err := p.repo.ReleaseClaims(context.Background(), p.owner); err != nil {
+			p.logger.Errorf("Failed to release outbox claims: %v", err)
+		}
+	}()
+
 	p.logger.Infof("Publishing %d pending events", len(events))
 
-	for _, event := range events {
-		// Publish to Kafka
-		err := p.producer.PublishEvent(ctx, event.Topic, event.AggregateID, event.Payload)
+	records := make([]kafka.Record, 0, len(events))
+	batch := make([]*OutboxEvent, 0, len(events))
+	errs := make(map[string]error)
+	held := make(map[string]bool) // Aggregates with an event that cannot be sent
+	skipped := make(map[string]bool)
+
+	for i := range events {
+		event := &events[i]
+		if held[event.AggregateID] {
+			skipped[event.ID] = true // Released for a later round, in order
+			continue
+		}
+		envelope, err := p.envelope(event)
 		if err != nil {
-			// Increment attempt counter
-			p.logger.Errorf("Failed to publish event %s: %v", event.ID, err)
-			
-			if event.Attempts >= 4 { // Max 5 attempts (0-4)
+			errs[event.ID] = err
+			held[event.AggregateID] = true
+			continue
+		}
+		records = append(records, kafka.Record{Topic: event.Topic, Key: event.AggregateID, Event: envelope})
+		batch = append(batch, event)
+	}
+
+	if err := p.producer.PublishEvents(ctx, records); err != nil {
+		var batchErr *kafka.BatchError
+		if !errors.As(err, &batchErr) {
+			return 0, err
+		}
+		for i, err := range batchErr.Errors {
+			if err != nil {
+				errs[batch[i].ID] = err
+			}
+		}
+	}
+
+	metrics.Add("publish_attempts", int64(len(events)-len(skipped)))
+	metrics.Add("publish_failures", int64(len(errs)))
+
+	for i := range events {
+		event := &events[i]
+		if skipped[event.ID] {
+			continue
+		}
+
+		if err, ok := errs[event.ID]; ok {
+			p.logger.Errorf("Failed to publish event %s (attempt %d/%d): %v", event.ID, event.Attempts+1, MaxAttempts, err)
+
+			if event.Attempts+1 >= MaxAttempts {
+				metrics.Add("marked_failed", 1)
 				p.repo.MarkAsFailed(ctx, event.ID, err.Error())
 			} else {
-				p.repo.IncrementAttempt(ctx, event.ID, err.Error())
+				p.repo.IncrementAttempt(ctx, event.ID, err.Error(), retryDelay(event.Attempts+1))
 			}
 			continue
 		}
 
 		// Mark as published
+		metrics.Add("published", 1)
 		if err := p.repo.MarkAsPublished(ctx, event.ID); err != nil {
 			p.logger.Errorf("Failed to mark event as published: %v", err)
 		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	return len(events), nil
+}
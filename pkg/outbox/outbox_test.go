@@ -0,0 +1,314 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kmassidik/mercuria/internal/common/config"
+	"github.com/kmassidik/mercuria/internal/common/db"
+	"github.com/kmassidik/mercuria/internal/common/logger"
+)
+
+func TestOrderedPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []claimCandidate
+		locked     []string
+		want       []string
+	}{
+		{
+			name: "all claimable",
+			candidates: []claimCandidate{
+				{id: "a1", aggregateID: "a"},
+				{id: "b1", aggregateID: "b"},
+				{id: "a2", aggregateID: "a"},
+			},
+			locked: []string{"a1", "b1", "a2"},
+			want:   []string{"a1", "b1", "a2"},
+		},
+		{
+			name: "waiting event holds back the rest of its aggregate",
+			candidates: []claimCandidate{
+				{id: "a1", aggregateID: "a"},
+				{id: "a2", aggregateID: "a", waiting: true},
+				{id: "b1", aggregateID: "b"},
+				{id: "a3", aggregateID: "a"},
+			},
+			locked: []string{"a1", "b1", "a3"},
+			want:   []string{"a1", "b1"},
+		},
+		{
+			name: "unlocked event holds back the rest of its aggregate",
+			candidates: []claimCandidate{
+				{id: "a1", aggregateID: "a"},
+				{id: "b1", aggregateID: "b"},
+				{id: "a2", aggregateID: "a"},
+				{id: "b2", aggregateID: "b"},
+			},
+			locked: []string{"a2", "b1", "b2"},
+			want:   []string{"b1", "b2"},
+		},
+		{
+			name:       "nothing locked",
+			candidates: []claimCandidate{{id: "a1", aggregateID: "a"}},
+			want:       []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locked := make(map[string]bool)
+			for _, id := range tt.locked {
+				locked[id] = true
+			}
+
+			if got := orderedPrefix(tt.candidates, locked); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderedPrefix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, RetryBackoff},
+		{1, RetryBackoff},
+		{2, 2 * RetryBackoff},
+		{5, 16 * RetryBackoff},
+		{9, 256 * RetryBackoff},
+		{10, MaxRetryDelay},
+		{100, MaxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// testRepository returns a repository on a fresh schema with the outbox
+// migrations applied, or skips when PostgreSQL is not available
+func testRepository(t *testing.T) (*Repository, *sql.DB) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	cfg := testDatabaseConfig()
+
+	admin, err := sql.Open("postgres", db.DSN(cfg))
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+
+	schema := fmt.Sprintf("outbox_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	conn, err := sql.Open("postgres", db.DSN(cfg)+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if cleanup, err := sql.Open("postgres", db.DSN(cfg)); err == nil {
+			cleanup.Exec("DROP SCHEMA " + schema + " CASCADE")
+			cleanup.Close()
+		}
+	})
+
+	files, err := filepath.Glob("../../migrations/outbox/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Failed to find outbox migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if _, err := conn.Exec(string(migration)); err != nil {
+			t.Fatalf("Failed to apply %s: %v", file, err)
+		}
+	}
+
+	return NewRepository(conn, logger.New("test")), conn
+}
+
+// testDatabaseConfig points at the PostgreSQL used by integration tests
+func testDatabaseConfig() config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", "5432"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "postgres"),
+		DBName:   getEnv("DB_NAME", "postgres"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// saveEvents saves one event per aggregate id, in order, and returns their ids
+func saveEvents(t *testing.T, repo *Repository, conn *sql.DB, aggregateIDs ...string) []string {
+	ctx := context.Background()
+	ids := []string{}
+
+	for _, aggregateID := range aggregateIDs {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		event := &OutboxEvent{
+			AggregateID: aggregateID,
+			EventType:   "test.event",
+			Topic:       "test",
+			Payload:     map[string]string{"aggregate": aggregateID},
+		}
+		if err := repo.SaveEvent(ctx, tx, event); err != nil {
+			tx.Rollback()
+			t.Fatalf("SaveEvent failed: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func claimIDs(t *testing.T, repo *Repository, owner string, lease time.Duration) []string {
+	events, err := repo.ClaimPendingEvents(context.Background(), owner, lease, 10)
+	if err != nil {
+		t.Fatalf("ClaimPendingEvents(%s) failed: %v", owner, err)
+	}
+
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestClaimPendingEventsOrdered(t *testing.T) {
+	repo, conn := testRepository(t)
+	ctx := context.Background()
+
+	ids := saveEvents(t, repo, conn, "a", "a", "b")
+	a1, a2, b1 := ids[0], ids[1], ids[2]
+
+	if got := claimIDs(t, repo, "p1", time.Minute); !reflect.DeepEqual(got, []string{a1, a2, b1}) {
+		t.Fatalf("First claim = %v, want %v", got, []string{a1, a2, b1})
+	}
+	if got := claimIDs(t, repo, "p2", time.Minute); len(got) != 0 {
+		t.Fatalf("Expected leased events not to be claimed again, got %v", got)
+	}
+
+	// A failed event holds back its aggregate, not the others
+	if err := repo.ReleaseClaims(ctx, "p1"); err != nil {
+		t.Fatalf("ReleaseClaims failed: %v", err)
+	}
+	if err := repo.MarkAsFailed(ctx, a1, "boom"); err != nil {
+		t.Fatalf("MarkAsFailed failed: %v", err)
+	}
+	if got := claimIDs(t, repo, "p2", time.Minute); !reflect.DeepEqual(got, []string{b1}) {
+		t.Fatalf("Claim behind failed event = %v, want %v", got, []string{b1})
+	}
+
+	// Skipping it lets the aggregate continue
+	if err := repo.SkipEvent(ctx, a1); err != nil {
+		t.Fatalf("SkipEvent failed: %v", err)
+	}
+	if got := claimIDs(t, repo, "p2", time.Minute); !reflect.DeepEqual(got, []string{a2, b1}) {
+		t.Fatalf("Claim after skip = %v, want %v", got, []string{a2, b1})
+	}
+}
+
+func TestClaimPendingEventsBackoff(t *testing.T) {
+	repo, conn := testRepository(t)
+
+	ids := saveEvents(t, repo, conn, "a", "a", "b")
+	if err := repo.IncrementAttempt(context.Background(), ids[0], "boom", time.Minute); err != nil {
+		t.Fatalf("IncrementAttempt failed: %v", err)
+	}
+
+	if got := claimIDs(t, repo, "p1", time.Minute); !reflect.DeepEqual(got, []string{ids[2]}) {
+		t.Errorf("Claim during backoff = %v, want %v", got, []string{ids[2]})
+	}
+}
+
+func TestClaimPendingEventsLeaseExpiry(t *testing.T) {
+	repo, conn := testRepository(t)
+
+	ids := saveEvents(t, repo, conn, "a")
+	if got := claimIDs(t, repo, "p1", 50*time.Millisecond); !reflect.DeepEqual(got, ids) {
+		t.Fatalf("First claim = %v, want %v", got, ids)
+	}
+	if got := claimIDs(t, repo, "p2", time.Minute); len(got) != 0 {
+		t.Fatalf("Expected leased event not to be claimed again, got %v", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := claimIDs(t, repo, "p2", time.Minute); !reflect.DeepEqual(got, ids) {
+		t.Errorf("Claim after lease expiry = %v, want %v", got, ids)
+	}
+}
+
+func TestListenForEvents(t *testing.T) {
+	repo, conn := testRepository(t)
+	ctx := context.Background()
+
+	p := NewPublisher(repo, nil, "test", logger.New("test"), time.Minute)
+	if err := p.ListenForEvents(db.DSN(testDatabaseConfig())); err != nil {
+		t.Fatalf("ListenForEvents failed: %v", err)
+	}
+	defer p.listener.Close()
+
+	// Nothing is sent for a rolled back insert
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := repo.SaveEvent(ctx, tx, &OutboxEvent{AggregateID: "a", EventType: "test.event", Topic: "test", Payload: map[string]string{}}); err != nil {
+		t.Fatalf("SaveEvent failed: %v", err)
+	}
+	tx.Rollback()
+
+	select {
+	case n := <-p.listener.Notify:
+		t.Fatalf("Expected no notification for a rolled back insert, got %v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	saveEvents(t, repo, conn, "a")
+	select {
+	case n := <-p.listener.Notify:
+		if n == nil || n.Channel != notifyChannel {
+			t.Errorf("Unexpected notification: %v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a notification once the insert committed")
+	}
+}